@@ -6,6 +6,7 @@ require (
 	cloud.google.com/go/firestore v1.2.0
 	cloud.google.com/go/storage v1.10.0 // indirect
 	firebase.google.com/go v3.13.0+incompatible
+	github.com/andybalholm/brotli v1.1.1
 	github.com/google/uuid v1.1.1
 	github.com/gorilla/handlers v1.4.2
 	github.com/gorilla/mux v1.7.4
@@ -15,4 +16,6 @@ require (
 	github.com/spf13/viper v1.7.0
 	golang.org/x/net v0.0.0-20200707034311-ab3426394381 // indirect
 	google.golang.org/api v0.29.0
+	google.golang.org/grpc v1.29.1
+	google.golang.org/protobuf v1.24.0
 )
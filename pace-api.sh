@@ -1,2 +1,3 @@
 #!/bin/bash
-/home/jason/www-data/pace-api/pace-api -conf=/home/jason/www-data/pace-api/
+# exec so the server gets systemd's SIGTERM itself and can shut down cleanly
+exec /home/jason/www-data/pace-api/pace-api -conf=/home/jason/www-data/pace-api/
@@ -0,0 +1,210 @@
+package apiversion
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/validate"
+)
+
+// ErrTrailingData if a JSON body has more after the first value
+var ErrTrailingData = errors.New("Body has data after the JSON value")
+
+// DTO is how a version of the API sends an entity
+type DTO interface {
+	// Entity converts the DTO to the entity it stands for
+	Entity() interface{}
+}
+
+type converter struct {
+	dtoType    reflect.Type
+	fromEntity func(entity interface{}) DTO
+}
+
+// Version is a version of the API, with its own JSON shapes for the entities
+// that have changed since. Entities without a DTO are sent as they are.
+type Version struct {
+	Name       string
+	converters map[reflect.Type]converter
+}
+
+// New makes a Version without any DTOs
+func New(name string) *Version {
+	return &Version{Name: name, converters: map[reflect.Type]converter{}}
+}
+
+// Register adds a DTO. dto is a zero value of the DTO, fromEntity makes one from its entity.
+func (v *Version) Register(dto DTO, fromEntity func(entity interface{}) DTO) {
+	v.converters[reflect.TypeOf(dto.Entity())] = converter{
+		dtoType:    reflect.TypeOf(dto),
+		fromEntity: fromEntity,
+	}
+}
+
+// DTOType gets the type this version sends instead of the type of v, like
+// v2.Project for entity.Project or []v2.Project for []entity.Project
+func (v *Version) DTOType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Slice {
+		return reflect.SliceOf(v.DTOType(t.Elem()))
+	}
+	if converter, ok := v.converter(t); ok {
+		return converter.dtoType
+	}
+
+	return t
+}
+
+// ToDTO converts an entity, or a list of them, to this version's shape.
+// Anything else, like messages, is returned as it is.
+func (v *Version) ToDTO(entity interface{}) interface{} {
+	if v == nil || entity == nil {
+		return entity
+	}
+	value := reflect.ValueOf(entity)
+	if value.Kind() == reflect.Slice && v.DTOType(value.Type()) != value.Type() {
+		list := reflect.MakeSlice(reflect.SliceOf(v.DTOType(value.Type().Elem())), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			list.Index(i).Set(reflect.ValueOf(v.ToDTO(value.Index(i).Interface())))
+		}
+		return list.Interface()
+	}
+	if converter, ok := v.converter(value.Type()); ok {
+		return converter.fromEntity(entity)
+	}
+
+	return entity
+}
+
+// Decode reads JSON into target, a pointer to an entity. If the version has a
+// DTO for the entity, the JSON is read and checked as the DTO first.
+func (v *Version) Decode(r io.Reader, target interface{}) error {
+	targetValue := reflect.ValueOf(target).Elem()
+	converter, ok := v.converter(targetValue.Type())
+	if !ok {
+		return DecodeJSON(r, target)
+	}
+
+	dto := reflect.New(converter.dtoType)
+	err := DecodeJSON(r, dto.Interface())
+	if err != nil {
+		return err
+	}
+	err = validate.Struct(dto.Interface())
+	if err != nil {
+		return err
+	}
+	targetValue.Set(reflect.ValueOf(dto.Elem().Interface().(DTO).Entity()))
+
+	return nil
+}
+
+// DecodeJSON reads one JSON value into target. Fields target doesn't have, and
+// anything after the value, are errors.
+func DecodeJSON(r io.Reader, target interface{}) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(target)
+	if err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return ErrTrailingData
+	}
+
+	return nil
+}
+
+func (v *Version) converter(t reflect.Type) (converter, bool) {
+	if v == nil {
+		return converter{}, false
+	}
+	converter, ok := v.converters[t]
+	return converter, ok
+}
+
+// Use is how often a client has called a version of the API
+type Use struct {
+	Version   string    `json:"version"`
+	Client    string    `json:"client"`
+	UserAgent string    `json:"userAgent"`
+	Requests  int64     `json:"requests"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// Usage limits
+const (
+	// maxUses is how many version, client and User-Agent combinations are
+	// kept. Past that the least recently seen one is forgotten, so clients
+	// making up User-Agents can't use up the server's memory.
+	maxUses = 10000
+	// maxUserAgentLength is how much of a User-Agent is kept
+	maxUserAgentLength = 200
+)
+
+// Usage counts requests per version and client, so old versions can be removed
+// once nobody uses them. It is kept in memory, so it restarts with the server.
+type Usage struct {
+	mutex sync.Mutex
+	uses  map[[3]string]*list.Element
+	// recent has the uses, most recently recorded first
+	recent *list.List
+	limit  int
+}
+
+// NewUsage makes an empty Usage
+func NewUsage() *Usage {
+	return &Usage{uses: map[[3]string]*list.Element{}, recent: list.New(), limit: maxUses}
+}
+
+// Record counts a request, returning whether it is the client's first call of the version today (UTC)
+func (u *Usage) Record(version string, client string, userAgent string, now time.Time) bool {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	key := [3]string{version, client, userAgent}
+	element, ok := u.uses[key]
+	if ok {
+		u.recent.MoveToFront(element)
+	} else {
+		if u.recent.Len() >= u.limit {
+			oldest := u.recent.Remove(u.recent.Back()).(*Use)
+			delete(u.uses, [3]string{oldest.Version, oldest.Client, oldest.UserAgent})
+		}
+		element = u.recent.PushFront(&Use{Version: version, Client: client, UserAgent: userAgent, FirstSeen: now})
+		u.uses[key] = element
+	}
+	use := element.Value.(*Use)
+	firstToday := !ok || use.LastSeen.UTC().Format("2006-01-02") != now.UTC().Format("2006-01-02")
+	use.Requests++
+	use.LastSeen = now
+
+	return firstToday
+}
+
+// Uses lists the recorded uses, most recent first
+func (u *Usage) Uses() []Use {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	uses := make([]Use, 0, u.recent.Len())
+	for element := u.recent.Front(); element != nil; element = element.Next() {
+		uses = append(uses, *element.Value.(*Use))
+	}
+	sort.Slice(uses, func(i, j int) bool {
+		return uses[i].LastSeen.After(uses[j].LastSeen)
+	})
+
+	return uses
+}
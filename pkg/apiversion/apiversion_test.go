@@ -0,0 +1,86 @@
+package apiversion
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type thing struct {
+	Name string
+}
+
+type thingDTO struct {
+	Title string `json:"title" validate:"required"`
+}
+
+func (t thingDTO) Entity() interface{} { return thing{Name: t.Title} }
+
+func TestVersion(t *testing.T) {
+	version := New("test")
+	version.Register(thingDTO{}, func(e interface{}) DTO { return thingDTO{Title: e.(thing).Name} })
+
+	if dto := version.ToDTO([]thing{{Name: "a"}}); !reflect.DeepEqual(dto, []thingDTO{{Title: "a"}}) {
+		t.Errorf("Unexpected DTO %#v", dto)
+	}
+	if message := version.ToDTO("Pong"); message != "Pong" {
+		t.Errorf("Expected other values to pass through, got %#v", message)
+	}
+
+	var decoded thing
+	err := version.Decode(strings.NewReader(`{"title": "b"}`), &decoded)
+	if err != nil || decoded.Name != "b" {
+		t.Errorf("Unexpected decoded %+v, %v", decoded, err)
+	}
+	err = version.Decode(strings.NewReader(`{"name": "b"}`), &decoded)
+	if err == nil {
+		t.Error("Expected the DTO to be validated")
+	}
+
+	var unversioned *Version
+	err = unversioned.Decode(strings.NewReader(`{"Name": "c"}`), &decoded)
+	if err != nil || decoded.Name != "c" {
+		t.Errorf("Expected a nil Version to decode as it is, got %+v, %v", decoded, err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	usage := NewUsage()
+	day := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	if !usage.Record("v1", "user:1", "PaCE iOS/1.2", day) {
+		t.Error("Expected the first call to be the first today")
+	}
+	if usage.Record("v1", "user:1", "PaCE iOS/1.2", day.Add(time.Hour)) {
+		t.Error("Expected the second call not to be the first today")
+	}
+	if !usage.Record("v1", "user:1", "PaCE iOS/1.2", day.Add(24*time.Hour)) {
+		t.Error("Expected a call the next day to be the first today")
+	}
+	usage.Record("v2", "user:1", "PaCE iOS/1.3", day.Add(25*time.Hour))
+
+	uses := usage.Uses()
+	if len(uses) != 2 || uses[0].Version != "v2" || uses[1].Requests != 3 || !uses[1].FirstSeen.Equal(day) {
+		t.Errorf("Unexpected uses %+v", uses)
+	}
+}
+
+func TestUsageLimit(t *testing.T) {
+	usage := NewUsage()
+	usage.limit = 2
+	day := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	usage.Record("v1", "ip:192.0.2.1", "a", day)
+	usage.Record("v1", "ip:192.0.2.1", "b", day.Add(time.Minute))
+	usage.Record("v1", "ip:192.0.2.1", "a", day.Add(2*time.Minute))
+	usage.Record("v1", "ip:192.0.2.1", strings.Repeat("c", 1000), day.Add(3*time.Minute))
+
+	uses := usage.Uses()
+	if len(uses) != 2 || uses[1].UserAgent != "a" || uses[1].Requests != 2 {
+		t.Fatalf("Expected the least recently seen use to be forgotten, got %+v", uses)
+	}
+	if len(uses[0].UserAgent) != maxUserAgentLength {
+		t.Errorf("Expected the User-Agent to be cut to %d bytes, got %d", maxUserAgentLength, len(uses[0].UserAgent))
+	}
+}
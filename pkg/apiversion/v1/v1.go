@@ -0,0 +1,274 @@
+// Package v1 has the JSON shapes of the first version of the API, which is also
+// what the unversioned /api routes send. They are copies of the entities as
+// they were when v2 was added, and must not change. The entities are converted
+// to and from them with plain type conversions, so changing an entity stops
+// this package compiling until the v1 shape gets a mapping of its own.
+package v1
+
+import (
+	"github.com/coma-toast/pace-api/pkg/apiversion"
+	"github.com/coma-toast/pace-api/pkg/entity"
+)
+
+// Version is v1 of the API
+var Version = apiversion.New("v1")
+
+func init() {
+	Version.Register(User{}, func(e interface{}) apiversion.DTO { return User(e.(entity.User)) })
+	Version.Register(CreateUserRequest{}, func(e interface{}) apiversion.DTO {
+		request := e.(entity.CreateUserRequest)
+		return CreateUserRequest{User: User(request.User), Password: request.Password}
+	})
+	Version.Register(UpdateUserRequest{}, func(e interface{}) apiversion.DTO { return UpdateUserRequest(e.(entity.UpdateUserRequest)) })
+	Version.Register(LoginResponse{}, func(e interface{}) apiversion.DTO {
+		response := e.(entity.LoginResponse)
+		return LoginResponse{
+			Token:                       response.Token,
+			Expires:                     response.Expires,
+			RefreshToken:                response.RefreshToken,
+			RefreshExpires:              response.RefreshExpires,
+			User:                        User(response.User),
+			TwoFactorEnrollmentRequired: response.TwoFactorEnrollmentRequired,
+		}
+	})
+	Version.Register(Contact{}, func(e interface{}) apiversion.DTO { return Contact(e.(entity.Contact)) })
+	Version.Register(Company{}, func(e interface{}) apiversion.DTO { return Company(e.(entity.Company)) })
+	Version.Register(Project{}, func(e interface{}) apiversion.DTO { return Project(e.(entity.Project)) })
+	Version.Register(UpdateProjectRequest{}, func(e interface{}) apiversion.DTO { return UpdateProjectRequest(e.(entity.UpdateProjectRequest)) })
+	Version.Register(Inventory{}, func(e interface{}) apiversion.DTO { return Inventory(e.(entity.Inventory)) })
+	Version.Register(UpdateInventoryRequest{}, func(e interface{}) apiversion.DTO { return UpdateInventoryRequest(e.(entity.UpdateInventoryRequest)) })
+	Version.Register(Inspection{}, func(e interface{}) apiversion.DTO { return Inspection(e.(entity.Inspection)) })
+	Version.Register(UpdateInspectionRequest{}, func(e interface{}) apiversion.DTO { return UpdateInspectionRequest(e.(entity.UpdateInspectionRequest)) })
+}
+
+// User is a user
+type User struct {
+	ID        string `json:"id"`
+	Created   string `json:"created"`
+	FirstName string `json:"firstname"`
+	LastName  string `json:"lastname"`
+	Role      string `json:"role"`
+	Username  string `json:"username" validate:"required,max=100"`
+	Password  string `json:"-"`
+	Email     string `json:"email" validate:"email"`
+	Phone     string `json:"phone" validate:"phone"`
+	TimeZone  string `json:"timezone"`
+	DarkMode  bool   `json:"darkmode"`
+	// TOTPSecret is set once enrollment starts, and only used once TOTPEnabled is set
+	TOTPSecret      string   `json:"-"`
+	TOTPEnabled     bool     `json:"totpEnabled"`
+	TOTPLastCounter int64    `json:"-"`
+	RecoveryCodes   []string `json:"-"`
+}
+
+// CreateUserRequest is a new user along with their password
+type CreateUserRequest struct {
+	User
+	Password string `json:"password" validate:"required,min=8,max=200"`
+}
+
+// UpdateUserRequest is a passwordless user. Without an ID, the user is found by Username.
+type UpdateUserRequest struct {
+	ID        string `json:"id"`
+	FirstName string `json:"firstname"`
+	LastName  string `json:"lastname"`
+	Role      string `json:"role"`
+	Username  string `json:"username" validate:"required,max=100"`
+	Email     string `json:"email" validate:"email"`
+	Phone     string `json:"phone" validate:"phone"`
+	TimeZone  string `json:"timezone"`
+	DarkMode  bool   `json:"darkmode"`
+}
+
+// LoginResponse is returned after a successful login or token refresh
+type LoginResponse struct {
+	Token          string `json:"token"`
+	Expires        string `json:"expires"`
+	RefreshToken   string `json:"refreshToken"`
+	RefreshExpires string `json:"refreshExpires"`
+	User           User   `json:"user"`
+	// TwoFactorEnrollmentRequired means the token only works for /api/2fa until the user enrolls
+	TwoFactorEnrollmentRequired bool `json:"twoFactorEnrollmentRequired"`
+}
+
+// Contact is a non-user contact
+type Contact struct {
+	ID        string `json:"id"`
+	Created   string `json:"created"`
+	FirstName string `json:"firstname" validate:"required,max=100"`
+	LastName  string `json:"lastname"`
+	Company   string `json:"company"`
+	Email     string `json:"email" validate:"email"`
+	Phone     string `json:"phone" validate:"phone"`
+	Timezone  string `json:"timezone"`
+	Favorite  bool   `json:"favorite"`
+	Deleted   bool   `json:"deleted"`
+	Instance  string `json:"instance"`
+}
+
+// Company is a contact company
+type Company struct {
+	ID             string `json:"id"`
+	Created        string `json:"created"`
+	Name           string `json:"name" validate:"required,max=200"`
+	PrimaryContact string `json:"primaryContact"`
+	Phone          string `json:"phone" validate:"phone"`
+	Email          string `json:"email" validate:"email"`
+	Address        string `json:"address"`
+	City           string `json:"city"`
+	State          string `json:"state" validate:"state"`
+	Zip            string `json:"zip" validate:"zip"`
+	Favorite       bool   `json:"favorite"`
+	Deleted        bool   `json:"deleted"`
+	Instance       string `json:"instance"`
+}
+
+// Project is a construction project
+type Project struct {
+	ID                    string `json:"id"`
+	Created               string `json:"created"`
+	Deleted               bool   `json:"deleted"`
+	Name                  string `json:"name" validate:"required,max=200"`
+	StartDate             string `json:"startDate" validate:"date"`
+	DueDate               string `json:"dueDate" validate:"date,after=StartDate"`
+	Address               string `json:"address"`
+	City                  string `json:"city"`
+	State                 string `json:"state" validate:"state"`
+	Zip                   int32  `json:"zip" validate:"min=0,max=99999"`
+	ProjectManager        string `json:"projectManager"`
+	ClientID              string `json:"clientID"`
+	EORNameID             string `json:"eORNameID"`
+	DetailerNameID        string `json:"detailerNameID"`
+	InspectionLabID       string `json:"inspectionLabID"`
+	SteelErectorNameID    string `json:"steelErectorNameID"`
+	SteelFabricatorNameID string `json:"steelFabricatorNameID"`
+	GeneralContractorID   string `json:"generalContractorID"`
+	PrimaryContactNameID  string `json:"primaryContactNameID"`
+	PrimaryContactPhone   string `json:"primaryContactPhone" validate:"phone"`
+	PrimaryContactEmail   string `json:"primaryContactEmail" validate:"email"`
+	SquareFootage         int32  `json:"squareFootage" validate:"min=0"`
+	WeightInTons          int32  `json:"weightInTons" validate:"min=0"`
+}
+
+// UpdateProjectRequest is a construction project. Without an ID, the project is found by Name.
+type UpdateProjectRequest struct {
+	ID                    string `json:"id"`
+	Name                  string `json:"name" validate:"required,max=200"`
+	Deleted               bool   `json:"deleted"`
+	StartDate             string `json:"startDate" validate:"date"`
+	DueDate               string `json:"dueDate" validate:"date,after=StartDate"`
+	Address               string `json:"address"`
+	City                  string `json:"city"`
+	State                 string `json:"state" validate:"state"`
+	Zip                   int32  `json:"zip" validate:"min=0,max=99999"`
+	ProjectManager        string `json:"projectManager"`
+	ClientID              string `json:"clientID"`
+	EORNameID             string `json:"eORNameID"`
+	DetailerNameID        string `json:"detailerNameID"`
+	InspectionLabID       string `json:"inspectionLabID"`
+	SteelErectorNameID    string `json:"steelErectorNameID"`
+	SteelFabricatorNameID string `json:"steelFabricatorNameID"`
+	GeneralContractorID   string `json:"generalContractorID"`
+	PrimaryContactNameID  string `json:"primaryContactNameID"`
+	PrimaryContactPhone   string `json:"primaryContactPhone" validate:"phone"`
+	PrimaryContactEmail   string `json:"primaryContactEmail" validate:"email"`
+	SquareFootage         int32  `json:"squareFootage" validate:"min=0"`
+	WeightInTons          int32  `json:"weightInTons" validate:"min=0"`
+}
+
+// Inventory is an inventory item
+type Inventory struct {
+	ID        string       `json:"ID"`
+	Created   string       `json:"created"`
+	ProjectID string       `json:"projectID" validate:"required"`
+	Stage     entity.Stage `json:"stage"`
+	Size      int32        `json:"size" validate:"min=0"`
+	Length    int32        `json:"length" validate:"min=0"`
+	Grade     int32        `json:"grade" validate:"min=0"`
+	Shape     string       `json:"shape"`
+	Passed    bool         `json:"passed"`
+	Sequence  int32        `json:"sequence" validate:"min=0"`
+	Priority  int32        `json:"priority" validate:"min=0"`
+}
+
+// UpdateInventoryRequest is an inventory item
+type UpdateInventoryRequest struct {
+	ID        string       `json:"ID"`
+	ProjectID string       `json:"projectID" validate:"required"`
+	Stage     entity.Stage `json:"stage"`
+	Size      int32        `json:"size" validate:"min=0"`
+	Length    int32        `json:"length" validate:"min=0"`
+	Grade     int32        `json:"grade" validate:"min=0"`
+	Shape     string       `json:"shape"`
+	Passed    bool         `json:"passed"`
+	Sequence  int32        `json:"sequence" validate:"min=0"`
+	Priority  int32        `json:"priority" validate:"min=0"`
+}
+
+// Inspection is an inspection report
+type Inspection struct {
+	ID             string `json:"id"`
+	Created        string `json:"created"`
+	ProjectID      string `json:"projectID"`
+	Username       string `json:"username"`
+	StartTime      string `json:"startTime"`
+	EndTime        string `json:"endTime"`
+	InspectedParts string `json:"inspectedParts"`
+}
+
+// UpdateInspectionRequest is an inspection report
+type UpdateInspectionRequest struct {
+	ID             string `json:"id"`
+	ProjectID      string `json:"projectID" validate:"required"`
+	Username       string `json:"username"`
+	StartTime      string `json:"startTime" validate:"date"`
+	EndTime        string `json:"endTime" validate:"date,after=StartTime"`
+	InspectedParts string `json:"inspectedParts"`
+}
+
+// Entity converts to an entity.User
+func (u User) Entity() interface{} { return entity.User(u) }
+
+// Entity converts to an entity.CreateUserRequest
+func (c CreateUserRequest) Entity() interface{} {
+	return entity.CreateUserRequest{User: entity.User(c.User), Password: c.Password}
+}
+
+// Entity converts to an entity.UpdateUserRequest
+func (u UpdateUserRequest) Entity() interface{} { return entity.UpdateUserRequest(u) }
+
+// Entity converts to an entity.LoginResponse
+func (l LoginResponse) Entity() interface{} {
+	return entity.LoginResponse{
+		Token:                       l.Token,
+		Expires:                     l.Expires,
+		RefreshToken:                l.RefreshToken,
+		RefreshExpires:              l.RefreshExpires,
+		User:                        entity.User(l.User),
+		TwoFactorEnrollmentRequired: l.TwoFactorEnrollmentRequired,
+	}
+}
+
+// Entity converts to an entity.Contact
+func (c Contact) Entity() interface{} { return entity.Contact(c) }
+
+// Entity converts to an entity.Company
+func (c Company) Entity() interface{} { return entity.Company(c) }
+
+// Entity converts to an entity.Project
+func (p Project) Entity() interface{} { return entity.Project(p) }
+
+// Entity converts to an entity.UpdateProjectRequest
+func (p UpdateProjectRequest) Entity() interface{} { return entity.UpdateProjectRequest(p) }
+
+// Entity converts to an entity.Inventory
+func (i Inventory) Entity() interface{} { return entity.Inventory(i) }
+
+// Entity converts to an entity.UpdateInventoryRequest
+func (i UpdateInventoryRequest) Entity() interface{} { return entity.UpdateInventoryRequest(i) }
+
+// Entity converts to an entity.Inspection
+func (i Inspection) Entity() interface{} { return entity.Inspection(i) }
+
+// Entity converts to an entity.UpdateInspectionRequest
+func (i UpdateInspectionRequest) Entity() interface{} { return entity.UpdateInspectionRequest(i) }
@@ -0,0 +1,428 @@
+// Package v2 has the JSON shapes that changed in v2 of the API. Everything else
+// is sent as the entity itself. The changes from v1 are:
+//   - user and contact fields are camelCase, like firstName and timeZone
+//   - project zips are strings, keeping their leading zeros, and eORNameID is eorNameID
+//   - inventory items have an id, not an ID
+package v2
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/coma-toast/pace-api/pkg/apiversion"
+	"github.com/coma-toast/pace-api/pkg/entity"
+)
+
+// Version is v2 of the API
+var Version = apiversion.New("v2")
+
+func init() {
+	Version.Register(User{}, func(e interface{}) apiversion.DTO { return newUser(e.(entity.User)) })
+	Version.Register(CreateUserRequest{}, func(e interface{}) apiversion.DTO {
+		request := e.(entity.CreateUserRequest)
+		return CreateUserRequest{User: newUser(request.User), Password: request.Password}
+	})
+	Version.Register(UpdateUserRequest{}, func(e interface{}) apiversion.DTO {
+		user := e.(entity.UpdateUserRequest)
+		return UpdateUserRequest{
+			ID:        user.ID,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Role:      user.Role,
+			Username:  user.Username,
+			Email:     user.Email,
+			Phone:     user.Phone,
+			TimeZone:  user.TimeZone,
+			DarkMode:  user.DarkMode,
+		}
+	})
+	Version.Register(LoginResponse{}, func(e interface{}) apiversion.DTO {
+		response := e.(entity.LoginResponse)
+		return LoginResponse{
+			Token:                       response.Token,
+			Expires:                     response.Expires,
+			RefreshToken:                response.RefreshToken,
+			RefreshExpires:              response.RefreshExpires,
+			User:                        newUser(response.User),
+			TwoFactorEnrollmentRequired: response.TwoFactorEnrollmentRequired,
+		}
+	})
+	Version.Register(Contact{}, func(e interface{}) apiversion.DTO {
+		contact := e.(entity.Contact)
+		return Contact{
+			ID:        contact.ID,
+			Created:   contact.Created,
+			FirstName: contact.FirstName,
+			LastName:  contact.LastName,
+			Company:   contact.Company,
+			Email:     contact.Email,
+			Phone:     contact.Phone,
+			TimeZone:  contact.Timezone,
+			Favorite:  contact.Favorite,
+			Deleted:   contact.Deleted,
+			Instance:  contact.Instance,
+		}
+	})
+	Version.Register(Project{}, func(e interface{}) apiversion.DTO {
+		project := e.(entity.Project)
+		return Project{
+			ID:                    project.ID,
+			Created:               project.Created,
+			Deleted:               project.Deleted,
+			Name:                  project.Name,
+			StartDate:             project.StartDate,
+			DueDate:               project.DueDate,
+			Address:               project.Address,
+			City:                  project.City,
+			State:                 project.State,
+			Zip:                   zipString(project.Zip),
+			ProjectManager:        project.ProjectManager,
+			ClientID:              project.ClientID,
+			EORNameID:             project.EORNameID,
+			DetailerNameID:        project.DetailerNameID,
+			InspectionLabID:       project.InspectionLabID,
+			SteelErectorNameID:    project.SteelErectorNameID,
+			SteelFabricatorNameID: project.SteelFabricatorNameID,
+			GeneralContractorID:   project.GeneralContractorID,
+			PrimaryContactNameID:  project.PrimaryContactNameID,
+			PrimaryContactPhone:   project.PrimaryContactPhone,
+			PrimaryContactEmail:   project.PrimaryContactEmail,
+			SquareFootage:         project.SquareFootage,
+			WeightInTons:          project.WeightInTons,
+		}
+	})
+	Version.Register(UpdateProjectRequest{}, func(e interface{}) apiversion.DTO {
+		project := e.(entity.UpdateProjectRequest)
+		return UpdateProjectRequest{
+			ID:                    project.ID,
+			Name:                  project.Name,
+			Deleted:               project.Deleted,
+			StartDate:             project.StartDate,
+			DueDate:               project.DueDate,
+			Address:               project.Address,
+			City:                  project.City,
+			State:                 project.State,
+			Zip:                   zipString(project.Zip),
+			ProjectManager:        project.ProjectManager,
+			ClientID:              project.ClientID,
+			EORNameID:             project.EORNameID,
+			DetailerNameID:        project.DetailerNameID,
+			InspectionLabID:       project.InspectionLabID,
+			SteelErectorNameID:    project.SteelErectorNameID,
+			SteelFabricatorNameID: project.SteelFabricatorNameID,
+			GeneralContractorID:   project.GeneralContractorID,
+			PrimaryContactNameID:  project.PrimaryContactNameID,
+			PrimaryContactPhone:   project.PrimaryContactPhone,
+			PrimaryContactEmail:   project.PrimaryContactEmail,
+			SquareFootage:         project.SquareFootage,
+			WeightInTons:          project.WeightInTons,
+		}
+	})
+	Version.Register(Inventory{}, func(e interface{}) apiversion.DTO { return Inventory(e.(entity.Inventory)) })
+	Version.Register(UpdateInventoryRequest{}, func(e interface{}) apiversion.DTO {
+		return UpdateInventoryRequest(e.(entity.UpdateInventoryRequest))
+	})
+}
+
+// User is a user
+type User struct {
+	ID          string `json:"id"`
+	Created     string `json:"created"`
+	FirstName   string `json:"firstName"`
+	LastName    string `json:"lastName"`
+	Role        string `json:"role"`
+	Username    string `json:"username" validate:"required,max=100"`
+	Email       string `json:"email" validate:"email"`
+	Phone       string `json:"phone" validate:"phone"`
+	TimeZone    string `json:"timeZone"`
+	DarkMode    bool   `json:"darkMode"`
+	TOTPEnabled bool   `json:"totpEnabled"`
+}
+
+func newUser(user entity.User) User {
+	return User{
+		ID:          user.ID,
+		Created:     user.Created,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		Role:        user.Role,
+		Username:    user.Username,
+		Email:       user.Email,
+		Phone:       user.Phone,
+		TimeZone:    user.TimeZone,
+		DarkMode:    user.DarkMode,
+		TOTPEnabled: user.TOTPEnabled,
+	}
+}
+
+// Entity converts to an entity.User
+func (u User) Entity() interface{} {
+	return entity.User{
+		ID:          u.ID,
+		Created:     u.Created,
+		FirstName:   u.FirstName,
+		LastName:    u.LastName,
+		Role:        u.Role,
+		Username:    u.Username,
+		Email:       u.Email,
+		Phone:       u.Phone,
+		TimeZone:    u.TimeZone,
+		DarkMode:    u.DarkMode,
+		TOTPEnabled: u.TOTPEnabled,
+	}
+}
+
+// CreateUserRequest is a new user along with their password
+type CreateUserRequest struct {
+	User
+	Password string `json:"password" validate:"required,min=8,max=200"`
+}
+
+// Entity converts to an entity.CreateUserRequest
+func (c CreateUserRequest) Entity() interface{} {
+	return entity.CreateUserRequest{User: c.User.Entity().(entity.User), Password: c.Password}
+}
+
+// UpdateUserRequest is a passwordless user. Without an ID, the user is found by Username.
+type UpdateUserRequest struct {
+	ID        string `json:"id"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Role      string `json:"role"`
+	Username  string `json:"username" validate:"required,max=100"`
+	Email     string `json:"email" validate:"email"`
+	Phone     string `json:"phone" validate:"phone"`
+	TimeZone  string `json:"timeZone"`
+	DarkMode  bool   `json:"darkMode"`
+}
+
+// Entity converts to an entity.UpdateUserRequest
+func (u UpdateUserRequest) Entity() interface{} {
+	return entity.UpdateUserRequest{
+		ID:        u.ID,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Role:      u.Role,
+		Username:  u.Username,
+		Email:     u.Email,
+		Phone:     u.Phone,
+		TimeZone:  u.TimeZone,
+		DarkMode:  u.DarkMode,
+	}
+}
+
+// LoginResponse is returned after a successful login or token refresh
+type LoginResponse struct {
+	Token          string `json:"token"`
+	Expires        string `json:"expires"`
+	RefreshToken   string `json:"refreshToken"`
+	RefreshExpires string `json:"refreshExpires"`
+	User           User   `json:"user"`
+	// TwoFactorEnrollmentRequired means the token only works for /api/v2/2fa until the user enrolls
+	TwoFactorEnrollmentRequired bool `json:"twoFactorEnrollmentRequired"`
+}
+
+// Entity converts to an entity.LoginResponse
+func (l LoginResponse) Entity() interface{} {
+	return entity.LoginResponse{
+		Token:                       l.Token,
+		Expires:                     l.Expires,
+		RefreshToken:                l.RefreshToken,
+		RefreshExpires:              l.RefreshExpires,
+		User:                        l.User.Entity().(entity.User),
+		TwoFactorEnrollmentRequired: l.TwoFactorEnrollmentRequired,
+	}
+}
+
+// Contact is a non-user contact
+type Contact struct {
+	ID        string `json:"id"`
+	Created   string `json:"created"`
+	FirstName string `json:"firstName" validate:"required,max=100"`
+	LastName  string `json:"lastName"`
+	Company   string `json:"company"`
+	Email     string `json:"email" validate:"email"`
+	Phone     string `json:"phone" validate:"phone"`
+	TimeZone  string `json:"timeZone"`
+	Favorite  bool   `json:"favorite"`
+	Deleted   bool   `json:"deleted"`
+	Instance  string `json:"instance"`
+}
+
+// Entity converts to an entity.Contact
+func (c Contact) Entity() interface{} {
+	return entity.Contact{
+		ID:        c.ID,
+		Created:   c.Created,
+		FirstName: c.FirstName,
+		LastName:  c.LastName,
+		Company:   c.Company,
+		Email:     c.Email,
+		Phone:     c.Phone,
+		Timezone:  c.TimeZone,
+		Favorite:  c.Favorite,
+		Deleted:   c.Deleted,
+		Instance:  c.Instance,
+	}
+}
+
+// Project is a construction project
+type Project struct {
+	ID                    string `json:"id"`
+	Created               string `json:"created"`
+	Deleted               bool   `json:"deleted"`
+	Name                  string `json:"name" validate:"required,max=200"`
+	StartDate             string `json:"startDate" validate:"date"`
+	DueDate               string `json:"dueDate" validate:"date,after=StartDate"`
+	Address               string `json:"address"`
+	City                  string `json:"city"`
+	State                 string `json:"state" validate:"state"`
+	Zip                   string `json:"zip" validate:"zip,max=5"`
+	ProjectManager        string `json:"projectManager"`
+	ClientID              string `json:"clientID"`
+	EORNameID             string `json:"eorNameID"`
+	DetailerNameID        string `json:"detailerNameID"`
+	InspectionLabID       string `json:"inspectionLabID"`
+	SteelErectorNameID    string `json:"steelErectorNameID"`
+	SteelFabricatorNameID string `json:"steelFabricatorNameID"`
+	GeneralContractorID   string `json:"generalContractorID"`
+	PrimaryContactNameID  string `json:"primaryContactNameID"`
+	PrimaryContactPhone   string `json:"primaryContactPhone" validate:"phone"`
+	PrimaryContactEmail   string `json:"primaryContactEmail" validate:"email"`
+	SquareFootage         int32  `json:"squareFootage" validate:"min=0"`
+	WeightInTons          int32  `json:"weightInTons" validate:"min=0"`
+}
+
+// Entity converts to an entity.Project
+func (p Project) Entity() interface{} {
+	return entity.Project{
+		ID:                    p.ID,
+		Created:               p.Created,
+		Deleted:               p.Deleted,
+		Name:                  p.Name,
+		StartDate:             p.StartDate,
+		DueDate:               p.DueDate,
+		Address:               p.Address,
+		City:                  p.City,
+		State:                 p.State,
+		Zip:                   zipNumber(p.Zip),
+		ProjectManager:        p.ProjectManager,
+		ClientID:              p.ClientID,
+		EORNameID:             p.EORNameID,
+		DetailerNameID:        p.DetailerNameID,
+		InspectionLabID:       p.InspectionLabID,
+		SteelErectorNameID:    p.SteelErectorNameID,
+		SteelFabricatorNameID: p.SteelFabricatorNameID,
+		GeneralContractorID:   p.GeneralContractorID,
+		PrimaryContactNameID:  p.PrimaryContactNameID,
+		PrimaryContactPhone:   p.PrimaryContactPhone,
+		PrimaryContactEmail:   p.PrimaryContactEmail,
+		SquareFootage:         p.SquareFootage,
+		WeightInTons:          p.WeightInTons,
+	}
+}
+
+// UpdateProjectRequest is a construction project. Without an ID, the project is found by Name.
+type UpdateProjectRequest struct {
+	ID                    string `json:"id"`
+	Name                  string `json:"name" validate:"required,max=200"`
+	Deleted               bool   `json:"deleted"`
+	StartDate             string `json:"startDate" validate:"date"`
+	DueDate               string `json:"dueDate" validate:"date,after=StartDate"`
+	Address               string `json:"address"`
+	City                  string `json:"city"`
+	State                 string `json:"state" validate:"state"`
+	Zip                   string `json:"zip" validate:"zip,max=5"`
+	ProjectManager        string `json:"projectManager"`
+	ClientID              string `json:"clientID"`
+	EORNameID             string `json:"eorNameID"`
+	DetailerNameID        string `json:"detailerNameID"`
+	InspectionLabID       string `json:"inspectionLabID"`
+	SteelErectorNameID    string `json:"steelErectorNameID"`
+	SteelFabricatorNameID string `json:"steelFabricatorNameID"`
+	GeneralContractorID   string `json:"generalContractorID"`
+	PrimaryContactNameID  string `json:"primaryContactNameID"`
+	PrimaryContactPhone   string `json:"primaryContactPhone" validate:"phone"`
+	PrimaryContactEmail   string `json:"primaryContactEmail" validate:"email"`
+	SquareFootage         int32  `json:"squareFootage" validate:"min=0"`
+	WeightInTons          int32  `json:"weightInTons" validate:"min=0"`
+}
+
+// Entity converts to an entity.UpdateProjectRequest
+func (p UpdateProjectRequest) Entity() interface{} {
+	return entity.UpdateProjectRequest{
+		ID:                    p.ID,
+		Name:                  p.Name,
+		Deleted:               p.Deleted,
+		StartDate:             p.StartDate,
+		DueDate:               p.DueDate,
+		Address:               p.Address,
+		City:                  p.City,
+		State:                 p.State,
+		Zip:                   zipNumber(p.Zip),
+		ProjectManager:        p.ProjectManager,
+		ClientID:              p.ClientID,
+		EORNameID:             p.EORNameID,
+		DetailerNameID:        p.DetailerNameID,
+		InspectionLabID:       p.InspectionLabID,
+		SteelErectorNameID:    p.SteelErectorNameID,
+		SteelFabricatorNameID: p.SteelFabricatorNameID,
+		GeneralContractorID:   p.GeneralContractorID,
+		PrimaryContactNameID:  p.PrimaryContactNameID,
+		PrimaryContactPhone:   p.PrimaryContactPhone,
+		PrimaryContactEmail:   p.PrimaryContactEmail,
+		SquareFootage:         p.SquareFootage,
+		WeightInTons:          p.WeightInTons,
+	}
+}
+
+// zipString formats a stored zip with its leading zeros, or "" if there isn't one
+func zipString(zip int32) string {
+	if zip == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%05d", zip)
+}
+
+// zipNumber is how a zip is stored. It has already been validated as five digits.
+func zipNumber(zip string) int32 {
+	number, _ := strconv.ParseInt(zip, 10, 32)
+
+	return int32(number)
+}
+
+// Inventory is an inventory item
+type Inventory struct {
+	ID        string       `json:"id"`
+	Created   string       `json:"created"`
+	ProjectID string       `json:"projectID" validate:"required"`
+	Stage     entity.Stage `json:"stage"`
+	Size      int32        `json:"size" validate:"min=0"`
+	Length    int32        `json:"length" validate:"min=0"`
+	Grade     int32        `json:"grade" validate:"min=0"`
+	Shape     string       `json:"shape"`
+	Passed    bool         `json:"passed"`
+	Sequence  int32        `json:"sequence" validate:"min=0"`
+	Priority  int32        `json:"priority" validate:"min=0"`
+}
+
+// Entity converts to an entity.Inventory
+func (i Inventory) Entity() interface{} { return entity.Inventory(i) }
+
+// UpdateInventoryRequest is an inventory item
+type UpdateInventoryRequest struct {
+	ID        string       `json:"id"`
+	ProjectID string       `json:"projectID" validate:"required"`
+	Stage     entity.Stage `json:"stage"`
+	Size      int32        `json:"size" validate:"min=0"`
+	Length    int32        `json:"length" validate:"min=0"`
+	Grade     int32        `json:"grade" validate:"min=0"`
+	Shape     string       `json:"shape"`
+	Passed    bool         `json:"passed"`
+	Sequence  int32        `json:"sequence" validate:"min=0"`
+	Priority  int32        `json:"priority" validate:"min=0"`
+}
+
+// Entity converts to an entity.UpdateInventoryRequest
+func (i UpdateInventoryRequest) Entity() interface{} { return entity.UpdateInventoryRequest(i) }
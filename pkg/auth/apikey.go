@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	helper "github.com/coma-toast/pace-api/pkg/utils"
+)
+
+// ScopeAll grants every scope to an API key
+const ScopeAll = "*"
+
+// Resources that API key scopes can be granted for, as "<resource>:read" or "<resource>:write"
+var Resources = []string{"user", "contact", "company", "project", "inventory", "inspection", "membership", "graphql", "sync", "search"}
+
+// readOnlyResources only need the read scope, whatever the method. GraphQL
+// queries are sent as POSTs but can't change anything.
+var readOnlyResources = map[string]bool{"graphql": true}
+
+// ErrInvalidAPIKey if an API key is malformed, unknown, revoked or expired
+var ErrInvalidAPIKey = errors.New("Invalid API key")
+
+// SplitAPIKey gets the key ID and secret out of a key like pace_<id>.<secret>
+func SplitAPIKey(key string, prefix string) (string, string, error) {
+	if !strings.HasPrefix(key, prefix) {
+		return "", "", ErrInvalidAPIKey
+	}
+	parts := strings.SplitN(strings.TrimPrefix(key, prefix), ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", ErrInvalidAPIKey
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// CheckAPIKey checks a secret against a stored key and returns the identity it grants
+func CheckAPIKey(apiKey entity.APIKey, secret string) (Identity, error) {
+	if apiKey.Revoked {
+		return Identity{}, ErrInvalidAPIKey
+	}
+	if apiKey.Expires != "" {
+		expires, err := time.Parse(time.RFC3339, apiKey.Expires)
+		if err != nil || time.Now().After(expires) {
+			return Identity{}, ErrInvalidAPIKey
+		}
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(helper.Hash(secret, apiKey.ID))) != 1 {
+		return Identity{}, ErrInvalidAPIKey
+	}
+
+	return Identity{
+		Username: apiKey.Name,
+		APIKeyID: apiKey.ID,
+		Scopes:   apiKey.Scopes,
+
+		DailyQuota: apiKey.DailyQuota,
+	}, nil
+}
+
+// ValidScope reports whether an API key can be granted the scope
+func ValidScope(scope string) bool {
+	if scope == ScopeAll {
+		return true
+	}
+	for _, resource := range Resources {
+		if scope == resource+":read" || scope == resource+":write" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collections are the plural paths of resources, like /api/projects/{id}
+var collections = map[string]string{
+	"users":       "user",
+	"contacts":    "contact",
+	"companies":   "company",
+	"projects":    "project",
+	"inspections": "inspection",
+}
+
+// Resource gets the resource of an API path, like inventory for /api/inventory
+// or project for /api/projects/{id}
+func Resource(path string) string {
+	resource := strings.SplitN(strings.TrimPrefix(path, "/api/"), "/", 2)[0]
+	if singular, ok := collections[resource]; ok {
+		return singular
+	}
+
+	return resource
+}
+
+// RequiredScope gets the scope needed to call a method on an API path like /api/inventory
+func RequiredScope(method string, path string) string {
+	resource := Resource(path)
+	if method == "GET" || method == "HEAD" || readOnlyResources[resource] {
+		return resource + ":read"
+	}
+
+	return resource + ":write"
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	helper "github.com/coma-toast/pace-api/pkg/utils"
+)
+
+func TestToken(t *testing.T) {
+	claims := Claims{UserID: "1", Username: "jason", Role: entity.RoleAdmin, Expires: time.Now().Add(time.Minute).Unix()}
+	token, err := NewToken(claims, "secret")
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+
+	parsed, err := ParseToken(token, "secret")
+	if err != nil {
+		t.Fatal("Error parsing token: ", err)
+	}
+	if parsed != claims {
+		t.Error("Parsed claims do not match: ", parsed)
+	}
+
+	if _, err := ParseToken(token, "other secret"); err != ErrInvalidToken {
+		t.Error("Token signed with another secret should be invalid, got: ", err)
+	}
+
+	claims.Expires = time.Now().Add(-time.Minute).Unix()
+	expired, _ := NewToken(claims, "secret")
+	if _, err := ParseToken(expired, "secret"); err != ErrExpiredToken {
+		t.Error("Expired token should be rejected, got: ", err)
+	}
+}
+
+func TestScope(t *testing.T) {
+	scope := NewScope(Identity{UserID: "1"}, []entity.Membership{
+		{ProjectID: "viewed", Role: entity.ProjectRoleViewer},
+		{ProjectID: "edited", Role: entity.ProjectRoleEditor},
+		{ProjectID: "managed", Role: entity.ProjectRoleManager},
+	})
+
+	tests := []struct {
+		projectID                    string
+		canRead, canWrite, canManage bool
+	}{
+		{"viewed", true, false, false},
+		{"edited", true, true, false},
+		{"managed", true, true, true},
+		{"other", false, false, false},
+	}
+	for _, test := range tests {
+		if scope.CanRead(test.projectID) != test.canRead ||
+			scope.CanWrite(test.projectID) != test.canWrite ||
+			scope.CanManage(test.projectID) != test.canManage {
+			t.Error("Unexpected access for project ", test.projectID)
+		}
+	}
+
+	admin := NewScope(Identity{Role: entity.RoleAdmin}, nil)
+	if !admin.CanManage("other") {
+		t.Error("Admins should be able to manage every project")
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	keyID, secret, err := SplitAPIKey("pace_abc.s3cret", "pace_")
+	if err != nil || keyID != "abc" || secret != "s3cret" {
+		t.Fatal("Error splitting API key: ", keyID, secret, err)
+	}
+	if _, _, err := SplitAPIKey("abc.s3cret", "pace_"); err != ErrInvalidAPIKey {
+		t.Error("Key without prefix should be invalid, got: ", err)
+	}
+
+	apiKey := entity.APIKey{ID: keyID, Name: "scanner", Hash: helper.Hash(secret, keyID), Scopes: []string{"inventory:read"}}
+	identity, err := CheckAPIKey(apiKey, secret)
+	if err != nil {
+		t.Fatal("Error checking API key: ", err)
+	}
+	if !identity.HasScope(RequiredScope("GET", "/api/inventory")) {
+		t.Error("Key should be able to read inventory")
+	}
+	if identity.HasScope(RequiredScope("PUT", "/api/inventory")) {
+		t.Error("Key should not be able to write inventory")
+	}
+	if RequiredScope("PATCH", "/api/projects/{id}") != "project:write" {
+		t.Error("Collection routes should need the same scope as the resource")
+	}
+	if RequiredScope("POST", "/api/graphql") != "graphql:read" {
+		t.Error("GraphQL queries should only need the read scope")
+	}
+
+	if _, err := CheckAPIKey(apiKey, "wrong"); err != ErrInvalidAPIKey {
+		t.Error("Wrong secret should be rejected, got: ", err)
+	}
+	apiKey.Expires = time.Now().Add(-time.Hour).Format(time.RFC3339)
+	if _, err := CheckAPIKey(apiKey, secret); err != ErrInvalidAPIKey {
+		t.Error("Expired key should be rejected, got: ", err)
+	}
+	apiKey.Expires = ""
+	apiKey.Revoked = true
+	if _, err := CheckAPIKey(apiKey, secret); err != ErrInvalidAPIKey {
+		t.Error("Revoked key should be rejected, got: ", err)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	sessionID, secret, err := SplitRefreshToken("abc.s3cret")
+	if err != nil {
+		t.Fatal("Error splitting refresh token: ", err)
+	}
+
+	session := entity.Session{
+		ID:      sessionID,
+		Hash:    helper.Hash(secret, sessionID),
+		Expires: time.Now().Add(time.Hour).Format(time.RFC3339),
+	}
+	if err := CheckRefreshToken(session, secret); err != nil {
+		t.Error("Error checking refresh token: ", err)
+	}
+	if err := CheckRefreshToken(session, "wrong"); err != ErrInvalidToken {
+		t.Error("Wrong secret should be rejected, got: ", err)
+	}
+
+	rotated := session
+	rotated.ReplacedBy = "def"
+	if err := CheckRefreshToken(rotated, secret); err != ErrTokenReused {
+		t.Error("Rotated token should be reported as reused, got: ", err)
+	}
+
+	revoked := session
+	revoked.Revoked = true
+	if err := CheckRefreshToken(revoked, secret); err != ErrSessionRevoked {
+		t.Error("Revoked session should be rejected, got: ", err)
+	}
+
+	if active := ActiveSessions([]entity.Session{session, rotated, revoked}); len(active) != 1 {
+		t.Error("Only the current session should be active, got: ", active)
+	}
+}
+
+func TestLockoutPolicy(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: 5 * time.Minute}
+	now := time.Now().Truncate(time.Second)
+	attempts := entity.LoginAttempts{Key: "username:jason"}
+
+	expected := []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, wait := range expected {
+		var locked bool
+		attempts, locked = policy.Fail(attempts, now)
+		if locked != (wait > 0) {
+			t.Errorf("Failure %d: expected locked to be %t", i+1, wait > 0)
+		}
+		if got := LockedFor(attempts, now); got != wait {
+			t.Errorf("Failure %d: expected to be locked for %s, got %s", i+1, wait, got)
+		}
+	}
+
+	if LockedFor(attempts, now.Add(time.Hour)) != 0 {
+		t.Error("Lockout should have expired")
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B, SHA1
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for seconds, expected := range vectors {
+		if code := hotp(key, uint64(seconds/totpPeriod), 8); code != expected {
+			t.Errorf("Expected %s at %d, got %s", expected, seconds, code)
+		}
+	}
+
+	secret := totpEncoding.EncodeToString(key)
+	now := time.Unix(1111111109, 0)
+	counter, ok := CheckTOTP(secret, "081804", 0, now)
+	if !ok {
+		t.Fatal("Current code should be accepted")
+	}
+	if _, ok := CheckTOTP(secret, "081804", counter, now); ok {
+		t.Error("Code should not be accepted twice")
+	}
+	if _, ok := CheckTOTP(secret, "081804", 0, now.Add(5*time.Minute)); ok {
+		t.Error("Old code should not be accepted")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes("1", 3)
+	if err != nil {
+		t.Fatal("Error generating recovery codes: ", err)
+	}
+
+	remaining, ok := UseRecoveryCode("1", codes[1], hashes)
+	if !ok || len(remaining) != 2 {
+		t.Fatal("Recovery code should be accepted once")
+	}
+	if _, ok := UseRecoveryCode("1", codes[1], remaining); ok {
+		t.Error("Recovery code should not be accepted twice")
+	}
+	if _, ok := UseRecoveryCode("2", codes[0], hashes); ok {
+		t.Error("Recovery code should only work for its own user")
+	}
+}
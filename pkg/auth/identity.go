@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+)
+
+type contextKey int
+
+const identityKey contextKey = iota
+
+// Identity is the authenticated caller of a request, either a user or an API key
+type Identity struct {
+	UserID   string
+	Username string
+	Role     string
+	// SessionID is the login session the access token was issued for
+	SessionID string
+	// EnrollOnly is set until a user that must use two-factor auth has enrolled
+	EnrollOnly bool
+	// APIKeyID, Scopes and DailyQuota are only set for API keys
+	APIKeyID   string
+	Scopes     []string
+	DailyQuota int64
+}
+
+// IsAPIKey reports whether the caller is a machine client
+func (i Identity) IsAPIKey() bool {
+	return i.APIKeyID != ""
+}
+
+// HasScope reports whether an API key was granted the scope. Users are
+// limited by their role and memberships instead, so they have every scope.
+func (i Identity) HasScope(scope string) bool {
+	if !i.IsAPIKey() {
+		return true
+	}
+	for _, granted := range i.Scopes {
+		if granted == scope || granted == ScopeAll {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsAdmin reports whether the caller can see and change everything
+func (i Identity) IsAdmin() bool {
+	return i.Role == entity.RoleAdmin
+}
+
+// CanCreateProjects reports whether the caller may start new projects
+func (i Identity) CanCreateProjects() bool {
+	return i.Role == entity.RoleAdmin || i.Role == entity.RoleProjectManager
+}
+
+// NewContext returns a copy of ctx carrying the identity
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey, identity)
+}
+
+// FromContext gets the identity stored by NewContext
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey).(Identity)
+	return identity, ok
+}
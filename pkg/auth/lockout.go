@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+)
+
+// LockoutPolicy decides how long logins are blocked after repeated failures.
+// Once Threshold failures have been reached, every further failure doubles
+// the lockout, starting at BaseDelay and capped at MaxDelay.
+type LockoutPolicy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// LockedFor gets how long until the key may try to log in again
+func LockedFor(attempts entity.LoginAttempts, now time.Time) time.Duration {
+	if attempts.LockedUntil == "" {
+		return 0
+	}
+	lockedUntil, err := time.Parse(time.RFC3339, attempts.LockedUntil)
+	if err != nil || !lockedUntil.After(now) {
+		return 0
+	}
+
+	return lockedUntil.Sub(now)
+}
+
+// Fail records a failed login and reports whether it locked the key
+func (p LockoutPolicy) Fail(attempts entity.LoginAttempts, now time.Time) (entity.LoginAttempts, bool) {
+	attempts.Failures++
+	attempts.LastFailure = now.Format(time.RFC3339)
+	if attempts.Failures < p.Threshold {
+		return attempts, false
+	}
+
+	delay := p.BaseDelay
+	for i := p.Threshold; i < attempts.Failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	attempts.LockedUntil = now.Add(delay).Format(time.RFC3339)
+
+	return attempts, true
+}
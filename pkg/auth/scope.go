@@ -0,0 +1,55 @@
+package auth
+
+import "github.com/coma-toast/pace-api/pkg/entity"
+
+// Scope is what a caller can reach based on their project memberships
+type Scope struct {
+	Identity Identity
+	// AllProjects is set for admins and API keys, which aren't tied to memberships
+	AllProjects bool
+	// Roles maps project IDs to the caller's project role
+	Roles map[string]string
+}
+
+// NewScope builds a Scope from the caller's memberships
+func NewScope(identity Identity, memberships []entity.Membership) Scope {
+	roles := make(map[string]string, len(memberships))
+	for _, membership := range memberships {
+		roles[membership.ProjectID] = membership.Role
+	}
+
+	return Scope{
+		Identity:    identity,
+		AllProjects: identity.IsAdmin() || identity.IsAPIKey(),
+		Roles:       roles,
+	}
+}
+
+// CanRead reports whether the caller can see a project and its data
+func (s Scope) CanRead(projectID string) bool {
+	if s.AllProjects {
+		return true
+	}
+	_, ok := s.Roles[projectID]
+
+	return ok
+}
+
+// CanWrite reports whether the caller can change a project's data
+func (s Scope) CanWrite(projectID string) bool {
+	if s.AllProjects {
+		return true
+	}
+	role := s.Roles[projectID]
+
+	return role == entity.ProjectRoleEditor || role == entity.ProjectRoleManager
+}
+
+// CanManage reports whether the caller can delete a project and manage its members
+func (s Scope) CanManage(projectID string) bool {
+	if s.AllProjects {
+		return true
+	}
+
+	return s.Roles[projectID] == entity.ProjectRoleManager
+}
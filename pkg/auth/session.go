@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	helper "github.com/coma-toast/pace-api/pkg/utils"
+)
+
+// ErrTokenReused if a refresh token that was already rotated is used again.
+// Either the token was stolen or the client is misbehaving, so the whole family gets revoked.
+var ErrTokenReused = errors.New("Refresh token has already been used")
+
+// ErrSessionRevoked if the session behind a token has been ended
+var ErrSessionRevoked = errors.New("Session has been revoked")
+
+// SplitRefreshToken gets the session ID and secret out of a refresh token
+func SplitRefreshToken(token string) (string, string, error) {
+	sessionID, secret, err := SplitAPIKey(token, "")
+	if err != nil {
+		return "", "", ErrInvalidToken
+	}
+
+	return sessionID, secret, nil
+}
+
+// CheckRefreshToken checks a refresh token secret against its stored session
+func CheckRefreshToken(session entity.Session, secret string) error {
+	if subtle.ConstantTimeCompare([]byte(session.Hash), []byte(helper.Hash(secret, session.ID))) != 1 {
+		return ErrInvalidToken
+	}
+	if session.Revoked {
+		return ErrSessionRevoked
+	}
+	if session.ReplacedBy != "" {
+		return ErrTokenReused
+	}
+	expires, err := time.Parse(time.RFC3339, session.Expires)
+	if err != nil || time.Now().After(expires) {
+		return ErrExpiredToken
+	}
+
+	return nil
+}
+
+// ActiveSessions gets the current session of each login that hasn't been revoked or expired
+func ActiveSessions(sessions []entity.Session) []entity.Session {
+	active := make([]entity.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if session.Revoked || session.ReplacedBy != "" {
+			continue
+		}
+		expires, err := time.Parse(time.RFC3339, session.Expires)
+		if err != nil || time.Now().After(expires) {
+			continue
+		}
+		active = append(active, session)
+	}
+
+	return active
+}
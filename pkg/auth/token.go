@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken if a token is malformed or the signature doesn't match
+var ErrInvalidToken = errors.New("Invalid token")
+
+// ErrExpiredToken if a token is past its expiry
+var ErrExpiredToken = errors.New("Token has expired")
+
+// ErrNoSecret if the token secret is not configured
+var ErrNoSecret = errors.New("TokenSecret is not configured")
+
+// Claims are the signed contents of an access token
+type Claims struct {
+	UserID    string `json:"uid"`
+	Username  string `json:"usr"`
+	Role      string `json:"rol"`
+	SessionID string `json:"sid"`
+	// EnrollOnly tokens are for users who must set up two-factor auth before doing anything else
+	EnrollOnly bool  `json:"enr,omitempty"`
+	Expires    int64 `json:"exp"`
+}
+
+// Identity gets the caller identity from the claims
+func (c Claims) Identity() Identity {
+	return Identity{
+		UserID:     c.UserID,
+		Username:   c.Username,
+		Role:       c.Role,
+		SessionID:  c.SessionID,
+		EnrollOnly: c.EnrollOnly,
+	}
+}
+
+// NewToken signs the claims with the secret
+func NewToken(claims Claims, secret string) (string, error) {
+	return Seal(claims, secret)
+}
+
+// ParseToken checks the signature and expiry of a token and returns its claims
+func ParseToken(token string, secret string) (Claims, error) {
+	var claims Claims
+	err := Open(token, secret, &claims)
+	if err != nil {
+		return Claims{}, err
+	}
+	if time.Now().Unix() > claims.Expires {
+		return Claims{}, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+// Seal encodes a value as JSON and signs it with the secret
+func Seal(value interface{}, secret string) (string, error) {
+	if secret == "" {
+		return "", ErrNoSecret
+	}
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + sign(encoded, secret), nil
+}
+
+// Open checks the signature of a sealed value and decodes it into target
+func Open(sealed string, secret string, target interface{}) error {
+	if secret == "" {
+		return ErrNoSecret
+	}
+	parts := strings.Split(sealed, ".")
+	if len(parts) != 2 {
+		return ErrInvalidToken
+	}
+	if subtle.ConstantTimeCompare([]byte(sign(parts[0], secret)), []byte(parts[1])) != 1 {
+		return ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	err = json.Unmarshal(payload, target)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+func sign(payload string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
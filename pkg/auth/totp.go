@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	helper "github.com/coma-toast/pace-api/pkg/utils"
+)
+
+// TOTP settings. These are the defaults every authenticator app supports.
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// totpSkew is how many periods either side of now a code is accepted for, to allow for clock drift
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret generates a base32 TOTP secret
+func NewTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI gets the otpauth:// provisioning URI authenticator apps use to add an account
+func TOTPURI(issuer string, account string, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(totpDigits))
+	values.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer + ":" + account)
+
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, values.Encode())
+}
+
+// CheckTOTP checks a code against the secret. It returns the time step the
+// code was for, which must be greater than lastCounter so a code can't be replayed.
+func CheckTOTP(secret string, code string, lastCounter int64, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return 0, false
+	}
+
+	counter := now.Unix() / totpPeriod
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		step := counter + offset
+		if step <= lastCounter {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(key, uint64(step), totpDigits)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// hotp is the RFC 4226 HMAC-based one-time password
+func hotp(key []byte, counter uint64, digits int) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%modulo)
+}
+
+// NewRecoveryCodes generates one-time recovery codes, along with the hashes to store
+func NewRecoveryCodes(userID string, count int) ([]string, []string, error) {
+	codes := make([]string, count)
+	hashes := make([]string, count)
+	for i := range codes {
+		random := make([]byte, 5)
+		_, err := rand.Read(random)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(random))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = helper.Hash(codes[i], userID)
+	}
+
+	return codes, hashes, nil
+}
+
+// UseRecoveryCode checks a recovery code and returns the remaining hashes without it
+func UseRecoveryCode(userID string, code string, hashes []string) ([]string, bool) {
+	hash := helper.Hash(strings.ToLower(strings.TrimSpace(code)), userID)
+	for i, stored := range hashes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			remaining := append([]string{}, hashes[:i]...)
+			return append(remaining, hashes[i+1:]...), true
+		}
+	}
+
+	return hashes, false
+}
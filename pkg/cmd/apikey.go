@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/validate"
+	"github.com/rollbar/rollbar-go"
+)
+
+// GetAPIKeyHandler lists all API keys. Admin only.
+func (a App) GetAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can manage API keys", w)
+		return
+	}
+
+	provider, err := a.Container.APIKeyProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting APIKeyProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	allAPIKeys, err := provider.GetAll()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting All API keys: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, allAPIKeys, w)
+}
+
+// CreateAPIKeyHandler creates an API key. The key is only ever returned here. Admin only.
+func (a App) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can manage API keys", w)
+		return
+	}
+
+	var apiKey entity.APIKey
+	err := decodeJSON(r, &apiKey)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when creating an API key: %s", err), r)
+		jsonResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+	err = validate.Struct(apiKey)
+	if err != nil {
+		errorResponse(err, w)
+		return
+	}
+	for _, scope := range apiKey.Scopes {
+		if !auth.ValidScope(scope) {
+			jsonResponse(http.StatusUnprocessableEntity, fmt.Sprintf("Unknown scope %q", scope), w)
+			return
+		}
+	}
+	apiKey.CreatedBy = identity.Username
+
+	provider, err := a.Container.APIKeyProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting APIKeyProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	newAPIKey, key, err := provider.Add(apiKey)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error setting APIKeyProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, entity.CreateAPIKeyResponse{APIKey: newAPIKey, Key: key}, w)
+}
+
+// DeleteAPIKeyHandler revokes an API key. Admin only.
+func (a App) DeleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can manage API keys", w)
+		return
+	}
+
+	var apiKey entity.APIKey
+	err := decodeJSON(r, &apiKey)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when revoking an API key: %s", err), r)
+		jsonResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	provider, err := a.Container.APIKeyProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting APIKeyProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	err = provider.Revoke(apiKey.ID)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error revoking API key: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, fmt.Sprintf("API key %s revoked", apiKey.ID), w)
+}
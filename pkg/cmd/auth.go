@@ -0,0 +1,411 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/provider/apikey"
+	"github.com/coma-toast/pace-api/pkg/provider/session"
+	helper "github.com/coma-toast/pace-api/pkg/utils"
+	"github.com/gorilla/mux"
+	"github.com/rollbar/rollbar-go"
+)
+
+// Token lifetimes used when they are not set in the config
+const (
+	defaultTokenTTL        = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// apiKeyTouchInterval is how often an API key's LastUsed time is updated
+const apiKeyTouchInterval = time.Minute
+
+// publicRoutes can be called without a token
+var publicRoutes = map[string]bool{
+	"/api/ping":          true,
+	"/api/openapi.json":  true,
+	"/api/docs":          true,
+	"/api/login":         true,
+	"/api/token/refresh": true,
+	"/api/oidc/login":    true,
+	"/api/oidc/callback": true,
+	"/healthz":           true,
+	"/readyz":            true,
+	"/metrics":           true,
+}
+
+// tokenSecret gets the access token secret, if there is a config
+func (a App) tokenSecret() string {
+	if a.Config == nil {
+		return ""
+	}
+
+	return a.Config.TokenSecret
+}
+
+// authMiddleware checks the bearer token or API key and puts the caller's identity in the request context
+func (a App) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var path string
+		if route := mux.CurrentRoute(r); route != nil {
+			path = routeTemplate(route)
+			if publicRoutes[path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		header := r.Header.Get("Authorization")
+		identity, err := a.authenticate(header)
+		if err != nil {
+			if strings.HasPrefix(header, "ApiKey ") {
+				rollbar.Warning(fmt.Sprintf("Rejected API key: %s", err), r)
+				err = auth.ErrInvalidAPIKey
+			}
+			jsonResponse(http.StatusUnauthorized, err.Error(), w)
+			return
+		}
+		if identity.EnrollOnly && !enrollRoutes[path] {
+			jsonResponse(http.StatusForbidden, "Two-factor enrollment required, see /api/2fa/enroll", w)
+			return
+		}
+		scope := auth.RequiredScope(r.Method, path)
+		if !identity.HasScope(scope) {
+			jsonResponse(http.StatusForbidden, fmt.Sprintf("API key is missing the %s scope", scope), w)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), identity)))
+	})
+}
+
+// errMissingCredentials is for requests without a bearer token or API key
+var errMissingCredentials = errors.New("Missing bearer token or API key")
+
+// authenticate gets the caller from an Authorization header, either
+// "Bearer <token>" or "ApiKey <key>"
+func (a App) authenticate(header string) (auth.Identity, error) {
+	switch {
+	case strings.HasPrefix(header, "Bearer "):
+		claims, err := auth.ParseToken(strings.TrimPrefix(header, "Bearer "), a.tokenSecret())
+		if err != nil {
+			return auth.Identity{}, err
+		}
+		identity := claims.Identity()
+		err = a.checkSession(identity.SessionID)
+		if err != nil {
+			return auth.Identity{}, err
+		}
+		return identity, nil
+	case strings.HasPrefix(header, "ApiKey "):
+		return a.apiKeyIdentity(strings.TrimPrefix(header, "ApiKey "))
+	}
+
+	return auth.Identity{}, errMissingCredentials
+}
+
+// checkSession makes sure the login an access token belongs to hasn't been revoked
+func (a App) checkSession(sessionID string) error {
+	if sessionID == "" {
+		return auth.ErrInvalidToken
+	}
+
+	provider, err := a.Container.SessionProvider()
+	if err != nil {
+		return err
+	}
+	session, err := provider.GetByID(sessionID)
+	if err != nil || session.Revoked {
+		return auth.ErrSessionRevoked
+	}
+
+	return nil
+}
+
+// apiKeyIdentity looks up an API key and records that it was used
+func (a App) apiKeyIdentity(key string) (auth.Identity, error) {
+	keyID, secret, err := auth.SplitAPIKey(key, apikey.KeyPrefix)
+	if err != nil {
+		return auth.Identity{}, err
+	}
+
+	provider, err := a.Container.APIKeyProvider()
+	if err != nil {
+		return auth.Identity{}, err
+	}
+	apiKey, err := provider.GetByID(keyID)
+	if err != nil {
+		return auth.Identity{}, err
+	}
+	identity, err := auth.CheckAPIKey(apiKey, secret)
+	if err != nil {
+		return auth.Identity{}, err
+	}
+
+	// Scanning stations call the API constantly, so LastUsed is only written
+	// once per apiKeyTouchInterval, and they don't wait on it
+	if !touchDue(apiKey.LastUsed, time.Now()) {
+		return identity, nil
+	}
+	go func() {
+		err := provider.Touch(apiKey.ID)
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error updating last used time of API key %s: %s", apiKey.ID, err))
+		}
+	}()
+
+	return identity, nil
+}
+
+// touchDue is true if an API key last used at lastUsed should be touched again
+func touchDue(lastUsed string, now time.Time) bool {
+	used, err := time.Parse(time.RFC3339, lastUsed)
+
+	return err != nil || now.Sub(used) >= apiKeyTouchInterval
+}
+
+// scope loads the project memberships of the caller
+func (a App) scope(r *http.Request) (auth.Scope, error) {
+	return a.contextScope(r.Context())
+}
+
+// contextScope loads the project memberships of the caller in ctx
+func (a App) contextScope(ctx context.Context) (auth.Scope, error) {
+	identity, _ := auth.FromContext(ctx)
+	if identity.IsAdmin() || identity.IsAPIKey() {
+		return auth.NewScope(identity, nil), nil
+	}
+
+	provider, err := a.Container.MembershipProvider()
+	if err != nil {
+		return auth.Scope{}, err
+	}
+	memberships, err := provider.GetByUser(identity.UserID)
+	if err != nil {
+		return auth.Scope{}, err
+	}
+
+	return auth.NewScope(identity, memberships), nil
+}
+
+// LoginHandler exchanges a username and password for an access and refresh token
+func (a App) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	var login entity.LoginRequest
+	err := decodeJSON(r, &login)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when logging in: %s", err), r)
+		jsonResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	ip := a.clientIP(r)
+	keys := loginKeys(login.Username, ip)
+	wait, err := a.lockedFor(keys)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error checking login lockout for %s: %s", login.Username, err), r)
+		errorResponse(err, w)
+		return
+	}
+	if wait > 0 {
+		tooManyLogins(wait, w)
+		return
+	}
+
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting UserProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	user, err := provider.GetByUsername(login.Username)
+	if err != nil || subtle.ConstantTimeCompare([]byte(user.Password), []byte(helper.Hash(login.Password, user.ID))) != 1 {
+		rollbar.Info(fmt.Sprintf("Failed login for %s from %s", login.Username, ip), r)
+		err = a.recordFailedLogin(keys, ip)
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error recording failed login for %s: %s", login.Username, err), r)
+		}
+		jsonResponse(http.StatusUnauthorized, "Invalid username or password", w)
+		return
+	}
+
+	if user.TOTPEnabled {
+		err = a.checkSecondFactor(user, login.Code, login.RecoveryCode)
+		if err == errTwoFactorInvalid {
+			recordErr := a.recordFailedLogin(keys, ip)
+			if recordErr != nil {
+				rollbar.Warning(fmt.Sprintf("Error recording failed login for %s: %s", login.Username, recordErr), r)
+			}
+		}
+		if err == errTwoFactorRequired || err == errTwoFactorInvalid {
+			jsonResponse(http.StatusUnauthorized, err.Error(), w)
+			return
+		}
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error checking two-factor code for %s: %s", login.Username, err), r)
+			errorResponse(err, w)
+			return
+		}
+	}
+
+	attemptProvider, err := a.Container.LoginAttemptProvider()
+	if err == nil {
+		err = attemptProvider.Reset(keys[0])
+	}
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error clearing failed logins for %s: %s", login.Username, err), r)
+	}
+
+	sessionProvider, err := a.Container.SessionProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting SessionProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	session, refreshToken, err := sessionProvider.Add(entity.Session{
+		UserID:    user.ID,
+		Expires:   a.refreshExpiry().Format(time.RFC3339),
+		UserAgent: r.UserAgent(),
+		IP:        ip,
+	})
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error starting session for %s: %s", user.Username, err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	a.tokenResponse(w, r, user, session, refreshToken)
+}
+
+// RefreshHandler rotates a refresh token, returning a new access and refresh token
+func (a App) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var refresh entity.RefreshRequest
+	err := decodeJSON(r, &refresh)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when refreshing a token: %s", err), r)
+		jsonResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	sessionID, secret, err := auth.SplitRefreshToken(refresh.RefreshToken)
+	if err != nil {
+		jsonResponse(http.StatusUnauthorized, err.Error(), w)
+		return
+	}
+
+	sessionProvider, err := a.Container.SessionProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting SessionProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	session, err := sessionProvider.GetByID(sessionID)
+	if err != nil {
+		jsonResponse(http.StatusUnauthorized, auth.ErrInvalidToken.Error(), w)
+		return
+	}
+
+	err = auth.CheckRefreshToken(session, secret)
+	if err != nil {
+		refuseRefresh(w, r, sessionProvider, session, err)
+		return
+	}
+
+	userProvider, err := a.Container.UserProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting UserProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	user, err := userProvider.GetByID(session.UserID)
+	if err != nil {
+		jsonResponse(http.StatusUnauthorized, err.Error(), w)
+		return
+	}
+
+	newSession, refreshToken, err := sessionProvider.Rotate(session, a.refreshExpiry().Format(time.RFC3339))
+	if err == auth.ErrTokenReused || err == auth.ErrSessionRevoked {
+		refuseRefresh(w, r, sessionProvider, session, err)
+		return
+	}
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error rotating session %s: %s", session.ID, err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	a.tokenResponse(w, r, user, newSession, refreshToken)
+}
+
+// refuseRefresh turns down a refresh token. A token that was already used
+// revokes its whole session family, since it may have been stolen.
+func refuseRefresh(w http.ResponseWriter, r *http.Request, provider session.Provider, refused entity.Session, err error) {
+	if err == auth.ErrTokenReused {
+		rollbar.Warning(fmt.Sprintf("Refresh token reuse for user %s, revoking session family %s", refused.UserID, refused.FamilyID), r)
+		revokeErr := provider.RevokeFamily(refused.FamilyID)
+		if revokeErr != nil {
+			rollbar.Error(fmt.Sprintf("Error revoking session family %s: %s", refused.FamilyID, revokeErr), r)
+		}
+	}
+
+	jsonResponse(http.StatusUnauthorized, err.Error(), w)
+}
+
+// tokenResponse sends a new access token for the session along with its refresh token
+func (a App) tokenResponse(w http.ResponseWriter, r *http.Request, user entity.User, session entity.Session, refreshToken string) {
+	enrollOnly, err := a.twoFactorEnrollmentRequired(user)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting two-factor policy: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	ttl := defaultTokenTTL
+	if a.Config != nil && a.Config.TokenTTL > 0 {
+		ttl = a.Config.TokenTTL
+	}
+	expires := time.Now().Add(ttl)
+	token, err := auth.NewToken(auth.Claims{
+		UserID:     user.ID,
+		Username:   user.Username,
+		Role:       user.Role,
+		SessionID:  session.ID,
+		EnrollOnly: enrollOnly,
+		Expires:    expires.Unix(),
+	}, a.tokenSecret())
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error creating token for %s: %s", user.Username, err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, entity.LoginResponse{
+		Token:          token,
+		Expires:        expires.Format(time.RFC3339),
+		RefreshToken:   refreshToken,
+		RefreshExpires: session.Expires,
+		User:           user,
+
+		TwoFactorEnrollmentRequired: enrollOnly,
+	}, w)
+}
+
+// refreshExpiry is when a refresh token issued now expires
+func (a App) refreshExpiry() time.Time {
+	ttl := defaultRefreshTokenTTL
+	if a.Config != nil && a.Config.RefreshTokenTTL > 0 {
+		ttl = a.Config.RefreshTokenTTL
+	}
+
+	return time.Now().Add(ttl)
+}
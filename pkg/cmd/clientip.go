@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP gets the address of the caller. X-Forwarded-For is only believed
+// when the request came through one of the configured TrustedProxies.
+func (a App) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !a.trustedProxy(ip) {
+		return ip
+	}
+
+	// Each proxy appends the address it got the request from, so walk back
+	// from the end until we leave our own proxies.
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !a.trustedProxy(hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// trustedProxy reports whether an IP matches one of the TrustedProxies
+func (a App) trustedProxy(ip string) bool {
+	if a.Config == nil {
+		return false
+	}
+
+	return ipIn(ip, a.Config.TrustedProxies)
+}
+
+// ipIn reports whether an IP matches one of a list of IPs and CIDRs
+func ipIn(ip string, networks []string) bool {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return false
+	}
+
+	for _, allowed := range networks {
+		if strings.Contains(allowed, "/") {
+			_, network, err := net.ParseCIDR(allowed)
+			if err == nil && network.Contains(parsedIP) {
+				return true
+			}
+		} else if parsedIP.Equal(net.ParseIP(allowed)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,26 +1,48 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"cloud.google.com/go/firestore"
+	"github.com/coma-toast/pace-api/pkg/apiversion"
+	"github.com/coma-toast/pace-api/pkg/apiversion/v1"
+	"github.com/coma-toast/pace-api/pkg/apiversion/v2"
 	"github.com/coma-toast/pace-api/pkg/container"
-	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/health"
+	"github.com/coma-toast/pace-api/pkg/oidc"
 	"github.com/coma-toast/pace-api/pkg/paceconfig"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/ratelimit"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/rollbar/rollbar-go"
+	"google.golang.org/grpc"
 )
 
 // App is the app container
 type App struct {
 	Config    *paceconfig.Config
 	Container container.Container
+	// OIDC is the single sign-on identity provider, nil when it isn't configured
+	OIDC *oidc.Provider
+	// Limiter rate limits clients, nil when there are no limits
+	Limiter *ratelimit.Limiter
+	// IPLimiter rate limits client IPs before they are authenticated, nil when there are no limits
+	IPLimiter *ratelimit.Limiter
+	// VersionUsage counts calls per API version and client, nil to not count them
+	VersionUsage *apiversion.Usage
+	// Health runs the readiness checks, nil to report ready without any
+	Health *health.Checker
 }
 
 // TODO: look at Aaron's hub repo to see how to do the providers/connections.
@@ -52,701 +74,205 @@ func Run() {
 	rollbar.Info("PACE-API starting up...")
 	rollbar.Wait()
 
+	app.Config = conf
 	app.Container = container.NewProduction(conf)
+	app.Limiter = newLimiter(conf.RateLimits)
+	app.IPLimiter = newLimiter(conf.IPRateLimits)
+	app.VersionUsage = apiversion.NewUsage()
+	app.Health = app.newHealthChecker()
 
-	log.Fatal(http.ListenAndServe(":8001", app.getHandlers()))
+	app.OIDC, err = app.newOIDCProvider(context.Background())
+	if err != nil {
+		log.Fatalf("Error setting up single sign-on: %s", err)
+	}
+
+	// Background workers run until shutdown
+	workerContext, stopWorkers := context.WithCancel(context.Background())
+	workers := &sync.WaitGroup{}
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		// Sends queued webhook deliveries, retrying failed ones
+		app.Container.WebhookDispatcher().Run(workerContext)
+	}()
+
+	var grpcServer *grpc.Server
+	if conf.GRPCAddress != "" {
+		listener, err := net.Listen("tcp", conf.GRPCAddress)
+		if err != nil {
+			log.Fatalf("Error listening for gRPC: %s", err)
+		}
+		grpcServer = app.newGRPCServer()
+		go func() {
+			err := grpcServer.Serve(listener)
+			if err != nil {
+				log.Fatalf("Error serving gRPC: %s", err)
+			}
+		}()
+	}
+
+	server := app.newHTTPServer()
+	serveErrors := make(chan error, 1)
+	go func() {
+		serveErrors <- app.listenAndServe(server)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-serveErrors:
+		log.Fatalf("Error serving HTTP: %s", err)
+	case received := <-signals:
+		rollbar.Info(fmt.Sprintf("PACE-API got %s, shutting down...", received))
+	}
+	app.shutdown(server, grpcServer, stopWorkers, workers)
 }
 
 func (a App) getHandlers() http.Handler {
 	r := mux.NewRouter()
-	// r.Use(authMiddle)
-	// r.Handle("/api", authMiddle(blaHandler)).Methods(http.)
-	// r.Methods("GET", "POST")
-	r.HandleFunc("/api/ping", PingHandler)
-	r.HandleFunc("/api/user", a.GetUserHandler).Methods("GET")
-	r.HandleFunc("/api/user", a.UpdateUserHandler).Methods("POST")
-	r.HandleFunc("/api/user", a.CreateUserHandler).Methods("PUT")
-	r.HandleFunc("/api/user", a.DeleteUserHandler).Methods("DELETE")
-	// TODO:  r.HandleFunc("/api/password", a.PasswordHandler).Methods("POST")
-	r.HandleFunc("/api/contact", a.GetContactHandler).Methods("GET")
-	r.HandleFunc("/api/contact", a.UpdateContactHandler).Methods("POST")
-	r.HandleFunc("/api/contact", a.CreateContactHandler).Methods("PUT")
-	r.HandleFunc("/api/contact", a.DeleteContactHandler).Methods("DELETE")
-	r.HandleFunc("/api/company", a.GetCompanyHandler).Methods("GET")
-	r.HandleFunc("/api/company", a.UpdateCompanyHandler).Methods("POST")
-	r.HandleFunc("/api/company", a.CreateCompanyHandler).Methods("PUT")
-	r.HandleFunc("/api/company", a.DeleteCompanyHandler).Methods("DELETE")
-	r.HandleFunc("/api/project", a.GetProjectHandler).Methods("GET")
-	r.HandleFunc("/api/project", a.UpdateProjectHandler).Methods("POST")
-	r.HandleFunc("/api/project", a.CreateProjectHandler).Methods("PUT")
-	r.HandleFunc("/api/project", a.DeleteProjectHandler).Methods("DELETE")
-	r.HandleFunc("/api/inventory", a.GetInventoryHandler).Methods("GET")
-	r.HandleFunc("/api/inventory", a.UpdateInventoryHandler).Methods("POST")
-	r.HandleFunc("/api/inventory", a.CreateInventoryHandler).Methods("PUT")
-	r.HandleFunc("/api/inventory", a.DeleteInventoryHandler).Methods("DELETE")
-	r.HandleFunc("/api/inspection", a.GetInspectionHandler).Methods("GET")
-	r.HandleFunc("/api/inspection", a.UpdateInspectionHandler).Methods("POST")
-	r.HandleFunc("/api/inspection", a.CreateInspectionHandler).Methods("PUT")
-	r.HandleFunc("/api/inspection", a.DeleteInspectionHandler).Methods("DELETE")
+	r.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	r.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
+	r.Use(a.ipRateLimitMiddleware)
+	r.Use(a.authMiddleware)
+	r.Use(a.rateLimitMiddleware)
+	r.Use(a.idempotencyMiddleware)
+	r.Use(conditionalMiddleware)
+	// Probes for systemd, uptime checks and load balancers, outside the API versions
+	r.HandleFunc("/healthz", a.LivenessHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/readyz", a.ReadinessHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/metrics", a.MetricsHandler).Methods("GET")
+	for _, version := range []*apiversion.Version{v1.Version, v2.Version} {
+		versionRouter := r.PathPrefix("/api/" + version.Name).Subrouter()
+		versionRouter.Use(a.versionMiddleware(version, v2.Version))
+		a.addRoutes(versionRouter, version == v1.Version)
+	}
+	// Unversioned routes are v1, for clients from before there were versions
+	unversionedRouter := r.PathPrefix("/api").Subrouter()
+	unversionedRouter.Use(a.versionMiddleware(v1.Version, v2.Version))
+	a.addRoutes(unversionedRouter, true)
 
 	// r.Use(loggingMiddleware)
 	// Gorilla Mux's logging handler.
-	loggedRouter := handlers.LoggingHandler(os.Stdout, r)
+	loggedRouter := handlers.LoggingHandler(os.Stdout, metricsMiddleware(r, a.corsHandler(a.securityMiddleware(compressMiddleware(requestIDMiddleware(r))))))
 
 	return loggedRouter
 }
 
-// TODO: auth middleware
+// addRoutes adds the routes of an API version to its sub-router. flatRoutes
+// adds the deprecated flat routes, which are only in v1.
+func (a App) addRoutes(r *mux.Router, flatRoutes bool) {
+	r.HandleFunc("/ping", a.PingHandler)
+	r.HandleFunc("/openapi.json", a.OpenAPIHandler(r)).Methods("GET")
+	r.HandleFunc("/docs", a.DocsHandler).Methods("GET")
+	r.HandleFunc("/versions", a.GetAPIVersionUsageHandler).Methods("GET")
+	r.HandleFunc("/login", a.LoginHandler).Methods("POST")
+	r.HandleFunc("/login/unlock", a.UnlockLoginHandler).Methods("POST")
+	r.HandleFunc("/login/lockouts", a.GetLockoutEventsHandler).Methods("GET")
+	r.HandleFunc("/oidc/login", a.OIDCLoginHandler).Methods("GET")
+	r.HandleFunc("/oidc/callback", a.OIDCCallbackHandler).Methods("GET")
+	r.HandleFunc("/token/refresh", a.RefreshHandler).Methods("POST")
+	r.HandleFunc("/session", a.GetSessionHandler).Methods("GET")
+	r.HandleFunc("/session", a.DeleteSessionHandler).Methods("DELETE")
+	r.HandleFunc("/2fa", a.DisableTwoFactorHandler).Methods("DELETE")
+	r.HandleFunc("/2fa/enroll", a.EnrollTwoFactorHandler).Methods("POST")
+	r.HandleFunc("/2fa/confirm", a.ConfirmTwoFactorHandler).Methods("POST")
+	r.HandleFunc("/2fa/policy", a.GetTwoFactorPolicyHandler).Methods("GET")
+	r.HandleFunc("/2fa/policy", a.UpdateTwoFactorPolicyHandler).Methods("POST")
+	r.HandleFunc("/users", a.GetUserHandler).Methods("GET")
+	r.HandleFunc("/users", a.CreateUserHandler).Methods("POST")
+	r.HandleFunc("/users/{id}", a.GetUserByIDHandler).Methods("GET")
+	r.HandleFunc("/users/{id}", a.UpdateUserByIDHandler).Methods("PUT", "PATCH")
+	r.HandleFunc("/users/{id}", a.DeleteUserByIDHandler).Methods("DELETE")
+	r.HandleFunc("/contacts", a.GetContactHandler).Methods("GET")
+	r.HandleFunc("/contacts", a.CreateContactHandler).Methods("POST")
+	r.HandleFunc("/contacts/{id}", a.GetContactByIDHandler).Methods("GET")
+	r.HandleFunc("/contacts/{id}", a.UpdateContactByIDHandler).Methods("PUT", "PATCH")
+	r.HandleFunc("/contacts/{id}", a.DeleteContactByIDHandler).Methods("DELETE")
+	r.HandleFunc("/companies", a.GetCompanyHandler).Methods("GET")
+	r.HandleFunc("/companies", a.CreateCompanyHandler).Methods("POST")
+	r.HandleFunc("/companies/{id}", a.GetCompanyByIDHandler).Methods("GET")
+	r.HandleFunc("/companies/{id}", a.UpdateCompanyByIDHandler).Methods("PUT", "PATCH")
+	r.HandleFunc("/companies/{id}", a.DeleteCompanyByIDHandler).Methods("DELETE")
+	r.HandleFunc("/projects", a.GetProjectHandler).Methods("GET")
+	r.HandleFunc("/projects", a.CreateProjectHandler).Methods("POST")
+	r.HandleFunc("/projects/{id}", a.GetProjectByIDHandler).Methods("GET")
+	r.HandleFunc("/projects/{id}", a.UpdateProjectByIDHandler).Methods("PUT", "PATCH")
+	r.HandleFunc("/projects/{id}", a.DeleteProjectByIDHandler).Methods("DELETE")
+	r.HandleFunc("/inventory/{id}", a.GetInventoryByIDHandler).Methods("GET")
+	r.HandleFunc("/inventory/{id}", a.UpdateInventoryByIDHandler).Methods("PUT", "PATCH")
+	r.HandleFunc("/inventory/{id}", a.DeleteInventoryByIDHandler).Methods("DELETE")
+	r.HandleFunc("/inspections", a.GetInspectionHandler).Methods("GET")
+	r.HandleFunc("/inspections", a.CreateInspectionHandler).Methods("POST")
+	r.HandleFunc("/inspections/{id}", a.GetInspectionByIDHandler).Methods("GET")
+	r.HandleFunc("/inspections/{id}", a.UpdateInspectionByIDHandler).Methods("PUT", "PATCH")
+	r.HandleFunc("/inspections/{id}", a.DeleteInspectionByIDHandler).Methods("DELETE")
+	r.HandleFunc("/inventory", a.GetInventoryHandler).Methods("GET")
+	r.HandleFunc("/inventory", a.CreateInventoryHandler).Methods("POST")
+	r.HandleFunc("/membership", a.GetMembershipHandler).Methods("GET")
+	r.HandleFunc("/membership", a.UpdateMembershipHandler).Methods("POST")
+	r.HandleFunc("/membership", a.CreateMembershipHandler).Methods("PUT")
+	r.HandleFunc("/membership", a.DeleteMembershipHandler).Methods("DELETE")
+	r.HandleFunc("/apikey", a.GetAPIKeyHandler).Methods("GET")
+	r.HandleFunc("/apikey", a.CreateAPIKeyHandler).Methods("PUT")
+	r.HandleFunc("/apikey", a.DeleteAPIKeyHandler).Methods("DELETE")
+	r.HandleFunc("/graphql", a.GraphQLHandler).Methods("GET", "POST")
+	r.HandleFunc("/graphql/schema", a.GraphQLSchemaHandler).Methods("GET")
+	r.HandleFunc("/sync", a.SyncHandler).Methods("GET")
+	r.HandleFunc("/sync/mutations", a.UploadMutationsHandler).Methods("POST")
+	r.HandleFunc("/search", a.SearchHandler).Methods("GET")
+	r.HandleFunc("/webhooks", a.GetWebhookHandler).Methods("GET")
+	r.HandleFunc("/webhooks", a.CreateWebhookHandler).Methods("POST")
+	r.HandleFunc("/webhooks/{id}", a.GetWebhookByIDHandler).Methods("GET")
+	r.HandleFunc("/webhooks/{id}", a.UpdateWebhookByIDHandler).Methods("PUT", "PATCH")
+	r.HandleFunc("/webhooks/{id}", a.DeleteWebhookByIDHandler).Methods("DELETE")
+	r.HandleFunc("/webhooks/{id}/deliveries", a.GetWebhookDeliveriesHandler).Methods("GET")
+	r.HandleFunc("/webhooks/{id}/deliveries/{deliveryID}/redeliver", a.RedeliverWebhookHandler).Methods("POST")
+
+	if !flatRoutes {
+		return
+	}
+	// Deprecated flat routes, kept for older clients
+	r.HandleFunc("/user", deprecated("/api/users", a.GetUserHandler)).Methods("GET")
+	r.HandleFunc("/user", deprecated("/api/users/{id}", a.UpdateUserHandler)).Methods("POST")
+	r.HandleFunc("/user", deprecated("/api/users", a.CreateUserHandler)).Methods("PUT")
+	r.HandleFunc("/user", deprecated("/api/users/{id}", a.DeleteUserHandler)).Methods("DELETE")
+	// TODO:  r.HandleFunc("/password", a.PasswordHandler).Methods("POST")
+	r.HandleFunc("/contact", deprecated("/api/contacts", a.GetContactHandler)).Methods("GET")
+	r.HandleFunc("/contact", deprecated("/api/contacts/{id}", a.UpdateContactHandler)).Methods("POST")
+	r.HandleFunc("/contact", deprecated("/api/contacts", a.CreateContactHandler)).Methods("PUT")
+	r.HandleFunc("/contact", deprecated("/api/contacts/{id}", a.DeleteContactHandler)).Methods("DELETE")
+	r.HandleFunc("/company", deprecated("/api/companies", a.GetCompanyHandler)).Methods("GET")
+	r.HandleFunc("/company", deprecated("/api/companies/{id}", a.UpdateCompanyHandler)).Methods("POST")
+	r.HandleFunc("/company", deprecated("/api/companies", a.CreateCompanyHandler)).Methods("PUT")
+	r.HandleFunc("/company", deprecated("/api/companies/{id}", a.DeleteCompanyHandler)).Methods("DELETE")
+	r.HandleFunc("/project", deprecated("/api/projects", a.GetProjectHandler)).Methods("GET")
+	r.HandleFunc("/project", deprecated("/api/projects/{id}", a.UpdateProjectHandler)).Methods("POST")
+	r.HandleFunc("/project", deprecated("/api/projects", a.CreateProjectHandler)).Methods("PUT")
+	r.HandleFunc("/project", deprecated("/api/projects/{id}", a.DeleteProjectHandler)).Methods("DELETE")
+	r.HandleFunc("/inventory", deprecated("/api/inventory", a.CreateInventoryHandler)).Methods("PUT")
+	r.HandleFunc("/inventory", deprecated("/api/inventory/{id}", a.DeleteInventoryHandler)).Methods("DELETE")
+	r.HandleFunc("/inspection", deprecated("/api/inspections", a.GetInspectionHandler)).Methods("GET")
+	r.HandleFunc("/inspection", deprecated("/api/inspections/{id}", a.UpdateInspectionHandler)).Methods("POST")
+	r.HandleFunc("/inspection", deprecated("/api/inspections", a.CreateInspectionHandler)).Methods("PUT")
+	r.HandleFunc("/inspection", deprecated("/api/inspections/{id}", a.DeleteInspectionHandler)).Methods("DELETE")
+}
 
 // PingHandler is just a quick test to ensure api calls are working.
-func PingHandler(w http.ResponseWriter, r *http.Request) {
+func (a App) PingHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	// Dev code alert
 	rollbar.Info(
-		fmt.Sprintf("Ping test sent from %s", r.Header.Get("X-FORWARDED-FOR")), r)
+		fmt.Sprintf("Ping test sent from %s", a.clientIP(r)), r)
 	data := "Pong"
 	jsonResponse(http.StatusOK, data, w)
 }
 
-// GetUserHandler handles api calls for User
-func (a App) GetUserHandler(w http.ResponseWriter, r *http.Request) {
-	userName := r.URL.Query().Get("username")
-	provider, err := a.Container.UserProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting UserProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err, w)
-		return
-	}
-	if userName == "" {
-		allUsers, err := provider.GetAll()
-		if err != nil {
-			rollbar.Warning(fmt.Sprintf("Error getting All Users: %s", err), r)
-			jsonResponse(http.StatusInternalServerError, err, w)
-			return
-		}
-		jsonResponse(http.StatusOK, allUsers, w)
-	} else {
-		user, err := provider.GetByUsername(userName)
-		if err != nil {
-			rollbar.Warning(fmt.Sprintf("Error getting User: %s", err), r)
-			jsonResponse(http.StatusInternalServerError, err, w)
-			return
-		}
-		jsonResponse(http.StatusOK, user, w)
-	}
-}
-
-// UpdateUserHandler handles api calls for User
-func (a App) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
-	var user entity.UpdateUserRequest
-	err := json.NewDecoder(r.Body).Decode(&user)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when updating a User: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err, w)
-		return
-	}
-
-	provider, err := a.Container.UserProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting UserProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err, w)
-		return
-	}
-
-	updatedUser, err := provider.Update(user)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error setting UserProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err, w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, updatedUser, w)
-}
-
-// CreateUserHandler adds a new user
-func (a App) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
-	var user entity.User
-	err := json.NewDecoder(r.Body).Decode(&user)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when updating a User: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	provider, err := a.Container.UserProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting UserProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	updatedUser, err := provider.Add(user)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error setting UserProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, updatedUser, w)
-}
-
-// DeleteUserHandler deletes an existing user
-func (a App) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
-	var user entity.User
-	err := json.NewDecoder(r.Body).Decode(&user)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when updating a User: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	provider, err := a.Container.UserProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting UserProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	err = provider.Delete(user)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error deleting User: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, fmt.Sprintf("User %s Deleted", user.Username), w)
-}
-
-// GetContactHandler handles api calls for contacts
-func (a App) GetContactHandler(w http.ResponseWriter, r *http.Request) {
-	provider, err := a.Container.ContactProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting ContactProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err, w)
-	}
-	allContacts, err := provider.GetAll()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting All Contacts: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err, w)
-		return
-	}
-	jsonResponse(http.StatusOK, allContacts, w)
-}
-
-// UpdateContactHandler handles api calls for contacts
-func (a App) UpdateContactHandler(w http.ResponseWriter, r *http.Request) {
-	var contact entity.Contact
-	provider, err := a.Container.ContactProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting ContactProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err, w)
-	}
-
-	err = json.NewDecoder(r.Body).Decode(&contact)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when updating a User: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	updatedUser, err := provider.Update(contact)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error setting ContactProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, updatedUser, w)
-}
-
-// CreateContactHandler handles api calls for contacts
-func (a App) CreateContactHandler(w http.ResponseWriter, r *http.Request) {
-	var contact entity.Contact
-	provider, err := a.Container.ContactProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting ContactProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err, w)
-	}
-
-	err = json.NewDecoder(r.Body).Decode(&contact)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when creating a Contact: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	updatedContact, err := provider.Add(contact)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error setting ContactProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, updatedContact, w)
-}
-
-// DeleteContactHandler handles api calls for contacts
-func (a App) DeleteContactHandler(w http.ResponseWriter, r *http.Request) {
-	var contact entity.Contact
-	err := json.NewDecoder(r.Body).Decode(&contact)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when updating a contact: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	provider, err := a.Container.ContactProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting contactProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	err = provider.Delete(contact)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error deleting contact: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, fmt.Sprintf("contact %s %s  Deleted", contact.FirstName, contact.LastName), w)
-}
-
-//GetCompanyHandler handles api calls for Company
-func (a App) GetCompanyHandler(w http.ResponseWriter, r *http.Request) {
-	provider, err := a.Container.CompanyProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting CompanyProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err, w)
-		return
-	}
-	allCompanies, err := provider.GetAll()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting All Companies: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err, w)
-		return
-	}
-	jsonResponse(http.StatusOK, allCompanies, w)
-}
-
-//UpdateCompanyHandler handles api calls for Company
-func (a App) UpdateCompanyHandler(w http.ResponseWriter, r *http.Request) {
-	var company entity.Company
-	provider, err := a.Container.CompanyProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting CompanyProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err, w)
-		return
-	}
-
-	err = json.NewDecoder(r.Body).Decode(&company)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when updating a Company: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	updatedUser, err := provider.Update(company)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error setting CompanyProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, updatedUser, w)
-}
-
-//CreateCompanyHandler handles api calls for Company
-func (a App) CreateCompanyHandler(w http.ResponseWriter, r *http.Request) {
-	var company entity.Company
-	provider, err := a.Container.CompanyProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting CompanyProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err, w)
-		return
-	}
-
-	err = json.NewDecoder(r.Body).Decode(&company)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when creating a Company: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	updatedUser, err := provider.Add(company)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error setting CompanyProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, updatedUser, w)
-}
-
-//DeleteCompanyHandler handles api calls for Company
-func (a App) DeleteCompanyHandler(w http.ResponseWriter, r *http.Request) {
-	var company entity.Company
-	provider, err := a.Container.CompanyProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting CompanyProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err, w)
-		return
-	}
-
-	err = json.NewDecoder(r.Body).Decode(&company)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when deleting a Company: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	err = provider.Delete(company)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error deleting company: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, fmt.Sprintf("company %s Deleted", company.Name), w)
-}
-
-// GetProjectHandler handles api calls for User
-func (a App) GetProjectHandler(w http.ResponseWriter, r *http.Request) {
-	projectName := r.URL.Query().Get("name")
-	provider, err := a.Container.ProjectProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting ProjectProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err, w)
-		return
-	}
-	if projectName == "" {
-		fmt.Println("No name provided")
-		allProjects, err := provider.GetAll()
-		if err != nil {
-			rollbar.Warning(fmt.Sprintf("Error getting All Projects: %s", err), r)
-			jsonResponse(http.StatusInternalServerError, err, w)
-			return
-		}
-		jsonResponse(http.StatusOK, allProjects, w)
-	} else {
-		user, err := provider.GetByName(projectName)
-		if err != nil {
-			rollbar.Warning(fmt.Sprintf("Error getting Project: %s", err), r)
-			jsonResponse(http.StatusInternalServerError, err, w)
-			return
-		}
-		jsonResponse(http.StatusOK, user, w)
-	}
-}
-
-// UpdateProjectHandler handles api calls for Project
-// TODO: search by project name or by ID. Otherwise you can't update the project name
-func (a App) UpdateProjectHandler(w http.ResponseWriter, r *http.Request) {
-	var project entity.UpdateProjectRequest
-	err := json.NewDecoder(r.Body).Decode(&project)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when updating a Project: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	provider, err := a.Container.ProjectProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting ProjectProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	updatedProject, err := provider.Update(project)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error setting ProjectProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, updatedProject, w)
-}
-
-// CreateProjectHandler adds a new user
-func (a App) CreateProjectHandler(w http.ResponseWriter, r *http.Request) {
-	var user entity.Project
-	err := json.NewDecoder(r.Body).Decode(&user)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when updating a Project: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	provider, err := a.Container.ProjectProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting ProjectProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	updatedProject, err := provider.Add(user)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error setting ProjectProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, updatedProject, w)
-}
-
-// DeleteProjectHandler deletes an existing user
-func (a App) DeleteProjectHandler(w http.ResponseWriter, r *http.Request) {
-	var project entity.Project
-	err := json.NewDecoder(r.Body).Decode(&project)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when updating a Project: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	provider, err := a.Container.ProjectProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error getting ProjectProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	err = provider.Delete(project)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error deleting Project: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, fmt.Sprintf("Project %s Deleted", project.Name), w)
-}
-
-// GetInventoryHandler Gets Inventory
-func (a App) GetInventoryHandler(w http.ResponseWriter, r *http.Request) {
-	var inventory entity.Inventory
-	inventoryID := r.URL.Query().Get("id")
-
-	provider, err := a.Container.InventoryProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when getting InventoryProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	if inventoryID == "" {
-		allInventory, err := provider.GetAll()
-		if err != nil {
-			rollbar.Warning(fmt.Sprintf("Error getting All Inventory: %s", err), r)
-			jsonResponse(http.StatusInternalServerError, err, w)
-			return
-		}
-		jsonResponse(http.StatusOK, allInventory, w)
-	} else {
-		inventory, err = provider.GetByID(inventory.ID)
-		if err != nil {
-			rollbar.Warning(fmt.Sprintf("Error getting Inventory %s: %s", inventory.ID, err), r)
-			jsonResponse(http.StatusInternalServerError, err.Error(), w)
-			return
-
-		}
-		jsonResponse(http.StatusOK, inventory, w)
-	}
-}
-
-// UpdateInventoryHandler Updates Inventory
-func (a App) UpdateInventoryHandler(w http.ResponseWriter, r *http.Request) {
-	var inventoryRequest entity.UpdateInventoryRequest
-	err := json.NewDecoder(r.Body).Decode(&inventoryRequest)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when getting Inventory: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	provider, err := a.Container.InventoryProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when getting InventoryProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	inventoryData, err := provider.Update(inventoryRequest)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error updating Inventory: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, inventoryData, w)
-}
-
-// CreateInventoryHandler Creates Inventory
-func (a App) CreateInventoryHandler(w http.ResponseWriter, r *http.Request) {
-	var inventoryRequest entity.Inventory
-	err := json.NewDecoder(r.Body).Decode(&inventoryRequest)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when getting Inventory: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	provider, err := a.Container.InventoryProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when getting InventoryProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	inventoryData, err := provider.Add(inventoryRequest)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error adding Inventory item: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, inventoryData, w)
-}
-
-// DeleteInventoryHandler Deletes Inventory
-func (a App) DeleteInventoryHandler(w http.ResponseWriter, r *http.Request) {
-	var inventoryRequest entity.Inventory
-	err := json.NewDecoder(r.Body).Decode(&inventoryRequest)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when Inventory: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	provider, err := a.Container.InventoryProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when getting InventoryProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	err = provider.Delete(inventoryRequest)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error deleting Inventory: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, fmt.Sprintf("Inventory item %s deleted", inventoryRequest.ID), w)
-}
-
-// GetInspectionHandler Gets Inspections
-func (a App) GetInspectionHandler(w http.ResponseWriter, r *http.Request) {
-	inspectionID := r.URL.Query().Get("id")
-
-	provider, err := a.Container.InspectionProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when getting InspectionProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	if inspectionID == "" {
-		allInspections, err := provider.GetAll()
-		if err != nil {
-			rollbar.Warning(fmt.Sprintf("Error Getting All Inspections: %s", err), r)
-			jsonResponse(http.StatusInternalServerError, err, w)
-			return
-		}
-		jsonResponse(http.StatusOK, allInspections, w)
-	} else {
-		inspection, err := provider.GetByID(inspectionID)
-		if err != nil {
-			rollbar.Warning(fmt.Sprintf("Error getting Inspection %s: %s", inspection.ID, err), r)
-			jsonResponse(http.StatusInternalServerError, err.Error(), w)
-			return
-
-		}
-		jsonResponse(http.StatusOK, inspection, w)
-	}
-}
-
-// UpdateInspectionHandler Updates Inspection
-func (a App) UpdateInspectionHandler(w http.ResponseWriter, r *http.Request) {
-	var inspectionRequest entity.UpdateInspectionRequest
-	err := json.NewDecoder(r.Body).Decode(&inspectionRequest)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when Inspection: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	provider, err := a.Container.InspectionProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when getting InspectionProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	updatedInspection, err := provider.Update(inspectionRequest)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error Inspection: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, updatedInspection, w)
-}
-
-// CreateInspectionHandler Creates Inspection
-func (a App) CreateInspectionHandler(w http.ResponseWriter, r *http.Request) {
-	var inspection entity.UpdateInspectionRequest
-	err := json.NewDecoder(r.Body).Decode(&inspection)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when updating Inspection: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	provider, err := a.Container.InspectionProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when getting InspectionProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	newInspection, err := provider.Add(inspection)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error Inspection: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, newInspection, w)
-}
-
-// DeleteInspectionHandler Deletes Inspection
-func (a App) DeleteInspectionHandler(w http.ResponseWriter, r *http.Request) {
-	var inspectionRequest entity.Inspection
-	err := json.NewDecoder(r.Body).Decode(&inspectionRequest)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when deleting Inspection: %s", err), r)
-		jsonResponse(http.StatusBadRequest, err.Error(), w)
-		return
-	}
-
-	provider, err := a.Container.InspectionProvider()
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error decoding JSON when getting InspectionProvider: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	err = provider.Delete(inspectionRequest)
-	if err != nil {
-		rollbar.Warning(fmt.Sprintf("Error Inspection: %s", err), r)
-		jsonResponse(http.StatusInternalServerError, err.Error(), w)
-		return
-	}
-
-	jsonResponse(http.StatusOK, fmt.Sprintf("Inspection  : %s", inspectionRequest), w)
-}
-
 func jsonResponse(statusCode int, v interface{}, w http.ResponseWriter) {
+	if statusCode >= http.StatusBadRequest {
+		v = paceerror.NewBody(statusCode, v, w.Header().Get(requestIDHeader))
+	} else if versioned, ok := w.(*versionWriter); ok {
+		v = versioned.version.ToDTO(v)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	data, _ := json.Marshal(v)
@@ -755,3 +281,8 @@ func jsonResponse(statusCode int, v interface{}, w http.ResponseWriter) {
 	}
 	w.Write(data)
 }
+
+// errorResponse sends err with the status of its paceerror.Code, 500 if it doesn't have one
+func errorResponse(err error, w http.ResponseWriter) {
+	jsonResponse(paceerror.Status(paceerror.CodeOf(err)), err, w)
+}
@@ -1,12 +1,41 @@
 package cmd
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/coma-toast/pace-api/pkg/apiversion"
+	"github.com/coma-toast/pace-api/pkg/apiversion/v2"
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/container"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/graphql"
+	"github.com/coma-toast/pace-api/pkg/health"
+	"github.com/coma-toast/pace-api/pkg/openapi"
+	"github.com/coma-toast/pace-api/pkg/paceconfig"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+	"github.com/coma-toast/pace-api/pkg/provider/idempotency"
+	"github.com/coma-toast/pace-api/pkg/ratelimit"
+	"github.com/coma-toast/pace-api/pkg/rpc"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestRoute(t *testing.T) {
@@ -29,10 +58,826 @@ func TestUser(t *testing.T) {
 	defer testingServer.Close()
 	response, err := http.Get(fmt.Sprintf("%s/api/user", testingServer.URL))
 	if err != nil {
-		t.Error("Error getting user response: ", err)
+		t.Fatal("Error getting user response: ", err)
+	}
+	var body paceerror.Body
+	err = json.NewDecoder(response.Body).Decode(&body)
+	if err != nil {
+		t.Fatal("Error decoding error body: ", err)
+	}
+	if response.StatusCode != http.StatusUnauthorized || body.Error.Code != paceerror.CodeUnauthorized {
+		t.Errorf("Expected 401 for users without a token, got %d %+v", response.StatusCode, body.Error)
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	a := App{}
+	testingServer := httptest.NewServer(a.getHandlers())
+	defer testingServer.Close()
+	response, err := http.Get(fmt.Sprintf("%s/api/project", testingServer.URL))
+	if err != nil {
+		t.Fatal("Error getting project response: ", err)
+	}
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Error("Expected 401 without a token, got: ", response.StatusCode)
+	}
+}
+
+func TestErrorBody(t *testing.T) {
+	a := App{}
+	testingServer := httptest.NewServer(a.getHandlers())
+	defer testingServer.Close()
+	request, _ := http.NewRequest("GET", fmt.Sprintf("%s/api/project", testingServer.URL), nil)
+	request.Header.Set("X-Request-ID", "scan-42")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal("Error getting project response: ", err)
+	}
+	var body paceerror.Body
+	err = json.NewDecoder(response.Body).Decode(&body)
+	if err != nil {
+		t.Fatal("Error decoding error body: ", err)
+	}
+	if body.Error.Code != paceerror.CodeUnauthorized || body.Error.Message == "" || body.Error.RequestID != "scan-42" {
+		t.Errorf("Unexpected error body %+v", body.Error)
+	}
+	if response.Header.Get("X-Request-ID") != "scan-42" {
+		t.Error("Expected the request ID header back, got: ", response.Header.Get("X-Request-ID"))
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	a := App{}
+	testingServer := httptest.NewServer(a.getHandlers())
+	defer testingServer.Close()
+	response, err := http.Get(fmt.Sprintf("%s/api/openapi.json", testingServer.URL))
+	if err != nil {
+		t.Fatal("Error getting OpenAPI response: ", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		t.Fatal("Expected the OpenAPI document without a token, got: ", response.StatusCode)
+	}
+	var document openapi.Document
+	err = json.NewDecoder(response.Body).Decode(&document)
+	if err != nil {
+		t.Fatal("Error decoding OpenAPI document: ", err)
+	}
+
+	for path, item := range document.Paths {
+		for method, operation := range *item {
+			if operation.Summary == "" {
+				t.Errorf("%s %s is missing from routeDocs", strings.ToUpper(method), path)
+			}
+		}
+	}
+	if _, ok := document.Components.Schemas["Inventory"].Properties["ID"]; !ok {
+		t.Error("Expected Inventory to have an ID property")
+	}
+	project := document.Components.Schemas["Project"]
+	if _, ok := project.Properties["eORNameID"]; !ok || !reflect.DeepEqual(project.Required, []string{"name"}) {
+		t.Errorf("Unexpected Project schema %+v", project)
+	}
+	if _, ok := document.Components.Schemas["CreateUserRequest"].Properties["password"]; !ok {
+		t.Error("Expected CreateUserRequest to have a password property")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	a := App{Config: &paceconfig.Config{TrustedProxies: []string{"10.0.0.0/8", "127.0.0.1"}}}
+	tests := []struct {
+		remoteAddr, forwardedFor, expected string
+	}{
+		{"203.0.113.7:5555", "198.51.100.1", "203.0.113.7"},
+		{"127.0.0.1:5555", "198.51.100.1", "198.51.100.1"},
+		{"127.0.0.1:5555", "198.51.100.1, 203.0.113.9, 10.1.2.3", "203.0.113.9"},
+		{"127.0.0.1:5555", "", "127.0.0.1"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/ping", nil)
+		r.RemoteAddr = test.remoteAddr
+		r.Header.Set("X-Forwarded-For", test.forwardedFor)
+		if ip := a.clientIP(r); ip != test.expected {
+			t.Errorf("Expected %s for %s via %s, got %s", test.expected, test.forwardedFor, test.remoteAddr, ip)
+		}
+	}
+}
+
+func TestSSODisabled(t *testing.T) {
+	a := App{}
+	testingServer := httptest.NewServer(a.getHandlers())
+	defer testingServer.Close()
+	response, err := http.Get(fmt.Sprintf("%s/api/oidc/login", testingServer.URL))
+	if err != nil {
+		t.Fatal("Error getting SSO login response: ", err)
+	}
+	if response.StatusCode != http.StatusNotFound {
+		t.Error("Expected 404 without SSO configured, got: ", response.StatusCode)
+	}
+}
+
+func TestSSORole(t *testing.T) {
+	a := App{Config: &paceconfig.Config{
+		OIDCRoleMappings: []paceconfig.OIDCRoleMapping{
+			{Group: "pace-admins", Role: "admin"},
+			{Group: "pace-pms", Role: "projectManager"},
+		},
+		OIDCDefaultRole: "user",
+	}}
+	tests := []struct {
+		groups   []string
+		expected string
+	}{
+		{[]string{"staff", "pace-pms"}, "projectManager"},
+		{[]string{"pace-pms", "pace-admins"}, "admin"},
+		{[]string{"staff"}, "user"},
+		{nil, "user"},
+	}
+	for _, test := range tests {
+		role := a.ssoRole(test.groups)
+		if role != test.expected {
+			t.Errorf("ssoRole(%v) = %q, expected %q", test.groups, role, test.expected)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	a := App{Limiter: ratelimit.New(map[string]ratelimit.Limit{"ping": ratelimit.Per(2, time.Minute, 0)})}
+	testingServer := httptest.NewServer(a.getHandlers())
+	defer testingServer.Close()
+
+	for i := 0; i < 3; i++ {
+		response, err := http.Get(fmt.Sprintf("%s/api/ping", testingServer.URL))
+		if err != nil {
+			t.Fatal("Error getting Ping response: ", err)
+		}
+		if response.Header.Get("RateLimit-Limit") != "2" {
+			t.Errorf("Request %d: unexpected RateLimit headers %v", i, response.Header)
+		}
+		if i < 2 && (response.StatusCode != http.StatusOK || response.Header.Get("RateLimit-Remaining") != strconv.Itoa(1-i)) {
+			t.Errorf("Request %d: expected 200 with %d remaining, got %d %v", i, 1-i, response.StatusCode, response.Header)
+		}
+		if i == 2 && (response.StatusCode != http.StatusTooManyRequests || response.Header.Get("Retry-After") != "30") {
+			t.Errorf("Expected 429 with Retry-After 30, got %d %v", response.StatusCode, response.Header)
+		}
+	}
+}
+
+func TestIPRateLimit(t *testing.T) {
+	a := App{IPLimiter: ratelimit.New(map[string]ratelimit.Limit{"user": ratelimit.Per(2, time.Minute, 0)})}
+	testingServer := httptest.NewServer(a.getHandlers())
+	defer testingServer.Close()
+
+	// Requests without a token are rejected by authentication, but still count
+	expected := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}
+	for i, status := range expected {
+		response, err := http.Get(fmt.Sprintf("%s/api/users", testingServer.URL))
+		if err != nil {
+			t.Fatal("Error getting users response: ", err)
+		}
+		if response.StatusCode != status {
+			t.Errorf("Request %d: expected %d, got %d", i, status, response.StatusCode)
+		}
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	current := map[string]interface{}{
+		"name":  "Old name",
+		"city":  "Springfield",
+		"stage": map[string]interface{}{"raw": true, "finished": false},
+	}
+	patch := map[string]interface{}{
+		"Name":  "New name",
+		"city":  nil,
+		"stage": map[string]interface{}{"finished": true},
+	}
+	expected := map[string]interface{}{
+		"Name":  "New name",
+		"stage": map[string]interface{}{"raw": true, "finished": true},
+	}
+	merged := mergePatch(current, patch)
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Unexpected merge: %v", merged)
+	}
+}
+
+func TestDeprecatedRoute(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handler := deprecated("/api/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(http.StatusOK, "ok", w)
+	})
+	handler(recorder, httptest.NewRequest("POST", "/api/project", nil))
+	if recorder.Header().Get("Deprecation") != "true" || recorder.Header().Get("Link") != `</api/projects/{id}>; rel="successor-version"` {
+		t.Errorf("Expected deprecation headers, got %v", recorder.Header())
+	}
+}
+
+func TestAPIVersions(t *testing.T) {
+	a := App{
+		Config:       &paceconfig.Config{DeprecatedAPIVersions: []paceconfig.DeprecatedAPIVersion{{Version: "v1", Sunset: "2021-06-30"}}},
+		VersionUsage: apiversion.NewUsage(),
+	}
+	testingServer := httptest.NewServer(a.getHandlers())
+	defer testingServer.Close()
+
+	response, err := http.Get(fmt.Sprintf("%s/api/v1/ping", testingServer.URL))
+	if err != nil {
+		t.Fatal("Error getting Ping response: ", err)
+	}
+	if response.StatusCode != http.StatusOK ||
+		response.Header.Get("Deprecation") != "true" ||
+		response.Header.Get("Sunset") != "Wed, 30 Jun 2021 00:00:00 GMT" ||
+		response.Header.Get("Link") != `</api/v2/ping>; rel="successor-version"` {
+		t.Errorf("Expected v1 to be deprecated, got %d %v", response.StatusCode, response.Header)
+	}
+	response, err = http.Get(fmt.Sprintf("%s/api/v2/ping", testingServer.URL))
+	if err != nil {
+		t.Fatal("Error getting Ping response: ", err)
+	}
+	if response.StatusCode != http.StatusOK || response.Header.Get("Deprecation") != "" {
+		t.Errorf("Expected v2 not to be deprecated, got %d %v", response.StatusCode, response.Header)
+	}
+	response, err = http.Get(fmt.Sprintf("%s/api/v2/project", testingServer.URL))
+	if err != nil {
+		t.Fatal("Error getting flat route response: ", err)
+	}
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the flat routes to be gone from v2, got %d", response.StatusCode)
+	}
+
+	uses := a.VersionUsage.Uses()
+	if len(uses) != 2 || uses[0].Client != "ip:127.0.0.1" {
+		t.Errorf("Unexpected version usage %+v", uses)
+	}
+
+	response, err = http.Post(fmt.Sprintf("%s/api/v2/inventory", testingServer.URL), "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal("Error getting inventory create response: ", err)
+	}
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected v2 to create inventory with a POST, got %d", response.StatusCode)
+	}
+
+	response, err = http.Get(fmt.Sprintf("%s/api/v2/openapi.json", testingServer.URL))
+	if err != nil {
+		t.Fatal("Error getting OpenAPI response: ", err)
+	}
+	var document openapi.Document
+	err = json.NewDecoder(response.Body).Decode(&document)
+	if err != nil {
+		t.Fatal("Error decoding OpenAPI document: ", err)
+	}
+	if _, ok := document.Paths["/api/v2/projects/{id}"]; !ok {
+		t.Error("Expected the v2 document to have v2 paths")
+	}
+	if zip := document.Components.Schemas["Project"].Properties["zip"]; zip == nil || zip.Type != "string" {
+		t.Errorf("Expected the v2 Project zip to be a string, got %+v", zip)
+	}
+}
+
+func TestVersionedBody(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	jsonResponse(http.StatusOK, []entity.Project{{Name: "Riverside Garage", Zip: 2134}}, &versionWriter{ResponseWriter: recorder, version: v2.Version})
+	if body := recorder.Body.String(); !strings.Contains(body, `"zip":"02134"`) {
+		t.Errorf("Expected a v2 project, got %s", body)
+	}
+
+	r := httptest.NewRequest("PATCH", "/api/v2/projects/1", strings.NewReader(`{"zip": "53703", "eorNameID": "eor-1"}`))
+	r = r.WithContext(context.WithValue(r.Context(), versionContextKey{}, v2.Version))
+	var project entity.UpdateProjectRequest
+	err := readUpdate(r, entity.Project{Name: "Riverside Garage", Zip: 2134}, &project)
+	if err != nil || project.Name != "Riverside Garage" || project.Zip != 53703 || project.EORNameID != "eor-1" {
+		t.Errorf("Unexpected patched project %+v, %v", project, err)
+	}
+
+	r = httptest.NewRequest("PUT", "/api/v2/projects/1", strings.NewReader(`{"name": "Riverside Garage", "zip": "2134"}`))
+	r = r.WithContext(context.WithValue(r.Context(), versionContextKey{}, v2.Version))
+	err = readUpdate(r, entity.Project{}, &project)
+	if paceerror.CodeOf(err) != paceerror.CodeValidation {
+		t.Errorf("Expected a short zip to fail validation, got %v", err)
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	a := App{Config: &paceconfig.Config{GraphQLMaxDepth: 3}}
+	admin := auth.NewContext(context.Background(), auth.Identity{UserID: "1", Role: entity.RoleAdmin})
+
+	recorder := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/graphql", strings.NewReader(`{"query": "{ projects { inventory { project { name } } } }"}`))
+	a.GraphQLHandler(recorder, r.WithContext(admin))
+	var response graphql.Response
+	err := json.NewDecoder(recorder.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding GraphQL response: ", err)
+	}
+	if recorder.Code != http.StatusOK || response.Data != nil || len(response.Errors) != 1 || response.Errors[0].Message != "Query is nested 4 deep, the limit is 3" {
+		t.Errorf("Expected the query to be too deep, got %d %+v", recorder.Code, response.Errors)
+	}
+
+	recorder = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/graphql?query="+url.QueryEscape("{ projects(limit: 100) { inspections(limit: 100) { id } } }"), nil)
+	a.GraphQLHandler(recorder, r.WithContext(admin))
+	if body := recorder.Body.String(); !strings.Contains(body, "Query costs 10101, the limit is 5000") {
+		t.Errorf("Expected the query to cost too much, got %s", body)
+	}
+
+	recorder = httptest.NewRecorder()
+	a.GraphQLSchemaHandler(recorder, httptest.NewRequest("GET", "/api/graphql/schema", nil))
+	if body := recorder.Body.String(); !strings.Contains(body, "  client: Company\n") || !strings.Contains(body, "  project(id: ID!): Project\n") {
+		t.Errorf("Unexpected GraphQL schema %s", body)
+	}
+}
+
+func TestGRPCAuthRequired(t *testing.T) {
+	a := App{}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening: ", err)
+	}
+	server := a.newGRPCServer()
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.ForceCodec(rpc.Codec{})))
+	if err != nil {
+		t.Fatal("Error dialing: ", err)
+	}
+	defer conn.Close()
+
+	var project entity.Project
+	err = conn.Invoke(context.Background(), "/pace.v1.ProjectService/Get", &rpc.IDRequest{ID: "1"}, &project)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Error("Expected Unauthenticated without a token, got: ", err)
+	}
+
+	stream, err := conn.NewStream(context.Background(), &grpc.StreamDesc{ServerStreams: true}, "/pace.v1.InventoryService/List")
+	if err == nil {
+		err = stream.SendMsg(&rpc.ListRequest{})
+	}
+	if err == nil {
+		err = stream.RecvMsg(&entity.Inventory{})
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Error("Expected Unauthenticated listing without a token, got: ", err)
+	}
+}
+
+// testContainer only has the providers a test sets, the rest panic
+type testContainer struct {
+	container.Container
+	idempotency idempotency.Provider
+}
+
+func (c testContainer) IdempotencyProvider() (idempotency.Provider, error) {
+	return c.idempotency, nil
+}
+
+type memoryIdempotencyProvider struct {
+	records map[string]entity.IdempotencyRecord
+}
+
+func (p *memoryIdempotencyProvider) Get(ID string) (entity.IdempotencyRecord, error) {
+	record, ok := p.records[ID]
+	if !ok {
+		return entity.IdempotencyRecord{}, idempotency.ErrRecordNotFound
+	}
+	return record, nil
+}
+
+func (p *memoryIdempotencyProvider) Claim(record entity.IdempotencyRecord) error {
+	if _, ok := p.records[record.ID]; ok {
+		return idempotency.ErrKeyInUse
+	}
+	return p.Set(record)
+}
+
+func (p *memoryIdempotencyProvider) Set(record entity.IdempotencyRecord) error {
+	p.records[record.ID] = record
+	return nil
+}
+
+func (p *memoryIdempotencyProvider) Delete(ID string) error {
+	delete(p.records, ID)
+	return nil
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	a := App{Container: testContainer{idempotency: &memoryIdempotencyProvider{records: map[string]entity.IdempotencyRecord{}}}}
+	created := 0
+	r := mux.NewRouter()
+	r.Use(a.idempotencyMiddleware)
+	r.HandleFunc("/api/v2/inventory", func(w http.ResponseWriter, r *http.Request) {
+		created++
+		jsonResponse(http.StatusOK, entity.Inventory{ID: strconv.Itoa(created)}, w)
+	}).Methods("POST")
+
+	send := func(key string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("POST", "/api/v2/inventory", strings.NewReader(body))
+		request.Header.Set(idempotencyKeyHeader, key)
+		r.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	first := send("abc", `{"shape": "W8x10"}`)
+	retry := send("abc", `{"shape": "W8x10"}`)
+	if created != 1 || retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected the retry to replay %s, got %d %s after %d creates", first.Body, retry.Code, retry.Body, created)
+	}
+
+	reused := send("abc", `{"shape": "W12x26"}`)
+	if created != 1 || reused.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected a reused key to be rejected, got %d %s", reused.Code, reused.Body)
+	}
+
+	send("def", `{"shape": "W8x10"}`)
+	if created != 2 {
+		t.Errorf("Expected a new key to create again, got %d creates", created)
+	}
+}
+
+func TestSyncCollection(t *testing.T) {
+	changes := []entity.Change{
+		{ID: "a", Sequence: 12},
+		{ID: "b", Sequence: 14, Deleted: true},
+		{ID: "c", Sequence: 15},
+		{ID: "d", Sequence: 3<<40 | 7},
+	}
+	// c moved to a project the caller isn't a member of
+	collection := syncCollection(changes, []entity.Inventory{{ID: "a"}, {ID: "d"}}, map[string]bool{"a": true, "d": true}, firestoredb.SyncCursor{10})
+	if collection.Token != "15.0.0.7" || !reflect.DeepEqual(collection.Deleted, []string{"b", "c"}) || collection.More {
+		t.Errorf("Unexpected sync %+v", collection)
+	}
+	if !reflect.DeepEqual(changedIDs(changes), []string{"a", "c", "d"}) {
+		t.Errorf("Expected deleted records to not be loaded, got %v", changedIDs(changes))
+	}
+
+	collection = syncCollection(nil, []entity.Inventory{}, map[string]bool{}, firestoredb.SyncCursor{10})
+	if collection.Token != "10" || len(collection.Deleted) != 0 {
+		t.Errorf("Expected the token to stay the same without changes, got %+v", collection)
+	}
+}
+
+func TestMergeFields(t *testing.T) {
+	a := App{Config: &paceconfig.Config{ConflictPolicies: []paceconfig.ConflictPolicy{
+		{Collection: "inventory", Field: "stage", Policy: paceconfig.ConflictLastWriterWins},
+		{Collection: "inventory", Field: "passed", Policy: paceconfig.ConflictServerWins},
+	}}}
+	server := map[string]interface{}{"ID": "1", "shape": "W8x10", "length": 240.0, "passed": true, "grade": 50.0, "stage": map[string]interface{}{"finished": true}}
+	mutation := entity.Mutation{
+		Collection: "inventory",
+		Base:       map[string]interface{}{"shape": "W8x10", "length": 120.0, "passed": false, "grade": 36.0, "stage": map[string]interface{}{"onHold": true}},
+		Changes:    map[string]interface{}{"shape": "W8x12", "length": 180.0, "passed": false, "grade": 50.0, "stage": map[string]interface{}{"inProcess": true}},
+	}
+
+	apply, conflicts, err := a.mergeFields(mutation, server, true, true)
+	if err != nil {
+		t.Fatal("Error merging: ", err)
+	}
+	// shape only changed offline, stage is last writer wins, passed is server wins
+	// and grade was changed to the same value on both sides
+	expected := map[string]interface{}{"shape": "W8x12", "stage": map[string]interface{}{"inProcess": true}}
+	if !reflect.DeepEqual(apply, expected) {
+		t.Errorf("Expected to apply %v, got %v", expected, apply)
+	}
+	if len(conflicts) != 1 || conflicts[0].Field != "length" || conflicts[0].Server != 240.0 || conflicts[0].Client != 180.0 {
+		t.Errorf("Expected length to conflict, got %+v", conflicts)
+	}
+
+	apply, conflicts, _ = a.mergeFields(mutation, server, false, false)
+	if len(apply) != len(mutation.Changes) || len(conflicts) != 0 {
+		t.Errorf("Expected every change to apply when the record hasn't changed, got %v %+v", apply, conflicts)
+	}
+
+	mutation.Changes = map[string]interface{}{"ID": "2"}
+	_, _, err = a.mergeFields(mutation, server, false, false)
+	if paceerror.CodeOf(err) != paceerror.CodeBadRequest {
+		t.Error("Expected changing the ID to be rejected, got: ", err)
+	}
+}
+
+func TestShapedResponse(t *testing.T) {
+	a := App{}
+	inventory := []entity.Inventory{{ID: "1", ProjectID: "41", Shape: "W8x10", Length: 240}}
+
+	recorder := httptest.NewRecorder()
+	a.shapedResponse(inventory, recorder, httptest.NewRequest("GET", "/api/inventory?fields=id,%20shape,unknown", nil))
+	var trimmed []map[string]interface{}
+	json.NewDecoder(recorder.Body).Decode(&trimmed)
+	expected := []map[string]interface{}{{"ID": "1", "shape": "W8x10"}}
+	if !reflect.DeepEqual(trimmed, expected) {
+		t.Errorf("Expected %v, got %v", expected, trimmed)
+	}
+
+	recorder = httptest.NewRecorder()
+	a.shapedResponse(inventory[0], recorder, httptest.NewRequest("GET", "/api/inventory/1?expand=client", nil))
+	if body := recorder.Body.String(); recorder.Code != http.StatusBadRequest || !strings.Contains(body, "Can't expand client, try project") {
+		t.Errorf("Expected 400 for an unknown expansion, got %d %s", recorder.Code, body)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	a := App{Config: &paceconfig.Config{CORSAllowedOrigins: []string{"https://dashboard.example.com"}, MaxBodySize: 16}}
+	testingServer := httptest.NewServer(a.getHandlers())
+	defer testingServer.Close()
+
+	request, _ := http.NewRequest("OPTIONS", testingServer.URL+"/api/projects", nil)
+	request.Header.Set("Origin", "https://dashboard.example.com")
+	request.Header.Set("Access-Control-Request-Method", "PATCH")
+	request.Header.Set("Access-Control-Request-Headers", "Authorization, Content-Type")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal("Error sending preflight: ", err)
+	}
+	if response.StatusCode != http.StatusOK || response.Header.Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" || response.Header.Get("Access-Control-Allow-Methods") != "PATCH" {
+		t.Errorf("Expected the preflight to be allowed, got %d %v", response.StatusCode, response.Header)
+	}
+
+	response, err = http.Post(testingServer.URL+"/api/login", "application/json", strings.NewReader(`{"username": "someone", "password": "too long"}`))
+	if err != nil {
+		t.Fatal("Error logging in: ", err)
+	}
+	if response.StatusCode != http.StatusRequestEntityTooLarge || response.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("Expected a 413 with security headers, got %d %v", response.StatusCode, response.Header)
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	tests := []struct {
+		body  string
+		valid bool
+	}{
+		{`{"name": "Riverside Garage"}`, true},
+		{`{"name": "Riverside Garage", "color": "red"}`, false},
+		{`{"name": "Riverside Garage"} {"name": "x"}`, false},
+	}
+	for _, test := range tests {
+		var project entity.Project
+		err := decodeBody(httptest.NewRequest("POST", "/api/projects", strings.NewReader(test.body)), &project)
+		if (err == nil) != test.valid || (err != nil && paceerror.CodeOf(err) != paceerror.CodeBadRequest) {
+			t.Errorf("Expected %s to be valid: %t, got %v", test.body, test.valid, err)
+		}
+	}
+
+	r := httptest.NewRequest("PATCH", "/api/projects/1", strings.NewReader(`{"colour": "red"}`))
+	var project entity.UpdateProjectRequest
+	if err := readUpdate(r, entity.Project{ID: "1", Name: "Riverside Garage", Created: "2020-01-01T00:00:00Z"}, &project); paceerror.CodeOf(err) != paceerror.CodeBadRequest {
+		t.Errorf("Expected an unknown field in a patch to be rejected, got %v", err)
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	inventory := make([]entity.Inventory, 50)
+	for i := range inventory {
+		inventory[i] = entity.Inventory{ID: strconv.Itoa(i), ProjectID: "41", Shape: "W8x10"}
+	}
+	handler := compressMiddleware(conditionalMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", "Tue, 02 Jun 2020 15:04:05 GMT")
+		jsonResponse(http.StatusOK, inventory, w)
+	})))
+
+	request := httptest.NewRequest("GET", "/api/inventory", nil)
+	request.Header.Set("Accept-Encoding", "br;q=1.0, gzip;q=0.8")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	etag := recorder.Header().Get("ETag")
+	if recorder.Header().Get("Content-Encoding") != "br" || !strings.HasSuffix(etag, `-br"`) {
+		t.Fatalf("Expected a Brotli response with its own ETag, got %v", recorder.Header())
+	}
+	var decoded []entity.Inventory
+	if err := json.NewDecoder(brotli.NewReader(recorder.Body)).Decode(&decoded); err != nil || len(decoded) != len(inventory) {
+		t.Errorf("Expected the inventory back, got %d items, %v", len(decoded), err)
+	}
+
+	request.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNotModified || recorder.Body.Len() != 0 {
+		t.Errorf("Expected 304 for a matching ETag, got %d", recorder.Code)
+	}
+
+	request = httptest.NewRequest("GET", "/api/inventory", nil)
+	request.Header.Set("Accept-Encoding", "gzip, br;q=0.5")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	gzipETag := recorder.Header().Get("ETag")
+	if recorder.Header().Get("Content-Encoding") != "gzip" || !strings.HasSuffix(gzipETag, `-gzip"`) {
+		t.Fatalf("Expected a gzipped response with its own ETag, got %v", recorder.Header())
+	}
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal("Error reading gzip: ", err)
+	}
+	if err := json.NewDecoder(reader).Decode(&decoded); err != nil || len(decoded) != len(inventory) {
+		t.Errorf("Expected the inventory back, got %d items, %v", len(decoded), err)
+	}
+
+	request.Header.Set("If-None-Match", gzipETag)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for a matching gzip ETag, got %d", recorder.Code)
+	}
+
+	request = httptest.NewRequest("GET", "/api/inventory", nil)
+	request.Header.Set("If-Modified-Since", "Tue, 02 Jun 2020 15:04:05 GMT")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNotModified || recorder.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected 304 for an unchanged Last-Modified, got %d", recorder.Code)
+	}
+
+	request.Header.Set("If-Modified-Since", "Mon, 01 Jun 2020 15:04:05 GMT")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected a plain 200 after a change, got %d %v", recorder.Code, recorder.Header())
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	a := App{Config: &paceconfig.Config{ListenAddress: "127.0.0.1:0", ReadTimeout: 5 * time.Second, ShutdownTimeout: 5 * time.Second}}
+	server := a.newHTTPServer()
+	if server.Addr != "127.0.0.1:0" || server.ReadTimeout != 5*time.Second || server.ReadHeaderTimeout != 5*time.Second || server.IdleTimeout != defaultIdleTimeout {
+		t.Errorf("Expected the configured address and timeouts, with defaults for the rest, got %+v", server)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	response := make(chan string)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		response <- string(body)
+	}()
+	<-started
+
+	stopped := false
+	stopWorkers := func() { stopped = true }
+	shutdownDone := make(chan struct{})
+	go func() {
+		a.shutdown(server, nil, stopWorkers, &sync.WaitGroup{})
+		close(shutdownDone)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if _, err := http.Get("http://" + listener.Addr().String()); err == nil {
+		t.Error("Expected new connections to be refused while draining")
+	}
+	close(release)
+
+	if body := <-response; body != "done" {
+		t.Errorf("Expected the in-flight request to finish, got %s", body)
+	}
+	<-shutdownDone
+	if !stopped {
+		t.Error("Expected the background workers to be stopped")
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	a := App{}
+	a.Health = health.New(time.Second, time.Minute)
+	a.Health.Add("config", a.checkConfig)
+	testingServer := httptest.NewServer(a.getHandlers())
+	defer testingServer.Close()
+
+	response, err := http.Get(testingServer.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK || response.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected liveness without a token, got %d", response.StatusCode)
+	}
+
+	response, err = http.Get(testingServer.URL + "/readyz")
+	if err != nil {
+		t.Fatal(err)
 	}
 	body, _ := ioutil.ReadAll(response.Body)
-	if !reflect.DeepEqual(body, []byte("\"Pong\"")) {
-		t.Error("Body does not match expected value: ", body)
+	var report health.PublicReport
+	err = json.Unmarshal(body, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusServiceUnavailable || report.Status != health.StatusFail || report.Checks["config"] != health.StatusFail {
+		t.Errorf("Expected not ready without a config, got %d %+v", response.StatusCode, report)
+	}
+	if strings.Contains(string(body), "No config loaded") {
+		t.Errorf("Expected the check's error to be left out, got %s", body)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	a := App{Config: &paceconfig.Config{MetricsAllowedIPs: []string{"10.0.0.0/8"}, MetricsToken: "scraper-token"}}
+	testingServer := httptest.NewServer(a.getHandlers())
+	defer testingServer.Close()
+
+	http.Get(testingServer.URL + "/api/v2/ping")
+	http.Get(testingServer.URL + "/api/nowhere/42")
+
+	response, err := http.Get(testingServer.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusForbidden {
+		t.Error("Expected metrics to be refused outside the allowed IPs without the token, got: ", response.StatusCode)
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, testingServer.URL+"/metrics", nil)
+	request.Header.Set("Authorization", "Bearer scraper-token")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK || !strings.HasPrefix(response.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("Expected metrics with the token, got %d", response.StatusCode)
+	}
+	for _, line := range []string{
+		`pace_http_requests_total{route="/api/ping",method="GET",status="200"}`,
+		`pace_http_requests_total{route="unmatched",method="GET",status="404"}`,
+		`pace_http_requests_total{route="/metrics",method="GET",status="403"}`,
+		`pace_http_request_duration_seconds_bucket{route="/api/ping",method="GET",le="+Inf"}`,
+		`pace_http_requests_in_flight{route="/metrics",method="GET"} 1`,
+		"# TYPE pace_firestore_operations_total counter",
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("Expected %s in the metrics", line)
+		}
+	}
+}
+
+func TestMetricsAllowed(t *testing.T) {
+	a := App{Config: &paceconfig.Config{}}
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if a.metricsAllowed(request) {
+		t.Error("Expected metrics to be refused to remote clients without MetricsAllowedIPs or MetricsToken")
+	}
+	request.RemoteAddr = "127.0.0.1:4242"
+	if !a.metricsAllowed(request) {
+		t.Error("Expected metrics to be open to loopback clients without MetricsAllowedIPs or MetricsToken")
+	}
+	request.RemoteAddr = "[::1]:4242"
+	if !a.metricsAllowed(request) {
+		t.Error("Expected metrics to be open to IPv6 loopback clients")
+	}
+}
+
+func TestTouchDue(t *testing.T) {
+	now := time.Now()
+	if !touchDue("", now) || !touchDue(now.Add(-2*apiKeyTouchInterval).Format(time.RFC3339), now) {
+		t.Error("Expected keys never or long ago used to be touched")
+	}
+	if touchDue(now.Add(-apiKeyTouchInterval/2).Format(time.RFC3339), now) {
+		t.Error("Expected a recently used key not to be touched again")
+	}
+}
+
+func TestCanManageUsers(t *testing.T) {
+	if !canManageUsers(auth.Identity{UserID: "1", Role: entity.RoleAdmin}) {
+		t.Error("Expected admins to manage users")
+	}
+	if canManageUsers(auth.Identity{APIKeyID: "1", Scopes: []string{auth.ScopeAll}}) {
+		t.Error("Expected API keys not to manage users, even with every scope")
+	}
+	if canEditUser(auth.Identity{APIKeyID: "1", Scopes: []string{auth.ScopeAll}}, entity.User{ID: "2"}, entity.UpdateUserRequest{Role: entity.RoleAdmin}) {
+		t.Error("Expected API keys not to edit users")
+	}
+}
+
+func TestMembershipFiltered(t *testing.T) {
+	tests := []struct {
+		identity auth.Identity
+		v        interface{}
+		expected bool
+	}{
+		{auth.Identity{UserID: "1", Role: "user"}, []entity.Project{}, true},
+		{auth.Identity{UserID: "1", Role: "user"}, []entity.Inventory{}, true},
+		{auth.Identity{UserID: "1", Role: "user"}, entity.Project{}, false},
+		{auth.Identity{UserID: "1", Role: "user"}, []entity.Company{}, false},
+		{auth.Identity{UserID: "1", Role: "admin"}, []entity.Project{}, false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/projects", nil)
+		r = r.WithContext(auth.NewContext(r.Context(), test.identity))
+		if membershipFiltered(test.v, r) != test.expected {
+			t.Errorf("membershipFiltered(%T) as %s = %t, expected %t", test.v, test.identity.Role, !test.expected, test.expected)
+		}
 	}
 }
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/validate"
+	"github.com/rollbar/rollbar-go"
+)
+
+// createCompany adds a new company
+func (a App) createCompany(ctx context.Context, company entity.Company) (entity.Company, error) {
+	err := validate.Struct(company)
+	if err != nil {
+		return entity.Company{}, err
+	}
+	provider, err := a.Container.CompanyProvider()
+	if err != nil {
+		return entity.Company{}, err
+	}
+
+	return provider.Add(company)
+}
+
+// updateCompany saves an update to the company with its ID
+func (a App) updateCompany(ctx context.Context, company entity.Company) (entity.Company, error) {
+	err := validate.Struct(company)
+	if err != nil {
+		return entity.Company{}, err
+	}
+	provider, err := a.Container.CompanyProvider()
+	if err != nil {
+		return entity.Company{}, err
+	}
+
+	return provider.Update(company)
+}
+
+// deleteCompany deletes a company by ID
+func (a App) deleteCompany(ctx context.Context, ID string) (entity.Company, error) {
+	provider, err := a.Container.CompanyProvider()
+	if err != nil {
+		return entity.Company{}, err
+	}
+	company, err := provider.GetByID(ID)
+	if err != nil {
+		return entity.Company{}, err
+	}
+	err = provider.Delete(company)
+	if err != nil {
+		return entity.Company{}, err
+	}
+
+	return company, nil
+}
+
+// GetCompanyHandler handles api calls for Company
+func (a App) GetCompanyHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := a.Container.CompanyProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting CompanyProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	allCompanies, err := provider.GetAll()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting All Companies: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	a.shapedResponse(allCompanies, w, r)
+}
+
+// GetCompanyByIDHandler gets a Company by ID
+func (a App) GetCompanyByIDHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := a.Container.CompanyProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting CompanyProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	currentCompany, err := provider.GetByID(pathID(r))
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting Company %s: %s", pathID(r), err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	a.shapedResponse(currentCompany, w, r)
+}
+
+// CreateCompanyHandler handles api calls for Company
+func (a App) CreateCompanyHandler(w http.ResponseWriter, r *http.Request) {
+	var company entity.Company
+	err := decodeBody(r, &company)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	newCompany, err := a.createCompany(r.Context(), company)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, newCompany, w)
+}
+
+// UpdateCompanyHandler updates the Company with the id in the body
+func (a App) UpdateCompanyHandler(w http.ResponseWriter, r *http.Request) {
+	var company entity.Company
+	err := decodeBody(r, &company)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	updatedCompany, err := a.updateCompany(r.Context(), company)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedCompany, w)
+}
+
+// UpdateCompanyByIDHandler replaces (PUT) or patches (PATCH) a Company by ID
+func (a App) UpdateCompanyByIDHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := a.Container.CompanyProvider()
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+	currentCompany, err := provider.GetByID(pathID(r))
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	var company entity.Company
+	err = readUpdate(r, currentCompany, &company)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+	company.ID = currentCompany.ID
+
+	updatedCompany, err := a.updateCompany(r.Context(), company)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedCompany, w)
+}
+
+// DeleteCompanyHandler deletes the Company with the id in the body
+func (a App) DeleteCompanyHandler(w http.ResponseWriter, r *http.Request) {
+	var company entity.Company
+	err := decodeBody(r, &company)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	a.deleteCompanyResponse(company.ID, w, r)
+}
+
+// DeleteCompanyByIDHandler deletes a Company by ID
+func (a App) DeleteCompanyByIDHandler(w http.ResponseWriter, r *http.Request) {
+	a.deleteCompanyResponse(pathID(r), w, r)
+}
+
+func (a App) deleteCompanyResponse(ID string, w http.ResponseWriter, r *http.Request) {
+	company, err := a.deleteCompany(r.Context(), ID)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, fmt.Sprintf("company %s Deleted", company.Name), w)
+}
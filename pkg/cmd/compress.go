@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	gzipEncoding   = "gzip"
+	brotliEncoding = "br"
+	// minCompressSize is the smallest body worth compressing
+	minCompressSize = 1024
+)
+
+// compressEncodings are the encodings offered, preferred first
+var compressEncodings = []string{brotliEncoding, gzipEncoding}
+
+// encoder is a gzip or Brotli writer
+type encoder interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+var encoders = map[string]*sync.Pool{
+	gzipEncoding: {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+	brotliEncoding: {New: func() interface{} {
+		return brotli.NewWriter(nil)
+	}},
+}
+
+// compressWriter compresses the response with encoding once it's big enough.
+// The start of the body is held back until then.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buffer   []byte
+	started  bool
+	encoder  encoder
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.started {
+		if w.encoder != nil {
+			return w.encoder.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buffer = append(w.buffer, data...)
+	if len(w.buffer) >= minCompressSize {
+		err := w.start(true)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// start sends the headers and the held back body, compressed if compress is set
+// and the response can be
+func (w *compressWriter) start(compress bool) error {
+	w.started = true
+	header := w.Header()
+	if !compress || header.Get("Content-Encoding") != "" || !compressible(header.Get("Content-Type")) {
+		w.ResponseWriter.WriteHeader(w.status)
+		_, err := w.ResponseWriter.Write(w.buffer)
+		return err
+	}
+
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	if etag := header.Get("ETag"); etag != "" {
+		header.Set("ETag", encodedETag(etag, w.encoding))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.encoder = encoders[w.encoding].Get().(encoder)
+	w.encoder.Reset(w.ResponseWriter)
+	_, err := w.encoder.Write(w.buffer)
+
+	return err
+}
+
+// close sends what's still held back, and finishes the compressed stream
+func (w *compressWriter) close() {
+	if !w.started && w.status != 0 {
+		w.start(false)
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+		encoders[w.encoding].Put(w.encoder)
+		w.encoder = nil
+	}
+}
+
+// compressMiddleware compresses responses over minCompressSize with Brotli or
+// gzip, whichever the client prefers
+func compressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if r.Method == http.MethodHead || encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer writer.close()
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// negotiateEncoding picks the encoding an Accept-Encoding header gives the
+// highest quality, Brotli on a tie, or "" if it allows neither
+func negotiateEncoding(acceptEncoding string) string {
+	best, bestQuality := "", 0.0
+	for _, encoding := range compressEncodings {
+		if quality := encodingQuality(acceptEncoding, encoding); quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+
+	return best
+}
+
+// encodingQuality is how much an Accept-Encoding header wants encoding, 0 if not at all
+func encodingQuality(acceptEncoding string, encoding string) float64 {
+	accepted := 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name != encoding && name != "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				quality, _ = strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+			}
+		}
+		// An explicit entry for the encoding wins over *
+		if name == encoding {
+			return quality
+		}
+		accepted = quality
+	}
+
+	return accepted
+}
+
+// compressible is true for text content types
+func compressible(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") || strings.Contains(contentType, "json") || strings.Contains(contentType, "javascript")
+}
+
+// encodedETag is the ETag of a representation with a content encoding, which
+// has to differ from the ETag of the plain one for strong validation
+func encodedETag(etag string, encoding string) string {
+	return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+}
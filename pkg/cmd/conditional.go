@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	helper "github.com/coma-toast/pace-api/pkg/utils"
+	"github.com/rollbar/rollbar-go"
+)
+
+// changeTracker is a provider that tracks when its records changed
+type changeTracker interface {
+	GetChange(ID string) (entity.Change, error)
+	GetLastChange() (entity.Change, error)
+}
+
+// conditionalWriter holds a GET response back until it's known whether the
+// client already has it
+type conditionalWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *conditionalWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *conditionalWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.body.Write(data)
+}
+
+// conditionalMiddleware gives successful GET responses a strong ETag from
+// their body, and answers If-None-Match and If-Modified-Since with a 304 when
+// the client's copy is still current. Handlers set Last-Modified.
+func conditionalMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &conditionalWriter{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			return
+		}
+		if recorder.status != http.StatusOK {
+			w.WriteHeader(recorder.status)
+			w.Write(recorder.body.Bytes())
+			return
+		}
+
+		etag := `"` + helper.Hash(recorder.body.String(), "")[:32] + `"`
+		w.Header().Set("ETag", etag)
+		if notModified(r, etag, w.Header().Get("Last-Modified")) {
+			w.Header().Del("Content-Type")
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(recorder.status)
+		w.Write(recorder.body.Bytes())
+	})
+}
+
+// notModified is true if the client's copy, by If-None-Match or else by
+// If-Modified-Since, is the current one
+func notModified(r *http.Request, etag string, lastModified string) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+			for _, encoding := range compressEncodings {
+				if tag == encodedETag(etag, encoding) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+
+	return err == nil && !modified.After(since)
+}
+
+// setLastModified sets Last-Modified to when v, a record or a list of them,
+// last changed. Lists changed with any record of their collection. It is left
+// out when that isn't known, and when the response can change without any of
+// those records changing: with ?expand=, or lists filtered by membership.
+// The ETag still covers those.
+func (a App) setLastModified(v interface{}, w http.ResponseWriter, r *http.Request) {
+	if len(listParam(r, "expand")) > 0 || membershipFiltered(v, r) {
+		return
+	}
+	tracker, err := a.changeTracker(v)
+	if tracker == nil || err != nil {
+		return
+	}
+
+	value := reflect.ValueOf(v)
+	var change entity.Change
+	var latest time.Time
+	if value.Kind() == reflect.Slice {
+		change, err = tracker.GetLastChange()
+		for i := 0; i < value.Len(); i++ {
+			latest = laterTime(latest, value.Index(i).FieldByName("Created").String())
+		}
+	} else {
+		change, err = tracker.GetChange(value.FieldByName("ID").String())
+		latest = laterTime(latest, value.FieldByName("Created").String())
+	}
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting when %T last changed: %s", v, err), r)
+		return
+	}
+	latest = laterTime(latest, change.Modified)
+
+	if !latest.IsZero() {
+		w.Header().Set("Last-Modified", latest.UTC().Format(http.TimeFormat))
+	}
+}
+
+// membershipFiltered is true for lists that only have the projects the caller
+// is a member of, and their inventory and inspections
+func membershipFiltered(v interface{}, r *http.Request) bool {
+	identity, _ := auth.FromContext(r.Context())
+	if identity.IsAdmin() || identity.IsAPIKey() {
+		return false
+	}
+	switch v.(type) {
+	case []entity.Project, []entity.Inventory, []entity.Inspection:
+		return true
+	}
+
+	return false
+}
+
+// changeTracker gets the provider of v's records, nil for anything else
+func (a App) changeTracker(v interface{}) (changeTracker, error) {
+	if a.Container == nil {
+		return nil, nil
+	}
+	switch v.(type) {
+	case entity.User, []entity.User:
+		return a.Container.UserProvider()
+	case entity.Contact, []entity.Contact:
+		return a.Container.ContactProvider()
+	case entity.Company, []entity.Company:
+		return a.Container.CompanyProvider()
+	case entity.Project, []entity.Project:
+		return a.Container.ProjectProvider()
+	case entity.Inventory, []entity.Inventory:
+		return a.Container.InventoryProvider()
+	case entity.Inspection, []entity.Inspection:
+		return a.Container.InspectionProvider()
+	}
+
+	return nil, nil
+}
+
+// laterTime is the later of latest and an RFC 3339 time, if it can be read
+func laterTime(latest time.Time, value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil || !parsed.After(latest) {
+		return latest
+	}
+
+	return parsed
+}
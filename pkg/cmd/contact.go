@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/validate"
+	"github.com/rollbar/rollbar-go"
+)
+
+// createContact adds a new contact
+func (a App) createContact(ctx context.Context, contact entity.Contact) (entity.Contact, error) {
+	err := validate.Struct(contact)
+	if err != nil {
+		return entity.Contact{}, err
+	}
+	provider, err := a.Container.ContactProvider()
+	if err != nil {
+		return entity.Contact{}, err
+	}
+
+	return provider.Add(contact)
+}
+
+// updateContact saves an update to the contact with its ID
+func (a App) updateContact(ctx context.Context, contact entity.Contact) (entity.Contact, error) {
+	err := validate.Struct(contact)
+	if err != nil {
+		return entity.Contact{}, err
+	}
+	provider, err := a.Container.ContactProvider()
+	if err != nil {
+		return entity.Contact{}, err
+	}
+
+	return provider.Update(contact)
+}
+
+// deleteContact deletes a contact by ID
+func (a App) deleteContact(ctx context.Context, ID string) (entity.Contact, error) {
+	provider, err := a.Container.ContactProvider()
+	if err != nil {
+		return entity.Contact{}, err
+	}
+	contact, err := provider.GetByID(ID)
+	if err != nil {
+		return entity.Contact{}, err
+	}
+	err = provider.Delete(contact)
+	if err != nil {
+		return entity.Contact{}, err
+	}
+
+	return contact, nil
+}
+
+// GetContactHandler handles api calls for contacts
+func (a App) GetContactHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := a.Container.ContactProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting ContactProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	allContacts, err := provider.GetAll()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting All Contacts: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	a.shapedResponse(allContacts, w, r)
+}
+
+// GetContactByIDHandler gets a Contact by ID
+func (a App) GetContactByIDHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := a.Container.ContactProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting ContactProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	currentContact, err := provider.GetByID(pathID(r))
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting Contact %s: %s", pathID(r), err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	a.shapedResponse(currentContact, w, r)
+}
+
+// CreateContactHandler handles api calls for contacts
+func (a App) CreateContactHandler(w http.ResponseWriter, r *http.Request) {
+	var contact entity.Contact
+	err := decodeBody(r, &contact)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	newContact, err := a.createContact(r.Context(), contact)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, newContact, w)
+}
+
+// UpdateContactHandler updates the Contact with the id in the body
+func (a App) UpdateContactHandler(w http.ResponseWriter, r *http.Request) {
+	var contact entity.Contact
+	err := decodeBody(r, &contact)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	updatedContact, err := a.updateContact(r.Context(), contact)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedContact, w)
+}
+
+// UpdateContactByIDHandler replaces (PUT) or patches (PATCH) a Contact by ID
+func (a App) UpdateContactByIDHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := a.Container.ContactProvider()
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+	currentContact, err := provider.GetByID(pathID(r))
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	var contact entity.Contact
+	err = readUpdate(r, currentContact, &contact)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+	contact.ID = currentContact.ID
+
+	updatedContact, err := a.updateContact(r.Context(), contact)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedContact, w)
+}
+
+// DeleteContactHandler deletes the Contact with the id in the body
+func (a App) DeleteContactHandler(w http.ResponseWriter, r *http.Request) {
+	var contact entity.Contact
+	err := decodeBody(r, &contact)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	a.deleteContactResponse(contact.ID, w, r)
+}
+
+// DeleteContactByIDHandler deletes a Contact by ID
+func (a App) DeleteContactByIDHandler(w http.ResponseWriter, r *http.Request) {
+	a.deleteContactResponse(pathID(r), w, r)
+}
+
+func (a App) deleteContactResponse(ID string, w http.ResponseWriter, r *http.Request) {
+	contact, err := a.deleteContact(r.Context(), ID)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, fmt.Sprintf("contact %s %s Deleted", contact.FirstName, contact.LastName), w)
+}
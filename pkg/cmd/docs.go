@@ -0,0 +1,104 @@
+package cmd
+
+// docsPage shows the openapi.json next to it without loading anything from outside the API
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>PaCE API</title>
+<style>
+body { font-family: -apple-system, Helvetica, Arial, sans-serif; margin: 0 auto; max-width: 960px; padding: 1em; color: #222; }
+h2 { border-bottom: 1px solid #ddd; padding-bottom: .2em; margin-top: 1.5em; text-transform: capitalize; }
+details { border: 1px solid #ddd; border-radius: 4px; margin: .4em 0; }
+details.deprecated summary { opacity: .55; text-decoration: line-through; }
+summary { cursor: pointer; padding: .5em; font-family: Menlo, monospace; }
+.method { display: inline-block; width: 5em; font-weight: bold; }
+.get { color: #1a7f37; } .post { color: #0969da; } .put, .patch { color: #9a6700; } .delete { color: #cf222e; }
+.body { padding: 0 1em 1em; }
+pre { background: #f6f8fa; padding: .6em; overflow: auto; font-size: 13px; }
+table { border-collapse: collapse; font-size: 14px; }
+td, th { border: 1px solid #ddd; padding: .2em .5em; text-align: left; vertical-align: top; }
+a { color: #0969da; }
+</style>
+</head>
+<body>
+<h1>PaCE API</h1>
+<p>Generated from the routes and entity types. The raw document is <a href="openapi.json">openapi.json</a>.</p>
+<div id="operations">Loading...</div>
+<h2 id="schemas">Schemas</h2>
+<div id="components"></div>
+<script>
+function esc(text) {
+  return String(text).replace(/[&<>"]/g, function (c) { return {"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;"}[c]; });
+}
+function typeOf(schema) {
+  if (!schema) { return ""; }
+  if (schema.$ref) {
+    var name = schema.$ref.split("/").pop();
+    return '<a href="#schema-' + name + '">' + name + "</a>";
+  }
+  if (schema.oneOf) { return schema.oneOf.map(typeOf).join(" or "); }
+  if (schema.type === "array") { return typeOf(schema.items) + "[]"; }
+  return esc(schema.type || "any") + (schema.format ? " (" + esc(schema.format) + ")" : "");
+}
+function rules(schema) {
+  var out = [];
+  if (schema.enum) { out.push("one of " + schema.enum.join(", ")); }
+  if (schema.minLength !== undefined) { out.push("min length " + schema.minLength); }
+  if (schema.maxLength !== undefined) { out.push("max length " + schema.maxLength); }
+  if (schema.minimum !== undefined) { out.push("min " + schema.minimum); }
+  if (schema.maximum !== undefined) { out.push("max " + schema.maximum); }
+  if (schema.pattern) { out.push("pattern " + schema.pattern); }
+  if (schema.description) { out.push(schema.description); }
+  return esc(out.join("; "));
+}
+function content(body) {
+  return body && body.content ? typeOf(body.content["application/json"].schema) : "";
+}
+fetch("openapi.json").then(function (response) { return response.json(); }).then(function (doc) {
+  var groups = {};
+  Object.keys(doc.paths).sort().forEach(function (path) {
+    Object.keys(doc.paths[path]).forEach(function (method) {
+      var op = doc.paths[path][method];
+      var tag = (op.tags || ["other"])[0];
+      (groups[tag] = groups[tag] || []).push({path: path, method: method, op: op});
+    });
+  });
+  var html = "";
+  Object.keys(groups).sort().forEach(function (tag) {
+    html += "<h2>" + esc(tag) + "</h2>";
+    groups[tag].forEach(function (entry) {
+      var op = entry.op;
+      html += '<details class="' + (op.deprecated ? "deprecated" : "") + '"><summary><span class="method ' + entry.method + '">' +
+        entry.method.toUpperCase() + "</span>" + esc(entry.path) + " &mdash; " + esc(op.summary || "") + '</summary><div class="body">';
+      if (op.deprecated) { html += "<p><strong>Deprecated.</strong></p>"; }
+      if (op.security && op.security.length === 0) { html += "<p>No authentication needed.</p>"; }
+      (op.parameters || []).forEach(function (parameter) {
+        html += "<p>" + esc(parameter.in) + " parameter <code>" + esc(parameter.name) + "</code>" + (parameter.required ? " (required)" : "") + "</p>";
+      });
+      if (op.requestBody) { html += "<p>Request: " + content(op.requestBody) + "</p>"; }
+      Object.keys(op.responses).forEach(function (status) {
+        html += "<p>" + esc(status) + ": " + (content(op.responses[status]) || esc(op.responses[status].description)) + "</p>";
+      });
+      html += "</div></details>";
+    });
+  });
+  document.getElementById("operations").innerHTML = html;
+
+  var schemas = doc.components.schemas;
+  document.getElementById("components").innerHTML = Object.keys(schemas).sort().map(function (name) {
+    var schema = schemas[name];
+    var rows = Object.keys(schema.properties || {}).map(function (property) {
+      var propertySchema = schema.properties[property];
+      var required = (schema.required || []).indexOf(property) >= 0;
+      return "<tr><td><code>" + esc(property) + "</code>" + (required ? " *" : "") + "</td><td>" + typeOf(propertySchema) + "</td><td>" + rules(propertySchema) + "</td></tr>";
+    }).join("");
+    return '<h3 id="schema-' + name + '">' + esc(name) + "</h3><table><tr><th>Field</th><th>Type</th><th>Rules</th></tr>" + rows + "</table>";
+  }).join("");
+}).catch(function (err) {
+  document.getElementById("operations").textContent = "Couldn't load openapi.json: " + err;
+});
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,716 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/graphql"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/rollbar/rollbar-go"
+)
+
+// GraphQL query limits used when they are not set in the config
+const (
+	defaultGraphQLMaxDepth = 8
+	defaultGraphQLMaxCost  = 5000
+)
+
+// graphqlListLimit is how many items list fields return without a limit argument
+const graphqlListLimit = 100
+
+// InventoryCounts is how many inventory items of a project are in each stage
+type InventoryCounts struct {
+	Total     int `json:"total"`
+	Raw       int `json:"raw"`
+	InProcess int `json:"inProcess"`
+	OnHold    int `json:"onHold"`
+	Finished  int `json:"finished"`
+	Passed    int `json:"passed"`
+}
+
+// projectLinks are the companies and contacts a project points to by ID
+var projectLinks = []struct {
+	Name    string
+	Contact bool
+	ID      func(project entity.Project) string
+}{
+	{"client", false, func(project entity.Project) string { return project.ClientID }},
+	{"generalContractor", false, func(project entity.Project) string { return project.GeneralContractorID }},
+	{"inspectionLab", false, func(project entity.Project) string { return project.InspectionLabID }},
+	{"engineerOfRecord", true, func(project entity.Project) string { return project.EORNameID }},
+	{"detailer", true, func(project entity.Project) string { return project.DetailerNameID }},
+	{"steelErector", true, func(project entity.Project) string { return project.SteelErectorNameID }},
+	{"steelFabricator", true, func(project entity.Project) string { return project.SteelFabricatorNameID }},
+	{"primaryContact", true, func(project entity.Project) string { return project.PrimaryContactNameID }},
+}
+
+// graphqlSchema is built from the entity types, relationships follow their ID fields
+var graphqlSchema = newGraphQLSchema()
+
+func newGraphQLSchema() *graphql.Schema {
+	schema := graphql.NewSchema()
+	project := schema.ObjectOf(entity.Project{})
+	company := schema.ObjectOf(entity.Company{})
+	contact := schema.ObjectOf(entity.Contact{})
+	inventory := schema.ObjectOf(entity.Inventory{})
+	inspection := schema.ObjectOf(entity.Inspection{})
+	inventoryCounts := schema.ObjectOf(InventoryCounts{})
+
+	idArg := []graphql.Argument{{Name: "id", Type: &graphql.NonNull{Of: graphql.ID}}}
+	limitArg := []graphql.Argument{{Name: "limit", Type: graphql.Int, Default: graphqlListLimit}}
+	listOf := func(object *graphql.Object) graphql.Type {
+		return &graphql.NonNull{Of: &graphql.List{Of: &graphql.NonNull{Of: object}}}
+	}
+
+	schema.Query.AddField(&graphql.Field{Name: "project", Type: project, Args: idArg, Resolve: resolveProject})
+	schema.Query.AddField(&graphql.Field{Name: "projects", Type: listOf(project), Args: limitArg, Resolve: resolveProjects})
+	schema.Query.AddField(&graphql.Field{Name: "company", Type: company, Args: idArg, Resolve: resolveCompany})
+	schema.Query.AddField(&graphql.Field{Name: "companies", Type: listOf(company), Args: limitArg, Resolve: resolveCompanies})
+	schema.Query.AddField(&graphql.Field{Name: "contact", Type: contact, Args: idArg, Resolve: resolveContact})
+	schema.Query.AddField(&graphql.Field{Name: "contacts", Type: listOf(contact), Args: limitArg, Resolve: resolveContacts})
+	schema.Query.AddField(&graphql.Field{Name: "inventoryItem", Type: inventory, Args: idArg, Resolve: resolveInventoryItem})
+	schema.Query.AddField(&graphql.Field{Name: "inspection", Type: inspection, Args: idArg, Resolve: resolveInspection})
+
+	for _, link := range projectLinks {
+		link := link
+		if link.Contact {
+			project.AddField(&graphql.Field{
+				Name:        link.Name,
+				Description: "The contact in " + link.Name + "NameID",
+				Type:        contact,
+				Resolve: func(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+					return graphqlLoaderFrom(ctx).projectContacts(parents, link.ID)
+				},
+			})
+			continue
+		}
+		project.AddField(&graphql.Field{
+			Name:        link.Name,
+			Description: "The company in " + link.Name + "ID",
+			Type:        company,
+			Resolve: func(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+				return graphqlLoaderFrom(ctx).projectCompanies(parents, link.ID)
+			},
+		})
+	}
+	project.AddField(&graphql.Field{Name: "inventory", Type: listOf(inventory), Args: limitArg, Resolve: resolveProjectInventory})
+	project.AddField(&graphql.Field{Name: "inventoryCounts", Type: &graphql.NonNull{Of: inventoryCounts}, Resolve: resolveProjectInventoryCounts})
+	project.AddField(&graphql.Field{Name: "inspections", Description: "Most recent first", Type: listOf(inspection), Args: limitArg, Resolve: resolveProjectInspections})
+	inventory.AddField(&graphql.Field{Name: "project", Type: project, Resolve: resolveProjectOf})
+	inspection.AddField(&graphql.Field{Name: "project", Type: project, Resolve: resolveProjectOf})
+
+	return schema
+}
+
+// graphqlLimits gets the query limits from the config
+func (a App) graphqlLimits() graphql.Limits {
+	limits := graphql.Limits{MaxDepth: defaultGraphQLMaxDepth, MaxCost: defaultGraphQLMaxCost}
+	if a.Config != nil && a.Config.GraphQLMaxDepth > 0 {
+		limits.MaxDepth = a.Config.GraphQLMaxDepth
+	}
+	if a.Config != nil && a.Config.GraphQLMaxCost > 0 {
+		limits.MaxCost = a.Config.GraphQLMaxCost
+	}
+
+	return limits
+}
+
+// GraphQLHandler runs a GraphQL query, sent as a JSON body or in the query string
+func (a App) GraphQLHandler(w http.ResponseWriter, r *http.Request) {
+	var request graphql.Request
+	if r.Method == http.MethodGet {
+		request.Query = r.URL.Query().Get("query")
+		request.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			err := json.Unmarshal([]byte(variables), &request.Variables)
+			if err != nil {
+				errorResponse(paceerror.BadRequest(err), w)
+				return
+			}
+		}
+	} else {
+		err := decodeJSON(r, &request)
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error decoding JSON of a GraphQL query: %s", err), r)
+			errorResponse(paceerror.BadRequest(err), w)
+			return
+		}
+	}
+
+	scope, err := a.scope(r)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting caller scope: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	loader := &graphqlLoader{
+		app:       a,
+		request:   r,
+		scope:     scope,
+		projects:  map[string]*entity.Project{},
+		companies: map[string]*entity.Company{},
+		contacts:  map[string]*entity.Contact{},
+		inventory: map[string][]entity.Inventory{},
+	}
+	ctx := context.WithValue(r.Context(), graphqlLoaderKey{}, loader)
+
+	jsonResponse(http.StatusOK, graphqlSchema.Execute(ctx, request, a.graphqlLimits()), w)
+}
+
+// GraphQLSchemaHandler sends the GraphQL schema in the schema definition language
+func (a App) GraphQLSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(graphqlSchema.SDL()))
+}
+
+type graphqlLoaderKey struct{}
+
+// graphqlLoader loads records for one GraphQL request, reading each record at
+// most once and all the records a level of the query needs in one call
+type graphqlLoader struct {
+	app     App
+	request *http.Request
+	scope   auth.Scope
+	// Records by ID, nil for IDs that weren't found
+	projects  map[string]*entity.Project
+	companies map[string]*entity.Company
+	contacts  map[string]*entity.Contact
+	// inventory by project ID
+	inventory map[string][]entity.Inventory
+}
+
+func graphqlLoaderFrom(ctx context.Context) *graphqlLoader {
+	return ctx.Value(graphqlLoaderKey{}).(*graphqlLoader)
+}
+
+// require checks an API key was granted read access to a resource
+func (l *graphqlLoader) require(resource string) error {
+	scope := resource + ":read"
+	if !l.scope.Identity.HasScope(scope) {
+		return fmt.Errorf("API key is missing the %s scope", scope)
+	}
+
+	return nil
+}
+
+// fail logs err and hides the details of internal errors
+func (l *graphqlLoader) fail(err error) error {
+	if paceerror.CodeOf(err) == paceerror.CodeInternal {
+		rollbar.Warning(fmt.Sprintf("Error resolving a GraphQL query: %s", err), l.request)
+		return errors.New("Internal server error")
+	}
+	var pErr *paceerror.Error
+	if errors.As(err, &pErr) {
+		return errors.New(pErr.Message)
+	}
+
+	return err
+}
+
+// missing gets the IDs that aren't loaded yet, without blanks and duplicates
+func missing(IDs []string, loaded func(ID string) bool) []string {
+	var missingIDs []string
+	seen := map[string]bool{}
+	for _, ID := range IDs {
+		if ID != "" && !seen[ID] && !loaded(ID) {
+			seen[ID] = true
+			missingIDs = append(missingIDs, ID)
+		}
+	}
+
+	return missingIDs
+}
+
+func (l *graphqlLoader) loadProjects(IDs []string) error {
+	IDs = missing(IDs, func(ID string) bool { _, ok := l.projects[ID]; return ok })
+	if len(IDs) == 0 {
+		return nil
+	}
+	provider, err := l.app.Container.ProjectProvider()
+	if err != nil {
+		return l.fail(err)
+	}
+	projects, err := provider.GetByIDs(IDs)
+	if err != nil {
+		return l.fail(err)
+	}
+	for _, ID := range IDs {
+		l.projects[ID] = nil
+	}
+	for i := range projects {
+		l.projects[projects[i].ID] = &projects[i]
+	}
+
+	return nil
+}
+
+func (l *graphqlLoader) loadCompanies(IDs []string) error {
+	IDs = missing(IDs, func(ID string) bool { _, ok := l.companies[ID]; return ok })
+	if len(IDs) == 0 {
+		return nil
+	}
+	provider, err := l.app.Container.CompanyProvider()
+	if err != nil {
+		return l.fail(err)
+	}
+	companies, err := provider.GetByIDs(IDs)
+	if err != nil {
+		return l.fail(err)
+	}
+	for _, ID := range IDs {
+		l.companies[ID] = nil
+	}
+	for i := range companies {
+		l.companies[companies[i].ID] = &companies[i]
+	}
+
+	return nil
+}
+
+func (l *graphqlLoader) loadContacts(IDs []string) error {
+	IDs = missing(IDs, func(ID string) bool { _, ok := l.contacts[ID]; return ok })
+	if len(IDs) == 0 {
+		return nil
+	}
+	provider, err := l.app.Container.ContactProvider()
+	if err != nil {
+		return l.fail(err)
+	}
+	contacts, err := provider.GetByIDs(IDs)
+	if err != nil {
+		return l.fail(err)
+	}
+	for _, ID := range IDs {
+		l.contacts[ID] = nil
+	}
+	for i := range contacts {
+		l.contacts[contacts[i].ID] = &contacts[i]
+	}
+
+	return nil
+}
+
+func (l *graphqlLoader) loadInventory(projectIDs []string) error {
+	projectIDs = missing(projectIDs, func(ID string) bool { _, ok := l.inventory[ID]; return ok })
+	if len(projectIDs) == 0 {
+		return nil
+	}
+	provider, err := l.app.Container.InventoryProvider()
+	if err != nil {
+		return l.fail(err)
+	}
+	inventory, err := provider.GetByProjectIDs(projectIDs)
+	if err != nil {
+		return l.fail(err)
+	}
+	for _, projectID := range projectIDs {
+		l.inventory[projectID] = []entity.Inventory{}
+	}
+	for _, item := range inventory {
+		l.inventory[item.ProjectID] = append(l.inventory[item.ProjectID], item)
+	}
+
+	return nil
+}
+
+// project gets a loaded project the caller can read, nil otherwise
+func (l *graphqlLoader) project(ID string) interface{} {
+	if project := l.projects[ID]; project != nil && l.scope.CanRead(ID) {
+		return *project
+	}
+
+	return nil
+}
+
+func (l *graphqlLoader) projectCompanies(parents []interface{}, id func(project entity.Project) string) ([]interface{}, error) {
+	err := l.require("company")
+	if err != nil {
+		return nil, err
+	}
+	IDs := make([]string, len(parents))
+	for i, parent := range parents {
+		IDs[i] = id(parent.(entity.Project))
+	}
+	err = l.loadCompanies(IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	companies := make([]interface{}, len(parents))
+	for i, ID := range IDs {
+		if company := l.companies[ID]; company != nil {
+			companies[i] = *company
+		}
+	}
+
+	return companies, nil
+}
+
+func (l *graphqlLoader) projectContacts(parents []interface{}, id func(project entity.Project) string) ([]interface{}, error) {
+	err := l.require("contact")
+	if err != nil {
+		return nil, err
+	}
+	IDs := make([]string, len(parents))
+	for i, parent := range parents {
+		IDs[i] = id(parent.(entity.Project))
+	}
+	err = l.loadContacts(IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	contacts := make([]interface{}, len(parents))
+	for i, ID := range IDs {
+		if contact := l.contacts[ID]; contact != nil {
+			contacts[i] = *contact
+		}
+	}
+
+	return contacts, nil
+}
+
+// limitOf gets the limit argument of a list field
+func limitOf(args map[string]interface{}) (int, error) {
+	limit, _ := args["limit"].(int)
+	if limit < 1 {
+		return 0, errors.New("limit must be at least 1")
+	}
+
+	return limit, nil
+}
+
+func resolveProject(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	l := graphqlLoaderFrom(ctx)
+	err := l.require("project")
+	if err != nil {
+		return nil, err
+	}
+	ID := args["id"].(string)
+	err = l.loadProjects([]string{ID})
+	if err != nil {
+		return nil, err
+	}
+	if l.projects[ID] == nil {
+		return nil, errors.New("Project not found")
+	}
+	if !l.scope.CanRead(ID) {
+		return nil, errors.New("You are not a member of this project")
+	}
+
+	return []interface{}{l.project(ID)}, nil
+}
+
+func resolveProjects(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	l := graphqlLoaderFrom(ctx)
+	err := l.require("project")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := limitOf(args)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := l.app.Container.ProjectProvider()
+	if err != nil {
+		return nil, l.fail(err)
+	}
+	allProjects, err := provider.GetAll()
+	if err != nil {
+		return nil, l.fail(err)
+	}
+
+	projects := make([]entity.Project, 0, limit)
+	for i := range allProjects {
+		l.projects[allProjects[i].ID] = &allProjects[i]
+		if l.scope.CanRead(allProjects[i].ID) && len(projects) < limit {
+			projects = append(projects, allProjects[i])
+		}
+	}
+
+	return []interface{}{projects}, nil
+}
+
+func resolveCompany(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	l := graphqlLoaderFrom(ctx)
+	err := l.require("company")
+	if err != nil {
+		return nil, err
+	}
+	ID := args["id"].(string)
+	err = l.loadCompanies([]string{ID})
+	if err != nil {
+		return nil, err
+	}
+	if l.companies[ID] == nil {
+		return nil, errors.New("Company not found")
+	}
+
+	return []interface{}{*l.companies[ID]}, nil
+}
+
+func resolveCompanies(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	l := graphqlLoaderFrom(ctx)
+	err := l.require("company")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := limitOf(args)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := l.app.Container.CompanyProvider()
+	if err != nil {
+		return nil, l.fail(err)
+	}
+	companies, err := provider.GetAll()
+	if err != nil {
+		return nil, l.fail(err)
+	}
+	for i := range companies {
+		l.companies[companies[i].ID] = &companies[i]
+	}
+	if len(companies) > limit {
+		companies = companies[:limit]
+	}
+
+	return []interface{}{companies}, nil
+}
+
+func resolveContact(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	l := graphqlLoaderFrom(ctx)
+	err := l.require("contact")
+	if err != nil {
+		return nil, err
+	}
+	ID := args["id"].(string)
+	err = l.loadContacts([]string{ID})
+	if err != nil {
+		return nil, err
+	}
+	if l.contacts[ID] == nil {
+		return nil, errors.New("Contact not found")
+	}
+
+	return []interface{}{*l.contacts[ID]}, nil
+}
+
+func resolveContacts(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	l := graphqlLoaderFrom(ctx)
+	err := l.require("contact")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := limitOf(args)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := l.app.Container.ContactProvider()
+	if err != nil {
+		return nil, l.fail(err)
+	}
+	contacts, err := provider.GetAll()
+	if err != nil {
+		return nil, l.fail(err)
+	}
+	for i := range contacts {
+		l.contacts[contacts[i].ID] = &contacts[i]
+	}
+	if len(contacts) > limit {
+		contacts = contacts[:limit]
+	}
+
+	return []interface{}{contacts}, nil
+}
+
+func resolveInventoryItem(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	l := graphqlLoaderFrom(ctx)
+	err := l.require("inventory")
+	if err != nil {
+		return nil, err
+	}
+	provider, err := l.app.Container.InventoryProvider()
+	if err != nil {
+		return nil, l.fail(err)
+	}
+	item, err := provider.GetByID(args["id"].(string))
+	if err != nil {
+		return nil, l.fail(err)
+	}
+	if !l.scope.CanRead(item.ProjectID) {
+		return nil, errors.New("You are not a member of this project")
+	}
+
+	return []interface{}{item}, nil
+}
+
+func resolveInspection(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	l := graphqlLoaderFrom(ctx)
+	err := l.require("inspection")
+	if err != nil {
+		return nil, err
+	}
+	provider, err := l.app.Container.InspectionProvider()
+	if err != nil {
+		return nil, l.fail(err)
+	}
+	inspection, err := provider.GetByID(args["id"].(string))
+	if err != nil {
+		return nil, l.fail(err)
+	}
+	if !l.scope.CanRead(inspection.ProjectID) {
+		return nil, errors.New("You are not a member of this project")
+	}
+
+	return []interface{}{inspection}, nil
+}
+
+// resolveProjectOf gets the project of inventory items or inspections
+func resolveProjectOf(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	l := graphqlLoaderFrom(ctx)
+	err := l.require("project")
+	if err != nil {
+		return nil, err
+	}
+	IDs := make([]string, len(parents))
+	for i, parent := range parents {
+		switch parent := parent.(type) {
+		case entity.Inventory:
+			IDs[i] = parent.ProjectID
+		case entity.Inspection:
+			IDs[i] = parent.ProjectID
+		}
+	}
+	err = l.loadProjects(IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make([]interface{}, len(parents))
+	for i, ID := range IDs {
+		projects[i] = l.project(ID)
+	}
+
+	return projects, nil
+}
+
+func resolveProjectInventory(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	l := graphqlLoaderFrom(ctx)
+	err := l.require("inventory")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := limitOf(args)
+	if err != nil {
+		return nil, err
+	}
+	IDs := projectIDs(parents)
+	err = l.loadInventory(IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := make([]interface{}, len(parents))
+	for i, ID := range IDs {
+		items := l.inventory[ID]
+		if len(items) > limit {
+			items = items[:limit]
+		}
+		inventory[i] = items
+	}
+
+	return inventory, nil
+}
+
+func resolveProjectInventoryCounts(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	l := graphqlLoaderFrom(ctx)
+	err := l.require("inventory")
+	if err != nil {
+		return nil, err
+	}
+	IDs := projectIDs(parents)
+	err = l.loadInventory(IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]interface{}, len(parents))
+	for i, ID := range IDs {
+		var count InventoryCounts
+		for _, item := range l.inventory[ID] {
+			count.Total++
+			if item.Stage.Raw {
+				count.Raw++
+			}
+			if item.Stage.InProcess {
+				count.InProcess++
+			}
+			if item.Stage.OnHold {
+				count.OnHold++
+			}
+			if item.Stage.Finished {
+				count.Finished++
+			}
+			if item.Passed {
+				count.Passed++
+			}
+		}
+		counts[i] = count
+	}
+
+	return counts, nil
+}
+
+func resolveProjectInspections(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	l := graphqlLoaderFrom(ctx)
+	err := l.require("inspection")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := limitOf(args)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := l.app.Container.InspectionProvider()
+	if err != nil {
+		return nil, l.fail(err)
+	}
+	IDs := projectIDs(parents)
+	allInspections, err := provider.GetByProjectIDs(missing(IDs, func(string) bool { return false }))
+	if err != nil {
+		return nil, l.fail(err)
+	}
+	sort.SliceStable(allInspections, func(i, j int) bool { return allInspections[i].Created > allInspections[j].Created })
+
+	byProject := map[string][]entity.Inspection{}
+	for _, inspection := range allInspections {
+		if len(byProject[inspection.ProjectID]) < limit {
+			byProject[inspection.ProjectID] = append(byProject[inspection.ProjectID], inspection)
+		}
+	}
+	inspections := make([]interface{}, len(parents))
+	for i, ID := range IDs {
+		inspections[i] = byProject[ID]
+		if byProject[ID] == nil {
+			inspections[i] = []entity.Inspection{}
+		}
+	}
+
+	return inspections, nil
+}
+
+func projectIDs(parents []interface{}) []string {
+	IDs := make([]string, len(parents))
+	for i, parent := range parents {
+		IDs[i] = parent.(entity.Project).ID
+	}
+
+	return IDs
+}
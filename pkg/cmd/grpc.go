@@ -0,0 +1,503 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/rpc"
+	"github.com/rollbar/rollbar-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newGRPCServer makes the gRPC server for the services in proto/pace.proto. It
+// uses the same auth as the REST API, sent as authorization metadata.
+func (a App) newGRPCServer() *grpc.Server {
+	type methodInfo struct {
+		resource string
+		write    bool
+	}
+	methods := map[string]methodInfo{}
+	services := a.grpcServices()
+	for _, service := range services {
+		for _, method := range service.Methods {
+			methods["/"+service.FullName()+"/"+method.Name] = methodInfo{resource: service.Resource, write: method.Write}
+		}
+	}
+	authenticate := func(ctx context.Context, fullMethod string) (context.Context, error) {
+		method := methods[fullMethod]
+		scope := method.resource + ":read"
+		if method.write {
+			scope = method.resource + ":write"
+		}
+		identity, err := a.grpcIdentity(ctx, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		return auth.NewContext(ctx, identity), nil
+	}
+
+	server := grpc.NewServer(
+		grpc.CustomCodec(rpc.Codec{}),
+		grpc.UnaryInterceptor(func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := authenticate(ctx, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			response, err := handler(ctx, request)
+			if err != nil {
+				return nil, grpcError(info.FullMethod, err)
+			}
+			return response, nil
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := authenticate(stream.Context(), info.FullMethod)
+			if err != nil {
+				return err
+			}
+			err = handler(srv, &grpcStream{ServerStream: stream, ctx: ctx})
+			if err != nil {
+				return grpcError(info.FullMethod, err)
+			}
+			return nil
+		}),
+	)
+	for _, service := range services {
+		service.Register(server)
+	}
+
+	return server
+}
+
+// grpcStream is a stream with the caller's identity in its context
+type grpcStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcIdentity checks the authorization metadata of a call and that API keys have the scope
+func (a App) grpcIdentity(ctx context.Context, scope string) (auth.Identity, error) {
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+		header = md.Get("authorization")[0]
+	}
+
+	identity, err := a.authenticate(header)
+	if err != nil {
+		if strings.HasPrefix(header, "ApiKey ") {
+			rollbar.Warning(fmt.Sprintf("Rejected API key: %s", err))
+			err = auth.ErrInvalidAPIKey
+		}
+		return auth.Identity{}, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if identity.EnrollOnly {
+		return auth.Identity{}, status.Error(codes.PermissionDenied, "Two-factor enrollment required, see /api/2fa/enroll")
+	}
+	if !identity.HasScope(scope) {
+		return auth.Identity{}, status.Errorf(codes.PermissionDenied, "API key is missing the %s scope", scope)
+	}
+
+	return identity, nil
+}
+
+// grpcError logs internal errors and turns err into a status
+func grpcError(fullMethod string, err error) error {
+	if _, ok := status.FromError(err); !ok && paceerror.CodeOf(err) == paceerror.CodeInternal {
+		rollbar.Warning(fmt.Sprintf("Error in %s: %s", fullMethod, err))
+	}
+
+	return rpc.Error(err)
+}
+
+func newIDRequest() interface{}   { return &rpc.IDRequest{} }
+func newNameRequest() interface{} { return &rpc.NameRequest{} }
+func newListRequest() interface{} { return &rpc.ListRequest{} }
+
+// grpcServices are the services of proto/pace.proto. They mirror the
+// providers, with the same permission checks and validation as the REST routes.
+func (a App) grpcServices() []rpc.Service {
+	return []rpc.Service{
+		{Name: "UserService", Resource: "user", Methods: []rpc.Method{
+			{Name: "Get", NewRequest: newIDRequest, Unary: a.grpcGetUser},
+			{Name: "GetByUsername", NewRequest: newNameRequest, Unary: a.grpcGetUserByUsername},
+			{Name: "List", NewRequest: newListRequest, Stream: a.grpcListUsers},
+			{Name: "Add", Write: true, NewRequest: func() interface{} { return &entity.CreateUserRequest{} }, Unary: a.grpcAddUser},
+			{Name: "Update", Write: true, NewRequest: func() interface{} { return &entity.UpdateUserRequest{} }, Unary: a.grpcUpdateUser},
+			{Name: "Delete", Write: true, NewRequest: newIDRequest, Unary: a.grpcDeleteUser},
+		}},
+		{Name: "ContactService", Resource: "contact", Methods: []rpc.Method{
+			{Name: "Get", NewRequest: newIDRequest, Unary: a.grpcGetContact},
+			{Name: "List", NewRequest: newListRequest, Stream: a.grpcListContacts},
+			{Name: "Add", Write: true, NewRequest: func() interface{} { return &entity.Contact{} }, Unary: a.grpcAddContact},
+			{Name: "Update", Write: true, NewRequest: func() interface{} { return &entity.Contact{} }, Unary: a.grpcUpdateContact},
+			{Name: "Delete", Write: true, NewRequest: newIDRequest, Unary: a.grpcDeleteContact},
+		}},
+		{Name: "CompanyService", Resource: "company", Methods: []rpc.Method{
+			{Name: "Get", NewRequest: newIDRequest, Unary: a.grpcGetCompany},
+			{Name: "GetByName", NewRequest: newNameRequest, Unary: a.grpcGetCompanyByName},
+			{Name: "List", NewRequest: newListRequest, Stream: a.grpcListCompanies},
+			{Name: "Add", Write: true, NewRequest: func() interface{} { return &entity.Company{} }, Unary: a.grpcAddCompany},
+			{Name: "Update", Write: true, NewRequest: func() interface{} { return &entity.Company{} }, Unary: a.grpcUpdateCompany},
+			{Name: "Delete", Write: true, NewRequest: newIDRequest, Unary: a.grpcDeleteCompany},
+		}},
+		{Name: "ProjectService", Resource: "project", Methods: []rpc.Method{
+			{Name: "Get", NewRequest: newIDRequest, Unary: a.grpcGetProject},
+			{Name: "GetByName", NewRequest: newNameRequest, Unary: a.grpcGetProjectByName},
+			{Name: "List", NewRequest: newListRequest, Stream: a.grpcListProjects},
+			{Name: "Add", Write: true, NewRequest: func() interface{} { return &entity.Project{} }, Unary: a.grpcAddProject},
+			{Name: "Update", Write: true, NewRequest: func() interface{} { return &entity.UpdateProjectRequest{} }, Unary: a.grpcUpdateProject},
+			{Name: "Delete", Write: true, NewRequest: newIDRequest, Unary: a.grpcDeleteProject},
+		}},
+		{Name: "InventoryService", Resource: "inventory", Methods: []rpc.Method{
+			{Name: "Get", NewRequest: newIDRequest, Unary: a.grpcGetInventory},
+			{Name: "List", NewRequest: newListRequest, Stream: a.grpcListInventory},
+			{Name: "Add", Write: true, NewRequest: func() interface{} { return &entity.Inventory{} }, Unary: a.grpcAddInventory},
+			{Name: "Update", Write: true, NewRequest: func() interface{} { return &entity.UpdateInventoryRequest{} }, Unary: a.grpcUpdateInventory},
+			{Name: "Delete", Write: true, NewRequest: newIDRequest, Unary: a.grpcDeleteInventory},
+		}},
+		{Name: "InspectionService", Resource: "inspection", Methods: []rpc.Method{
+			{Name: "Get", NewRequest: newIDRequest, Unary: a.grpcGetInspection},
+			{Name: "List", NewRequest: newListRequest, Stream: a.grpcListInspections},
+			{Name: "Add", Write: true, NewRequest: func() interface{} { return &entity.UpdateInspectionRequest{} }, Unary: a.grpcAddInspection},
+			{Name: "Update", Write: true, NewRequest: func() interface{} { return &entity.UpdateInspectionRequest{} }, Unary: a.grpcUpdateInspection},
+			{Name: "Delete", Write: true, NewRequest: newIDRequest, Unary: a.grpcDeleteInspection},
+		}},
+	}
+}
+
+func (a App) grpcGetUser(ctx context.Context, request interface{}) (interface{}, error) {
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.GetByID(request.(*rpc.IDRequest).ID)
+}
+
+func (a App) grpcGetUserByUsername(ctx context.Context, request interface{}) (interface{}, error) {
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.GetByUsername(request.(*rpc.NameRequest).Name)
+}
+
+func (a App) grpcListUsers(ctx context.Context, request interface{}, send func(interface{}) error) error {
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		return err
+	}
+	users, err := provider.GetAll()
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		err = send(&users[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a App) grpcAddUser(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.createUser(ctx, *request.(*entity.CreateUserRequest))
+}
+
+func (a App) grpcUpdateUser(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.updateUser(ctx, *request.(*entity.UpdateUserRequest))
+}
+
+func (a App) grpcDeleteUser(ctx context.Context, request interface{}) (interface{}, error) {
+	user, err := a.deleteUser(ctx, request.(*rpc.IDRequest).ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.DeleteResponse{Message: fmt.Sprintf("User %s Deleted", user.Username)}, nil
+}
+
+func (a App) grpcGetContact(ctx context.Context, request interface{}) (interface{}, error) {
+	provider, err := a.Container.ContactProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.GetByID(request.(*rpc.IDRequest).ID)
+}
+
+func (a App) grpcListContacts(ctx context.Context, request interface{}, send func(interface{}) error) error {
+	provider, err := a.Container.ContactProvider()
+	if err != nil {
+		return err
+	}
+	contacts, err := provider.GetAll()
+	if err != nil {
+		return err
+	}
+	for i := range contacts {
+		err = send(&contacts[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a App) grpcAddContact(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.createContact(ctx, *request.(*entity.Contact))
+}
+
+func (a App) grpcUpdateContact(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.updateContact(ctx, *request.(*entity.Contact))
+}
+
+func (a App) grpcDeleteContact(ctx context.Context, request interface{}) (interface{}, error) {
+	contact, err := a.deleteContact(ctx, request.(*rpc.IDRequest).ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.DeleteResponse{Message: fmt.Sprintf("contact %s %s Deleted", contact.FirstName, contact.LastName)}, nil
+}
+
+func (a App) grpcGetCompany(ctx context.Context, request interface{}) (interface{}, error) {
+	provider, err := a.Container.CompanyProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.GetByID(request.(*rpc.IDRequest).ID)
+}
+
+func (a App) grpcGetCompanyByName(ctx context.Context, request interface{}) (interface{}, error) {
+	provider, err := a.Container.CompanyProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.GetByName(request.(*rpc.NameRequest).Name)
+}
+
+func (a App) grpcListCompanies(ctx context.Context, request interface{}, send func(interface{}) error) error {
+	provider, err := a.Container.CompanyProvider()
+	if err != nil {
+		return err
+	}
+	companies, err := provider.GetAll()
+	if err != nil {
+		return err
+	}
+	for i := range companies {
+		err = send(&companies[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a App) grpcAddCompany(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.createCompany(ctx, *request.(*entity.Company))
+}
+
+func (a App) grpcUpdateCompany(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.updateCompany(ctx, *request.(*entity.Company))
+}
+
+func (a App) grpcDeleteCompany(ctx context.Context, request interface{}) (interface{}, error) {
+	company, err := a.deleteCompany(ctx, request.(*rpc.IDRequest).ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.DeleteResponse{Message: fmt.Sprintf("company %s Deleted", company.Name)}, nil
+}
+
+func (a App) grpcGetProject(ctx context.Context, request interface{}) (interface{}, error) {
+	provider, err := a.Container.ProjectProvider()
+	if err != nil {
+		return nil, err
+	}
+	project, err := provider.GetByID(request.(*rpc.IDRequest).ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.readableProject(ctx, project)
+}
+
+func (a App) grpcGetProjectByName(ctx context.Context, request interface{}) (interface{}, error) {
+	provider, err := a.Container.ProjectProvider()
+	if err != nil {
+		return nil, err
+	}
+	project, err := provider.GetByName(request.(*rpc.NameRequest).Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.readableProject(ctx, project)
+}
+
+func (a App) grpcListProjects(ctx context.Context, request interface{}, send func(interface{}) error) error {
+	provider, err := a.Container.ProjectProvider()
+	if err != nil {
+		return err
+	}
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return err
+	}
+	projects, err := provider.GetAll()
+	if err != nil {
+		return err
+	}
+	for i := range projects {
+		if !scope.CanRead(projects[i].ID) {
+			continue
+		}
+		err = send(&projects[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a App) grpcAddProject(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.createProject(ctx, *request.(*entity.Project))
+}
+
+func (a App) grpcUpdateProject(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.updateProject(ctx, *request.(*entity.UpdateProjectRequest))
+}
+
+func (a App) grpcDeleteProject(ctx context.Context, request interface{}) (interface{}, error) {
+	project, err := a.deleteProject(ctx, request.(*rpc.IDRequest).ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.DeleteResponse{Message: fmt.Sprintf("Project %s Deleted", project.Name)}, nil
+}
+
+func (a App) grpcGetInventory(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.getInventory(ctx, request.(*rpc.IDRequest).ID)
+}
+
+func (a App) grpcListInventory(ctx context.Context, request interface{}, send func(interface{}) error) error {
+	provider, err := a.Container.InventoryProvider()
+	if err != nil {
+		return err
+	}
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return err
+	}
+	var inventory []entity.Inventory
+	if projectID := request.(*rpc.ListRequest).ProjectID; projectID != "" {
+		inventory, err = provider.GetByProjectIDs([]string{projectID})
+	} else {
+		inventory, err = provider.GetAll()
+	}
+	if err != nil {
+		return err
+	}
+	for i := range inventory {
+		if !scope.CanRead(inventory[i].ProjectID) {
+			continue
+		}
+		err = send(&inventory[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a App) grpcAddInventory(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.createInventory(ctx, *request.(*entity.Inventory))
+}
+
+func (a App) grpcUpdateInventory(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.updateInventory(ctx, *request.(*entity.UpdateInventoryRequest))
+}
+
+func (a App) grpcDeleteInventory(ctx context.Context, request interface{}) (interface{}, error) {
+	item, err := a.deleteInventory(ctx, request.(*rpc.IDRequest).ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.DeleteResponse{Message: fmt.Sprintf("Inventory item %s deleted", item.ID)}, nil
+}
+
+func (a App) grpcGetInspection(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.getInspection(ctx, request.(*rpc.IDRequest).ID)
+}
+
+func (a App) grpcListInspections(ctx context.Context, request interface{}, send func(interface{}) error) error {
+	provider, err := a.Container.InspectionProvider()
+	if err != nil {
+		return err
+	}
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return err
+	}
+	var inspections []entity.Inspection
+	if projectID := request.(*rpc.ListRequest).ProjectID; projectID != "" {
+		inspections, err = provider.GetByProjectIDs([]string{projectID})
+	} else {
+		inspections, err = provider.GetAll()
+	}
+	if err != nil {
+		return err
+	}
+	for i := range inspections {
+		if !scope.CanRead(inspections[i].ProjectID) {
+			continue
+		}
+		err = send(&inspections[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a App) grpcAddInspection(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.createInspection(ctx, *request.(*entity.UpdateInspectionRequest))
+}
+
+func (a App) grpcUpdateInspection(ctx context.Context, request interface{}) (interface{}, error) {
+	return a.updateInspection(ctx, *request.(*entity.UpdateInspectionRequest))
+}
+
+func (a App) grpcDeleteInspection(ctx context.Context, request interface{}) (interface{}, error) {
+	inspection, err := a.deleteInspection(ctx, request.(*rpc.IDRequest).ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.DeleteResponse{Message: fmt.Sprintf("Inspection %s deleted", inspection.ID)}, nil
+}
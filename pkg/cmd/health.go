@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/health"
+	"github.com/rollbar/rollbar-go"
+)
+
+// Health check defaults, for settings left out of the config
+const (
+	defaultHealthCheckTimeout  = 2 * time.Second
+	defaultHealthCheckCacheTTL = 10 * time.Second
+)
+
+// newHealthChecker checks the config, Firestore and the background workers
+func (a App) newHealthChecker() *health.Checker {
+	timeout := defaultHealthCheckTimeout
+	cacheTTL := defaultHealthCheckCacheTTL
+	if a.Config != nil && a.Config.HealthCheckTimeout > 0 {
+		timeout = a.Config.HealthCheckTimeout
+	}
+	if a.Config != nil && a.Config.HealthCheckCacheTTL > 0 {
+		cacheTTL = a.Config.HealthCheckCacheTTL
+	}
+
+	checker := health.New(timeout, cacheTTL)
+	checker.OnFail = func(name string, result health.Result) {
+		rollbar.Warning(fmt.Sprintf("Readiness check %s failed after %dms: %s", name, result.DurationMS, result.Error))
+	}
+	checker.Add("config", a.checkConfig)
+	if a.Container != nil {
+		checker.Add("firestore", a.Container.Ping)
+		checker.Add("webhookDispatcher", a.Container.WebhookDispatcher().Check)
+	}
+
+	return checker
+}
+
+// checkConfig is an error if there is no config, or its Firebase credentials
+// can't be read
+func (a App) checkConfig(ctx context.Context) error {
+	if a.Config == nil {
+		return errors.New("No config loaded")
+	}
+	file, err := os.Open(a.Config.FirebaseConfig)
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// LivenessHandler answers as long as the server can serve requests. It doesn't
+// check anything else, so a broken dependency doesn't get the server restarted.
+func (a App) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	healthResponse(http.StatusOK, map[string]string{"status": health.StatusOK}, w)
+}
+
+// ReadinessHandler reports whether the server's dependencies are working, with
+// only ok or fail for each check. Errors go to Rollbar, since the probe doesn't
+// need a token. It's a 503 if any of them failed.
+func (a App) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	report := health.Report{Status: health.StatusOK, Checked: time.Now().Format(time.RFC3339), Checks: map[string]health.Result{}}
+	if a.Health != nil {
+		report = a.Health.Check(time.Now())
+	}
+
+	status := http.StatusOK
+	if !report.OK() {
+		status = http.StatusServiceUnavailable
+	}
+	healthResponse(status, report.Public(), w)
+}
+
+// healthResponse sends v as is, unlike jsonResponse, which wraps failures in an
+// error body. Probes aren't cached.
+func healthResponse(statusCode int, v interface{}, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
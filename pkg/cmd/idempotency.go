@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/provider/idempotency"
+	helper "github.com/coma-toast/pace-api/pkg/utils"
+	"github.com/gorilla/mux"
+	"github.com/rollbar/rollbar-go"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	maxIdempotencyKeyLength  = 255
+	defaultIdempotencyKeyTTL = 24 * time.Hour
+)
+
+// idempotentRoutes are the create and batch routes that take an Idempotency-Key.
+// API keys are left out, their response has the secret.
+var idempotentRoutes = map[string]bool{
+	"POST /api/users":          true,
+	"POST /api/contacts":       true,
+	"POST /api/companies":      true,
+	"POST /api/projects":       true,
+	"POST /api/inspections":    true,
+	"POST /api/inventory":      true,
+	"PUT /api/membership":      true,
+	"POST /api/sync/mutations": true,
+	"PUT /api/user":            true,
+	"PUT /api/contact":         true,
+	"PUT /api/company":         true,
+	"PUT /api/project":         true,
+	"PUT /api/inventory":       true,
+	"PUT /api/inspection":      true,
+}
+
+// idempotencyKeyTTL is how long responses are kept for retries
+func (a App) idempotencyKeyTTL() time.Duration {
+	if a.Config != nil && a.Config.IdempotencyKeyTTL > 0 {
+		return a.Config.IdempotencyKeyTTL
+	}
+
+	return defaultIdempotencyKeyTTL
+}
+
+// idempotencyWriter keeps a copy of the response while sending it
+type idempotencyWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *idempotencyWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(data)
+
+	return w.ResponseWriter.Write(data)
+}
+
+// idempotencyMiddleware replays the response to a create request retried with
+// the same Idempotency-Key, so a retry after a timeout doesn't create it twice.
+// Keys are per client, and can't be reused for a different request.
+func (a App) idempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		route := mux.CurrentRoute(r)
+		if key == "" || route == nil || !idempotentRoutes[r.Method+" "+routeTemplate(route)] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			errorResponse(paceerror.New(paceerror.CodeBadRequest, fmt.Sprintf("%s can be up to %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength)), w)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			errorResponse(bodyError(err), w)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		provider, err := a.Container.IdempotencyProvider()
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error getting IdempotencyProvider: %s", err), r)
+			errorResponse(err, w)
+			return
+		}
+
+		client := a.rateLimitClient(r)
+		now := time.Now()
+		record := entity.IdempotencyRecord{
+			ID:          helper.Hash(client+" "+key, ""),
+			Created:     now.Format(time.RFC3339),
+			Expires:     now.Add(a.idempotencyKeyTTL()).Format(time.RFC3339),
+			Client:      client,
+			RequestHash: helper.Hash(r.Method+" "+r.URL.Path+"\n"+string(body), ""),
+		}
+
+		saved, err := provider.Get(record.ID)
+		if err == nil && idempotencyRecordExpired(saved, now) {
+			err = provider.Delete(record.ID)
+			if err == nil {
+				err = idempotency.ErrRecordNotFound
+			}
+		}
+		if !errors.Is(err, idempotency.ErrRecordNotFound) {
+			if err != nil {
+				rollbar.Warning(fmt.Sprintf("Error getting the response for %s: %s", idempotencyKeyHeader, err), r)
+				errorResponse(err, w)
+				return
+			}
+			replayResponse(w, saved, record.RequestHash)
+			return
+		}
+		err = provider.Claim(record)
+		if errors.Is(err, idempotency.ErrKeyInUse) {
+			idempotencyKeyInUse(w)
+			return
+		}
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error claiming %s: %s", idempotencyKeyHeader, err), r)
+			errorResponse(err, w)
+			return
+		}
+
+		recorder := &idempotencyWriter{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		// Server errors may go away, let the client retry them
+		if recorder.status == 0 || recorder.status >= http.StatusInternalServerError {
+			err = provider.Delete(record.ID)
+		} else {
+			record.Status = recorder.status
+			record.ContentType = w.Header().Get("Content-Type")
+			record.Body = recorder.body.Bytes()
+			err = provider.Set(record)
+		}
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error saving the response for %s: %s", idempotencyKeyHeader, err), r)
+		}
+	})
+}
+
+// idempotencyRecordExpired is true once a record is past its TTL
+func idempotencyRecordExpired(record entity.IdempotencyRecord, now time.Time) bool {
+	expires, err := time.Parse(time.RFC3339, record.Expires)
+
+	return err != nil || now.After(expires)
+}
+
+// replayResponse sends the saved response to an earlier request with the key
+func replayResponse(w http.ResponseWriter, saved entity.IdempotencyRecord, requestHash string) {
+	if saved.RequestHash != requestHash {
+		jsonResponse(http.StatusUnprocessableEntity, fmt.Sprintf("%s was already used for a different request", idempotencyKeyHeader), w)
+		return
+	}
+	if saved.Status == 0 {
+		idempotencyKeyInUse(w)
+		return
+	}
+
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.Header().Set("Content-Type", saved.ContentType)
+	w.WriteHeader(saved.Status)
+	w.Write(saved.Body)
+}
+
+func idempotencyKeyInUse(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	jsonResponse(http.StatusConflict, fmt.Sprintf("A request with this %s is still running", idempotencyKeyHeader), w)
+}
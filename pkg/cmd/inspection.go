@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/validate"
+	"github.com/rollbar/rollbar-go"
+)
+
+// getInspection gets an inspection by ID, if the caller can read its project
+func (a App) getInspection(ctx context.Context, ID string) (entity.Inspection, error) {
+	provider, err := a.Container.InspectionProvider()
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+	inspection, err := provider.GetByID(ID)
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+	if !scope.CanRead(inspection.ProjectID) {
+		return entity.Inspection{}, forbidden("You are not a member of this project")
+	}
+
+	return inspection, nil
+}
+
+// createInspection adds an inspection to a project the caller can edit
+func (a App) createInspection(ctx context.Context, inspection entity.UpdateInspectionRequest) (entity.Inspection, error) {
+	err := validate.Struct(inspection)
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+	if !scope.CanWrite(inspection.ProjectID) {
+		return entity.Inspection{}, forbidden("You can't add inspections to this project")
+	}
+
+	provider, err := a.Container.InspectionProvider()
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+
+	return provider.Add(inspection)
+}
+
+// updateInspection saves an update to the inspection with its ID. The caller
+// has to be able to edit both the project it is in and the one it moves to.
+func (a App) updateInspection(ctx context.Context, inspection entity.UpdateInspectionRequest) (entity.Inspection, error) {
+	err := validate.Struct(inspection)
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+
+	provider, err := a.Container.InspectionProvider()
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+	currentInspection, err := provider.GetByID(inspection.ID)
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+	if !scope.CanWrite(currentInspection.ProjectID) || !scope.CanWrite(inspection.ProjectID) {
+		return entity.Inspection{}, forbidden("You can't edit inspections for this project")
+	}
+
+	return provider.Update(inspection)
+}
+
+// deleteInspection deletes an inspection by ID
+func (a App) deleteInspection(ctx context.Context, ID string) (entity.Inspection, error) {
+	provider, err := a.Container.InspectionProvider()
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+	inspection, err := provider.GetByID(ID)
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+	if !scope.CanWrite(inspection.ProjectID) {
+		return entity.Inspection{}, forbidden("You can't delete inspections from this project")
+	}
+	err = provider.Delete(inspection)
+	if err != nil {
+		return entity.Inspection{}, err
+	}
+
+	return inspection, nil
+}
+
+// GetInspectionHandler lists the inspections the caller can read, or gets one by ?id=
+func (a App) GetInspectionHandler(w http.ResponseWriter, r *http.Request) {
+	inspectionID := r.URL.Query().Get("id")
+	if inspectionID != "" {
+		inspection, err := a.getInspection(r.Context(), inspectionID)
+		if err != nil {
+			failedAction(err, w, r)
+			return
+		}
+		a.shapedResponse(inspection, w, r)
+		return
+	}
+
+	provider, err := a.Container.InspectionProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting InspectionProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	scope, err := a.scope(r)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting caller scope: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	allInspections, err := provider.GetAll()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error Getting All Inspections: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	inspections := make([]entity.Inspection, 0, len(allInspections))
+	for _, inspection := range allInspections {
+		if scope.CanRead(inspection.ProjectID) {
+			inspections = append(inspections, inspection)
+		}
+	}
+	a.shapedResponse(inspections, w, r)
+}
+
+// GetInspectionByIDHandler gets an Inspection by ID
+func (a App) GetInspectionByIDHandler(w http.ResponseWriter, r *http.Request) {
+	inspection, err := a.getInspection(r.Context(), pathID(r))
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	a.shapedResponse(inspection, w, r)
+}
+
+// CreateInspectionHandler adds an Inspection
+func (a App) CreateInspectionHandler(w http.ResponseWriter, r *http.Request) {
+	var inspection entity.UpdateInspectionRequest
+	err := decodeBody(r, &inspection)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	newInspection, err := a.createInspection(r.Context(), inspection)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, newInspection, w)
+}
+
+// UpdateInspectionHandler updates the Inspection with the id in the body
+func (a App) UpdateInspectionHandler(w http.ResponseWriter, r *http.Request) {
+	var inspection entity.UpdateInspectionRequest
+	err := decodeBody(r, &inspection)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	updatedInspection, err := a.updateInspection(r.Context(), inspection)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedInspection, w)
+}
+
+// UpdateInspectionByIDHandler replaces (PUT) or patches (PATCH) an Inspection by ID
+func (a App) UpdateInspectionByIDHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := a.Container.InspectionProvider()
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+	currentInspection, err := provider.GetByID(pathID(r))
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	var inspection entity.UpdateInspectionRequest
+	err = readUpdate(r, currentInspection, &inspection)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+	inspection.ID = currentInspection.ID
+
+	updatedInspection, err := a.updateInspection(r.Context(), inspection)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedInspection, w)
+}
+
+// DeleteInspectionHandler deletes the Inspection with the id in the body
+func (a App) DeleteInspectionHandler(w http.ResponseWriter, r *http.Request) {
+	var inspection entity.Inspection
+	err := decodeBody(r, &inspection)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	a.deleteInspectionResponse(inspection.ID, w, r)
+}
+
+// DeleteInspectionByIDHandler deletes an Inspection by ID
+func (a App) DeleteInspectionByIDHandler(w http.ResponseWriter, r *http.Request) {
+	a.deleteInspectionResponse(pathID(r), w, r)
+}
+
+func (a App) deleteInspectionResponse(ID string, w http.ResponseWriter, r *http.Request) {
+	inspection, err := a.deleteInspection(r.Context(), ID)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, fmt.Sprintf("Inspection %s deleted", inspection.ID), w)
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/validate"
+	"github.com/rollbar/rollbar-go"
+)
+
+// getInventory gets an inventory item by ID, if the caller can read its project
+func (a App) getInventory(ctx context.Context, ID string) (entity.Inventory, error) {
+	provider, err := a.Container.InventoryProvider()
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+	item, err := provider.GetByID(ID)
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+	if !scope.CanRead(item.ProjectID) {
+		return entity.Inventory{}, forbidden("You are not a member of this project")
+	}
+
+	return item, nil
+}
+
+// createInventory adds an inventory item to a project the caller can edit
+func (a App) createInventory(ctx context.Context, item entity.Inventory) (entity.Inventory, error) {
+	err := validate.Struct(item)
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+	if !scope.CanWrite(item.ProjectID) {
+		return entity.Inventory{}, forbidden("You can't add inventory to this project")
+	}
+
+	provider, err := a.Container.InventoryProvider()
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+
+	return provider.Add(item)
+}
+
+// updateInventory saves an update to the inventory item with its ID. The caller
+// has to be able to edit both the project it is in and the one it moves to.
+func (a App) updateInventory(ctx context.Context, item entity.UpdateInventoryRequest) (entity.Inventory, error) {
+	err := validate.Struct(item)
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+
+	provider, err := a.Container.InventoryProvider()
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+	currentItem, err := provider.GetByID(item.ID)
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+	if !scope.CanWrite(currentItem.ProjectID) || !scope.CanWrite(item.ProjectID) {
+		return entity.Inventory{}, forbidden("You can't edit inventory for this project")
+	}
+
+	return provider.Update(item)
+}
+
+// deleteInventory deletes an inventory item by ID
+func (a App) deleteInventory(ctx context.Context, ID string) (entity.Inventory, error) {
+	provider, err := a.Container.InventoryProvider()
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+	item, err := provider.GetByID(ID)
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+	if !scope.CanWrite(item.ProjectID) {
+		return entity.Inventory{}, forbidden("You can't delete inventory from this project")
+	}
+	err = provider.Delete(item)
+	if err != nil {
+		return entity.Inventory{}, err
+	}
+
+	return item, nil
+}
+
+// GetInventoryHandler lists the inventory the caller can read, or gets an item by ?id=
+func (a App) GetInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	inventoryID := r.URL.Query().Get("id")
+	if inventoryID != "" {
+		item, err := a.getInventory(r.Context(), inventoryID)
+		if err != nil {
+			failedAction(err, w, r)
+			return
+		}
+		a.shapedResponse(item, w, r)
+		return
+	}
+
+	provider, err := a.Container.InventoryProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting InventoryProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	scope, err := a.scope(r)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting caller scope: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	allInventory, err := provider.GetAll()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting All Inventory: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	inventory := make([]entity.Inventory, 0, len(allInventory))
+	for _, item := range allInventory {
+		if scope.CanRead(item.ProjectID) {
+			inventory = append(inventory, item)
+		}
+	}
+	a.shapedResponse(inventory, w, r)
+}
+
+// GetInventoryByIDHandler gets an Inventory item by ID
+func (a App) GetInventoryByIDHandler(w http.ResponseWriter, r *http.Request) {
+	item, err := a.getInventory(r.Context(), pathID(r))
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	a.shapedResponse(item, w, r)
+}
+
+// CreateInventoryHandler adds an Inventory item
+func (a App) CreateInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	var item entity.Inventory
+	err := decodeBody(r, &item)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	newItem, err := a.createInventory(r.Context(), item)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, newItem, w)
+}
+
+// UpdateInventoryByIDHandler replaces (PUT) or patches (PATCH) an Inventory item by ID
+func (a App) UpdateInventoryByIDHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := a.Container.InventoryProvider()
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+	currentItem, err := provider.GetByID(pathID(r))
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	var item entity.UpdateInventoryRequest
+	err = readUpdate(r, currentItem, &item)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+	item.ID = currentItem.ID
+
+	updatedItem, err := a.updateInventory(r.Context(), item)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedItem, w)
+}
+
+// DeleteInventoryHandler deletes the Inventory item with the id in the body
+func (a App) DeleteInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	var item entity.Inventory
+	err := decodeBody(r, &item)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	a.deleteInventoryResponse(item.ID, w, r)
+}
+
+// DeleteInventoryByIDHandler deletes an Inventory item by ID
+func (a App) DeleteInventoryByIDHandler(w http.ResponseWriter, r *http.Request) {
+	a.deleteInventoryResponse(pathID(r), w, r)
+}
+
+func (a App) deleteInventoryResponse(ID string, w http.ResponseWriter, r *http.Request) {
+	item, err := a.deleteInventory(r.Context(), ID)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, fmt.Sprintf("Inventory item %s deleted", item.ID), w)
+}
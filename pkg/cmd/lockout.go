@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/rollbar/rollbar-go"
+)
+
+// Lockout settings used when they are not set in the config
+const (
+	defaultLoginLockoutThreshold   = 5
+	defaultLoginIPLockoutThreshold = 20
+	defaultLoginLockoutDelay       = 30 * time.Second
+	defaultLoginLockoutMaxDelay    = time.Hour
+)
+
+// lockoutPolicy gets the lockout policy for a username: or ip: key.
+// Whole crews share a yard's IP, so IPs get more attempts than usernames.
+func (a App) lockoutPolicy(key string) auth.LockoutPolicy {
+	policy := auth.LockoutPolicy{
+		Threshold: defaultLoginLockoutThreshold,
+		BaseDelay: defaultLoginLockoutDelay,
+		MaxDelay:  defaultLoginLockoutMaxDelay,
+	}
+	if strings.HasPrefix(key, "ip:") {
+		policy.Threshold = defaultLoginIPLockoutThreshold
+	}
+	if a.Config == nil {
+		return policy
+	}
+
+	if strings.HasPrefix(key, "ip:") && a.Config.LoginIPLockoutThreshold > 0 {
+		policy.Threshold = a.Config.LoginIPLockoutThreshold
+	}
+	if !strings.HasPrefix(key, "ip:") && a.Config.LoginLockoutThreshold > 0 {
+		policy.Threshold = a.Config.LoginLockoutThreshold
+	}
+	if a.Config.LoginLockoutDelay > 0 {
+		policy.BaseDelay = a.Config.LoginLockoutDelay
+	}
+	if a.Config.LoginLockoutMaxDelay > 0 {
+		policy.MaxDelay = a.Config.LoginLockoutMaxDelay
+	}
+
+	return policy
+}
+
+// loginKeys are the failed login counters a login attempt counts against
+func loginKeys(username string, ip string) []string {
+	return []string{"username:" + username, "ip:" + ip}
+}
+
+// lockedFor gets how long until any of the keys may try to log in again
+func (a App) lockedFor(keys []string) (time.Duration, error) {
+	provider, err := a.Container.LoginAttemptProvider()
+	if err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, key := range keys {
+		attempts, err := provider.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if keyWait := auth.LockedFor(attempts, time.Now()); keyWait > wait {
+			wait = keyWait
+		}
+	}
+
+	return wait, nil
+}
+
+// recordFailedLogin counts a failed login against each key, and records any
+// lockouts it causes. Each count is read and saved in one transaction, so
+// guesses sent in parallel all count.
+func (a App) recordFailedLogin(keys []string, ip string) error {
+	provider, err := a.Container.LoginAttemptProvider()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		policy := a.lockoutPolicy(key)
+		locked := false
+		attempts, err := provider.Update(key, func(attempts entity.LoginAttempts) entity.LoginAttempts {
+			attempts, locked = policy.Fail(attempts, time.Now())
+			return attempts
+		})
+		if err != nil {
+			return err
+		}
+
+		if locked {
+			_, err = provider.AddEvent(entity.LockoutEvent{
+				Key:         key,
+				Event:       entity.LockoutEventLocked,
+				Failures:    attempts.Failures,
+				LockedUntil: attempts.LockedUntil,
+				IP:          ip,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// tooManyLogins tells the client when it may try again
+func tooManyLogins(wait time.Duration, w http.ResponseWriter) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	jsonResponse(http.StatusTooManyRequests, fmt.Sprintf("Too many failed logins, try again in %d seconds", seconds), w)
+}
+
+// UnlockLoginHandler clears the failed logins of a username or IP. Admin only.
+func (a App) UnlockLoginHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can unlock logins", w)
+		return
+	}
+
+	var unlock entity.UnlockRequest
+	err := decodeJSON(r, &unlock)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when unlocking a login: %s", err), r)
+		jsonResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	var keys []string
+	if unlock.Username != "" {
+		keys = append(keys, "username:"+unlock.Username)
+	}
+	if unlock.IP != "" {
+		keys = append(keys, "ip:"+unlock.IP)
+	}
+	if len(keys) == 0 {
+		jsonResponse(http.StatusBadRequest, "A username or ip is required", w)
+		return
+	}
+
+	provider, err := a.Container.LoginAttemptProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting LoginAttemptProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	for _, key := range keys {
+		err = provider.Reset(key)
+		if err == nil {
+			_, err = provider.AddEvent(entity.LockoutEvent{
+				Key:   key,
+				Event: entity.LockoutEventUnlocked,
+				IP:    a.clientIP(r),
+				By:    identity.Username,
+			})
+		}
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error unlocking %s: %s", key, err), r)
+			errorResponse(err, w)
+			return
+		}
+	}
+
+	jsonResponse(http.StatusOK, fmt.Sprintf("Unlocked %s", strings.Join(keys, ", ")), w)
+}
+
+// GetLockoutEventsHandler lists lockout and unlock events for review. Admin only.
+func (a App) GetLockoutEventsHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can review lockouts", w)
+		return
+	}
+
+	provider, err := a.Container.LoginAttemptProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting LoginAttemptProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	events, err := provider.GetEvents()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting lockout events: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, events, w)
+}
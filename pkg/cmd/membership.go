@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/validate"
+	"github.com/rollbar/rollbar-go"
+)
+
+// GetMembershipHandler lists the members of a project, or the projects of a user
+func (a App) GetMembershipHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := r.URL.Query().Get("projectID")
+	userID := r.URL.Query().Get("userID")
+
+	scope, err := a.scope(r)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting caller scope: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	provider, err := a.Container.MembershipProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting MembershipProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	var memberships []entity.Membership
+	if projectID != "" {
+		if !scope.CanRead(projectID) {
+			jsonResponse(http.StatusForbidden, "You are not a member of this project", w)
+			return
+		}
+		memberships, err = provider.GetByProject(projectID)
+	} else {
+		if userID == "" {
+			userID = scope.Identity.UserID
+		}
+		if userID != scope.Identity.UserID && !scope.Identity.IsAdmin() {
+			jsonResponse(http.StatusForbidden, "You can only list your own memberships", w)
+			return
+		}
+		memberships, err = provider.GetByUser(userID)
+	}
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting Memberships: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, memberships, w)
+}
+
+// CreateMembershipHandler adds a user to a project
+func (a App) CreateMembershipHandler(w http.ResponseWriter, r *http.Request) {
+	var membership entity.Membership
+	err := decodeJSON(r, &membership)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when creating a Membership: %s", err), r)
+		jsonResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+	err = validate.Struct(membership)
+	if err != nil {
+		errorResponse(err, w)
+		return
+	}
+
+	scope, err := a.scope(r)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting caller scope: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	if !scope.CanManage(membership.ProjectID) {
+		jsonResponse(http.StatusForbidden, "Only project managers can add members", w)
+		return
+	}
+
+	provider, err := a.Container.MembershipProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting MembershipProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	newMembership, err := provider.Add(membership)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error setting MembershipProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, newMembership, w)
+}
+
+// UpdateMembershipHandler changes a member's project role
+func (a App) UpdateMembershipHandler(w http.ResponseWriter, r *http.Request) {
+	var membership entity.Membership
+	err := decodeJSON(r, &membership)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when updating a Membership: %s", err), r)
+		jsonResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+	err = validate.Struct(membership)
+	if err != nil {
+		errorResponse(err, w)
+		return
+	}
+
+	provider, err := a.Container.MembershipProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting MembershipProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	currentMembership, err := provider.GetByID(membership.ID)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting Membership: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	scope, err := a.scope(r)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting caller scope: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	if !scope.CanManage(currentMembership.ProjectID) {
+		jsonResponse(http.StatusForbidden, "Only project managers can change member roles", w)
+		return
+	}
+
+	updatedMembership, err := provider.Update(membership)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error setting MembershipProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedMembership, w)
+}
+
+// DeleteMembershipHandler removes a user from a project
+func (a App) DeleteMembershipHandler(w http.ResponseWriter, r *http.Request) {
+	var membership entity.Membership
+	err := decodeJSON(r, &membership)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when deleting a Membership: %s", err), r)
+		jsonResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	provider, err := a.Container.MembershipProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting MembershipProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	currentMembership, err := provider.GetByID(membership.ID)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting Membership: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	scope, err := a.scope(r)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting caller scope: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	if !scope.CanManage(currentMembership.ProjectID) {
+		jsonResponse(http.StatusForbidden, "Only project managers can remove members", w)
+		return
+	}
+
+	err = provider.Delete(currentMembership)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error deleting Membership: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, fmt.Sprintf("Membership %s Deleted", currentMembership.ID), w)
+}
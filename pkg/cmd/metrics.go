@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/metrics"
+	"github.com/gorilla/mux"
+)
+
+// unmatchedRoute labels requests that didn't match a route, so unknown paths
+// don't each get their own series
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequestsTotal = metrics.Default.NewCounter("pace_http_requests_total",
+		"HTTP requests by route, method and status.", "route", "method", "status")
+	httpRequestDuration = metrics.Default.NewHistogram("pace_http_request_duration_seconds",
+		"How long HTTP requests took, by route and method.", nil, "route", "method")
+	httpRequestsInFlight = metrics.Default.NewGauge("pace_http_requests_in_flight",
+		"HTTP requests being served, by route and method.", "route", "method")
+)
+
+// statusWriter remembers the status of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+// metricsMiddleware counts and times every request by the route of router it
+// matches. Routes are path templates without the version, like
+// /api/users/{id}. It wraps everything else, so the latency is what the client
+// saw.
+func metricsMiddleware(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := unmatchedRoute
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			route = routeTemplate(match.Route)
+		}
+		method := r.Method
+		if !knownMethod(method) {
+			method = "other"
+		}
+
+		httpRequestsInFlight.Add(1, route, method)
+		start := time.Now()
+		writer := &statusWriter{ResponseWriter: w}
+		defer func() {
+			httpRequestsInFlight.Add(-1, route, method)
+			if writer.status == 0 {
+				writer.status = http.StatusOK
+			}
+			httpRequestsTotal.Inc(route, method, strconv.Itoa(writer.status))
+			httpRequestDuration.Observe(time.Since(start).Seconds(), route, method)
+		}()
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// knownMethod is true for the standard HTTP methods
+func knownMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return true
+	}
+
+	return false
+}
+
+// MetricsHandler serves the metrics in the Prometheus text format, to the
+// MetricsAllowedIPs or callers with the MetricsToken. Without either, only
+// loopback clients get them.
+func (a App) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.metricsAllowed(r) {
+		jsonResponse(http.StatusForbidden, "Metrics aren't available to this client", w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	metrics.Default.WriteTo(w)
+}
+
+func (a App) metricsAllowed(r *http.Request) bool {
+	if a.Config == nil || (len(a.Config.MetricsAllowedIPs) == 0 && a.Config.MetricsToken == "") {
+		ip := net.ParseIP(a.clientIP(r))
+		return ip != nil && ip.IsLoopback()
+	}
+	if len(a.Config.MetricsAllowedIPs) > 0 && ipIn(a.clientIP(r), a.Config.MetricsAllowedIPs) {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	return a.Config.MetricsToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.Config.MetricsToken)) == 1
+}
@@ -0,0 +1,423 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/apiversion"
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/paceconfig"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+	"github.com/coma-toast/pace-api/pkg/validate"
+	"github.com/rollbar/rollbar-go"
+)
+
+// mutationResources are the collections offline edits can be uploaded for, and their scope resource
+var mutationResources = map[string]string{
+	"inventory":   "inventory",
+	"inspections": "inspection",
+}
+
+// mutationStore reads and writes the records of a collection for uploaded edits
+type mutationStore struct {
+	// get loads a record and the ID of its project
+	get       func(ID string) (interface{}, string, error)
+	getChange func(ID string) (entity.Change, error)
+	// decode reads a new record (ID is "") or an update from its JSON fields,
+	// validates it and gets its project ID
+	decode func(version *apiversion.Version, ID string, fields map[string]interface{}) (interface{}, string, error)
+	// add saves a new record and gets its ID
+	add func(record interface{}) (interface{}, string, error)
+	// update and delete fail with firestoredb.ErrRevisionChanged if the
+	// record changed since revision
+	update func(record interface{}, revision int64) (interface{}, error)
+	delete func(record interface{}, revision int64) error
+}
+
+func (a App) mutationStore(collection string) (mutationStore, error) {
+	switch collection {
+	case "inventory":
+		provider, err := a.Container.InventoryProvider()
+		if err != nil {
+			return mutationStore{}, err
+		}
+		return mutationStore{
+			get: func(ID string) (interface{}, string, error) {
+				item, err := provider.GetByID(ID)
+				return item, item.ProjectID, err
+			},
+			getChange: provider.GetChange,
+			decode: func(version *apiversion.Version, ID string, fields map[string]interface{}) (interface{}, string, error) {
+				if ID == "" {
+					var item entity.Inventory
+					err := decodeFields(version, fields, &item)
+					return item, item.ProjectID, err
+				}
+				var item entity.UpdateInventoryRequest
+				err := dropServerFields(version, fields, &item)
+				if err == nil {
+					err = decodeFields(version, fields, &item)
+				}
+				item.ID = ID
+				return item, item.ProjectID, err
+			},
+			add: func(record interface{}) (interface{}, string, error) {
+				item, err := provider.Add(record.(entity.Inventory))
+				return item, item.ID, err
+			},
+			update: func(record interface{}, revision int64) (interface{}, error) {
+				return provider.UpdateAtRevision(record.(entity.UpdateInventoryRequest), revision)
+			},
+			delete: func(record interface{}, revision int64) error {
+				return provider.DeleteAtRevision(record.(entity.Inventory), revision)
+			},
+		}, nil
+	case "inspections":
+		provider, err := a.Container.InspectionProvider()
+		if err != nil {
+			return mutationStore{}, err
+		}
+		return mutationStore{
+			get: func(ID string) (interface{}, string, error) {
+				inspection, err := provider.GetByID(ID)
+				return inspection, inspection.ProjectID, err
+			},
+			getChange: provider.GetChange,
+			decode: func(version *apiversion.Version, ID string, fields map[string]interface{}) (interface{}, string, error) {
+				var inspection entity.UpdateInspectionRequest
+				var err error
+				if ID != "" {
+					err = dropServerFields(version, fields, &inspection)
+				}
+				if err == nil {
+					err = decodeFields(version, fields, &inspection)
+				}
+				inspection.ID = ID
+				return inspection, inspection.ProjectID, err
+			},
+			add: func(record interface{}) (interface{}, string, error) {
+				inspection, err := provider.Add(record.(entity.UpdateInspectionRequest))
+				return inspection, inspection.ID, err
+			},
+			update: func(record interface{}, revision int64) (interface{}, error) {
+				return provider.UpdateAtRevision(record.(entity.UpdateInspectionRequest), revision)
+			},
+			delete: func(record interface{}, revision int64) error {
+				return provider.DeleteAtRevision(record.(entity.Inspection), revision)
+			},
+		}, nil
+	}
+
+	return mutationStore{}, fmt.Errorf("%s can't be edited offline", collection)
+}
+
+// decodeFields reads JSON fields into target in the shape of version, and validates it
+func decodeFields(version *apiversion.Version, fields map[string]interface{}, target interface{}) error {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return paceerror.BadRequest(err)
+	}
+	err = decodeVersion(version, bytes.NewReader(data), target)
+	if err != nil {
+		return err
+	}
+
+	return validate.Struct(target)
+}
+
+// jsonDocument gets the JSON fields of v
+func jsonDocument(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	document := map[string]interface{}{}
+	err = json.Unmarshal(data, &document)
+
+	return document, err
+}
+
+// UploadMutationsHandler applies a batch of edits made offline, in order. Each
+// gets a result, so one failed or conflicting edit doesn't stop the rest.
+func (a App) UploadMutationsHandler(w http.ResponseWriter, r *http.Request) {
+	var request entity.MutationRequest
+	err := decodeBody(r, &request)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when uploading mutations: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	err = validate.Struct(request)
+	if err != nil {
+		errorResponse(err, w)
+		return
+	}
+
+	scope, err := a.scope(r)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting caller scope: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	response := entity.MutationResponse{Results: make([]entity.MutationResult, 0, len(request.Mutations))}
+	for _, mutation := range request.Mutations {
+		result := entity.MutationResult{ID: mutation.ID, RecordID: mutation.RecordID}
+		err := a.applyMutation(r, scope, mutation, &result)
+		if err != nil {
+			if paceerror.CodeOf(err) == paceerror.CodeInternal {
+				rollbar.Warning(fmt.Sprintf("Error applying mutation %s to %s %s: %s", mutation.ID, mutation.Collection, mutation.RecordID, err), r)
+			}
+			body := paceerror.NewBody(paceerror.Status(paceerror.CodeOf(err)), err, w.Header().Get(requestIDHeader))
+			result.Status = entity.MutationFailed
+			result.Error = &body.Error
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	jsonResponse(http.StatusOK, response, w)
+}
+
+// mutationAttempts is how many times an edit is merged with a record that
+// keeps changing before it fails with a conflict
+const mutationAttempts = 3
+
+// applyMutation applies one edit, merging it with changes made on the server
+// since its base revision
+func (a App) applyMutation(r *http.Request, scope auth.Scope, mutation entity.Mutation, result *entity.MutationResult) error {
+	err := validate.Struct(mutation)
+	if err != nil {
+		return err
+	}
+	if writeScope := mutationResources[mutation.Collection] + ":write"; !scope.Identity.HasScope(writeScope) {
+		return paceerror.New(paceerror.CodeForbidden, fmt.Sprintf("API key is missing the %s scope", writeScope))
+	}
+	store, err := a.mutationStore(mutation.Collection)
+	if err != nil {
+		return err
+	}
+	version := versionOf(r)
+
+	if mutation.Action == entity.MutationCreate {
+		record, projectID, err := store.decode(version, "", mutation.Changes)
+		if err != nil {
+			return err
+		}
+		if !scope.CanWrite(projectID) {
+			return notAllowed(mutation.Collection)
+		}
+		record, result.RecordID, err = store.add(record)
+		if err != nil {
+			return err
+		}
+		result.Status = entity.MutationApplied
+		result.Record = version.ToDTO(record)
+		return setRevision(store, result)
+	}
+
+	if mutation.RecordID == "" {
+		return paceerror.New(paceerror.CodeBadRequest, fmt.Sprintf("recordID is required to %s", mutation.Action))
+	}
+	// The write fails if the record changed after it was merged with, so merge
+	// again with the new version
+	for attempt := 1; ; attempt++ {
+		*result = entity.MutationResult{ID: mutation.ID, RecordID: mutation.RecordID}
+		err = a.mergeMutation(r, scope, store, mutation, result)
+		if !errors.Is(err, firestoredb.ErrRevisionChanged) || attempt == mutationAttempts {
+			return err
+		}
+	}
+}
+
+// mergeMutation applies an update or delete, merging it with the record as it
+// is now
+func (a App) mergeMutation(r *http.Request, scope auth.Scope, store mutationStore, mutation entity.Mutation, result *entity.MutationResult) error {
+	version := versionOf(r)
+	current, projectID, err := store.get(mutation.RecordID)
+	if err != nil {
+		return err
+	}
+	if !scope.CanWrite(projectID) {
+		return notAllowed(mutation.Collection)
+	}
+	change, err := store.getChange(mutation.RecordID)
+	if err != nil {
+		return err
+	}
+	stale := mutation.BaseRevision != strconv.FormatInt(change.Sequence, 10)
+	clientNewer := editedAfter(mutation.Modified, change.Modified)
+	document, err := jsonDocument(version.ToDTO(current))
+	if err != nil {
+		return err
+	}
+
+	if mutation.Action == entity.MutationDelete {
+		useClient, conflict := a.settleConflict(mutation.Collection, "", clientNewer)
+		if stale && !useClient {
+			result.Status = entity.MutationMerged
+			if conflict {
+				result.Status = entity.MutationConflict
+				result.Conflicts = []entity.FieldConflict{{Server: document}}
+			}
+			result.Record = document
+			return setRevision(store, result)
+		}
+		result.Status = entity.MutationApplied
+		if stale {
+			result.Status = entity.MutationMerged
+		}
+		err = store.delete(current, change.Sequence)
+		if err != nil {
+			return err
+		}
+		return setRevision(store, result)
+	}
+
+	apply, conflicts, err := a.mergeFields(mutation, document, stale, clientNewer)
+	if err != nil {
+		return err
+	}
+	result.Status = entity.MutationApplied
+	if stale {
+		result.Status = entity.MutationMerged
+	}
+	if len(conflicts) > 0 {
+		result.Status = entity.MutationConflict
+		result.Conflicts = conflicts
+	}
+
+	record := current
+	if len(apply) > 0 {
+		for field, value := range apply {
+			document[field] = value
+		}
+		update, projectID, err := store.decode(version, mutation.RecordID, document)
+		if err != nil {
+			return err
+		}
+		// Moving a record needs write access to both projects
+		if !scope.CanWrite(projectID) {
+			return notAllowed(mutation.Collection)
+		}
+		record, err = store.update(update, change.Sequence)
+		if err != nil {
+			return err
+		}
+	}
+	result.Record = version.ToDTO(record)
+
+	return setRevision(store, result)
+}
+
+// notAllowed is the error for edits to projects the caller can't write to
+func notAllowed(collection string) error {
+	return paceerror.New(paceerror.CodeForbidden, fmt.Sprintf("You can't edit %s for this project", collection))
+}
+
+// setRevision sends the record's revision after the edit
+func setRevision(store mutationStore, result *entity.MutationResult) error {
+	change, err := store.getChange(result.RecordID)
+	if err != nil {
+		return err
+	}
+	result.Revision = strconv.FormatInt(change.Sequence, 10)
+
+	return nil
+}
+
+// mergeFields works out which of the client's changes to apply. Without
+// changes on the server since the base revision, that's all of them. Otherwise
+// fields the server didn't change are applied, and fields both sides changed
+// are settled by their conflict policy.
+func (a App) mergeFields(mutation entity.Mutation, server map[string]interface{}, stale bool, clientNewer bool) (map[string]interface{}, []entity.FieldConflict, error) {
+	fields := make([]string, 0, len(mutation.Changes))
+	for field := range mutation.Changes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	apply := map[string]interface{}{}
+	var conflicts []entity.FieldConflict
+	for _, field := range fields {
+		value := mutation.Changes[field]
+		serverValue, ok := server[field]
+		if !ok {
+			return nil, nil, paceerror.New(paceerror.CodeBadRequest, fmt.Sprintf("%s has no field %s", mutation.Collection, field))
+		}
+		if strings.EqualFold(field, "id") || field == "created" {
+			return nil, nil, paceerror.New(paceerror.CodeBadRequest, fmt.Sprintf("%s can't be changed", field))
+		}
+
+		base, hasBase := mutation.Base[field]
+		if !stale || (hasBase && reflect.DeepEqual(base, serverValue)) {
+			apply[field] = value
+			continue
+		}
+		if reflect.DeepEqual(value, serverValue) {
+			continue
+		}
+		useClient, conflict := a.settleConflict(mutation.Collection, field, clientNewer)
+		if useClient {
+			apply[field] = value
+		}
+		if conflict {
+			conflicts = append(conflicts, entity.FieldConflict{Field: field, Base: base, Client: value, Server: serverValue})
+		}
+	}
+
+	return apply, conflicts, nil
+}
+
+// conflictPolicy gets the policy for a field, "" for deleting the record
+func (a App) conflictPolicy(collection string, field string) string {
+	if a.Config == nil {
+		return paceconfig.ConflictManual
+	}
+	for _, policy := range a.Config.ConflictPolicies {
+		if (policy.Collection == "" || policy.Collection == collection) && (policy.Field == "" || strings.EqualFold(policy.Field, field)) {
+			return policy.Policy
+		}
+	}
+
+	return paceconfig.ConflictManual
+}
+
+// settleConflict decides a field changed both on the server and offline: use
+// the client's value or keep the server's, or leave it to the user
+func (a App) settleConflict(collection string, field string, clientNewer bool) (useClient bool, conflict bool) {
+	switch a.conflictPolicy(collection, field) {
+	case paceconfig.ConflictClientWins:
+		return true, false
+	case paceconfig.ConflictServerWins:
+		return false, false
+	case paceconfig.ConflictLastWriterWins:
+		return clientNewer, false
+	}
+
+	return false, true
+}
+
+// editedAfter is true if the offline edit was made after the server's last
+// change. Edits without a time lose.
+func editedAfter(clientModified string, serverModified string) bool {
+	client, err := time.Parse(time.RFC3339, clientModified)
+	if err != nil {
+		return false
+	}
+	server, err := time.Parse(time.RFC3339, serverModified)
+	if err != nil {
+		return true
+	}
+
+	return client.After(server)
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/oidc"
+	"github.com/coma-toast/pace-api/pkg/provider/user"
+	"github.com/rollbar/rollbar-go"
+)
+
+// oidcCookie holds the state of a single sign-on that is in progress
+const oidcCookie = "pace_oidc"
+
+// oidcCookiePath covers the OIDC routes of every API version, since the
+// callback in OIDCRedirectURL can be under a different one than the login
+const oidcCookiePath = "/api"
+
+// oidcLoginTTL is how long the user has to sign in at the IdP
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcLogin is what we need to remember between the redirect to the IdP and the callback
+type oidcLogin struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Expires  int64  `json:"exp"`
+}
+
+// newOIDCProvider discovers the identity provider set in the config, if there is one
+func (a App) newOIDCProvider(ctx context.Context) (*oidc.Provider, error) {
+	if a.Config == nil || a.Config.OIDCIssuer == "" {
+		return nil, nil
+	}
+
+	return oidc.Discover(ctx, oidc.Config{
+		Issuer:       a.Config.OIDCIssuer,
+		DiscoveryURL: a.Config.OIDCDiscoveryURL,
+		ClientID:     a.Config.OIDCClientID,
+		ClientSecret: a.Config.OIDCClientSecret,
+		RedirectURL:  a.Config.OIDCRedirectURL,
+		Scopes:       a.Config.OIDCScopes,
+		GroupsClaim:  a.Config.OIDCGroupsClaim,
+	}, nil)
+}
+
+// ssoRole is the role for a user in the given IdP groups
+func (a App) ssoRole(groups []string) string {
+	if a.Config == nil {
+		return ""
+	}
+	for _, mapping := range a.Config.OIDCRoleMappings {
+		for _, group := range groups {
+			if group == mapping.Group {
+				return mapping.Role
+			}
+		}
+	}
+
+	return a.Config.OIDCDefaultRole
+}
+
+// OIDCLoginHandler sends the user to the identity provider to sign in
+func (a App) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if a.OIDC == nil {
+		jsonResponse(http.StatusNotFound, "Single sign-on is not configured", w)
+		return
+	}
+
+	login := oidcLogin{Expires: time.Now().Add(oidcLoginTTL).Unix()}
+	var err error
+	for _, value := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		*value, err = oidc.NewVerifier()
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error starting single sign-on: %s", err), r)
+			errorResponse(err, w)
+			return
+		}
+	}
+
+	sealed, err := auth.Seal(login, a.tokenSecret())
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error starting single sign-on: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    sealed,
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, a.OIDC.AuthCodeURL(login.State, login.Nonce, login.Verifier), http.StatusFound)
+}
+
+// OIDCCallbackHandler finishes single sign-on, creating or linking the local user by email
+func (a App) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if a.OIDC == nil {
+		jsonResponse(http.StatusNotFound, "Single sign-on is not configured", w)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: oidcCookiePath, MaxAge: -1})
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		jsonResponse(http.StatusUnauthorized, fmt.Sprintf("Single sign-on failed: %s %s", query.Get("error"), query.Get("error_description")), w)
+		return
+	}
+
+	var login oidcLogin
+	cookie, err := r.Cookie(oidcCookie)
+	if err == nil {
+		err = auth.Open(cookie.Value, a.tokenSecret(), &login)
+	}
+	if err != nil || time.Now().Unix() > login.Expires || query.Get("state") == "" || query.Get("state") != login.State {
+		jsonResponse(http.StatusBadRequest, "Single sign-on expired or was started elsewhere, try again", w)
+		return
+	}
+
+	claims, err := a.OIDC.Exchange(r.Context(), query.Get("code"), login.Verifier, login.Nonce)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error finishing single sign-on: %s", err), r)
+		jsonResponse(http.StatusUnauthorized, err.Error(), w)
+		return
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		jsonResponse(http.StatusForbidden, "Your identity provider did not send a verified email", w)
+		return
+	}
+
+	user, err := a.ssoUser(claims)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting single sign-on user %s: %s", claims.Email, err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	sessionProvider, err := a.Container.SessionProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting SessionProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	session, refreshToken, err := sessionProvider.Add(entity.Session{
+		UserID:    user.ID,
+		Expires:   a.refreshExpiry().Format(time.RFC3339),
+		UserAgent: r.UserAgent(),
+		IP:        a.clientIP(r),
+	})
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error starting session for %s: %s", user.Username, err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	rollbar.Info(fmt.Sprintf("Single sign-on for %s (%s)", user.Username, claims.Subject), r)
+	a.tokenResponse(w, r, user, session, refreshToken)
+}
+
+// ssoUser finds the user with the email from the IdP, or creates them.
+// Their role always follows their IdP groups.
+func (a App) ssoUser(claims oidc.Claims) (entity.User, error) {
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		return entity.User{}, err
+	}
+	role := a.ssoRole(claims.Groups)
+
+	existingUser, err := provider.GetByEmail(claims.Email)
+	if errors.Is(err, user.ErrUserNotFound) {
+		// Nobody can log in with the password, it is only there because every user needs one
+		email := user.NormalizeEmail(claims.Email)
+		password, err := oidc.NewVerifier()
+		if err != nil {
+			return entity.User{}, err
+		}
+		rollbar.Info(fmt.Sprintf("Creating single sign-on user %s", email))
+		return provider.Add(entity.User{
+			FirstName: claims.FirstName,
+			LastName:  claims.LastName,
+			Role:      role,
+			Username:  email,
+			Password:  password,
+			Email:     email,
+		})
+	}
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	if existingUser.Role == role {
+		return existingUser, nil
+	}
+	rollbar.Info(fmt.Sprintf("Changing role of %s from %q to %q from their IdP groups", existingUser.Username, existingUser.Role, role))
+
+	return provider.Update(entity.UpdateUserRequest{
+		ID:        existingUser.ID,
+		FirstName: existingUser.FirstName,
+		LastName:  existingUser.LastName,
+		Role:      role,
+		Username:  existingUser.Username,
+		Email:     existingUser.Email,
+		Phone:     existingUser.Phone,
+		TimeZone:  existingUser.TimeZone,
+		DarkMode:  existingUser.DarkMode,
+	})
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/coma-toast/pace-api/pkg/apiversion"
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/graphql"
+	"github.com/coma-toast/pace-api/pkg/openapi"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/gorilla/mux"
+)
+
+// routeDoc describes a route for the OpenAPI document. Routes without one are
+// still listed, just without bodies.
+type routeDoc struct {
+	Summary string
+	// Query parameters, all optional
+	Query    []string
+	Request  interface{}
+	Response interface{}
+	// Deprecated is set on the old flat routes
+	Deprecated bool
+}
+
+// messageResponse stands for the plain string some routes respond with
+var messageResponse = ""
+
+// routeDocs are keyed by method and path template, like "GET /api/users/{id}"
+var routeDocs = map[string]routeDoc{
+	"GET /api/ping":                {Summary: "Check the API is up", Response: messageResponse},
+	"GET /api/openapi.json":        {Summary: "This OpenAPI document", Response: map[string]interface{}{}},
+	"GET /api/docs":                {Summary: "API docs viewer (HTML)"},
+	"GET /api/versions":            {Summary: "List which clients called which API versions (admin)", Response: []apiversion.Use{}},
+	"POST /api/login":              {Summary: "Log in with a username and password", Request: entity.LoginRequest{}, Response: entity.LoginResponse{}},
+	"POST /api/login/unlock":       {Summary: "Clear failed logins of a username or IP (admin)", Request: entity.UnlockRequest{}, Response: messageResponse},
+	"GET /api/login/lockouts":      {Summary: "List lockout events (admin)", Response: []entity.LockoutEvent{}},
+	"GET /api/oidc/login":          {Summary: "Start single sign-on, redirects to the identity provider"},
+	"GET /api/oidc/callback":       {Summary: "Finish single sign-on", Query: []string{"code", "state"}, Response: entity.LoginResponse{}},
+	"POST /api/token/refresh":      {Summary: "Exchange a refresh token for new tokens", Request: entity.RefreshRequest{}, Response: entity.LoginResponse{}},
+	"GET /api/session":             {Summary: "List active logins", Query: []string{"userID"}, Response: []entity.Session{}},
+	"DELETE /api/session":          {Summary: "End one login, or all of them", Request: entity.RevokeSessionRequest{}, Response: messageResponse},
+	"DELETE /api/2fa":              {Summary: "Turn off two-factor auth", Request: entity.TwoFactorCodeRequest{}, Response: messageResponse},
+	"POST /api/2fa/enroll":         {Summary: "Start two-factor enrollment", Response: entity.TwoFactorEnrollResponse{}},
+	"POST /api/2fa/confirm":        {Summary: "Confirm two-factor enrollment", Request: entity.TwoFactorCodeRequest{}, Response: entity.RecoveryCodesResponse{}},
+	"GET /api/2fa/policy":          {Summary: "Get the roles that need two-factor auth", Response: entity.TwoFactorPolicy{}},
+	"POST /api/2fa/policy":         {Summary: "Set the roles that need two-factor auth (admin)", Request: entity.TwoFactorPolicy{}, Response: entity.TwoFactorPolicy{}},
+	"GET /api/users":               {Summary: "List users, or get one by username", Query: []string{"username", "fields", "expand"}, Response: openapi.OneOf{[]entity.User{}, entity.User{}}},
+	"POST /api/users":              {Summary: "Create a user (admin)", Request: entity.CreateUserRequest{}, Response: entity.User{}},
+	"GET /api/users/{id}":          {Summary: "Get a user", Query: []string{"fields", "expand"}, Response: entity.User{}},
+	"PUT /api/users/{id}":          {Summary: "Replace or patch a user", Request: entity.UpdateUserRequest{}, Response: entity.User{}},
+	"DELETE /api/users/{id}":       {Summary: "Delete a user (admin)", Response: messageResponse},
+	"GET /api/contacts":            {Summary: "List contacts", Query: []string{"fields", "expand"}, Response: []entity.Contact{}},
+	"POST /api/contacts":           {Summary: "Create a contact", Request: entity.Contact{}, Response: entity.Contact{}},
+	"GET /api/contacts/{id}":       {Summary: "Get a contact", Query: []string{"fields", "expand"}, Response: entity.Contact{}},
+	"PUT /api/contacts/{id}":       {Summary: "Replace or patch a contact", Request: entity.Contact{}, Response: entity.Contact{}},
+	"DELETE /api/contacts/{id}":    {Summary: "Delete a contact", Response: messageResponse},
+	"GET /api/companies":           {Summary: "List companies", Query: []string{"fields", "expand"}, Response: []entity.Company{}},
+	"POST /api/companies":          {Summary: "Create a company", Request: entity.Company{}, Response: entity.Company{}},
+	"GET /api/companies/{id}":      {Summary: "Get a company", Query: []string{"fields", "expand"}, Response: entity.Company{}},
+	"PUT /api/companies/{id}":      {Summary: "Replace or patch a company", Request: entity.Company{}, Response: entity.Company{}},
+	"DELETE /api/companies/{id}":   {Summary: "Delete a company", Response: messageResponse},
+	"GET /api/projects":            {Summary: "List projects, or get one by name", Query: []string{"name", "fields", "expand"}, Response: openapi.OneOf{[]entity.Project{}, entity.Project{}}},
+	"POST /api/projects":           {Summary: "Create a project", Request: entity.Project{}, Response: entity.Project{}},
+	"GET /api/projects/{id}":       {Summary: "Get a project", Query: []string{"fields", "expand"}, Response: entity.Project{}},
+	"PUT /api/projects/{id}":       {Summary: "Replace or patch a project", Request: entity.UpdateProjectRequest{}, Response: entity.Project{}},
+	"DELETE /api/projects/{id}":    {Summary: "Delete a project (project manager)", Response: messageResponse},
+	"GET /api/inventory":           {Summary: "List inventory, or get an item by ID", Query: []string{"id", "fields", "expand"}, Response: openapi.OneOf{[]entity.Inventory{}, entity.Inventory{}}},
+	"POST /api/inventory":          {Summary: "Create an inventory item", Request: entity.UpdateInventoryRequest{}, Response: entity.Inventory{}},
+	"GET /api/inventory/{id}":      {Summary: "Get an inventory item", Query: []string{"fields", "expand"}, Response: entity.Inventory{}},
+	"PUT /api/inventory/{id}":      {Summary: "Replace or patch an inventory item", Request: entity.UpdateInventoryRequest{}, Response: entity.Inventory{}},
+	"DELETE /api/inventory/{id}":   {Summary: "Delete an inventory item", Response: messageResponse},
+	"GET /api/inspections":         {Summary: "List inspections", Query: []string{"fields", "expand"}, Response: []entity.Inspection{}},
+	"POST /api/inspections":        {Summary: "Create an inspection", Request: entity.UpdateInspectionRequest{}, Response: entity.Inspection{}},
+	"GET /api/inspections/{id}":    {Summary: "Get an inspection", Query: []string{"fields", "expand"}, Response: entity.Inspection{}},
+	"PUT /api/inspections/{id}":    {Summary: "Replace or patch an inspection", Request: entity.UpdateInspectionRequest{}, Response: entity.Inspection{}},
+	"DELETE /api/inspections/{id}": {Summary: "Delete an inspection", Response: messageResponse},
+	"GET /api/membership":          {Summary: "List the members of a project, or the projects of a user", Query: []string{"projectID", "userID"}, Response: []entity.Membership{}},
+	"PUT /api/membership":          {Summary: "Add a user to a project (project manager)", Request: entity.Membership{}, Response: entity.Membership{}},
+	"POST /api/membership":         {Summary: "Change a member's project role (project manager)", Request: entity.Membership{}, Response: entity.Membership{}},
+	"DELETE /api/membership":       {Summary: "Remove a user from a project (project manager)", Request: entity.Membership{}, Response: messageResponse},
+	"GET /api/apikey":              {Summary: "List API keys (admin)", Response: []entity.APIKey{}},
+	"PUT /api/apikey":              {Summary: "Create an API key (admin)", Request: entity.APIKey{}, Response: entity.CreateAPIKeyResponse{}},
+	"DELETE /api/apikey":           {Summary: "Revoke an API key (admin)", Request: entity.APIKey{}, Response: messageResponse},
+	"GET /api/graphql":             {Summary: "Run a GraphQL query", Query: []string{"query", "operationName", "variables"}, Response: graphql.Response{}},
+	"POST /api/graphql":            {Summary: "Run a GraphQL query", Request: graphql.Request{}, Response: graphql.Response{}},
+	"GET /api/graphql/schema":      {Summary: "The GraphQL schema (text)"},
+	"GET /api/sync":                {Summary: "Get what changed since each collection's sync token", Query: []string{"users", "contacts", "companies", "projects", "inventory", "inspections"}, Response: map[string]entity.SyncCollection{}},
+	"POST /api/sync/mutations":     {Summary: "Upload edits made offline, merging them with newer changes", Request: entity.MutationRequest{}, Response: entity.MutationResponse{}},
+	"GET /api/search":              {Summary: "Search projects, companies, contacts and inventory", Query: []string{"q", "types", "limit"}, Response: entity.SearchResult{}},
+	// Webhooks, admin only
+	"GET /api/webhooks":                                         {Summary: "List webhooks (admin)", Response: []entity.Webhook{}},
+	"POST /api/webhooks":                                        {Summary: "Subscribe a URL to events (admin)", Request: entity.Webhook{}, Response: entity.CreateWebhookResponse{}},
+	"GET /api/webhooks/{id}":                                    {Summary: "Get a webhook (admin)", Response: entity.Webhook{}},
+	"PUT /api/webhooks/{id}":                                    {Summary: "Replace or patch a webhook (admin)", Request: entity.Webhook{}, Response: entity.Webhook{}},
+	"DELETE /api/webhooks/{id}":                                 {Summary: "Delete a webhook (admin)", Response: messageResponse},
+	"GET /api/webhooks/{id}/deliveries":                         {Summary: "List the latest deliveries of a webhook (admin)", Response: []entity.WebhookDelivery{}},
+	"POST /api/webhooks/{id}/deliveries/{deliveryID}/redeliver": {Summary: "Send a delivery again (admin)", Response: entity.WebhookDelivery{}},
+	// Deprecated flat routes
+	"GET /api/user":          {Summary: "Use GET /api/users", Query: []string{"username", "fields", "expand"}, Response: openapi.OneOf{[]entity.User{}, entity.User{}}, Deprecated: true},
+	"POST /api/user":         {Summary: "Use PUT /api/users/{id}", Request: entity.UpdateUserRequest{}, Response: entity.User{}, Deprecated: true},
+	"PUT /api/user":          {Summary: "Use POST /api/users", Request: entity.CreateUserRequest{}, Response: entity.User{}, Deprecated: true},
+	"DELETE /api/user":       {Summary: "Use DELETE /api/users/{id}", Request: entity.User{}, Response: messageResponse, Deprecated: true},
+	"GET /api/contact":       {Summary: "Use GET /api/contacts", Query: []string{"fields", "expand"}, Response: []entity.Contact{}, Deprecated: true},
+	"POST /api/contact":      {Summary: "Use PUT /api/contacts/{id}", Request: entity.Contact{}, Response: entity.Contact{}, Deprecated: true},
+	"PUT /api/contact":       {Summary: "Use POST /api/contacts", Request: entity.Contact{}, Response: entity.Contact{}, Deprecated: true},
+	"DELETE /api/contact":    {Summary: "Use DELETE /api/contacts/{id}", Request: entity.Contact{}, Response: messageResponse, Deprecated: true},
+	"GET /api/company":       {Summary: "Use GET /api/companies", Query: []string{"fields", "expand"}, Response: []entity.Company{}, Deprecated: true},
+	"POST /api/company":      {Summary: "Use PUT /api/companies/{id}", Request: entity.Company{}, Response: entity.Company{}, Deprecated: true},
+	"PUT /api/company":       {Summary: "Use POST /api/companies", Request: entity.Company{}, Response: entity.Company{}, Deprecated: true},
+	"DELETE /api/company":    {Summary: "Use DELETE /api/companies/{id}", Request: entity.Company{}, Response: messageResponse, Deprecated: true},
+	"GET /api/project":       {Summary: "Use GET /api/projects", Query: []string{"name", "fields", "expand"}, Response: openapi.OneOf{[]entity.Project{}, entity.Project{}}, Deprecated: true},
+	"POST /api/project":      {Summary: "Use PUT /api/projects/{id}", Request: entity.UpdateProjectRequest{}, Response: entity.Project{}, Deprecated: true},
+	"PUT /api/project":       {Summary: "Use POST /api/projects", Request: entity.Project{}, Response: entity.Project{}, Deprecated: true},
+	"DELETE /api/project":    {Summary: "Use DELETE /api/projects/{id}", Request: entity.Project{}, Response: messageResponse, Deprecated: true},
+	"PUT /api/inventory":     {Summary: "Use POST /api/inventory", Request: entity.Inventory{}, Response: entity.Inventory{}, Deprecated: true},
+	"DELETE /api/inventory":  {Summary: "Use DELETE /api/inventory/{id}", Request: entity.Inventory{}, Response: messageResponse, Deprecated: true},
+	"GET /api/inspection":    {Summary: "Use GET /api/inspections", Query: []string{"id", "fields", "expand"}, Response: openapi.OneOf{[]entity.Inspection{}, entity.Inspection{}}, Deprecated: true},
+	"POST /api/inspection":   {Summary: "Use PUT /api/inspections/{id}", Request: entity.UpdateInspectionRequest{}, Response: entity.Inspection{}, Deprecated: true},
+	"PUT /api/inspection":    {Summary: "Use POST /api/inspections", Request: entity.UpdateInspectionRequest{}, Response: entity.Inspection{}, Deprecated: true},
+	"DELETE /api/inspection": {Summary: "Use DELETE /api/inspections/{id}", Request: entity.Inspection{}, Response: messageResponse, Deprecated: true},
+}
+
+var pathParameter = regexp.MustCompile(`{(\w+)}`)
+
+// openAPIDocument describes every route of router, with the bodies of version
+func openAPIDocument(router *mux.Router, version *apiversion.Version) (*openapi.Document, error) {
+	document := openapi.New(openapi.Info{
+		Title:       "PaCE API " + version.Name,
+		Version:     "v0.0.1",
+		Description: "API for the PaCE app. Errors are returned as an ErrorBody.",
+	})
+	document.Components.SecuritySchemes = map[string]*openapi.SecurityScheme{
+		"bearer": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+		"apiKey": {Type: "apiKey", In: "header", Name: "Authorization", Description: "ApiKey pace_<id>.<secret>"},
+	}
+	document.Security = []map[string][]string{{"bearer": {}}, {"apiKey": {}}}
+	errorResponse := document.JSON("Error", paceerror.Body{})
+
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		fullPath, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		path := routeTemplate(route)
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{http.MethodGet}
+		}
+
+		for _, method := range methods {
+			doc := routeDocs[method+" "+path]
+			if method == http.MethodPatch {
+				// PATCH takes a JSON merge patch with any of the PUT fields
+				doc = routeDocs[http.MethodPut+" "+path]
+			}
+			operation := &openapi.Operation{
+				Summary:     doc.Summary,
+				Tags:        []string{auth.Resource(path)},
+				OperationID: operationID(method, path),
+				Deprecated:  doc.Deprecated,
+				Responses:   map[string]*openapi.Response{"default": errorResponse},
+			}
+			if publicRoutes[path] {
+				operation.Security = &[]map[string][]string{}
+			}
+			for _, match := range pathParameter.FindAllStringSubmatch(path, -1) {
+				operation.Parameters = append(operation.Parameters, openapi.Parameter{
+					Name: match[1], In: "path", Required: true, Schema: &openapi.Schema{Type: "string"},
+				})
+			}
+			for _, query := range doc.Query {
+				operation.Parameters = append(operation.Parameters, openapi.Parameter{
+					Name: query, In: "query", Schema: &openapi.Schema{Type: "string"},
+				})
+			}
+			if doc.Request != nil {
+				operation.RequestBody = document.Body(versioned(version, doc.Request))
+			}
+			if doc.Response != nil {
+				operation.Responses["200"] = document.JSON("OK", versioned(version, doc.Response))
+			} else {
+				operation.Responses["200"] = &openapi.Response{Description: "OK"}
+			}
+			document.Add(method, fullPath, operation)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	document.SchemaOf(paceerror.Body{})
+
+	return document, nil
+}
+
+// versioned swaps the entity types of v for the ones version sends
+func versioned(version *apiversion.Version, v interface{}) interface{} {
+	if oneOf, ok := v.(openapi.OneOf); ok {
+		options := openapi.OneOf{}
+		for _, option := range oneOf {
+			options = append(options, versioned(version, option))
+		}
+		return options
+	}
+
+	return reflect.Zero(version.DTOType(reflect.TypeOf(v))).Interface()
+}
+
+// operationID makes an ID like getUsersByID or putInventory from a method and path
+func operationID(method string, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.Split(strings.TrimPrefix(path, "/api/"), "/") {
+		if match := pathParameter.FindStringSubmatch(part); match != nil {
+			part = "by_" + match[1]
+		}
+		for _, word := range strings.FieldsFunc(part, func(r rune) bool { return r == '_' || r == '.' || r == '-' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+
+	return id
+}
+
+// OpenAPIHandler serves the OpenAPI document of the routes of an API version
+func (a App) OpenAPIHandler(router *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		document, err := openAPIDocument(router, versionOf(r))
+		if err != nil {
+			errorResponse(err, w)
+			return
+		}
+
+		jsonResponse(http.StatusOK, document, w)
+	}
+}
+
+// DocsHandler serves a page that shows the OpenAPI document
+func (a App) DocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; script-src 'unsafe-inline'; connect-src 'self'; frame-ancestors 'none'")
+	w.Write([]byte(docsPage))
+}
@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/validate"
+	"github.com/rollbar/rollbar-go"
+)
+
+// readableProject checks the caller is a member of the project
+func (a App) readableProject(ctx context.Context, project entity.Project) (entity.Project, error) {
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return entity.Project{}, err
+	}
+	if !scope.CanRead(project.ID) {
+		return entity.Project{}, forbidden("You are not a member of this project")
+	}
+
+	return project, nil
+}
+
+// createProject adds a new project. Admins and project managers can, and
+// anyone but admins becomes the manager of what they create.
+func (a App) createProject(ctx context.Context, project entity.Project) (entity.Project, error) {
+	identity, _ := auth.FromContext(ctx)
+	if !identity.CanCreateProjects() {
+		return entity.Project{}, forbidden("Only admins and project managers can create projects")
+	}
+	err := validate.Struct(project)
+	if err != nil {
+		return entity.Project{}, err
+	}
+
+	provider, err := a.Container.ProjectProvider()
+	if err != nil {
+		return entity.Project{}, err
+	}
+	newProject, err := provider.Add(project)
+	if err != nil {
+		return entity.Project{}, err
+	}
+
+	// Admins can already see everything. Anyone else manages what they create.
+	if !identity.IsAdmin() {
+		membershipProvider, err := a.Container.MembershipProvider()
+		if err == nil {
+			_, err = membershipProvider.Add(entity.Membership{
+				UserID:    identity.UserID,
+				ProjectID: newProject.ID,
+				Role:      entity.ProjectRoleManager,
+			})
+		}
+		if err != nil {
+			return entity.Project{}, fmt.Errorf("Error adding %s as manager of new Project %s: %w", identity.Username, newProject.ID, err)
+		}
+	}
+
+	return newProject, nil
+}
+
+// updateProject saves an update to the project with its ID, or its Name without one
+func (a App) updateProject(ctx context.Context, project entity.UpdateProjectRequest) (entity.Project, error) {
+	err := validate.Struct(project)
+	if err != nil {
+		return entity.Project{}, err
+	}
+
+	provider, err := a.Container.ProjectProvider()
+	if err != nil {
+		return entity.Project{}, err
+	}
+	var currentProject entity.Project
+	if project.ID != "" {
+		currentProject, err = provider.GetByID(project.ID)
+	} else {
+		currentProject, err = provider.GetByName(project.Name)
+	}
+	if err != nil {
+		return entity.Project{}, err
+	}
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return entity.Project{}, err
+	}
+	if !scope.CanWrite(currentProject.ID) {
+		return entity.Project{}, forbidden("You can't edit this project")
+	}
+
+	return provider.Update(project)
+}
+
+// deleteProject deletes a project by ID, along with its memberships. Only its managers can.
+func (a App) deleteProject(ctx context.Context, ID string) (entity.Project, error) {
+	provider, err := a.Container.ProjectProvider()
+	if err != nil {
+		return entity.Project{}, err
+	}
+	project, err := provider.GetByID(ID)
+	if err != nil {
+		return entity.Project{}, err
+	}
+	scope, err := a.contextScope(ctx)
+	if err != nil {
+		return entity.Project{}, err
+	}
+	if !scope.CanManage(project.ID) {
+		return entity.Project{}, forbidden("Only project managers can delete a project")
+	}
+
+	err = provider.Delete(project)
+	if err != nil {
+		return entity.Project{}, err
+	}
+	err = a.deleteProjectMemberships(project.ID)
+	if err != nil {
+		return entity.Project{}, err
+	}
+
+	return project, nil
+}
+
+// GetProjectHandler lists the projects the caller can read, or gets one by ?name=
+func (a App) GetProjectHandler(w http.ResponseWriter, r *http.Request) {
+	projectName := r.URL.Query().Get("name")
+	provider, err := a.Container.ProjectProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting ProjectProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	if projectName != "" {
+		project, err := provider.GetByName(projectName)
+		if err == nil {
+			project, err = a.readableProject(r.Context(), project)
+		}
+		if err != nil {
+			failedAction(err, w, r)
+			return
+		}
+		a.shapedResponse(project, w, r)
+		return
+	}
+
+	scope, err := a.scope(r)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting caller scope: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	allProjects, err := provider.GetAll()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting All Projects: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	projects := make([]entity.Project, 0, len(allProjects))
+	for _, project := range allProjects {
+		if scope.CanRead(project.ID) {
+			projects = append(projects, project)
+		}
+	}
+	a.shapedResponse(projects, w, r)
+}
+
+// GetProjectByIDHandler gets a Project by ID
+func (a App) GetProjectByIDHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := a.Container.ProjectProvider()
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+	project, err := provider.GetByID(pathID(r))
+	if err == nil {
+		project, err = a.readableProject(r.Context(), project)
+	}
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	a.shapedResponse(project, w, r)
+}
+
+// CreateProjectHandler adds a new project
+func (a App) CreateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	var project entity.Project
+	err := decodeBody(r, &project)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	newProject, err := a.createProject(r.Context(), project)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, newProject, w)
+}
+
+// UpdateProjectHandler updates the Project with the id, or the name, in the body
+func (a App) UpdateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	var project entity.UpdateProjectRequest
+	err := decodeBody(r, &project)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	updatedProject, err := a.updateProject(r.Context(), project)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedProject, w)
+}
+
+// UpdateProjectByIDHandler replaces (PUT) or patches (PATCH) a Project by ID, including its name
+func (a App) UpdateProjectByIDHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := a.Container.ProjectProvider()
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+	currentProject, err := provider.GetByID(pathID(r))
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	var project entity.UpdateProjectRequest
+	err = readUpdate(r, currentProject, &project)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+	project.ID = currentProject.ID
+
+	updatedProject, err := a.updateProject(r.Context(), project)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedProject, w)
+}
+
+// DeleteProjectHandler deletes the Project with the id in the body
+func (a App) DeleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	var project entity.Project
+	err := decodeBody(r, &project)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	a.deleteProjectResponse(project.ID, w, r)
+}
+
+// DeleteProjectByIDHandler deletes a Project by ID, along with its memberships
+func (a App) DeleteProjectByIDHandler(w http.ResponseWriter, r *http.Request) {
+	a.deleteProjectResponse(pathID(r), w, r)
+}
+
+func (a App) deleteProjectResponse(ID string, w http.ResponseWriter, r *http.Request) {
+	project, err := a.deleteProject(r.Context(), ID)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, fmt.Sprintf("Project %s Deleted", project.Name), w)
+}
+
+// deleteProjectMemberships removes everyone from a deleted project
+func (a App) deleteProjectMemberships(projectID string) error {
+	membershipProvider, err := a.Container.MembershipProvider()
+	if err != nil {
+		return err
+	}
+	memberships, err := membershipProvider.GetByProject(projectID)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting Memberships of deleted Project %s: %s", projectID, err))
+	}
+	for _, membership := range memberships {
+		err = membershipProvider.Delete(membership)
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error deleting Membership %s: %s", membership.ID, err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/paceconfig"
+	"github.com/coma-toast/pace-api/pkg/ratelimit"
+	"github.com/gorilla/mux"
+	"github.com/rollbar/rollbar-go"
+)
+
+// newLimiter makes a rate limiter from config limits, nil if there are none
+func newLimiter(rateLimits []paceconfig.RateLimit) *ratelimit.Limiter {
+	if len(rateLimits) == 0 {
+		return nil
+	}
+
+	limits := map[string]ratelimit.Limit{}
+	for _, limit := range rateLimits {
+		limits[limit.Group] = ratelimit.Per(limit.Requests, limit.Per, limit.Burst)
+	}
+
+	return ratelimit.New(limits)
+}
+
+// rateLimitClient is who a request counts against: the API key, user or client IP
+func (a App) rateLimitClient(r *http.Request) string {
+	identity, _ := auth.FromContext(r.Context())
+	switch {
+	case identity.IsAPIKey():
+		return "apikey:" + identity.APIKeyID
+	case identity.UserID != "":
+		return "user:" + identity.UserID
+	}
+
+	return "ip:" + a.clientIP(r)
+}
+
+// ipRateLimitMiddleware limits requests per client IP and route group. It runs
+// before authentication, so requests with bad tokens, keys or passwords count too.
+func (a App) ipRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.IPLimiter != nil && !allowRequest(a.IPLimiter, "ip:"+a.clientIP(r), w, r) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitMiddleware limits requests per client and route group, and counts API key daily quotas
+func (a App) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.Limiter != nil && !allowRequest(a.Limiter, a.rateLimitClient(r), w, r) {
+			return
+		}
+
+		identity, _ := auth.FromContext(r.Context())
+		if identity.DailyQuota > 0 {
+			exceeded, err := a.quotaExceeded(identity)
+			if err != nil {
+				// Don't lock out scanning stations because the usage count failed
+				rollbar.Warning(fmt.Sprintf("Error counting daily quota of API key %s: %s", identity.APIKeyID, err), r)
+			}
+			if exceeded {
+				now := time.Now().UTC()
+				midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+				w.Header().Set("Retry-After", strconv.Itoa(int(midnight.Sub(now).Seconds())+1))
+				jsonResponse(http.StatusTooManyRequests, fmt.Sprintf("Daily quota of %d requests used up, it resets at midnight UTC", identity.DailyQuota), w)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowRequest takes a token from the client's bucket for the route group and
+// sets the RateLimit headers, sending a 429 when there are none left
+func allowRequest(limiter *ratelimit.Limiter, client string, w http.ResponseWriter, r *http.Request) bool {
+	var path string
+	if route := mux.CurrentRoute(r); route != nil {
+		path = routeTemplate(route)
+	}
+
+	result := limiter.Allow(auth.Resource(path), client, time.Now())
+	if result.Limit > 0 {
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(result.Reset.Seconds())))
+	}
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(result.RetryAfter.Seconds())))
+		jsonResponse(http.StatusTooManyRequests, fmt.Sprintf("Too many requests, try again in %d seconds", int(result.RetryAfter.Seconds())), w)
+		return false
+	}
+
+	return true
+}
+
+// quotaExceeded counts a request against an API key's daily quota
+func (a App) quotaExceeded(identity auth.Identity) (bool, error) {
+	provider, err := a.Container.APIKeyProvider()
+	if err != nil {
+		return false, err
+	}
+	used, err := provider.CountUse(identity.APIKeyID, time.Now().UTC().Format("2006-01-02"))
+	if err != nil {
+		return false, err
+	}
+
+	return used > identity.DailyQuota, nil
+}
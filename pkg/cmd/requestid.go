@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// requestIDHeader carries the request ID, sent back on every response and in error bodies
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID is what a client supplied request ID has to look like to be reused
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// requestIDMiddleware gives every request an ID, reusing the client's if it sent a usable one
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.New().String()
+		}
+		r.Header.Set(requestIDHeader, requestID)
+		w.Header().Set(requestIDHeader, requestID)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// notFoundHandler answers requests that don't match a route
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(http.StatusNotFound, fmt.Sprintf("No route for %s", r.URL.Path), w)
+}
+
+// methodNotAllowedHandler answers requests to a route with a method it doesn't have
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(http.StatusMethodNotAllowed, fmt.Sprintf("%s is not allowed on %s", r.Method, r.URL.Path), w)
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/coma-toast/pace-api/pkg/apiversion"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/gorilla/mux"
+	"github.com/rollbar/rollbar-go"
+)
+
+// deprecated marks an old flat route, pointing clients at the route that replaces it
+func deprecated(successor string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+		handler(w, r)
+	}
+}
+
+// forbidden is the error for callers that aren't allowed to do what they asked
+func forbidden(message string) error {
+	return paceerror.New(paceerror.CodeForbidden, message)
+}
+
+// failedAction sends the error of a record action, logging it if it is internal.
+// The actions are shared by the flat, ID-addressed and gRPC routes, so they
+// return errors rather than responding.
+func failedAction(err error, w http.ResponseWriter, r *http.Request) {
+	if paceerror.CodeOf(err) == paceerror.CodeInternal {
+		rollbar.Warning(fmt.Sprintf("Error in %s %s: %s", r.Method, r.URL.Path, err), r)
+	}
+	errorResponse(err, w)
+}
+
+// pathID is the {id} of an ID-addressed route
+func pathID(r *http.Request) string {
+	return mux.Vars(r)["id"]
+}
+
+// readUpdate reads the body of a PUT or PATCH into target, in the shape of the
+// request's version. PUT bodies replace the record, PATCH bodies are JSON merge
+// patches (RFC 7386) over current.
+func readUpdate(r *http.Request, current interface{}, target interface{}) error {
+	if r.Method != http.MethodPatch {
+		return decodeBody(r, target)
+	}
+
+	var patch interface{}
+	err := decodeJSON(r, &patch)
+	if err != nil {
+		return bodyError(err)
+	}
+	document, err := jsonDocument(versionOf(r).ToDTO(current))
+	if err != nil {
+		return err
+	}
+	err = dropServerFields(versionOf(r), document, target)
+	if err != nil {
+		return err
+	}
+
+	merged, err := json.Marshal(mergePatch(document, patch))
+	if err != nil {
+		return err
+	}
+
+	return decodeVersion(versionOf(r), bytes.NewReader(merged), target)
+}
+
+// dropServerFields removes the fields of a record that target, an update
+// request, doesn't have, like created, so they aren't unknown fields
+func dropServerFields(version *apiversion.Version, document map[string]interface{}, target interface{}) error {
+	fields, err := jsonDocument(version.ToDTO(reflect.Zero(reflect.TypeOf(target).Elem()).Interface()))
+	if err != nil {
+		return err
+	}
+	for field := range document {
+		if _, ok := fields[field]; !ok {
+			delete(document, field)
+		}
+	}
+
+	return nil
+}
+
+// mergePatch applies a JSON merge patch to a decoded JSON document
+func mergePatch(document interface{}, patch interface{}) interface{} {
+	patchFields, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	fields, ok := document.(map[string]interface{})
+	if !ok {
+		fields = map[string]interface{}{}
+	}
+
+	for key, value := range patchFields {
+		// Field names are matched like encoding/json does, so "Name" patches "name"
+		for existing := range fields {
+			if existing != key && strings.EqualFold(existing, key) {
+				fields[key] = fields[existing]
+				delete(fields, existing)
+			}
+		}
+		if value == nil {
+			delete(fields, key)
+			continue
+		}
+		fields[key] = mergePatch(fields[key], value)
+	}
+
+	return fields
+}
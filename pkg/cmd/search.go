@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/search"
+	"github.com/rollbar/rollbar-go"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchHandler finds projects, companies, contacts and inventory by what's in
+// them, like /api/search?q=warehouse&types=project,company. Only records the
+// caller can read are sent.
+func (a App) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	query := search.Query{Text: r.URL.Query().Get("q"), Types: listParam(r, "types"), Limit: defaultSearchLimit}
+	if strings.TrimSpace(query.Text) == "" {
+		errorResponse(paceerror.New(paceerror.CodeBadRequest, "Search needs a query in q"), w)
+		return
+	}
+	for _, searchType := range query.Types {
+		if !stringIn(searchType, search.Types) {
+			errorResponse(paceerror.New(paceerror.CodeBadRequest, fmt.Sprintf("Can't search %s, try %s", searchType, strings.Join(search.Types, ", "))), w)
+			return
+		}
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		var err error
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit < 1 || query.Limit > maxSearchLimit {
+			errorResponse(paceerror.New(paceerror.CodeBadRequest, fmt.Sprintf("limit has to be from 1 to %d", maxSearchLimit)), w)
+			return
+		}
+	}
+
+	scope, err := a.scope(r)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting project memberships: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	query.CanRead = searchPermission(scope)
+
+	index, err := a.Container.SearchIndex()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error loading the search index: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, index.Search(query), w)
+}
+
+// searchPermission is whether a search result can be sent. Project records
+// need a membership, and API keys the read scope of the type.
+func searchPermission(scope auth.Scope) func(search.Document) bool {
+	return func(document search.Document) bool {
+		if !scope.Identity.HasScope(document.Type + ":read") {
+			return false
+		}
+
+		return document.ProjectID == "" || scope.CanRead(document.ProjectID)
+	}
+}
+
+func stringIn(value string, values []string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
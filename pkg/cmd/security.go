@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/gorilla/handlers"
+)
+
+const defaultMaxBodySize = 1 << 20
+
+// errBodyTooLarge is the error http.MaxBytesReader reads with past the limit
+const errBodyTooLarge = "http: request body too large"
+
+var (
+	defaultCORSMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type", idempotencyKeyHeader, requestIDHeader}
+	// corsExposedHeaders are the response headers browser code can read
+	corsExposedHeaders = []string{
+		requestIDHeader, "Idempotent-Replayed", "Deprecation", "Sunset", "Link",
+		"Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset",
+	}
+)
+
+// securityHeaders are sent with every response. The API only sends JSON, so
+// nothing can be framed or run. DocsHandler loosens the policy for its page.
+var securityHeaders = map[string]string{
+	"X-Content-Type-Options":  "nosniff",
+	"X-Frame-Options":         "DENY",
+	"Referrer-Policy":         "no-referrer",
+	"Content-Security-Policy": "default-src 'none'; frame-ancestors 'none'",
+}
+
+// corsHandler lets the CORSAllowedOrigins call the API from a browser, and
+// answers their preflight requests. Without any origins, next is returned as is.
+func (a App) corsHandler(next http.Handler) http.Handler {
+	if a.Config == nil || len(a.Config.CORSAllowedOrigins) == 0 {
+		return next
+	}
+
+	methods := a.Config.CORSAllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	headers := a.Config.CORSAllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	options := []handlers.CORSOption{
+		handlers.AllowedOrigins(a.Config.CORSAllowedOrigins),
+		handlers.AllowedMethods(methods),
+		handlers.AllowedHeaders(headers),
+		handlers.ExposedHeaders(corsExposedHeaders),
+	}
+	if maxAge := int(a.Config.CORSMaxAge.Seconds()); maxAge > 0 {
+		options = append(options, handlers.MaxAge(maxAge))
+	}
+
+	return varyOrigin(handlers.CORS(options...)(next))
+}
+
+// varyOrigin tells caches the response depends on the Origin, which the CORS
+// handler only does when there is more than one allowed origin
+func varyOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// securityMiddleware sends the security headers and limits the size of request
+// bodies to MaxBodySize. HSTS is only sent over HTTPS.
+func (a App) securityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for header, value := range securityHeaders {
+			w.Header().Set(header, value)
+		}
+		if a.secureRequest(r) {
+			w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		}
+
+		maxBodySize := a.maxBodySize()
+		if r.ContentLength > maxBodySize {
+			errorResponse(paceerror.New(paceerror.CodeTooLarge, fmt.Sprintf("Request bodies can be up to %d bytes", maxBodySize)), w)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a App) maxBodySize() int64 {
+	if a.Config != nil && a.Config.MaxBodySize > 0 {
+		return a.Config.MaxBodySize
+	}
+
+	return defaultMaxBodySize
+}
+
+// secureRequest is true for requests over HTTPS, directly or through a trusted proxy
+func (a App) secureRequest(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return a.trustedProxy(ip) && r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// bodyError is the error for a request body that couldn't be read, a
+// paceerror.CodeTooLarge if it's over MaxBodySize
+func bodyError(err error) *paceerror.Error {
+	if err.Error() == errBodyTooLarge {
+		return &paceerror.Error{Code: paceerror.CodeTooLarge, Message: "Request body is too large", Err: err}
+	}
+
+	return paceerror.BadRequest(err)
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rollbar/rollbar-go"
+	"google.golang.org/grpc"
+)
+
+// Server defaults, for settings left out of the config
+const (
+	defaultListenAddress   = ":8001"
+	defaultReadTimeout     = 30 * time.Second
+	defaultWriteTimeout    = 60 * time.Second
+	defaultIdleTimeout     = 2 * time.Minute
+	defaultShutdownTimeout = 30 * time.Second
+	// readHeaderTimeout stops clients from holding connections open with slow headers
+	readHeaderTimeout = 10 * time.Second
+)
+
+// newHTTPServer makes the HTTP server from the config
+func (a App) newHTTPServer() *http.Server {
+	server := &http.Server{
+		Addr:              defaultListenAddress,
+		Handler:           a.getHandlers(),
+		ReadTimeout:       defaultReadTimeout,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      defaultWriteTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+	}
+	if a.Config == nil {
+		return server
+	}
+	if a.Config.ListenAddress != "" {
+		server.Addr = a.Config.ListenAddress
+	}
+	if a.Config.ReadTimeout > 0 {
+		server.ReadTimeout = a.Config.ReadTimeout
+	}
+	if a.Config.ReadTimeout > 0 && a.Config.ReadTimeout < readHeaderTimeout {
+		server.ReadHeaderTimeout = a.Config.ReadTimeout
+	}
+	if a.Config.WriteTimeout > 0 {
+		server.WriteTimeout = a.Config.WriteTimeout
+	}
+	if a.Config.IdleTimeout > 0 {
+		server.IdleTimeout = a.Config.IdleTimeout
+	}
+
+	return server
+}
+
+// listenAndServe serves HTTPS if there is a certificate, and HTTP if not. It
+// returns nil once the server is shut down.
+func (a App) listenAndServe(server *http.Server) error {
+	var err error
+	if a.Config != nil && a.Config.TLSCertFile != "" && a.Config.TLSKeyFile != "" {
+		err = server.ListenAndServeTLS(a.Config.TLSCertFile, a.Config.TLSKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+// shutdown stops taking requests and waits for the in-flight ones, the gRPC
+// calls and the background workers to finish, for up to ShutdownTimeout. Then
+// the Firestore client is closed and Rollbar flushed.
+func (a App) shutdown(server *http.Server, grpcServer *grpc.Server, stopWorkers context.CancelFunc, workers *sync.WaitGroup) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout())
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error draining HTTP requests, closing the rest: %s", err))
+		server.Close()
+	}
+
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}
+
+	stopWorkers()
+	finished := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		rollbar.Warning("Background workers didn't stop in time")
+	}
+
+	if a.Container != nil {
+		err = a.Container.Close()
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error closing the Firestore client: %s", err))
+		}
+	}
+	rollbar.Info("PACE-API stopped")
+	rollbar.Wait()
+}
+
+func (a App) shutdownTimeout() time.Duration {
+	if a.Config != nil && a.Config.ShutdownTimeout > 0 {
+		return a.Config.ShutdownTimeout
+	}
+
+	return defaultShutdownTimeout
+}
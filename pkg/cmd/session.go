@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/rollbar/rollbar-go"
+)
+
+// GetSessionHandler lists the active logins of the caller, or of any user for admins
+func (a App) GetSessionHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	userID := r.URL.Query().Get("userID")
+	if userID == "" {
+		userID = identity.UserID
+	}
+	if userID != identity.UserID && !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "You can only list your own sessions", w)
+		return
+	}
+
+	provider, err := a.Container.SessionProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting SessionProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	sessions, err := provider.GetByUser(userID)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting Sessions: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, auth.ActiveSessions(sessions), w)
+}
+
+// DeleteSessionHandler revokes one login, or every login of a user when all is set
+func (a App) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	var revoke entity.RevokeSessionRequest
+	err := decodeJSON(r, &revoke)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when revoking a Session: %s", err), r)
+		jsonResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	provider, err := a.Container.SessionProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting SessionProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	identity, _ := auth.FromContext(r.Context())
+	if revoke.All {
+		userID := revoke.UserID
+		if userID == "" {
+			userID = identity.UserID
+		}
+		if userID != identity.UserID && !identity.IsAdmin() {
+			jsonResponse(http.StatusForbidden, "You can only revoke your own sessions", w)
+			return
+		}
+
+		err = provider.RevokeUser(userID)
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error revoking Sessions of user %s: %s", userID, err), r)
+			errorResponse(err, w)
+			return
+		}
+
+		jsonResponse(http.StatusOK, fmt.Sprintf("All sessions of user %s revoked", userID), w)
+		return
+	}
+
+	session, err := provider.GetByID(revoke.ID)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting Session: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	if session.UserID != identity.UserID && !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "You can only revoke your own sessions", w)
+		return
+	}
+
+	err = provider.RevokeFamily(session.FamilyID)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error revoking Session %s: %s", session.ID, err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, fmt.Sprintf("Session %s revoked", session.ID), w)
+}
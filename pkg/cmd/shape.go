@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/rollbar/rollbar-go"
+)
+
+// expansion is a related record ?expand= can embed, found by the ID in a field
+type expansion struct {
+	// kind is "company", "contact" or "project", each kind is loaded in one call
+	kind string
+	ID   func(record interface{}) string
+}
+
+// expansions are the expansions of each entity type, by name
+var expansions = newExpansions()
+
+func newExpansions() map[reflect.Type]map[string]expansion {
+	projectExpansions := map[string]expansion{}
+	for _, link := range projectLinks {
+		link := link
+		kind := "company"
+		if link.Contact {
+			kind = "contact"
+		}
+		projectExpansions[link.Name] = expansion{kind: kind, ID: func(record interface{}) string {
+			return link.ID(record.(entity.Project))
+		}}
+	}
+
+	return map[reflect.Type]map[string]expansion{
+		reflect.TypeOf(entity.Project{}): projectExpansions,
+		reflect.TypeOf(entity.Inventory{}): {
+			"project": {kind: "project", ID: func(record interface{}) string { return record.(entity.Inventory).ProjectID }},
+		},
+		reflect.TypeOf(entity.Inspection{}): {
+			"project": {kind: "project", ID: func(record interface{}) string { return record.(entity.Inspection).ProjectID }},
+		},
+	}
+}
+
+// listParam splits a comma separated query parameter
+func listParam(r *http.Request, name string) []string {
+	var values []string
+	for _, value := range strings.Split(r.URL.Query().Get(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// shapedResponse sends v, a record or a list of them, with only the ?fields=
+// asked for and the related records in ?expand= embedded. Field names are
+// the JSON names of the request's API version.
+func (a App) shapedResponse(v interface{}, w http.ResponseWriter, r *http.Request) {
+	a.setLastModified(v, w, r)
+	fields := listParam(r, "fields")
+	expand := listParam(r, "expand")
+	if len(fields) == 0 && len(expand) == 0 {
+		jsonResponse(http.StatusOK, v, w)
+		return
+	}
+
+	value := reflect.ValueOf(v)
+	records := []interface{}{v}
+	if value.Kind() == reflect.Slice {
+		records = make([]interface{}, value.Len())
+		for i := range records {
+			records[i] = value.Index(i).Interface()
+		}
+	}
+
+	recordType := value.Type()
+	if recordType.Kind() == reflect.Slice {
+		recordType = recordType.Elem()
+	}
+	related, err := a.expand(r, recordType, records, expand)
+	if err != nil {
+		if paceerror.CodeOf(err) == paceerror.CodeInternal {
+			rollbar.Warning(fmt.Sprintf("Error expanding %s: %s", strings.Join(expand, ","), err), r)
+		}
+		errorResponse(err, w)
+		return
+	}
+
+	version := versionOf(r)
+	documents := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		document, err := jsonDocument(version.ToDTO(record))
+		if err != nil {
+			errorResponse(err, w)
+			return
+		}
+		for name, records := range related {
+			document[name] = version.ToDTO(records[i])
+		}
+		documents[i] = trimFields(document, fields, expand)
+	}
+
+	if value.Kind() == reflect.Slice {
+		jsonResponse(http.StatusOK, documents, w)
+		return
+	}
+	jsonResponse(http.StatusOK, documents[0], w)
+}
+
+// expand loads the related records of each record, by expansion name. Records
+// of each kind are loaded in one batch, missing ones are nil.
+func (a App) expand(r *http.Request, recordType reflect.Type, records []interface{}, names []string) (map[string][]interface{}, error) {
+	related := map[string][]interface{}{}
+	if len(names) == 0 {
+		return related, nil
+	}
+
+	identity, _ := auth.FromContext(r.Context())
+	available := expansions[recordType]
+	IDsByKind := map[string][]string{}
+	for _, name := range names {
+		expansion, ok := available[name]
+		if !ok {
+			return nil, paceerror.New(paceerror.CodeBadRequest, fmt.Sprintf("Can't expand %s, try %s", name, expansionNames(available)))
+		}
+		if !identity.HasScope(expansion.kind + ":read") {
+			return nil, paceerror.New(paceerror.CodeForbidden, fmt.Sprintf("API key is missing the %s:read scope", expansion.kind))
+		}
+		for _, record := range records {
+			if ID := expansion.ID(record); ID != "" {
+				IDsByKind[expansion.kind] = append(IDsByKind[expansion.kind], ID)
+			}
+		}
+	}
+
+	loaded := map[string]map[string]interface{}{}
+	for kind, IDs := range IDsByKind {
+		byID, err := a.loadByIDs(kind, uniqueStrings(IDs))
+		if err != nil {
+			return nil, err
+		}
+		loaded[kind] = byID
+	}
+
+	for _, name := range names {
+		expansion := available[name]
+		related[name] = make([]interface{}, len(records))
+		for i, record := range records {
+			if found, ok := loaded[expansion.kind][expansion.ID(record)]; ok {
+				related[name][i] = found
+			}
+		}
+	}
+
+	return related, nil
+}
+
+// loadByIDs gets companies, contacts or projects by ID in one Firestore GetAll
+func (a App) loadByIDs(kind string, IDs []string) (map[string]interface{}, error) {
+	byID := map[string]interface{}{}
+	switch kind {
+	case "company":
+		provider, err := a.Container.CompanyProvider()
+		if err != nil {
+			return nil, err
+		}
+		companies, err := provider.GetByIDs(IDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, company := range companies {
+			byID[company.ID] = company
+		}
+	case "contact":
+		provider, err := a.Container.ContactProvider()
+		if err != nil {
+			return nil, err
+		}
+		contacts, err := provider.GetByIDs(IDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, contact := range contacts {
+			byID[contact.ID] = contact
+		}
+	case "project":
+		provider, err := a.Container.ProjectProvider()
+		if err != nil {
+			return nil, err
+		}
+		projects, err := provider.GetByIDs(IDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, project := range projects {
+			byID[project.ID] = project
+		}
+	}
+
+	return byID, nil
+}
+
+// trimFields keeps the fields asked for, matched like encoding/json does, and the expansions
+func trimFields(document map[string]interface{}, fields []string, expand []string) map[string]interface{} {
+	if len(fields) == 0 {
+		return document
+	}
+
+	trimmed := map[string]interface{}{}
+	for key, value := range document {
+		for _, field := range append(fields, expand...) {
+			if strings.EqualFold(key, field) {
+				trimmed[key] = value
+				break
+			}
+		}
+	}
+
+	return trimmed
+}
+
+func expansionNames(available map[string]expansion) string {
+	if len(available) == 0 {
+		return "nothing, these records have no expansions"
+	}
+	names := make([]string, 0, len(available))
+	for name := range available {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+	"github.com/rollbar/rollbar-go"
+)
+
+// syncLimit is the most changes sent per collection in one sync
+const syncLimit = 500
+
+// syncCollections are the collections /api/sync serves and the scope resource of each
+var syncCollections = []struct {
+	name     string
+	resource string
+}{
+	{"users", "user"},
+	{"contacts", "contact"},
+	{"companies", "company"},
+	{"projects", "project"},
+	{"inventory", "inventory"},
+	{"inspections", "inspection"},
+}
+
+// SyncHandler sends what changed in each collection since its sync token, like
+// ?projects=41&inventory=17. An empty token gets everything. Without any
+// collections in the query, every collection is sent from the start.
+func (a App) SyncHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	requested := false
+	for _, collection := range syncCollections {
+		_, ok := query[collection.name]
+		requested = requested || ok
+	}
+
+	scope, err := a.scope(r)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting project memberships: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	response := map[string]entity.SyncCollection{}
+	for _, collection := range syncCollections {
+		if _, ok := query[collection.name]; requested && !ok {
+			continue
+		}
+		if !scope.Identity.HasScope(collection.resource + ":read") {
+			jsonResponse(http.StatusForbidden, fmt.Sprintf("API key is missing the %s:read scope", collection.resource), w)
+			return
+		}
+		since, err := firestoredb.ParseSyncCursor(query.Get(collection.name))
+		if err != nil {
+			errorResponse(paceerror.New(paceerror.CodeBadRequest, fmt.Sprintf("Invalid sync token for %s", collection.name)), w)
+			return
+		}
+
+		changes, err := a.syncChanges(collection.name, scope, since)
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error syncing %s: %s", collection.name, err), r)
+			errorResponse(err, w)
+			return
+		}
+		changes.Changed = versionOf(r).ToDTO(changes.Changed)
+		response[collection.name] = changes
+	}
+
+	jsonResponse(http.StatusOK, response, w)
+}
+
+// syncChanges gets the changes to a collection after the cursor since.
+// Records the caller can't read (anymore) are sent as deleted.
+func (a App) syncChanges(name string, scope auth.Scope, since firestoredb.SyncCursor) (entity.SyncCollection, error) {
+	var changes []entity.Change
+	var changed interface{}
+	sent := map[string]bool{}
+
+	switch name {
+	case "users":
+		provider, err := a.Container.UserProvider()
+		if err == nil {
+			changes, err = provider.GetChanges(since, syncLimit)
+		}
+		var users []entity.User
+		if err == nil {
+			users, err = provider.GetByIDs(changedIDs(changes))
+		}
+		if err != nil {
+			return entity.SyncCollection{}, err
+		}
+		for _, user := range users {
+			sent[user.ID] = true
+		}
+		changed = users
+	case "contacts":
+		provider, err := a.Container.ContactProvider()
+		if err == nil {
+			changes, err = provider.GetChanges(since, syncLimit)
+		}
+		var contacts []entity.Contact
+		if err == nil {
+			contacts, err = provider.GetByIDs(changedIDs(changes))
+		}
+		if err != nil {
+			return entity.SyncCollection{}, err
+		}
+		for _, contact := range contacts {
+			sent[contact.ID] = true
+		}
+		changed = contacts
+	case "companies":
+		provider, err := a.Container.CompanyProvider()
+		if err == nil {
+			changes, err = provider.GetChanges(since, syncLimit)
+		}
+		var companies []entity.Company
+		if err == nil {
+			companies, err = provider.GetByIDs(changedIDs(changes))
+		}
+		if err != nil {
+			return entity.SyncCollection{}, err
+		}
+		for _, company := range companies {
+			sent[company.ID] = true
+		}
+		changed = companies
+	case "projects":
+		provider, err := a.Container.ProjectProvider()
+		if err == nil {
+			changes, err = provider.GetChanges(since, syncLimit)
+		}
+		var projects []entity.Project
+		if err == nil {
+			projects, err = provider.GetByIDs(changedIDs(changes))
+		}
+		if err != nil {
+			return entity.SyncCollection{}, err
+		}
+		readable := []entity.Project{}
+		for _, project := range projects {
+			if scope.CanRead(project.ID) {
+				readable = append(readable, project)
+				sent[project.ID] = true
+			}
+		}
+		changed = readable
+	case "inventory":
+		provider, err := a.Container.InventoryProvider()
+		if err == nil {
+			changes, err = provider.GetChanges(since, syncLimit)
+		}
+		var inventory []entity.Inventory
+		if err == nil {
+			inventory, err = provider.GetByIDs(changedIDs(changes))
+		}
+		if err != nil {
+			return entity.SyncCollection{}, err
+		}
+		readable := []entity.Inventory{}
+		for _, item := range inventory {
+			if scope.CanRead(item.ProjectID) {
+				readable = append(readable, item)
+				sent[item.ID] = true
+			}
+		}
+		changed = readable
+	case "inspections":
+		provider, err := a.Container.InspectionProvider()
+		if err == nil {
+			changes, err = provider.GetChanges(since, syncLimit)
+		}
+		var inspections []entity.Inspection
+		if err == nil {
+			inspections, err = provider.GetByIDs(changedIDs(changes))
+		}
+		if err != nil {
+			return entity.SyncCollection{}, err
+		}
+		readable := []entity.Inspection{}
+		for _, inspection := range inspections {
+			if scope.CanRead(inspection.ProjectID) {
+				readable = append(readable, inspection)
+				sent[inspection.ID] = true
+			}
+		}
+		changed = readable
+	default:
+		return entity.SyncCollection{}, fmt.Errorf("%s can't be synced", name)
+	}
+
+	return syncCollection(changes, changed, sent, since), nil
+}
+
+// syncCollection adds tombstones for the changes that weren't sent, and the next token
+// from the last committed change read of each shard. The changes of a shard
+// commit in sequence order, so no change before it can still show up later.
+func syncCollection(changes []entity.Change, changed interface{}, sent map[string]bool, since firestoredb.SyncCursor) entity.SyncCollection {
+	collection := entity.SyncCollection{
+		Changed: changed,
+		Deleted: []string{},
+		More:    len(changes) >= syncLimit,
+	}
+	for _, change := range changes {
+		if !sent[change.ID] {
+			collection.Deleted = append(collection.Deleted, change.ID)
+		}
+		since.Advance(change.Sequence)
+	}
+	collection.Token = since.String()
+
+	return collection
+}
+
+// changedIDs gets the IDs of the records that weren't deleted
+func changedIDs(changes []entity.Change) []string {
+	IDs := []string{}
+	for _, change := range changes {
+		if !change.Deleted {
+			IDs = append(IDs, change.ID)
+		}
+	}
+
+	return IDs
+}
@@ -0,0 +1,331 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/rollbar/rollbar-go"
+)
+
+// totpIssuer is the account name shown in authenticator apps
+const totpIssuer = "PaCE"
+
+// recoveryCodeCount is how many recovery codes a user gets when enrolling
+const recoveryCodeCount = 10
+
+// enrollRoutes are the only routes an EnrollOnly token can call
+var enrollRoutes = map[string]bool{
+	"/api/2fa/enroll":  true,
+	"/api/2fa/confirm": true,
+}
+
+var errTwoFactorRequired = errors.New("Two-factor code required")
+var errTwoFactorInvalid = errors.New("Invalid two-factor code")
+
+// checkSecondFactor checks the TOTP or recovery code of a login against the
+// user as saved, and marks it used in the same transaction so the same code
+// can't be used again, not even by two logins at the same time
+func (a App) checkSecondFactor(user entity.User, code string, recoveryCode string) error {
+	if code == "" && recoveryCode == "" {
+		return errTwoFactorRequired
+	}
+
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		return err
+	}
+
+	remaining := 0
+	err = provider.UseTwoFactorCode(user.ID, func(saved *entity.User) error {
+		if code != "" {
+			counter, ok := auth.CheckTOTP(saved.TOTPSecret, code, saved.TOTPLastCounter, time.Now())
+			if !ok {
+				return errTwoFactorInvalid
+			}
+			saved.TOTPLastCounter = counter
+			return nil
+		}
+
+		codes, ok := auth.UseRecoveryCode(saved.ID, recoveryCode, saved.RecoveryCodes)
+		if !ok {
+			return errTwoFactorInvalid
+		}
+		saved.RecoveryCodes = codes
+		remaining = len(codes)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if code == "" {
+		rollbar.Info(fmt.Sprintf("User %s logged in with a recovery code, %d left", user.Username, remaining))
+	}
+
+	return nil
+}
+
+// twoFactorEnrollmentRequired reports whether the policy makes the user enroll before doing anything else
+func (a App) twoFactorEnrollmentRequired(user entity.User) (bool, error) {
+	if user.TOTPEnabled {
+		return false, nil
+	}
+
+	provider, err := a.Container.PolicyProvider()
+	if err != nil {
+		return false, err
+	}
+	twoFactorPolicy, err := provider.GetTwoFactor()
+	if err != nil {
+		return false, err
+	}
+	for _, role := range twoFactorPolicy.RequiredRoles {
+		if role == user.Role {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// currentUser loads the user making the request
+func (a App) currentUser(r *http.Request) (entity.User, error) {
+	identity, _ := auth.FromContext(r.Context())
+	if identity.IsAPIKey() {
+		return entity.User{}, errors.New("API keys don't have a user")
+	}
+
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	return provider.GetByID(identity.UserID)
+}
+
+// EnrollTwoFactorHandler starts two-factor enrollment and returns the secret for the authenticator app
+func (a App) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := a.currentUser(r)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting current User: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	if user.TOTPEnabled {
+		jsonResponse(http.StatusConflict, "Two-factor auth is already enabled", w)
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error generating TOTP secret: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	user.TOTPSecret = secret
+	user.TOTPLastCounter = 0
+
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting UserProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	_, err = provider.UpdateTwoFactor(user)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error saving TOTP secret for %s: %s", user.Username, err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, entity.TwoFactorEnrollResponse{
+		Secret: secret,
+		URI:    auth.TOTPURI(totpIssuer, user.Username, secret),
+	}, w)
+}
+
+// ConfirmTwoFactorHandler turns on two-factor auth once the user proves their
+// authenticator works, and returns their recovery codes
+func (a App) ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var confirm entity.TwoFactorCodeRequest
+	err := decodeJSON(r, &confirm)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when confirming two-factor auth: %s", err), r)
+		jsonResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	user, err := a.currentUser(r)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting current User: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	if user.TOTPEnabled {
+		jsonResponse(http.StatusConflict, "Two-factor auth is already enabled", w)
+		return
+	}
+	if user.TOTPSecret == "" {
+		jsonResponse(http.StatusBadRequest, "Start enrollment at /api/2fa/enroll first", w)
+		return
+	}
+
+	counter, ok := auth.CheckTOTP(user.TOTPSecret, confirm.Code, 0, time.Now())
+	if !ok {
+		jsonResponse(http.StatusBadRequest, errTwoFactorInvalid.Error(), w)
+		return
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes(user.ID, recoveryCodeCount)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error generating recovery codes: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	user.TOTPEnabled = true
+	user.TOTPLastCounter = counter
+	user.RecoveryCodes = hashes
+
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting UserProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	_, err = provider.UpdateTwoFactor(user)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error enabling two-factor auth for %s: %s", user.Username, err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, entity.RecoveryCodesResponse{RecoveryCodes: codes}, w)
+}
+
+// DisableTwoFactorHandler turns off two-factor auth. Users need a current code,
+// admins can reset anyone without one.
+func (a App) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var disable entity.TwoFactorCodeRequest
+	err := decodeJSON(r, &disable)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when disabling two-factor auth: %s", err), r)
+		jsonResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	identity, _ := auth.FromContext(r.Context())
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting UserProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	var user entity.User
+	if disable.UserID != "" && disable.UserID != identity.UserID {
+		if !identity.IsAdmin() {
+			jsonResponse(http.StatusForbidden, "Only admins can reset two-factor auth for other users", w)
+			return
+		}
+		user, err = provider.GetByID(disable.UserID)
+	} else {
+		user, err = a.currentUser(r)
+	}
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting User: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	if user.ID == identity.UserID {
+		if _, ok := auth.CheckTOTP(user.TOTPSecret, disable.Code, user.TOTPLastCounter, time.Now()); !ok || !user.TOTPEnabled {
+			jsonResponse(http.StatusBadRequest, errTwoFactorInvalid.Error(), w)
+			return
+		}
+		user.TOTPEnabled = false
+		required, err := a.twoFactorEnrollmentRequired(user)
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error getting two-factor policy: %s", err), r)
+			errorResponse(err, w)
+			return
+		}
+		if required {
+			jsonResponse(http.StatusForbidden, "Two-factor auth is required for your role", w)
+			return
+		}
+	}
+
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.TOTPLastCounter = 0
+	user.RecoveryCodes = nil
+	_, err = provider.UpdateTwoFactor(user)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error disabling two-factor auth for %s: %s", user.Username, err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, fmt.Sprintf("Two-factor auth disabled for %s", user.Username), w)
+}
+
+// GetTwoFactorPolicyHandler gets the roles that must use two-factor auth. Admin only.
+func (a App) GetTwoFactorPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can manage the two-factor policy", w)
+		return
+	}
+
+	provider, err := a.Container.PolicyProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting PolicyProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	twoFactorPolicy, err := provider.GetTwoFactor()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting two-factor policy: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, twoFactorPolicy, w)
+}
+
+// UpdateTwoFactorPolicyHandler sets the roles that must use two-factor auth. Admin only.
+func (a App) UpdateTwoFactorPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can manage the two-factor policy", w)
+		return
+	}
+
+	var twoFactorPolicy entity.TwoFactorPolicy
+	err := decodeJSON(r, &twoFactorPolicy)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when updating the two-factor policy: %s", err), r)
+		jsonResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	provider, err := a.Container.PolicyProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting PolicyProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	updatedPolicy, err := provider.SetTwoFactor(twoFactorPolicy)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error setting two-factor policy: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedPolicy, w)
+}
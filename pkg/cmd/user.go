@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/validate"
+	"github.com/rollbar/rollbar-go"
+)
+
+// canManageUsers reports whether the caller can create, delete and edit any
+// user. API keys never can, whatever their scopes, so a leaked key can't make admins.
+func canManageUsers(identity auth.Identity) bool {
+	return identity.IsAdmin() && !identity.IsAPIKey()
+}
+
+// canEditUser reports whether the caller can save the update. Users can edit
+// their own profile but not their role.
+func canEditUser(identity auth.Identity, currentUser entity.User, update entity.UpdateUserRequest) bool {
+	if canManageUsers(identity) {
+		return true
+	}
+
+	return currentUser.ID == identity.UserID && update.Role == currentUser.Role
+}
+
+// createUser adds a new user. Only admins can.
+func (a App) createUser(ctx context.Context, user entity.CreateUserRequest) (entity.User, error) {
+	identity, _ := auth.FromContext(ctx)
+	if !canManageUsers(identity) {
+		return entity.User{}, forbidden("Only admins can create users")
+	}
+	err := validate.Struct(user)
+	if err != nil {
+		return entity.User{}, err
+	}
+	user.User.Password = user.Password
+
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	return provider.Add(user.User)
+}
+
+// updateUser saves an update to the user with its ID, or its Username without one
+func (a App) updateUser(ctx context.Context, user entity.UpdateUserRequest) (entity.User, error) {
+	err := validate.Struct(user)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		return entity.User{}, err
+	}
+	var currentUser entity.User
+	if user.ID != "" {
+		currentUser, err = provider.GetByID(user.ID)
+	} else {
+		currentUser, err = provider.GetByUsername(user.Username)
+	}
+	if err != nil {
+		return entity.User{}, err
+	}
+	identity, _ := auth.FromContext(ctx)
+	if !canEditUser(identity, currentUser, user) {
+		return entity.User{}, forbidden("You can only edit your own profile, and not your role")
+	}
+
+	return provider.Update(user)
+}
+
+// deleteUser deletes a user and ends all of their logins. Only admins can.
+func (a App) deleteUser(ctx context.Context, ID string) (entity.User, error) {
+	identity, _ := auth.FromContext(ctx)
+	if !canManageUsers(identity) {
+		return entity.User{}, forbidden("Only admins can delete users")
+	}
+
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		return entity.User{}, err
+	}
+	user, err := provider.GetByID(ID)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	// Their logins end first, so a failed revoke leaves the user to delete again
+	// rather than a deleted user who is still logged in
+	sessionProvider, err := a.Container.SessionProvider()
+	if err != nil {
+		return entity.User{}, err
+	}
+	err = sessionProvider.RevokeUser(user.ID)
+	if err != nil {
+		return entity.User{}, fmt.Errorf("Error revoking Sessions of User %s: %w", user.ID, err)
+	}
+	err = provider.Delete(user)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	return user, nil
+}
+
+// GetUserHandler handles api calls for User
+func (a App) GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	userName := r.URL.Query().Get("username")
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting UserProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+	if userName == "" {
+		allUsers, err := provider.GetAll()
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error getting All Users: %s", err), r)
+			errorResponse(err, w)
+			return
+		}
+		a.shapedResponse(allUsers, w, r)
+	} else {
+		user, err := provider.GetByUsername(userName)
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error getting User: %s", err), r)
+			errorResponse(err, w)
+			return
+		}
+		a.shapedResponse(user, w, r)
+	}
+}
+
+// GetUserByIDHandler gets a User by ID
+func (a App) GetUserByIDHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting UserProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	currentUser, err := provider.GetByID(pathID(r))
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting User %s: %s", pathID(r), err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	a.shapedResponse(currentUser, w, r)
+}
+
+// CreateUserHandler adds a new user
+func (a App) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var user entity.CreateUserRequest
+	err := decodeBody(r, &user)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	newUser, err := a.createUser(r.Context(), user)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, newUser, w)
+}
+
+// UpdateUserHandler updates the User with the id, or the username, in the body
+func (a App) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var user entity.UpdateUserRequest
+	err := decodeBody(r, &user)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	updatedUser, err := a.updateUser(r.Context(), user)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedUser, w)
+}
+
+// UpdateUserByIDHandler replaces (PUT) or patches (PATCH) a User by ID, including their username
+func (a App) UpdateUserByIDHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := a.Container.UserProvider()
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+	currentUser, err := provider.GetByID(pathID(r))
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	var user entity.UpdateUserRequest
+	err = readUpdate(r, currentUser, &user)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+	user.ID = currentUser.ID
+
+	updatedUser, err := a.updateUser(r.Context(), user)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedUser, w)
+}
+
+// DeleteUserHandler deletes the User with the id in the body
+func (a App) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	var user entity.User
+	err := decodeBody(r, &user)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	a.deleteUserResponse(user.ID, w, r)
+}
+
+// DeleteUserByIDHandler deletes a User by ID and ends all of their logins
+func (a App) DeleteUserByIDHandler(w http.ResponseWriter, r *http.Request) {
+	a.deleteUserResponse(pathID(r), w, r)
+}
+
+func (a App) deleteUserResponse(ID string, w http.ResponseWriter, r *http.Request) {
+	user, err := a.deleteUser(r.Context(), ID)
+	if err != nil {
+		failedAction(err, w, r)
+		return
+	}
+
+	jsonResponse(http.StatusOK, fmt.Sprintf("User %s Deleted", user.Username), w)
+}
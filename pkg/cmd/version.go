@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/apiversion"
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/paceconfig"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/gorilla/mux"
+	"github.com/rollbar/rollbar-go"
+)
+
+type versionContextKey struct{}
+
+var versionPrefix = regexp.MustCompile(`^/api/v[0-9]+(/|$)`)
+
+// routeTemplate is the path template of route without its version, like
+// "/api/users/{id}" for "/api/v2/users/{id}", so route settings cover every version
+func routeTemplate(route *mux.Route) string {
+	path, _ := route.GetPathTemplate()
+
+	return versionPrefix.ReplaceAllString(path, "/api$1")
+}
+
+// versionWriter lets jsonResponse send entities in the shape of the request's version
+type versionWriter struct {
+	http.ResponseWriter
+	version *apiversion.Version
+}
+
+// versionOf gets the API version of a request, nil outside the versioned routes
+func versionOf(r *http.Request) *apiversion.Version {
+	version, _ := r.Context().Value(versionContextKey{}).(*apiversion.Version)
+
+	return version
+}
+
+// deprecatedVersion gets the config of a deprecated API version
+func (a App) deprecatedVersion(name string) (paceconfig.DeprecatedAPIVersion, bool) {
+	if a.Config == nil {
+		return paceconfig.DeprecatedAPIVersion{}, false
+	}
+	for _, deprecated := range a.Config.DeprecatedAPIVersions {
+		if deprecated.Version == name {
+			return deprecated, true
+		}
+	}
+
+	return paceconfig.DeprecatedAPIVersion{}, false
+}
+
+// versionMiddleware serves a sub-router as version of the API. Deprecated
+// versions get Deprecation, Sunset and Link headers, and their use is logged by client.
+func (a App) versionMiddleware(version *apiversion.Version, latest *apiversion.Version) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := a.rateLimitClient(r)
+			firstToday := a.VersionUsage != nil && a.VersionUsage.Record(version.Name, client, r.UserAgent(), time.Now())
+			if deprecated, ok := a.deprecatedVersion(version.Name); ok {
+				w.Header().Set("Deprecation", "true")
+				if sunset, err := time.Parse("2006-01-02", deprecated.Sunset); err == nil {
+					w.Header().Set("Sunset", sunset.Format(http.TimeFormat))
+				}
+				if version != latest {
+					successor := "/api/" + latest.Name + strings.TrimPrefix(versionPrefix.ReplaceAllString(r.URL.Path, "/api$1"), "/api")
+					w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+				}
+				if firstToday {
+					rollbar.Info(fmt.Sprintf("Deprecated API %s called by %s (%s)", version.Name, client, r.UserAgent()), r)
+				}
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), versionContextKey{}, version))
+			next.ServeHTTP(&versionWriter{ResponseWriter: w, version: version}, r)
+		})
+	}
+}
+
+// decodeBody reads a JSON body into target, a pointer to an entity, in the
+// shape of the request's version. Bad JSON is a paceerror.CodeBadRequest.
+func decodeBody(r *http.Request, target interface{}) error {
+	return decodeVersion(versionOf(r), r.Body, target)
+}
+
+// decodeJSON reads a JSON body into target as it is, for requests that aren't versioned
+func decodeJSON(r *http.Request, target interface{}) error {
+	return apiversion.DecodeJSON(r.Body, target)
+}
+
+func decodeVersion(version *apiversion.Version, body io.Reader, target interface{}) error {
+	err := version.Decode(body, target)
+	if err != nil && paceerror.CodeOf(err) != paceerror.CodeValidation {
+		return bodyError(err)
+	}
+
+	return err
+}
+
+// GetAPIVersionUsageHandler lists which clients called which API versions since the server started. Admin only.
+func (a App) GetAPIVersionUsageHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can review API version usage", w)
+		return
+	}
+	if a.VersionUsage == nil {
+		jsonResponse(http.StatusOK, []apiversion.Use{}, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, a.VersionUsage.Uses(), w)
+}
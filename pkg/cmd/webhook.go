@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/events"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/validate"
+	"github.com/gorilla/mux"
+	"github.com/rollbar/rollbar-go"
+)
+
+// maxDeliveryLog is how many deliveries of a webhook are listed
+const maxDeliveryLog = 100
+
+// GetWebhookHandler lists all webhooks. Admin only.
+func (a App) GetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can manage webhooks", w)
+		return
+	}
+
+	provider, err := a.Container.WebhookProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting WebhookProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	allWebhooks, err := provider.GetAll()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting All webhooks: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, allWebhooks, w)
+}
+
+// CreateWebhookHandler subscribes a URL to events. The secret deliveries are
+// signed with is only ever returned here. Admin only.
+func (a App) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can manage webhooks", w)
+		return
+	}
+
+	var webhook entity.Webhook
+	err := decodeJSON(r, &webhook)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when creating a webhook: %s", err), r)
+		errorResponse(bodyError(err), w)
+		return
+	}
+	err = validateWebhook(webhook)
+	if err != nil {
+		errorResponse(err, w)
+		return
+	}
+	webhook.CreatedBy = identity.Username
+
+	provider, err := a.Container.WebhookProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting WebhookProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	newWebhook, secret, err := provider.Add(webhook)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error setting WebhookProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, entity.CreateWebhookResponse{Webhook: newWebhook, Secret: secret}, w)
+}
+
+// GetWebhookByIDHandler gets a webhook. Admin only.
+func (a App) GetWebhookByIDHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can manage webhooks", w)
+		return
+	}
+
+	provider, err := a.Container.WebhookProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting WebhookProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	webhook, err := provider.GetByID(pathID(r))
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting webhook %s: %s", pathID(r), err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, webhook, w)
+}
+
+// UpdateWebhookByIDHandler changes a webhook's URL, events or whether it's
+// disabled. The secret stays the same. Admin only.
+func (a App) UpdateWebhookByIDHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can manage webhooks", w)
+		return
+	}
+
+	provider, err := a.Container.WebhookProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting WebhookProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	currentWebhook, err := provider.GetByID(pathID(r))
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting webhook %s: %s", pathID(r), err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	var webhookRequest entity.Webhook
+	err = readUpdate(r, currentWebhook, &webhookRequest)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error decoding JSON when updating webhook %s: %s", currentWebhook.ID, err), r)
+		errorResponse(err, w)
+		return
+	}
+	err = validateWebhook(webhookRequest)
+	if err != nil {
+		errorResponse(err, w)
+		return
+	}
+	webhookRequest.ID = currentWebhook.ID
+
+	updatedWebhook, err := provider.Update(webhookRequest)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error setting WebhookProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, updatedWebhook, w)
+}
+
+// DeleteWebhookByIDHandler removes a webhook. Admin only.
+func (a App) DeleteWebhookByIDHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can manage webhooks", w)
+		return
+	}
+
+	provider, err := a.Container.WebhookProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting WebhookProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	err = provider.Delete(pathID(r))
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error deleting webhook %s: %s", pathID(r), err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, fmt.Sprintf("Webhook %s deleted", pathID(r)), w)
+}
+
+// GetWebhookDeliveriesHandler lists the latest deliveries of a webhook, newest
+// first. Admin only.
+func (a App) GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can manage webhooks", w)
+		return
+	}
+
+	provider, err := a.Container.WebhookProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting WebhookProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	deliveries, err := provider.GetDeliveries(pathID(r))
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting deliveries of webhook %s: %s", pathID(r), err), r)
+		errorResponse(err, w)
+		return
+	}
+	if len(deliveries) > maxDeliveryLog {
+		deliveries = deliveries[:maxDeliveryLog]
+	}
+
+	jsonResponse(http.StatusOK, deliveries, w)
+}
+
+// RedeliverWebhookHandler sends a delivery again right away, whatever its
+// status, and responds with how it went. Admin only.
+func (a App) RedeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin() {
+		jsonResponse(http.StatusForbidden, "Only admins can manage webhooks", w)
+		return
+	}
+
+	provider, err := a.Container.WebhookProvider()
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting WebhookProvider: %s", err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	delivery, err := provider.GetDelivery(mux.Vars(r)["deliveryID"])
+	if err == nil && delivery.WebhookID != pathID(r) {
+		err = paceerror.NotFound("Webhook delivery not found")
+	}
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error getting webhook delivery %s: %s", mux.Vars(r)["deliveryID"], err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	delivery.Status = entity.DeliveryPending
+	err = provider.SetDelivery(delivery)
+	if err == nil {
+		delivery, err = a.Container.WebhookDispatcher().Send(delivery)
+	}
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error redelivering webhook delivery %s: %s", delivery.ID, err), r)
+		errorResponse(err, w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, delivery, w)
+}
+
+// validateWebhook checks a webhook has an http(s) URL and known events
+func validateWebhook(webhook entity.Webhook) error {
+	err := validate.Struct(webhook)
+	if err != nil {
+		return err
+	}
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return paceerror.New(paceerror.CodeValidation, "url must be an http or https URL")
+	}
+	for _, event := range webhook.Events {
+		if !events.ValidEvent(event) {
+			return paceerror.New(paceerror.CodeValidation, fmt.Sprintf("Unknown event %q", event))
+		}
+	}
+
+	return nil
+}
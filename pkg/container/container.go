@@ -6,14 +6,23 @@ import (
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go"
+	"github.com/coma-toast/pace-api/pkg/events"
 	"github.com/coma-toast/pace-api/pkg/paceconfig"
+	"github.com/coma-toast/pace-api/pkg/provider/apikey"
 	"github.com/coma-toast/pace-api/pkg/provider/company"
 	"github.com/coma-toast/pace-api/pkg/provider/contact"
 	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+	"github.com/coma-toast/pace-api/pkg/provider/idempotency"
 	"github.com/coma-toast/pace-api/pkg/provider/inspection"
 	"github.com/coma-toast/pace-api/pkg/provider/inventory"
+	"github.com/coma-toast/pace-api/pkg/provider/loginattempt"
+	"github.com/coma-toast/pace-api/pkg/provider/membership"
+	"github.com/coma-toast/pace-api/pkg/provider/policy"
 	"github.com/coma-toast/pace-api/pkg/provider/project"
+	"github.com/coma-toast/pace-api/pkg/provider/session"
 	"github.com/coma-toast/pace-api/pkg/provider/user"
+	"github.com/coma-toast/pace-api/pkg/provider/webhook"
+	"github.com/coma-toast/pace-api/pkg/search"
 	"google.golang.org/api/option"
 )
 
@@ -25,28 +34,60 @@ type Container interface {
 	ProjectProvider() (project.Provider, error)
 	InspectionProvider() (inspection.Provider, error)
 	InventoryProvider() (inventory.Provider, error)
+	MembershipProvider() (membership.Provider, error)
+	APIKeyProvider() (apikey.Provider, error)
+	SessionProvider() (session.Provider, error)
+	LoginAttemptProvider() (loginattempt.Provider, error)
+	PolicyProvider() (policy.Provider, error)
+	IdempotencyProvider() (idempotency.Provider, error)
+	SearchIndex() (*search.Index, error)
+	WebhookProvider() (webhook.Provider, error)
+	WebhookDispatcher() *events.Dispatcher
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// clients are the connections shared by every copy of a Production container
+type clients struct {
+	firestore *firestore.Client
 }
 
 // Production is our production container for our external connections
 type Production struct {
 	config *paceconfig.Config
 	// Providers
-	userProvider       *user.DatabaseProvider
-	contactProvider    *contact.DatabaseProvider
-	companyProvider    *company.DatabaseProvider
-	projectProvider    *project.DatabaseProvider
-	inspectionProvider *inspection.DatabaseProvider
-	inventoryProvider  *inventory.DatabaseProvider
+	userProvider         *user.DatabaseProvider
+	contactProvider      *contact.DatabaseProvider
+	companyProvider      *company.DatabaseProvider
+	projectProvider      *project.DatabaseProvider
+	inspectionProvider   *inspection.DatabaseProvider
+	inventoryProvider    *inventory.DatabaseProvider
+	membershipProvider   *membership.DatabaseProvider
+	apiKeyProvider       *apikey.DatabaseProvider
+	sessionProvider      *session.DatabaseProvider
+	loginAttemptProvider *loginattempt.DatabaseProvider
+	policyProvider       *policy.DatabaseProvider
+	idempotencyProvider  *idempotency.DatabaseProvider
+	webhookProvider      *webhook.DatabaseProvider
+	searchIndex          *search.Index
+	webhookDispatcher    *events.Dispatcher
 	// Clients
-	firestoreClient *firestore.Client
+	clients *clients
 	// Mutex Locks
-	userProviderMutex       *sync.Mutex
-	contactProviderMutex    *sync.Mutex
-	companyProviderMutex    *sync.Mutex
-	projectProviderMutex    *sync.Mutex
-	inspectionProviderMutex *sync.Mutex
-	inventoryProviderMutex  *sync.Mutex
-	firestoreClientMutex    *sync.Mutex
+	userProviderMutex         *sync.Mutex
+	contactProviderMutex      *sync.Mutex
+	companyProviderMutex      *sync.Mutex
+	projectProviderMutex      *sync.Mutex
+	inspectionProviderMutex   *sync.Mutex
+	inventoryProviderMutex    *sync.Mutex
+	membershipProviderMutex   *sync.Mutex
+	apiKeyProviderMutex       *sync.Mutex
+	sessionProviderMutex      *sync.Mutex
+	loginAttemptProviderMutex *sync.Mutex
+	policyProviderMutex       *sync.Mutex
+	idempotencyProviderMutex  *sync.Mutex
+	webhookProviderMutex      *sync.Mutex
+	firestoreClientMutex      *sync.Mutex
 }
 
 // UserProvider provides the user provider
@@ -62,8 +103,9 @@ func (p Production) UserProvider() (user.Provider, error) {
 
 	p.userProvider = &user.DatabaseProvider{
 		SharedProvider: &firestoredb.DatabaseProvider{
-			Database:   firestoreConnection,
-			Collection: "users",
+			Database:     firestoreConnection,
+			Collection:   "users",
+			TrackChanges: true,
 		},
 	}
 
@@ -82,9 +124,13 @@ func (p Production) ContactProvider() (contact.Provider, error) {
 	}
 	p.contactProvider = &contact.DatabaseProvider{
 		SharedProvider: &firestoredb.DatabaseProvider{
-			Database:   firestoreConnection,
-			Collection: "contacts",
-		}}
+			Database:     firestoreConnection,
+			Collection:   "contacts",
+			TrackChanges: true,
+			Search:       p.searchIndex,
+		},
+		Events: p.webhookDispatcher,
+	}
 
 	return p.contactProvider, nil
 }
@@ -102,9 +148,12 @@ func (p Production) CompanyProvider() (company.Provider, error) {
 
 	p.companyProvider = &company.DatabaseProvider{
 		SharedProvider: &firestoredb.DatabaseProvider{
-			Database:   firestoreConnection,
-			Collection: "company",
+			Database:     firestoreConnection,
+			Collection:   "company",
+			TrackChanges: true,
+			Search:       p.searchIndex,
 		},
+		Events: p.webhookDispatcher,
 	}
 	return p.companyProvider, nil
 }
@@ -122,9 +171,12 @@ func (p Production) ProjectProvider() (project.Provider, error) {
 
 	p.projectProvider = &project.DatabaseProvider{
 		SharedProvider: &firestoredb.DatabaseProvider{
-			Database:   firestoreConnection,
-			Collection: "projects",
+			Database:     firestoreConnection,
+			Collection:   "projects",
+			TrackChanges: true,
+			Search:       p.searchIndex,
 		},
+		Events: p.webhookDispatcher,
 	}
 
 	return p.projectProvider, nil
@@ -143,9 +195,11 @@ func (p Production) InspectionProvider() (inspection.Provider, error) {
 
 	p.inspectionProvider = &inspection.DatabaseProvider{
 		SharedProvider: &firestoredb.DatabaseProvider{
-			Database:   firestoreConnection,
-			Collection: "inspections",
+			Database:     firestoreConnection,
+			Collection:   "inspections",
+			TrackChanges: true,
 		},
+		Events: p.webhookDispatcher,
 	}
 
 	return p.inspectionProvider, nil
@@ -164,33 +218,302 @@ func (p Production) InventoryProvider() (inventory.Provider, error) {
 
 	p.inventoryProvider = &inventory.DatabaseProvider{
 		SharedProvider: &firestoredb.DatabaseProvider{
-			Database:   firestoreConnection,
-			Collection: "inventory",
+			Database:     firestoreConnection,
+			Collection:   "inventory",
+			TrackChanges: true,
+			Search:       p.searchIndex,
 		},
+		Events: p.webhookDispatcher,
 	}
 
 	return p.inventoryProvider, nil
 }
 
+// MembershipProvider provides the project Membership provider
+func (p Production) MembershipProvider() (membership.Provider, error) {
+	if p.membershipProvider != nil {
+		return p.membershipProvider, nil
+	}
+
+	firestoreConnection, err := p.getFirestoreConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	p.membershipProvider = &membership.DatabaseProvider{
+		SharedProvider: &firestoredb.DatabaseProvider{
+			Database:   firestoreConnection,
+			Collection: "memberships",
+		},
+	}
+
+	return p.membershipProvider, nil
+}
+
+// APIKeyProvider provides the API key provider
+func (p Production) APIKeyProvider() (apikey.Provider, error) {
+	if p.apiKeyProvider != nil {
+		return p.apiKeyProvider, nil
+	}
+
+	firestoreConnection, err := p.getFirestoreConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	p.apiKeyProvider = &apikey.DatabaseProvider{
+		SharedProvider: &firestoredb.DatabaseProvider{
+			Database:   firestoreConnection,
+			Collection: "apiKeys",
+		},
+		UsageProvider: &firestoredb.DatabaseProvider{
+			Database:   firestoreConnection,
+			Collection: "apiKeyUsage",
+		},
+	}
+
+	return p.apiKeyProvider, nil
+}
+
+// SessionProvider provides the login session provider
+func (p Production) SessionProvider() (session.Provider, error) {
+	if p.sessionProvider != nil {
+		return p.sessionProvider, nil
+	}
+
+	firestoreConnection, err := p.getFirestoreConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	p.sessionProvider = &session.DatabaseProvider{
+		SharedProvider: &firestoredb.DatabaseProvider{
+			Database:   firestoreConnection,
+			Collection: "sessions",
+		},
+	}
+
+	return p.sessionProvider, nil
+}
+
+// LoginAttemptProvider provides the failed login provider
+func (p Production) LoginAttemptProvider() (loginattempt.Provider, error) {
+	if p.loginAttemptProvider != nil {
+		return p.loginAttemptProvider, nil
+	}
+
+	firestoreConnection, err := p.getFirestoreConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	p.loginAttemptProvider = &loginattempt.DatabaseProvider{
+		SharedProvider: &firestoredb.DatabaseProvider{
+			Database:   firestoreConnection,
+			Collection: "loginAttempts",
+		},
+		EventProvider: &firestoredb.DatabaseProvider{
+			Database:   firestoreConnection,
+			Collection: "lockoutEvents",
+		},
+	}
+
+	return p.loginAttemptProvider, nil
+}
+
+// PolicyProvider provides the security policy provider
+func (p Production) PolicyProvider() (policy.Provider, error) {
+	if p.policyProvider != nil {
+		return p.policyProvider, nil
+	}
+
+	firestoreConnection, err := p.getFirestoreConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	p.policyProvider = &policy.DatabaseProvider{
+		SharedProvider: &firestoredb.DatabaseProvider{
+			Database:   firestoreConnection,
+			Collection: "policies",
+		},
+	}
+
+	return p.policyProvider, nil
+}
+
+// IdempotencyProvider provides the idempotency key provider
+func (p Production) IdempotencyProvider() (idempotency.Provider, error) {
+	if p.idempotencyProvider != nil {
+		return p.idempotencyProvider, nil
+	}
+
+	firestoreConnection, err := p.getFirestoreConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	p.idempotencyProvider = &idempotency.DatabaseProvider{
+		SharedProvider: &firestoredb.DatabaseProvider{
+			Database:   firestoreConnection,
+			Collection: "idempotencyKeys",
+		},
+	}
+
+	return p.idempotencyProvider, nil
+}
+
+// WebhookProvider provides the webhook provider
+func (p Production) WebhookProvider() (webhook.Provider, error) {
+	if p.webhookProvider != nil {
+		return p.webhookProvider, nil
+	}
+
+	firestoreConnection, err := p.getFirestoreConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	p.webhookProvider = &webhook.DatabaseProvider{
+		SharedProvider: &firestoredb.DatabaseProvider{
+			Database:   firestoreConnection,
+			Collection: "webhooks",
+		},
+		DeliveryProvider: &firestoredb.DatabaseProvider{
+			Database:   firestoreConnection,
+			Collection: "webhookDeliveries",
+		},
+		LockProvider: &firestoredb.DatabaseProvider{
+			Database:   firestoreConnection,
+			Collection: "webhookLocks",
+		},
+	}
+
+	return p.webhookProvider, nil
+}
+
+// WebhookDispatcher provides the dispatcher that sends events to webhooks
+func (p Production) WebhookDispatcher() *events.Dispatcher {
+	return p.webhookDispatcher
+}
+
+// SearchIndex provides the full-text index, loading every searchable record
+// the first time. After that it's kept up to date by the providers.
+func (p Production) SearchIndex() (*search.Index, error) {
+	err := p.searchIndex.Build(func() error {
+		contactProvider, err := p.ContactProvider()
+		if err != nil {
+			return err
+		}
+		contacts, err := contactProvider.GetAll()
+		if err != nil {
+			return err
+		}
+		for _, contact := range contacts {
+			p.searchIndex.Save("contacts", contact.ID, contact)
+		}
+
+		companyProvider, err := p.CompanyProvider()
+		if err != nil {
+			return err
+		}
+		companies, err := companyProvider.GetAll()
+		if err != nil {
+			return err
+		}
+		for _, company := range companies {
+			p.searchIndex.Save("company", company.ID, company)
+		}
+
+		projectProvider, err := p.ProjectProvider()
+		if err != nil {
+			return err
+		}
+		projects, err := projectProvider.GetAll()
+		if err != nil {
+			return err
+		}
+		for _, project := range projects {
+			p.searchIndex.Save("projects", project.ID, project)
+		}
+
+		inventoryProvider, err := p.InventoryProvider()
+		if err != nil {
+			return err
+		}
+		inventory, err := inventoryProvider.GetAll()
+		if err != nil {
+			return err
+		}
+		for _, item := range inventory {
+			p.searchIndex.Save("inventory", item.ID, item)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.searchIndex, nil
+}
+
 // NewProduction builds a container with all of the config
 func NewProduction(paceconfig *paceconfig.Config) Container {
-	return &Production{
-		config:                  paceconfig,
-		userProviderMutex:       &sync.Mutex{},
-		contactProviderMutex:    &sync.Mutex{},
-		companyProviderMutex:    &sync.Mutex{},
-		projectProviderMutex:    &sync.Mutex{},
-		inspectionProviderMutex: &sync.Mutex{},
-		inventoryProviderMutex:  &sync.Mutex{},
-		firestoreClientMutex:    &sync.Mutex{},
+	production := &Production{
+		config:                    paceconfig,
+		searchIndex:               search.New(),
+		userProviderMutex:         &sync.Mutex{},
+		contactProviderMutex:      &sync.Mutex{},
+		companyProviderMutex:      &sync.Mutex{},
+		projectProviderMutex:      &sync.Mutex{},
+		inspectionProviderMutex:   &sync.Mutex{},
+		inventoryProviderMutex:    &sync.Mutex{},
+		membershipProviderMutex:   &sync.Mutex{},
+		apiKeyProviderMutex:       &sync.Mutex{},
+		sessionProviderMutex:      &sync.Mutex{},
+		loginAttemptProviderMutex: &sync.Mutex{},
+		policyProviderMutex:       &sync.Mutex{},
+		idempotencyProviderMutex:  &sync.Mutex{},
+		webhookProviderMutex:      &sync.Mutex{},
+		firestoreClientMutex:      &sync.Mutex{},
+		clients:                   &clients{},
 	}
+	production.webhookDispatcher = events.NewDispatcher(production.WebhookProvider)
+
+	return production
+}
+
+// Ping checks Firestore can be queried with the credentials
+func (p Production) Ping(ctx context.Context) error {
+	client, err := p.getFirestoreConnection()
+	if err != nil {
+		return err
+	}
+	_, err = client.Collection("users").Limit(1).Documents(ctx).GetAll()
+
+	return err
+}
+
+// Close closes the Firestore client. Providers can't be used after.
+func (p Production) Close() error {
+	p.firestoreClientMutex.Lock()
+	defer p.firestoreClientMutex.Unlock()
+	if p.clients.firestore == nil {
+		return nil
+	}
+	err := p.clients.firestore.Close()
+	p.clients.firestore = nil
+
+	return err
 }
 
-// Connect is the Firebase DB connection
+// getFirestoreConnection connects to Firestore the first time, every provider shares the client
 func (p Production) getFirestoreConnection() (*firestore.Client, error) {
-	// TODO mutex
-	if p.firestoreClient != nil {
-		return p.firestoreClient, nil
+	p.firestoreClientMutex.Lock()
+	defer p.firestoreClientMutex.Unlock()
+	if p.clients.firestore != nil {
+		return p.clients.firestore, nil
 	}
 	var client *firestore.Client
 	ctx := context.Background()
@@ -206,6 +529,7 @@ func (p Production) getFirestoreConnection() (*firestore.Client, error) {
 		return nil, err
 
 	}
+	p.clients.firestore = client
 
 	return client, nil
 }
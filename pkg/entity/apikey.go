@@ -0,0 +1,23 @@
+package entity
+
+// APIKey lets a machine client call the API without logging in.
+// Only a hash of the key is stored, the key itself is shown once on creation.
+type APIKey struct {
+	ID        string   `json:"id"`
+	Created   string   `json:"created"`
+	CreatedBy string   `json:"createdBy"`
+	Name      string   `json:"name" validate:"required,max=100"`
+	Hash      string   `json:"-"`
+	Scopes    []string `json:"scopes"`
+	Expires   string   `json:"expires" validate:"datetime"`
+	LastUsed  string   `json:"lastUsed"`
+	Revoked   bool     `json:"revoked"`
+	// DailyQuota is how many requests the key can make per UTC day, 0 for no quota
+	DailyQuota int64 `json:"dailyQuota" validate:"min=0"`
+}
+
+// CreateAPIKeyResponse is a new APIKey along with the plain key
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
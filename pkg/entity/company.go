@@ -2,17 +2,17 @@ package entity
 
 // Company is a contact company
 type Company struct {
-	ID             string `json:"id"`
-	Created        string `json:"created"`
-	Name           string `json:"name"`
-	PrimaryContact string `json:"primaryContact"`
-	Phone          string `json:"phone"`
-	Email          string `json:"email"`
-	Address        string `json:"address"`
-	City           string `json:"city"`
-	State          string `json:"state"`
-	Zip            string `json:"zip"`
-	Favorite       bool   `json:"favorite"`
-	Deleted        bool   `json:"deleted"`
-	Instance       string `json:"instance"`
+	ID             string `json:"id" proto:"1"`
+	Created        string `json:"created" proto:"2"`
+	Name           string `json:"name" validate:"required,max=200" proto:"3"`
+	PrimaryContact string `json:"primaryContact" proto:"4"`
+	Phone          string `json:"phone" validate:"phone" proto:"5"`
+	Email          string `json:"email" validate:"email" proto:"6"`
+	Address        string `json:"address" proto:"7"`
+	City           string `json:"city" proto:"8"`
+	State          string `json:"state" validate:"state" proto:"9"`
+	Zip            string `json:"zip" validate:"zip" proto:"10"`
+	Favorite       bool   `json:"favorite" proto:"11"`
+	Deleted        bool   `json:"deleted" proto:"12"`
+	Instance       string `json:"instance" proto:"13"`
 }
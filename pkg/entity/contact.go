@@ -2,15 +2,15 @@ package entity
 
 // Contact is a non-user contact
 type Contact struct {
-	ID        string `json:"id"`
-	Created   string `json:"created"`
-	FirstName string `json:"firstname"`
-	LastName  string `json:"lastname"`
-	Company   string `json:"company"`
-	Email     string `json:"email"`
-	Phone     string `json:"phone"`
-	Timezone  string `json:"timezone"`
-	Favorite  bool   `json:"favorite"`
-	Deleted   bool   `json:"deleted"`
-	Instance  string `json:"instance"`
+	ID        string `json:"id" proto:"1"`
+	Created   string `json:"created" proto:"2"`
+	FirstName string `json:"firstname" validate:"required,max=100" proto:"3"`
+	LastName  string `json:"lastname" proto:"4"`
+	Company   string `json:"company" proto:"5"`
+	Email     string `json:"email" validate:"email" proto:"6"`
+	Phone     string `json:"phone" validate:"phone" proto:"7"`
+	Timezone  string `json:"timezone" proto:"8"`
+	Favorite  bool   `json:"favorite" proto:"9"`
+	Deleted   bool   `json:"deleted" proto:"10"`
+	Instance  string `json:"instance" proto:"11"`
 }
@@ -0,0 +1,15 @@
+package entity
+
+// IdempotencyRecord is the response to a create request sent with an
+// Idempotency-Key header, kept to replay it when the request is retried.
+// Status is 0 while the first request is still running.
+type IdempotencyRecord struct {
+	ID          string `json:"id"`
+	Created     string `json:"created"`
+	Expires     string `json:"expires"`
+	Client      string `json:"client"`
+	RequestHash string `json:"requestHash"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+}
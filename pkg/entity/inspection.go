@@ -2,21 +2,21 @@ package entity
 
 // Inspection is an inspection report
 type Inspection struct {
-	ID             string `json:"id"`
-	Created        string `json:"created"`
-	ProjectID      string `json:"projectID"`
-	Username       string `json:"username"`
-	StartTime      string `json:"startTime"`
-	EndTime        string `json:"endTime"`
-	InspectedParts string `json:"inspectedParts"`
+	ID             string `json:"id" proto:"1"`
+	Created        string `json:"created" proto:"2"`
+	ProjectID      string `json:"projectID" proto:"3"`
+	Username       string `json:"username" proto:"4"`
+	StartTime      string `json:"startTime" proto:"5"`
+	EndTime        string `json:"endTime" proto:"6"`
+	InspectedParts string `json:"inspectedParts" proto:"7"`
 }
 
 // UpdateInspectionRequest is an inspection report
 type UpdateInspectionRequest struct {
-	ID             string `json:"id"`
-	ProjectID      string `json:"projectID"`
-	Username       string `json:"username"`
-	StartTime      string `json:"startTime"`
-	EndTime        string `json:"endTime"`
-	InspectedParts string `json:"inspectedParts"`
+	ID             string `json:"id" proto:"1"`
+	ProjectID      string `json:"projectID" validate:"required" proto:"2"`
+	Username       string `json:"username" proto:"3"`
+	StartTime      string `json:"startTime" validate:"date" proto:"4"`
+	EndTime        string `json:"endTime" validate:"date,after=StartTime" proto:"5"`
+	InspectedParts string `json:"inspectedParts" proto:"6"`
 }
@@ -5,37 +5,37 @@ package entity
 
 // Inventory is an inventory item
 type Inventory struct {
-	ID        string `json:"ID"`
-	Created   string `json:"created"`
-	ProjectID string `json:"projectID"`
-	Stage     Stage  `json:"stage"`
-	Size      int32  `json:"size"`
-	Length    int32  `json:"length"`
-	Grade     int32  `json:"grade"`
-	Shape     string `json:"shape"`
-	Passed    bool   `json:"passed"`
-	Sequence  int32  `json:"sequence"`
-	Priority  int32  `json:"priority"`
+	ID        string `json:"ID" proto:"1"`
+	Created   string `json:"created" proto:"2"`
+	ProjectID string `json:"projectID" validate:"required" proto:"3"`
+	Stage     Stage  `json:"stage" proto:"4"`
+	Size      int32  `json:"size" validate:"min=0" proto:"5"`
+	Length    int32  `json:"length" validate:"min=0" proto:"6"`
+	Grade     int32  `json:"grade" validate:"min=0" proto:"7"`
+	Shape     string `json:"shape" proto:"8"`
+	Passed    bool   `json:"passed" proto:"9"`
+	Sequence  int32  `json:"sequence" validate:"min=0" proto:"10"`
+	Priority  int32  `json:"priority" validate:"min=0" proto:"11"`
 }
 
 // Stage is what stage the inventory item is in
 type Stage struct {
-	Raw       bool `json:"raw"`
-	InProcess bool `json:"inProcess"`
-	OnHold    bool `json:"onHold"`
-	Finished  bool `json:"finished"`
+	Raw       bool `json:"raw" proto:"1"`
+	InProcess bool `json:"inProcess" proto:"2"`
+	OnHold    bool `json:"onHold" proto:"3"`
+	Finished  bool `json:"finished" proto:"4"`
 }
 
 // UpdateInventoryRequest is an inventory item
 type UpdateInventoryRequest struct {
-	ID        string `json:"ID"`
-	ProjectID string `json:"projectID"`
-	Stage     Stage  `json:"stage"`
-	Size      int32  `json:"size"`
-	Length    int32  `json:"length"`
-	Grade     int32  `json:"grade"`
-	Shape     string `json:"shape"`
-	Passed    bool   `json:"passed"`
-	Sequence  int32  `json:"sequence"`
-	Priority  int32  `json:"priority"`
+	ID        string `json:"ID" proto:"1"`
+	ProjectID string `json:"projectID" validate:"required" proto:"2"`
+	Stage     Stage  `json:"stage" proto:"3"`
+	Size      int32  `json:"size" validate:"min=0" proto:"4"`
+	Length    int32  `json:"length" validate:"min=0" proto:"5"`
+	Grade     int32  `json:"grade" validate:"min=0" proto:"6"`
+	Shape     string `json:"shape" proto:"7"`
+	Passed    bool   `json:"passed" proto:"8"`
+	Sequence  int32  `json:"sequence" validate:"min=0" proto:"9"`
+	Priority  int32  `json:"priority" validate:"min=0" proto:"10"`
 }
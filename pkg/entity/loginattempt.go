@@ -0,0 +1,35 @@
+package entity
+
+// Lockout events
+const (
+	LockoutEventLocked   = "locked"
+	LockoutEventUnlocked = "unlocked"
+)
+
+// LoginAttempts tracks failed logins for a username or a client IP.
+// Key is "username:<username>" or "ip:<address>".
+type LoginAttempts struct {
+	ID          string `json:"id"`
+	Key         string `json:"key"`
+	Failures    int    `json:"failures"`
+	LastFailure string `json:"lastFailure"`
+	LockedUntil string `json:"lockedUntil"`
+}
+
+// LockoutEvent records a username or IP being locked out or unlocked, for review
+type LockoutEvent struct {
+	ID          string `json:"id"`
+	Created     string `json:"created"`
+	Key         string `json:"key"`
+	Event       string `json:"event"`
+	Failures    int    `json:"failures"`
+	LockedUntil string `json:"lockedUntil"`
+	IP          string `json:"ip"`
+	By          string `json:"by"`
+}
+
+// UnlockRequest clears the failed logins of a username, an IP, or both
+type UnlockRequest struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+}
@@ -0,0 +1,17 @@
+package entity
+
+// Project roles for a Membership, from least to most privileged
+const (
+	ProjectRoleViewer  = "viewer"
+	ProjectRoleEditor  = "editor"
+	ProjectRoleManager = "manager"
+)
+
+// Membership gives a user access to a single project
+type Membership struct {
+	ID        string `json:"id"`
+	Created   string `json:"created"`
+	UserID    string `json:"userID"`
+	ProjectID string `json:"projectID"`
+	Role      string `json:"role" validate:"required,oneof=viewer editor manager"`
+}
@@ -0,0 +1,67 @@
+package entity
+
+import "github.com/coma-toast/pace-api/pkg/paceerror"
+
+// Mutation actions
+const (
+	MutationCreate = "create"
+	MutationUpdate = "update"
+	MutationDelete = "delete"
+)
+
+// Mutation results
+const (
+	// MutationApplied if the record hadn't changed since the client's base revision
+	MutationApplied = "applied"
+	// MutationMerged if it had, but every field could be merged or settled by policy
+	MutationMerged = "merged"
+	// MutationConflict if some fields need the user to pick a value. The rest were applied.
+	MutationConflict = "conflict"
+	MutationFailed   = "failed"
+)
+
+// MutationRequest is a batch of edits made offline, applied in order
+type MutationRequest struct {
+	Mutations []Mutation `json:"mutations" validate:"required,max=500"`
+}
+
+// Mutation is one offline edit. Updates send the fields they changed in
+// Changes, and the values those fields had when the edit was made in Base.
+type Mutation struct {
+	// ID is the client's ID for the edit, sent back with its result
+	ID         string `json:"id"`
+	Collection string `json:"collection" validate:"required,oneof=inventory inspections"`
+	Action     string `json:"action" validate:"required,oneof=create update delete"`
+	RecordID   string `json:"recordID"`
+	// BaseRevision is the sync token of the record when the client got it
+	BaseRevision string                 `json:"baseRevision"`
+	Base         map[string]interface{} `json:"base"`
+	Changes      map[string]interface{} `json:"changes"`
+	// Modified is when the edit was made on the device, for last-writer-wins
+	Modified string `json:"modified" validate:"datetime"`
+}
+
+// MutationResponse has a result for every mutation, in the same order
+type MutationResponse struct {
+	Results []MutationResult `json:"results"`
+}
+
+// MutationResult is what happened to a mutation. Record and Revision are the
+// record as it is now, send Revision as the base of the next edit.
+type MutationResult struct {
+	ID        string              `json:"id"`
+	Status    string              `json:"status"`
+	RecordID  string              `json:"recordID"`
+	Revision  string              `json:"revision"`
+	Record    interface{}         `json:"record,omitempty"`
+	Conflicts []FieldConflict     `json:"conflicts,omitempty"`
+	Error     *paceerror.Response `json:"error,omitempty"`
+}
+
+// FieldConflict is a field changed both on the server and offline
+type FieldConflict struct {
+	Field  string      `json:"field"`
+	Base   interface{} `json:"base"`
+	Client interface{} `json:"client"`
+	Server interface{} `json:"server"`
+}
@@ -4,52 +4,53 @@ package entity
 // If you want phone number update, for example, use a contact id
 // Project is a construction project
 type Project struct {
-	ID                    string `json:"id"`
-	Created               string `json:"created"`
-	Deleted               bool   `json:"deleted"`
-	Name                  string `json:"name"`
-	StartDate             string `json:"startDate"`
-	DueDate               string `json:"dueDate"`
-	Address               string `json:"address"`
-	City                  string `json:"city"`
-	State                 string `json:"state"`
-	Zip                   int32  `json:"zip"`
-	ProjectManager        string `json:"projectManager"`
-	ClientID              string `json:"clientID"`
-	EORNameID             string `json:"eORNameID"`
-	DetailerNameID        string `json:"detailerNameID"`
-	InspectionLabID       string `json:"inspectionLabID"`
-	SteelErectorNameID    string `json:"steelErectorNameID"`
-	SteelFabricatorNameID string `json:"steelFabricatorNameID"`
-	GeneralContractorID   string `json:"generalContractorID"`
-	PrimaryContactNameID  string `json:"primaryContactNameID"`
-	PrimaryContactPhone   string `json:"primaryContactPhone"`
-	PrimaryContactEmail   string `json:"primaryContactEmail"`
-	SquareFootage         int32  `json:"squareFootage"`
-	WeightInTons          int32  `json:"weightInTons"`
+	ID                    string `json:"id" proto:"1"`
+	Created               string `json:"created" proto:"2"`
+	Deleted               bool   `json:"deleted" proto:"3"`
+	Name                  string `json:"name" validate:"required,max=200" proto:"4"`
+	StartDate             string `json:"startDate" validate:"date" proto:"5"`
+	DueDate               string `json:"dueDate" validate:"date,after=StartDate" proto:"6"`
+	Address               string `json:"address" proto:"7"`
+	City                  string `json:"city" proto:"8"`
+	State                 string `json:"state" validate:"state" proto:"9"`
+	Zip                   int32  `json:"zip" validate:"min=0,max=99999" proto:"10"`
+	ProjectManager        string `json:"projectManager" proto:"11"`
+	ClientID              string `json:"clientID" proto:"12"`
+	EORNameID             string `json:"eORNameID" proto:"13"`
+	DetailerNameID        string `json:"detailerNameID" proto:"14"`
+	InspectionLabID       string `json:"inspectionLabID" proto:"15"`
+	SteelErectorNameID    string `json:"steelErectorNameID" proto:"16"`
+	SteelFabricatorNameID string `json:"steelFabricatorNameID" proto:"17"`
+	GeneralContractorID   string `json:"generalContractorID" proto:"18"`
+	PrimaryContactNameID  string `json:"primaryContactNameID" proto:"19"`
+	PrimaryContactPhone   string `json:"primaryContactPhone" validate:"phone" proto:"20"`
+	PrimaryContactEmail   string `json:"primaryContactEmail" validate:"email" proto:"21"`
+	SquareFootage         int32  `json:"squareFootage" validate:"min=0" proto:"22"`
+	WeightInTons          int32  `json:"weightInTons" validate:"min=0" proto:"23"`
 }
 
-// UpdateProjectRequest is a construction project
+// UpdateProjectRequest is a construction project. Without an ID, the project is found by Name.
 type UpdateProjectRequest struct {
-	Name                  string `json:"name"`
-	Deleted               bool   `json:"deleted"`
-	StartDate             string `json:"startDate"`
-	DueDate               string `json:"dueDate"`
-	Address               string `json:"address"`
-	City                  string `json:"city"`
-	State                 string `json:"state"`
-	Zip                   int32  `json:"zip"`
-	ProjectManager        string `json:"projectManager"`
-	ClientID              string `json:"clientID"`
-	EORNameID             string `json:"eORNameID"`
-	DetailerNameID        string `json:"detailerNameID"`
-	InspectionLabID       string `json:"inspectionLabID"`
-	SteelErectorNameID    string `json:"steelErectorNameID"`
-	SteelFabricatorNameID string `json:"steelFabricatorNameID"`
-	GeneralContractorID   string `json:"generalContractorID"`
-	PrimaryContactNameID  string `json:"primaryContactNameID"`
-	PrimaryContactPhone   string `json:"primaryContactPhone"`
-	PrimaryContactEmail   string `json:"primaryContactEmail"`
-	SquareFootage         int32  `json:"squareFootage"`
-	WeightInTons          int32  `json:"weightInTons"`
+	ID                    string `json:"id" proto:"1"`
+	Name                  string `json:"name" validate:"required,max=200" proto:"2"`
+	Deleted               bool   `json:"deleted" proto:"3"`
+	StartDate             string `json:"startDate" validate:"date" proto:"4"`
+	DueDate               string `json:"dueDate" validate:"date,after=StartDate" proto:"5"`
+	Address               string `json:"address" proto:"6"`
+	City                  string `json:"city" proto:"7"`
+	State                 string `json:"state" validate:"state" proto:"8"`
+	Zip                   int32  `json:"zip" validate:"min=0,max=99999" proto:"9"`
+	ProjectManager        string `json:"projectManager" proto:"10"`
+	ClientID              string `json:"clientID" proto:"11"`
+	EORNameID             string `json:"eORNameID" proto:"12"`
+	DetailerNameID        string `json:"detailerNameID" proto:"13"`
+	InspectionLabID       string `json:"inspectionLabID" proto:"14"`
+	SteelErectorNameID    string `json:"steelErectorNameID" proto:"15"`
+	SteelFabricatorNameID string `json:"steelFabricatorNameID" proto:"16"`
+	GeneralContractorID   string `json:"generalContractorID" proto:"17"`
+	PrimaryContactNameID  string `json:"primaryContactNameID" proto:"18"`
+	PrimaryContactPhone   string `json:"primaryContactPhone" validate:"phone" proto:"19"`
+	PrimaryContactEmail   string `json:"primaryContactEmail" validate:"email" proto:"20"`
+	SquareFootage         int32  `json:"squareFootage" validate:"min=0" proto:"21"`
+	WeightInTons          int32  `json:"weightInTons" validate:"min=0" proto:"22"`
 }
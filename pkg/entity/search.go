@@ -0,0 +1,19 @@
+package entity
+
+// SearchResult is the response to a search
+type SearchResult struct {
+	// Total is the number of matches, Hits has up to the limit of them
+	Total int         `json:"total"`
+	Hits  []SearchHit `json:"hits"`
+	// Facets counts the matches of each type
+	Facets map[string]int `json:"facets"`
+}
+
+// SearchHit is a record that matched a search
+type SearchHit struct {
+	Type      string  `json:"type"`
+	ID        string  `json:"id"`
+	ProjectID string  `json:"projectID,omitempty"`
+	Title     string  `json:"title"`
+	Score     float64 `json:"score"`
+}
@@ -0,0 +1,28 @@
+package entity
+
+// Session is one refresh token. Each refresh replaces the session with a new
+// one in the same family, so a family is a single login on a single device.
+type Session struct {
+	ID         string `json:"id"`
+	Created    string `json:"created"`
+	UserID     string `json:"userID"`
+	FamilyID   string `json:"familyID"`
+	Hash       string `json:"-"`
+	Expires    string `json:"expires"`
+	UserAgent  string `json:"userAgent"`
+	IP         string `json:"ip"`
+	ReplacedBy string `json:"-"`
+	Revoked    bool   `json:"revoked"`
+}
+
+// RefreshRequest exchanges a refresh token for a new access and refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// RevokeSessionRequest ends one session, or every session of a user
+type RevokeSessionRequest struct {
+	ID     string `json:"id"`
+	UserID string `json:"userID"`
+	All    bool   `json:"all"`
+}
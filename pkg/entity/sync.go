@@ -0,0 +1,19 @@
+package entity
+
+// Change is the latest write to a record, kept for sync. Sequence goes up with
+// every write to the record's collection.
+type Change struct {
+	ID       string `json:"id"`
+	Sequence int64  `json:"sequence"`
+	Deleted  bool   `json:"deleted"`
+	Modified string `json:"modified"`
+}
+
+// SyncCollection is what changed in a collection since its sync token. Send
+// Token back on the next sync, and sync again right away while More is set.
+type SyncCollection struct {
+	Token   string      `json:"token"`
+	Changed interface{} `json:"changed"`
+	Deleted []string    `json:"deleted"`
+	More    bool        `json:"more"`
+}
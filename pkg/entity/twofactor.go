@@ -0,0 +1,23 @@
+package entity
+
+// TwoFactorPolicy is the admin-set list of roles that must use two-factor auth
+type TwoFactorPolicy struct {
+	RequiredRoles []string `json:"requiredRoles"`
+}
+
+// TwoFactorEnrollResponse has what an authenticator app needs to add the account
+type TwoFactorEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TwoFactorCodeRequest is a TOTP code, and the user it is for when an admin resets someone else
+type TwoFactorCodeRequest struct {
+	Code   string `json:"code"`
+	UserID string `json:"userID"`
+}
+
+// RecoveryCodesResponse has one-time codes for when the authenticator is lost. They are only shown once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
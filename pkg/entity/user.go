@@ -1,28 +1,67 @@
 package entity
 
+// Global user roles. Any other role is a regular user whose project access
+// comes from their memberships.
+const (
+	RoleAdmin          = "admin"
+	RoleProjectManager = "projectManager"
+)
+
 // User is the user data
 type User struct {
-	ID        string `json:"id"`
-	Created   string `json:"created"`
-	FirstName string `json:"firstname"`
-	LastName  string `json:"lastname"`
-	Role      string `json:"role"`
-	Username  string `json:"username"`
+	ID        string `json:"id" proto:"1"`
+	Created   string `json:"created" proto:"2"`
+	FirstName string `json:"firstname" proto:"3"`
+	LastName  string `json:"lastname" proto:"4"`
+	Role      string `json:"role" proto:"5"`
+	Username  string `json:"username" validate:"required,max=100" proto:"6"`
 	Password  string `json:"-"`
-	Email     string `json:"email"`
-	Phone     string `json:"phone"`
-	TimeZone  string `json:"timezone"`
-	DarkMode  bool   `json:"darkmode"`
+	Email     string `json:"email" validate:"email" proto:"7"`
+	Phone     string `json:"phone" validate:"phone" proto:"8"`
+	TimeZone  string `json:"timezone" proto:"9"`
+	DarkMode  bool   `json:"darkmode" proto:"10"`
+	// TOTPSecret is set once enrollment starts, and only used once TOTPEnabled is set
+	TOTPSecret      string   `json:"-"`
+	TOTPEnabled     bool     `json:"totpEnabled" proto:"11"`
+	TOTPLastCounter int64    `json:"-"`
+	RecoveryCodes   []string `json:"-"`
+}
+
+// CreateUserRequest is a new user along with their password
+type CreateUserRequest struct {
+	User     `proto:"1"`
+	Password string `json:"password" validate:"required,min=8,max=200" proto:"2"`
 }
 
-// UpdateUserRequest is a passwordless user entity
+// UpdateUserRequest is a passwordless user entity. Without an ID, the user is found by Username.
 type UpdateUserRequest struct {
-	FirstName string `json:"firstname"`
-	LastName  string `json:"lastname"`
-	Role      string `json:"role"`
-	Username  string `json:"username"`
-	Email     string `json:"email"`
-	Phone     string `json:"phone"`
-	TimeZone  string `json:"timezone"`
-	DarkMode  bool   `json:"darkmode"`
+	ID        string `json:"id" proto:"1"`
+	FirstName string `json:"firstname" proto:"2"`
+	LastName  string `json:"lastname" proto:"3"`
+	Role      string `json:"role" proto:"4"`
+	Username  string `json:"username" validate:"required,max=100" proto:"5"`
+	Email     string `json:"email" validate:"email" proto:"6"`
+	Phone     string `json:"phone" validate:"phone" proto:"7"`
+	TimeZone  string `json:"timezone" proto:"8"`
+	DarkMode  bool   `json:"darkmode" proto:"9"`
+}
+
+// LoginRequest is a username and password login
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Code or RecoveryCode are needed for users with two-factor auth
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// LoginResponse is returned after a successful login or token refresh
+type LoginResponse struct {
+	Token          string `json:"token"`
+	Expires        string `json:"expires"`
+	RefreshToken   string `json:"refreshToken"`
+	RefreshExpires string `json:"refreshExpires"`
+	User           User   `json:"user"`
+	// TwoFactorEnrollmentRequired means the token only works for /api/2fa until the user enrolls
+	TwoFactorEnrollmentRequired bool `json:"twoFactorEnrollmentRequired"`
 }
@@ -0,0 +1,56 @@
+package entity
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook sends the events it subscribes to to a URL. Events are names like
+// "inventory.stageChanged", "inventory.*" or "*" for everything. The secret
+// signs deliveries, it is shown once on creation.
+type Webhook struct {
+	ID          string   `json:"id"`
+	Created     string   `json:"created"`
+	CreatedBy   string   `json:"createdBy"`
+	URL         string   `json:"url" validate:"required,max=2000"`
+	Description string   `json:"description" validate:"max=200"`
+	Events      []string `json:"events" validate:"required"`
+	Secret      string   `json:"-"`
+	// Disabled webhooks don't get new events
+	Disabled bool `json:"disabled"`
+}
+
+// CreateWebhookResponse is a new Webhook along with its secret
+type CreateWebhookResponse struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookEvent is the body of a delivery
+type WebhookEvent struct {
+	ID      string      `json:"id"`
+	Event   string      `json:"event"`
+	Created string      `json:"created"`
+	Data    interface{} `json:"data"`
+}
+
+// WebhookDelivery is an event queued for, or sent to, a webhook
+type WebhookDelivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhookID"`
+	EventID   string `json:"eventID"`
+	Event     string `json:"event"`
+	Created   string `json:"created"`
+	// Payload is the JSON body sent, a WebhookEvent
+	Payload  string `json:"payload"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// NextAttempt is when a pending delivery is sent next
+	NextAttempt string `json:"nextAttempt"`
+	LastAttempt string `json:"lastAttempt"`
+	// ResponseStatus is the HTTP status of the last attempt, 0 if it got none
+	ResponseStatus int    `json:"responseStatus"`
+	Error          string `json:"error"`
+}
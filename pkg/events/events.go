@@ -0,0 +1,355 @@
+// Package events sends entity events to the webhooks subscribed to them.
+// Deliveries are queued in the database and sent by a Dispatcher, retrying
+// with backoff, so events outlive a restart and a slow receiver doesn't hold up
+// the request that caused them.
+package events
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v2 "github.com/coma-toast/pace-api/pkg/apiversion/v2"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/provider/webhook"
+	"github.com/google/uuid"
+	"github.com/rollbar/rollbar-go"
+)
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-Pace-Event"
+	DeliveryHeader  = "X-Pace-Delivery"
+	SignatureHeader = "X-Pace-Signature"
+)
+
+const (
+	defaultPollInterval = 15 * time.Second
+	defaultMaxAttempts  = 10
+	sendTimeout         = 10 * time.Second
+	firstBackoff        = 30 * time.Second
+	maxBackoff          = 6 * time.Hour
+)
+
+// Names are the events that can be subscribed to
+var Names = []string{
+	"project.created", "project.updated", "project.deleted",
+	"inventory.created", "inventory.updated", "inventory.deleted", "inventory.stageChanged",
+	"inspection.created", "inspection.updated", "inspection.deleted",
+	"company.created", "company.updated", "company.deleted",
+	"contact.created", "contact.updated", "contact.deleted",
+}
+
+// Publisher is told about changes to records
+type Publisher interface {
+	Publish(event string, data interface{})
+}
+
+// Dispatcher queues events for the webhooks subscribed to them, and sends them
+type Dispatcher struct {
+	Webhooks     func() (webhook.Provider, error)
+	Client       *http.Client
+	PollInterval time.Duration
+	MaxAttempts  int
+	// What Run is up to, for Check
+	mutex    sync.Mutex
+	running  bool
+	busy     bool
+	lastPoll time.Time
+}
+
+// NewDispatcher makes a Dispatcher with the default client and retries
+func NewDispatcher(webhooks func() (webhook.Provider, error)) *Dispatcher {
+	return &Dispatcher{
+		Webhooks:     webhooks,
+		Client:       &http.Client{Timeout: sendTimeout},
+		PollInterval: defaultPollInterval,
+		MaxAttempts:  defaultMaxAttempts,
+	}
+}
+
+// Publish queues an event for every enabled webhook subscribed to it. The data
+// is sent in its latest API version. Errors are logged, the change it reports
+// has already been made.
+func (d *Dispatcher) Publish(event string, data interface{}) {
+	if d == nil {
+		return
+	}
+	err := d.publish(event, data)
+	if err != nil {
+		rollbar.Warning(fmt.Sprintf("Error publishing %s: %s", event, err))
+	}
+}
+
+func (d *Dispatcher) publish(event string, data interface{}) error {
+	provider, err := d.Webhooks()
+	if err != nil {
+		return err
+	}
+	webhooks, err := provider.GetAll()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	payload := entity.WebhookEvent{
+		ID:      uuid.New().String(),
+		Event:   event,
+		Created: now,
+		Data:    v2.Version.ToDTO(data),
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		if webhook.Disabled || !Subscribed(webhook.Events, event) {
+			continue
+		}
+		_, err = provider.AddDelivery(entity.WebhookDelivery{
+			WebhookID:   webhook.ID,
+			EventID:     payload.ID,
+			Event:       event,
+			Created:     now,
+			Payload:     string(body),
+			Status:      entity.DeliveryPending,
+			NextAttempt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Run sends due deliveries every PollInterval until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.setState(true, false)
+	defer d.setState(false, false)
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.setState(true, true)
+			err := d.SendDue(now)
+			if err != nil {
+				rollbar.Warning(fmt.Sprintf("Error sending webhook deliveries: %s", err))
+			}
+			d.setState(true, false)
+		}
+	}
+}
+
+// Check is an error if Run isn't running, or hasn't polled in three intervals
+func (d *Dispatcher) Check(ctx context.Context) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.running {
+		return errors.New("Webhook dispatcher isn't running")
+	}
+	if !d.busy && time.Since(d.lastPoll) > 3*d.PollInterval {
+		return fmt.Errorf("Webhook dispatcher last polled at %s", d.lastPoll.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) setState(running bool, busy bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.running = running
+	d.busy = busy
+	d.lastPoll = time.Now()
+}
+
+// SendDue sends the pending deliveries whose next attempt is at or before now
+func (d *Dispatcher) SendDue(now time.Time) error {
+	provider, err := d.Webhooks()
+	if err != nil {
+		return err
+	}
+	deliveries, err := provider.GetPendingDeliveries()
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		next, err := time.Parse(time.RFC3339, delivery.NextAttempt)
+		if err == nil && next.After(now) {
+			continue
+		}
+		_, err = d.Send(delivery)
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error sending webhook delivery %s: %s", delivery.ID, err))
+		}
+	}
+
+	return nil
+}
+
+// Send makes an attempt at a delivery and saves how it went. Failed attempts
+// are retried with Backoff until MaxAttempts. Nothing is sent if another
+// server is sending the same attempt, or if the attempt was already made,
+// since the lock only lasts while an attempt is being sent.
+func (d *Dispatcher) Send(delivery entity.WebhookDelivery) (entity.WebhookDelivery, error) {
+	provider, err := d.Webhooks()
+	if err != nil {
+		return delivery, err
+	}
+	claimed, err := provider.ClaimDelivery(delivery, 2*sendTimeout)
+	if err != nil || !claimed {
+		return delivery, err
+	}
+	claim := delivery
+	defer func() {
+		err := provider.ReleaseDelivery(claim)
+		if err != nil {
+			rollbar.Warning(fmt.Sprintf("Error releasing webhook delivery %s: %s", delivery.ID, err))
+		}
+	}()
+
+	current, err := provider.GetDelivery(delivery.ID)
+	if err != nil {
+		return delivery, err
+	}
+	if current.Status != entity.DeliveryPending || current.Attempts != delivery.Attempts {
+		return current, nil
+	}
+	delivery = current
+
+	webhook, err := provider.GetByID(delivery.WebhookID)
+	if err != nil {
+		return delivery, err
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttempt = now.Format(time.RFC3339)
+	delivery.ResponseStatus, delivery.Error = d.post(webhook, delivery, now)
+	switch {
+	case delivery.Error == "":
+		delivery.Status = entity.DeliveryDelivered
+		delivery.NextAttempt = ""
+	case delivery.Attempts >= d.maxAttempts():
+		delivery.Status = entity.DeliveryFailed
+		delivery.NextAttempt = ""
+	default:
+		delivery.Status = entity.DeliveryPending
+		delivery.NextAttempt = now.Add(Backoff(delivery.Attempts)).Format(time.RFC3339)
+	}
+
+	return delivery, provider.SetDelivery(delivery)
+}
+
+// post sends a delivery, returning the response status and an error message
+// if it wasn't a success
+func (d *Dispatcher) post(webhook entity.Webhook, delivery entity.WebhookDelivery, now time.Time) (int, string) {
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "pace-api-webhooks")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, delivery.ID)
+	request.Header.Set(SignatureHeader, Sign(webhook.Secret, now, []byte(delivery.Payload)))
+
+	response, err := d.Client.Do(request)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Sprintf("Webhook responded %s", response.Status)
+	}
+
+	return response.StatusCode, ""
+}
+
+func (d *Dispatcher) maxAttempts() int {
+	if d.MaxAttempts > 0 {
+		return d.MaxAttempts
+	}
+
+	return defaultMaxAttempts
+}
+
+// Sign is the signature header for a body sent at timestamp: the time and an
+// HMAC-SHA256 of "<time>.<body>" with the webhook's secret, like
+// t=1600000000,v1=5257a869...
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return fmt.Sprintf("t=%s,v1=%s", unix, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Backoff is how long to wait after a failed attempt before the next. It
+// doubles from 30 seconds up to 6 hours.
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := firstBackoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+
+	return backoff
+}
+
+// Subscribed is true if one of a webhook's events matches event. "*" matches
+// everything, and "inventory.*" every inventory event.
+func Subscribed(patterns []string, event string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == event {
+			return true
+		}
+		if strings.HasSuffix(pattern, ".*") && strings.HasPrefix(event, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidEvent is true for a name in Names, or a pattern matching some of them
+func ValidEvent(pattern string) bool {
+	for _, name := range Names {
+		if Subscribed([]string{pattern}, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Publish tells publisher about an event, if there is a publisher
+func Publish(publisher Publisher, event string, data interface{}) {
+	if publisher != nil {
+		publisher.Publish(event, data)
+	}
+}
@@ -0,0 +1,243 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/provider/webhook"
+)
+
+type memoryWebhookProvider struct {
+	webhook.Provider
+	webhooks   []entity.Webhook
+	deliveries map[string]entity.WebhookDelivery
+	locks      map[string]bool
+}
+
+func (p *memoryWebhookProvider) GetAll() ([]entity.Webhook, error) {
+	return p.webhooks, nil
+}
+
+func (p *memoryWebhookProvider) GetByID(ID string) (entity.Webhook, error) {
+	for _, webhook := range p.webhooks {
+		if webhook.ID == ID {
+			return webhook, nil
+		}
+	}
+	return entity.Webhook{}, webhook.ErrWebhookNotFound
+}
+
+func (p *memoryWebhookProvider) GetDelivery(ID string) (entity.WebhookDelivery, error) {
+	delivery, ok := p.deliveries[ID]
+	if !ok {
+		return entity.WebhookDelivery{}, webhook.ErrDeliveryNotFound
+	}
+	return delivery, nil
+}
+
+func (p *memoryWebhookProvider) GetPendingDeliveries() ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	for _, delivery := range p.deliveries {
+		if delivery.Status == entity.DeliveryPending {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (p *memoryWebhookProvider) AddDelivery(delivery entity.WebhookDelivery) (entity.WebhookDelivery, error) {
+	delivery.ID = delivery.WebhookID + "-" + delivery.Event
+	p.deliveries[delivery.ID] = delivery
+	return delivery, nil
+}
+
+func (p *memoryWebhookProvider) SetDelivery(delivery entity.WebhookDelivery) error {
+	p.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (p *memoryWebhookProvider) ClaimDelivery(delivery entity.WebhookDelivery, lease time.Duration) (bool, error) {
+	if p.locks[delivery.ID] {
+		return false, nil
+	}
+	p.locks[delivery.ID] = true
+	return true, nil
+}
+
+func (p *memoryWebhookProvider) ReleaseDelivery(delivery entity.WebhookDelivery) error {
+	delete(p.locks, delivery.ID)
+	return nil
+}
+
+func TestSign(t *testing.T) {
+	signature := Sign("whsec_test", time.Unix(1600000000, 0), []byte(`{"id":"1"}`))
+	expected := "t=1600000000,v1=983571080bc8e1763f7356987d4d88c92d1198d18c0737e3d8d042fa552ec74e"
+	if signature != expected {
+		t.Errorf("Expected %s, got %s", expected, signature)
+	}
+	if Sign("other", time.Unix(1600000000, 0), []byte(`{"id":"1"}`)) == signature {
+		t.Error("Expected the signature to depend on the secret")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{20, 6 * time.Hour},
+	}
+	for _, test := range tests {
+		if backoff := Backoff(test.attempts); backoff != test.expected {
+			t.Errorf("Expected %s after %d attempts, got %s", test.expected, test.attempts, backoff)
+		}
+	}
+}
+
+func TestSubscribed(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		event    string
+		expected bool
+	}{
+		{[]string{"*"}, "project.created", true},
+		{[]string{"inventory.*"}, "inventory.stageChanged", true},
+		{[]string{"inventory.*"}, "inspection.created", false},
+		{[]string{"project.updated", "project.deleted"}, "project.deleted", true},
+		{[]string{"project.updated"}, "project.created", false},
+	}
+	for _, test := range tests {
+		if Subscribed(test.patterns, test.event) != test.expected {
+			t.Errorf("Expected %v subscribed to %s to be %v", test.patterns, test.event, test.expected)
+		}
+	}
+	if ValidEvent("inventory.moved") || !ValidEvent("company.*") {
+		t.Error("Expected only known events to be valid")
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	var received []*http.Request
+	var bodies []string
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, r)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	provider := &memoryWebhookProvider{
+		webhooks: []entity.Webhook{
+			{ID: "w1", URL: server.URL, Events: []string{"inventory.*"}, Secret: "whsec_test"},
+			{ID: "w2", URL: server.URL, Events: []string{"project.created"}},
+			{ID: "w3", URL: server.URL, Events: []string{"*"}, Disabled: true},
+		},
+		deliveries: map[string]entity.WebhookDelivery{},
+		locks:      map[string]bool{},
+	}
+	dispatcher := NewDispatcher(func() (webhook.Provider, error) { return provider, nil })
+	dispatcher.MaxAttempts = 2
+
+	dispatcher.Publish("inventory.updated", entity.Inventory{ID: "i1"})
+	if len(provider.deliveries) != 1 {
+		t.Fatalf("Expected one delivery, for the subscribed and enabled webhook, got %+v", provider.deliveries)
+	}
+
+	now := time.Now()
+	err := dispatcher.SendDue(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := provider.deliveries["w1-inventory.updated"]
+	delivery := provider.deliveries["w1-inventory.updated"]
+	if len(received) != 1 || delivery.Status != entity.DeliveryPending || delivery.Attempts != 1 || delivery.ResponseStatus != 500 {
+		t.Fatalf("Expected a failed attempt to be retried, got %+v", delivery)
+	}
+	request := received[0]
+	if request.Header.Get(EventHeader) != "inventory.updated" || request.Header.Get(DeliveryHeader) != delivery.ID {
+		t.Errorf("Expected event and delivery headers, got %v", request.Header)
+	}
+	sent, _ := time.Parse(time.RFC3339, delivery.LastAttempt)
+	if request.Header.Get(SignatureHeader) != Sign("whsec_test", sent, []byte(bodies[0])) {
+		t.Errorf("Expected the body signed with the secret, got %s", request.Header.Get(SignatureHeader))
+	}
+	var event entity.WebhookEvent
+	if json.Unmarshal([]byte(bodies[0]), &event) != nil || event.Event != "inventory.updated" || event.Data.(map[string]interface{})["id"] != "i1" {
+		t.Errorf("Expected the event with the item in the latest version, got %s", bodies[0])
+	}
+
+	err = dispatcher.SendDue(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 {
+		t.Error("Expected no retry before the backoff")
+	}
+
+	status = http.StatusOK
+	err = dispatcher.SendDue(now.Add(Backoff(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery = provider.deliveries["w1-inventory.updated"]
+	if len(received) != 2 || delivery.Status != entity.DeliveryDelivered || delivery.Attempts != 2 || delivery.NextAttempt != "" {
+		t.Errorf("Expected the retry to be delivered, got %+v", delivery)
+	}
+
+	if delivery, _ := dispatcher.Send(stale); len(received) != 2 || delivery.Status != entity.DeliveryDelivered {
+		t.Errorf("Expected an attempt that was already made not to be sent again, got %+v", delivery)
+	}
+
+	status = http.StatusGone
+	delivery.Status = entity.DeliveryPending
+	provider.SetDelivery(delivery)
+	delivery, err = dispatcher.Send(delivery)
+	if err != nil || delivery.Status != entity.DeliveryFailed || delivery.Error == "" {
+		t.Errorf("Expected a redelivery past MaxAttempts to fail for good, got %+v %v", delivery, err)
+	}
+
+	delivery.Status = entity.DeliveryPending
+	provider.SetDelivery(delivery)
+	provider.locks[delivery.ID] = true
+	if delivery, _ := dispatcher.Send(delivery); len(received) != 3 || delivery.Attempts != 3 {
+		t.Error("Expected nothing sent while another server has the delivery")
+	}
+}
+
+func TestDispatcherCheck(t *testing.T) {
+	dispatcher := NewDispatcher(func() (webhook.Provider, error) {
+		return &memoryWebhookProvider{deliveries: map[string]entity.WebhookDelivery{}, locks: map[string]bool{}}, nil
+	})
+	dispatcher.PollInterval = 10 * time.Millisecond
+	if dispatcher.Check(context.Background()) == nil {
+		t.Error("Expected a failed check before Run")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := dispatcher.Check(context.Background()); err != nil {
+		t.Error("Expected a running dispatcher to pass, got: ", err)
+	}
+
+	cancel()
+	<-stopped
+	if dispatcher.Check(context.Background()) == nil {
+		t.Error("Expected a failed check once stopped")
+	}
+}
@@ -0,0 +1,599 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// DefaultListSize is how many items a list field is expected to have when
+// working out the cost of a query, unless it has a limit argument
+var DefaultListSize = 10
+
+// Request is a GraphQL request, as sent over HTTP
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Response is the result of a request. Data is left out if the request
+// couldn't be run at all.
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Error is an error in a response, with the path of the field it is for
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// SchemaName names Request in the OpenAPI document
+func (Request) SchemaName() string {
+	return "GraphQLRequest"
+}
+
+// SchemaName names Response in the OpenAPI document
+func (Response) SchemaName() string {
+	return "GraphQLResponse"
+}
+
+// SchemaName names Error in the OpenAPI document
+func (Error) SchemaName() string {
+	return "GraphQLError"
+}
+
+// Limits stop queries that would be too expensive to run. Zero means no limit.
+type Limits struct {
+	// MaxDepth is how deep selections can be nested, { project { client { name } } } is 3
+	MaxDepth int
+	// MaxCost is the most a query can cost. Each field costs its Cost, and the
+	// fields under a list cost as much as the list has items.
+	MaxCost int
+}
+
+// Execute runs a query request
+func (s *Schema) Execute(ctx context.Context, request Request, limits Limits) *Response {
+	e, err := s.prepare(request)
+	if err != nil {
+		return &Response{Errors: []*Error{toError(err)}}
+	}
+
+	groups, err := e.collect(s.Query, e.operation.SelectionSet, map[string]bool{})
+	if err != nil {
+		return &Response{Errors: []*Error{toError(err)}}
+	}
+	cost, depth, err := e.measure(s.Query, groups, 1)
+	if err != nil {
+		return &Response{Errors: []*Error{toError(err)}}
+	}
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return &Response{Errors: []*Error{{Message: fmt.Sprintf("Query is nested %d deep, the limit is %d", depth, limits.MaxDepth)}}}
+	}
+	if limits.MaxCost > 0 && cost > limits.MaxCost {
+		return &Response{Errors: []*Error{{Message: fmt.Sprintf("Query costs %d, the limit is %d", cost, limits.MaxCost)}}}
+	}
+
+	data := e.executeObjects(ctx, s.Query, []interface{}{nil}, groups, nil)[0]
+
+	return &Response{Data: data, Errors: e.errors}
+}
+
+type executor struct {
+	schema    *Schema
+	document  *Document
+	operation *Operation
+	variables map[string]interface{}
+	errors    []*Error
+}
+
+// prepare parses a request, picks its operation and checks its variables
+func (s *Schema) prepare(request Request) (*executor, error) {
+	document, err := Parse(request.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &executor{schema: s, document: document, variables: map[string]interface{}{}}
+	for _, operation := range document.Operations {
+		if request.OperationName == "" || operation.Name == request.OperationName {
+			if e.operation != nil {
+				return nil, fmt.Errorf("operationName is needed for documents with several operations")
+			}
+			e.operation = operation
+		}
+	}
+	if e.operation == nil {
+		return nil, fmt.Errorf("Unknown operation %s", request.OperationName)
+	}
+	if e.operation.Type != "query" {
+		return nil, fmt.Errorf("Only queries are supported, not %s", e.operation.Type)
+	}
+
+	for _, definition := range e.operation.Variables {
+		variableType := s.named(definition.Type)
+		if variableType == nil {
+			return nil, fmt.Errorf("Unknown type %s of $%s", definition.Type, definition.Name)
+		}
+		value, ok := request.Variables[definition.Name]
+		if !ok {
+			value = definition.Default
+		}
+		e.variables[definition.Name], err = coerce(value, variableType, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Variable $%s: %s", definition.Name, err)
+		}
+	}
+
+	return e, nil
+}
+
+// fieldGroup is the selections of a field under one response key, since the
+// same field can be selected more than once, like in two fragments
+type fieldGroup struct {
+	key        string
+	field      *Field
+	args       map[string]interface{}
+	selections []Selection
+}
+
+// collect flattens fragments and drops skipped selections, grouping fields by response key
+func (e *executor) collect(object *Object, selections []Selection, visiting map[string]bool) ([]*fieldGroup, error) {
+	var groups []*fieldGroup
+	byKey := map[string]*fieldGroup{}
+	var add func(selections []Selection) error
+	add = func(selections []Selection) error {
+		for _, selection := range selections {
+			include, err := e.included(selection.Directives)
+			if err != nil {
+				return err
+			}
+			if !include {
+				continue
+			}
+
+			switch {
+			case selection.Fragment != "":
+				fragment, ok := e.document.Fragments[selection.Fragment]
+				if !ok {
+					return fmt.Errorf("Unknown fragment %s", selection.Fragment)
+				}
+				if visiting[fragment.Name] {
+					return fmt.Errorf("Fragment %s spreads itself", fragment.Name)
+				}
+				if fragment.TypeCondition != object.Name {
+					return fmt.Errorf("Fragment %s is on %s, not %s", fragment.Name, fragment.TypeCondition, object.Name)
+				}
+				visiting[fragment.Name] = true
+				err = add(fragment.SelectionSet)
+				delete(visiting, fragment.Name)
+				if err != nil {
+					return err
+				}
+			case selection.Inline:
+				if selection.TypeCondition != "" && selection.TypeCondition != object.Name {
+					return fmt.Errorf("Fragment on %s can't be used on %s", selection.TypeCondition, object.Name)
+				}
+				err = add(selection.SelectionSet)
+				if err != nil {
+					return err
+				}
+			default:
+				key := selection.Name
+				if selection.Alias != "" {
+					key = selection.Alias
+				}
+				if group, ok := byKey[key]; ok {
+					if group.field.Name != selection.Name {
+						return fmt.Errorf("%s can't be both %s and %s", key, group.field.Name, selection.Name)
+					}
+					group.selections = append(group.selections, selection.SelectionSet...)
+					continue
+				}
+
+				field := object.Field(selection.Name)
+				if selection.Name == "__typename" {
+					field = &Field{Name: "__typename", Type: &NonNull{Of: String}}
+				}
+				if field == nil {
+					return fmt.Errorf("%s has no field %s", object.Name, selection.Name)
+				}
+				args, err := e.arguments(field, selection.Arguments)
+				if err != nil {
+					return fmt.Errorf("%s.%s: %s", object.Name, field.Name, err)
+				}
+				group := &fieldGroup{key: key, field: field, args: args, selections: selection.SelectionSet}
+				byKey[key] = group
+				groups = append(groups, group)
+			}
+		}
+
+		return nil
+	}
+
+	return groups, add(selections)
+}
+
+// included checks @skip and @include
+func (e *executor) included(directives []Directive) (bool, error) {
+	for _, directive := range directives {
+		if directive.Name != "skip" && directive.Name != "include" {
+			return false, fmt.Errorf("Unknown directive @%s", directive.Name)
+		}
+		value, err := coerce(directive.Arguments["if"], &NonNull{Of: Boolean}, e.variables)
+		if err != nil {
+			return false, fmt.Errorf("@%s: %s", directive.Name, err)
+		}
+		if value.(bool) == (directive.Name == "skip") {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// arguments checks the arguments of a field, filling in defaults
+func (e *executor) arguments(field *Field, values map[string]interface{}) (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	for name := range values {
+		known := false
+		for _, arg := range field.Args {
+			known = known || arg.Name == name
+		}
+		if !known {
+			return nil, fmt.Errorf("Unknown argument %s", name)
+		}
+	}
+	for _, arg := range field.Args {
+		value, ok := values[arg.Name]
+		if !ok {
+			value = arg.Default
+		}
+		coerced, err := coerce(value, arg.Type, e.variables)
+		if err != nil {
+			return nil, fmt.Errorf("Argument %s: %s", arg.Name, err)
+		}
+		args[arg.Name] = coerced
+	}
+
+	return args, nil
+}
+
+// measure checks the selections under each field and works out the cost and depth of a query
+func (e *executor) measure(object *Object, groups []*fieldGroup, depth int) (int, int, error) {
+	cost, maxDepth := 0, depth
+	for _, group := range groups {
+		fieldCost := group.field.Cost
+		if fieldCost == 0 {
+			fieldCost = 1
+		}
+
+		child, list := objectOf(group.field.Type)
+		if child == nil {
+			if len(group.selections) > 0 {
+				return 0, 0, fmt.Errorf("%s.%s is a %s, it can't have selections", object.Name, group.field.Name, group.field.Type)
+			}
+			cost += fieldCost
+			continue
+		}
+		if len(group.selections) == 0 {
+			return 0, 0, fmt.Errorf("%s.%s is a %s, select some of its fields", object.Name, group.field.Name, group.field.Type)
+		}
+
+		childGroups, err := e.collect(child, group.selections, map[string]bool{})
+		if err != nil {
+			return 0, 0, err
+		}
+		childCost, childDepth, err := e.measure(child, childGroups, depth+1)
+		if err != nil {
+			return 0, 0, err
+		}
+		if list {
+			size := DefaultListSize
+			if limit, ok := group.args["limit"].(int); ok && limit > 0 {
+				size = limit
+			}
+			childCost *= size
+		}
+		cost += fieldCost + childCost
+		if childDepth > maxDepth {
+			maxDepth = childDepth
+		}
+	}
+
+	return cost, maxDepth, nil
+}
+
+// objectOf gets the object type under any lists and non-nulls, and whether it is in a list
+func objectOf(t Type) (*Object, bool) {
+	switch typed := t.(type) {
+	case *NonNull:
+		return objectOf(typed.Of)
+	case *List:
+		object, _ := objectOf(typed.Of)
+		return object, true
+	case *Object:
+		return typed, false
+	}
+
+	return nil, false
+}
+
+// executeObjects resolves fields on all parents of an object type together,
+// so each field's resolver is called once per level of the query
+func (e *executor) executeObjects(ctx context.Context, object *Object, parents []interface{}, groups []*fieldGroup, path []interface{}) []*orderedObject {
+	results := make([]*orderedObject, len(parents))
+	for i := range results {
+		results[i] = &orderedObject{values: map[string]interface{}{}}
+	}
+
+	for _, group := range groups {
+		fieldPath := append(append([]interface{}{}, path...), group.key)
+		values, err := e.resolve(ctx, object, group, parents)
+		if err != nil {
+			e.errors = append(e.errors, &Error{Message: err.Error(), Path: fieldPath})
+			values = make([]interface{}, len(parents))
+		} else {
+			values, err = e.complete(ctx, group.field.Type, values, group.selections, fieldPath)
+			if err != nil {
+				e.errors = append(e.errors, &Error{Message: err.Error(), Path: fieldPath})
+				values = make([]interface{}, len(parents))
+			}
+		}
+		for i, result := range results {
+			result.set(group.key, values[i])
+		}
+	}
+
+	return results
+}
+
+func (e *executor) resolve(ctx context.Context, object *Object, group *fieldGroup, parents []interface{}) ([]interface{}, error) {
+	values := make([]interface{}, len(parents))
+	switch {
+	case group.field.Name == "__typename":
+		for i := range values {
+			values[i] = object.Name
+		}
+	case group.field.Resolve != nil:
+		resolved, err := group.field.Resolve(ctx, parents, group.args)
+		if err != nil {
+			return nil, err
+		}
+		if len(resolved) != len(parents) {
+			return nil, fmt.Errorf("%s.%s resolved %d values for %d parents", object.Name, group.field.Name, len(resolved), len(parents))
+		}
+		values = resolved
+	default:
+		for i, parent := range parents {
+			value := reflect.Indirect(reflect.ValueOf(parent))
+			if value.Kind() == reflect.Struct {
+				values[i] = value.FieldByIndex(group.field.index).Interface()
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// complete turns resolved values into their response values, resolving the
+// selections of objects for all values at once
+func (e *executor) complete(ctx context.Context, t Type, values []interface{}, selections []Selection, path []interface{}) ([]interface{}, error) {
+	switch typed := t.(type) {
+	case *NonNull:
+		completed, err := e.complete(ctx, typed.Of, values, selections, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range completed {
+			if isNull(value) {
+				return nil, fmt.Errorf("Cannot return null for %s", t)
+			}
+		}
+		return completed, nil
+	case *List:
+		var items []interface{}
+		lengths := make([]int, len(values))
+		for i, value := range values {
+			if isNull(value) {
+				lengths[i] = -1
+				continue
+			}
+			list := reflect.ValueOf(value)
+			if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+				return nil, fmt.Errorf("Expected a list for %s, got %T", t, value)
+			}
+			lengths[i] = list.Len()
+			for j := 0; j < list.Len(); j++ {
+				items = append(items, list.Index(j).Interface())
+			}
+		}
+		completedItems, err := e.complete(ctx, typed.Of, items, selections, path)
+		if err != nil {
+			return nil, err
+		}
+		completed := make([]interface{}, len(values))
+		for i, length := range lengths {
+			if length < 0 {
+				continue
+			}
+			list := make([]interface{}, length)
+			copy(list, completedItems)
+			completed[i] = list
+			completedItems = completedItems[length:]
+		}
+		return completed, nil
+	case *Object:
+		groups, err := e.collect(typed, selections, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		var parents []interface{}
+		for _, value := range values {
+			if !isNull(value) {
+				parents = append(parents, value)
+			}
+		}
+		results := e.executeObjects(ctx, typed, parents, groups, path)
+		completed := make([]interface{}, len(values))
+		for i, value := range values {
+			if !isNull(value) {
+				completed[i] = results[0]
+				results = results[1:]
+			}
+		}
+		return completed, nil
+	}
+
+	completed := make([]interface{}, len(values))
+	for i, value := range values {
+		if !isNull(value) {
+			completed[i] = reflect.Indirect(reflect.ValueOf(value)).Interface()
+		}
+	}
+
+	return completed, nil
+}
+
+func isNull(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map:
+		return reflected.IsNil()
+	}
+
+	return false
+}
+
+// coerce checks an input value against its type, replacing variables with their values
+func coerce(value interface{}, t Type, variables map[string]interface{}) (interface{}, error) {
+	if variable, ok := value.(Variable); ok {
+		value, ok = variables[string(variable)]
+		if !ok {
+			return nil, fmt.Errorf("Undefined variable $%s", variable)
+		}
+	}
+
+	if nonNull, ok := t.(*NonNull); ok {
+		if value == nil {
+			return nil, fmt.Errorf("Expected a %s, got null", t)
+		}
+		return coerce(value, nonNull.Of, variables)
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	switch t {
+	case String, ID:
+		switch typed := value.(type) {
+		case string:
+			return typed, nil
+		case int64:
+			if t == ID {
+				return fmt.Sprint(typed), nil
+			}
+		}
+	case Int:
+		switch typed := value.(type) {
+		case int:
+			return typed, nil
+		case int64:
+			if typed >= math.MinInt32 && typed <= math.MaxInt32 {
+				return int(typed), nil
+			}
+		case float64:
+			// JSON variables are floats
+			if typed == math.Trunc(typed) && typed >= math.MinInt32 && typed <= math.MaxInt32 {
+				return int(typed), nil
+			}
+		}
+	case Float:
+		switch typed := value.(type) {
+		case float64:
+			return typed, nil
+		case int64:
+			return float64(typed), nil
+		}
+	case Boolean:
+		if typed, ok := value.(bool); ok {
+			return typed, nil
+		}
+	}
+	if list, ok := t.(*List); ok {
+		values, ok := value.([]interface{})
+		if !ok {
+			// A single value is a list of one
+			values = []interface{}{value}
+		}
+		coerced := make([]interface{}, len(values))
+		for i, item := range values {
+			var err error
+			coerced[i], err = coerce(item, list.Of, variables)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return coerced, nil
+	}
+
+	return nil, fmt.Errorf("Expected a %s, got %v", t, value)
+}
+
+func toError(err error) *Error {
+	if graphQLError, ok := err.(*Error); ok {
+		return graphQLError
+	}
+
+	return &Error{Message: err.Error()}
+}
+
+// orderedObject is a response object, which keeps its fields in the order they were asked for
+type orderedObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *orderedObject) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// MarshalJSON writes the fields in order
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		keyJSON, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		valueJSON, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(keyJSON)
+		buffer.WriteByte(':')
+		buffer.Write(valueJSON)
+	}
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,119 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type testProject struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ClientID string `json:"clientID"`
+	Hidden   string `json:"-"`
+}
+
+type testCompany struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func testSchema(calls *int) *Schema {
+	schema := NewSchema()
+	project := schema.ObjectOf(testProject{})
+	company := schema.ObjectOf(testCompany{})
+	project.AddField(&Field{
+		Name: "client",
+		Type: company,
+		Resolve: func(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+			*calls++
+			clients := make([]interface{}, len(parents))
+			for i, parent := range parents {
+				if clientID := parent.(testProject).ClientID; clientID != "" {
+					clients[i] = testCompany{ID: clientID, Name: "Company " + clientID}
+				}
+			}
+			return clients, nil
+		},
+	})
+	schema.Query.AddField(&Field{
+		Name: "projects",
+		Type: &NonNull{Of: &List{Of: &NonNull{Of: project}}},
+		Args: []Argument{{Name: "limit", Type: Int}},
+		Resolve: func(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+			projects := []testProject{{ID: "1", Name: "Riverside", ClientID: "a"}, {ID: "2", Name: "Library", ClientID: "b"}, {ID: "3", Name: "Depot"}}
+			if limit, ok := args["limit"].(int); ok && limit < len(projects) {
+				projects = projects[:limit]
+			}
+			return []interface{}{projects}, nil
+		},
+	})
+
+	return schema
+}
+
+func TestExecute(t *testing.T) {
+	calls := 0
+	schema := testSchema(&calls)
+	response := schema.Execute(context.Background(), Request{
+		Query: `query Projects($limit: Int, $noClient: Boolean = false) {
+			all: projects(limit: $limit) { ...names client @skip(if: $noClient) { name } __typename }
+		}
+		fragment names on testProject { id name }`,
+		Variables: map[string]interface{}{"limit": float64(3)},
+	}, Limits{})
+	body, _ := json.Marshal(response)
+	expected := `{"data":{"all":[` +
+		`{"id":"1","name":"Riverside","client":{"name":"Company a"},"__typename":"testProject"},` +
+		`{"id":"2","name":"Library","client":{"name":"Company b"},"__typename":"testProject"},` +
+		`{"id":"3","name":"Depot","client":null,"__typename":"testProject"}]}}`
+	if string(body) != expected {
+		t.Errorf("Unexpected response %s", body)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the clients to be loaded in one call, got %d", calls)
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	calls := 0
+	schema := testSchema(&calls)
+	tests := []struct {
+		query   string
+		limits  Limits
+		message string
+	}{
+		{`{ projects { secret } }`, Limits{}, "testProject has no field secret"},
+		{`{ projects { Hidden } }`, Limits{}, "testProject has no field Hidden"},
+		{`{ projects }`, Limits{}, "select some of its fields"},
+		{`{ projects { name { first } } }`, Limits{}, "can't have selections"},
+		{`{ projects(limit: "ten") { name } }`, Limits{}, "Argument limit: Expected a Int"},
+		{`mutation { projects { name } }`, Limits{}, "Only queries are supported"},
+		{`{ projects { name `, Limits{}, "Unexpected end of document"},
+		{`{ projects { client { name } } }`, Limits{MaxDepth: 2}, "nested 3 deep, the limit is 2"},
+		{`{ projects { name client { name } } }`, Limits{MaxCost: 30}, "costs 31, the limit is 30"},
+	}
+	for _, test := range tests {
+		response := schema.Execute(context.Background(), Request{Query: test.query}, test.limits)
+		if response.Data != nil || len(response.Errors) != 1 || !strings.Contains(response.Errors[0].Message, test.message) {
+			t.Errorf("%s: expected %q, got %+v", test.query, test.message, response.Errors)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("Expected nothing to be resolved, got %d calls", calls)
+	}
+}
+
+func TestSDL(t *testing.T) {
+	calls := 0
+	sdl := testSchema(&calls).SDL()
+	for _, expected := range []string{
+		"type Query {\n  projects(limit: Int): [testProject!]!\n}",
+		"type testProject {\n  id: ID!\n  name: String!\n  clientID: String!\n  client: testCompany\n}",
+	} {
+		if !strings.Contains(sdl, expected) {
+			t.Errorf("Expected %q in\n%s", expected, sdl)
+		}
+	}
+}
@@ -0,0 +1,648 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Document is a parsed GraphQL request document
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query, mutation or subscription
+type Operation struct {
+	Type         string
+	Name         string
+	Variables    []VariableDefinition
+	SelectionSet []Selection
+}
+
+// VariableDefinition is a variable an operation takes, like $id: ID!
+type VariableDefinition struct {
+	Name    string
+	Type    TypeName
+	Default interface{}
+}
+
+// TypeName is a type written in a document, like [ID!]
+type TypeName struct {
+	Name    string
+	List    *TypeName
+	NonNull bool
+}
+
+func (t TypeName) String() string {
+	name := t.Name
+	if t.List != nil {
+		name = "[" + t.List.String() + "]"
+	}
+	if t.NonNull {
+		name += "!"
+	}
+
+	return name
+}
+
+// Fragment is a named fragment
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	SelectionSet  []Selection
+}
+
+// Selection is a field, a fragment spread or an inline fragment
+type Selection struct {
+	// Field selections
+	Alias        string
+	Name         string
+	Arguments    map[string]interface{}
+	SelectionSet []Selection
+	// Fragment spreads
+	Fragment string
+	// Inline fragments, which only have a SelectionSet
+	Inline        bool
+	TypeCondition string
+	Directives    []Directive
+}
+
+// Directive is a directive like @include(if: $expanded)
+type Directive struct {
+	Name      string
+	Arguments map[string]interface{}
+}
+
+// Variable is a $variable used as a value
+type Variable string
+
+// EnumValue is an unquoted name used as a value
+type EnumValue string
+
+// Parse parses a GraphQL document
+func Parse(source string) (*Document, error) {
+	p := &parser{lexer: lexer{source: source}}
+	err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	document := &Document{Fragments: map[string]*Fragment{}}
+	for p.token.kind != tokenEOF {
+		switch {
+		case p.token.is(tokenPunctuator, "{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			document.Operations = append(document.Operations, &Operation{Type: "query", SelectionSet: selections})
+		case p.token.is(tokenName, "fragment"):
+			fragment, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := document.Fragments[fragment.Name]; ok {
+				return nil, fmt.Errorf("There can only be one fragment named %s", fragment.Name)
+			}
+			document.Fragments[fragment.Name] = fragment
+		case p.token.is(tokenName, "query"), p.token.is(tokenName, "mutation"), p.token.is(tokenName, "subscription"):
+			operation, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			document.Operations = append(document.Operations, operation)
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(document.Operations) == 0 {
+		return nil, fmt.Errorf("The document has no operations")
+	}
+
+	return document, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunctuator
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func (t token) is(kind tokenKind, value string) bool {
+	return t.kind == kind && t.value == value
+}
+
+type lexer struct {
+	source string
+	pos    int
+}
+
+// next reads the next token, skipping whitespace, commas and comments
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.source) {
+		c := l.source[l.pos]
+		if c == '#' {
+			for l.pos < len(l.source) && l.source[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.pos++
+			continue
+		}
+		break
+	}
+	if l.pos >= len(l.source) {
+		return token{kind: tokenEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.source[l.pos]
+	switch {
+	case strings.HasPrefix(l.source[l.pos:], "..."):
+		l.pos += 3
+		return token{kind: tokenPunctuator, value: "...", pos: start}, nil
+	case strings.IndexByte("!$():=@[]{}|&", c) >= 0:
+		l.pos++
+		return token{kind: tokenPunctuator, value: string(c), pos: start}, nil
+	case c == '_' || isLetter(c):
+		for l.pos < len(l.source) && (l.source[l.pos] == '_' || isLetter(l.source[l.pos]) || isDigit(l.source[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokenName, value: l.source[start:l.pos], pos: start}, nil
+	case c == '-' || isDigit(c):
+		return l.number()
+	case c == '"':
+		return l.string()
+	}
+
+	return token{}, fmt.Errorf("Unexpected character %q at %d", c, start)
+}
+
+func (l *lexer) number() (token, error) {
+	start := l.pos
+	kind := tokenInt
+	if l.source[l.pos] == '-' {
+		l.pos++
+	}
+	digits := func() {
+		for l.pos < len(l.source) && isDigit(l.source[l.pos]) {
+			l.pos++
+		}
+	}
+	digits()
+	if l.pos < len(l.source) && l.source[l.pos] == '.' {
+		kind = tokenFloat
+		l.pos++
+		digits()
+	}
+	if l.pos < len(l.source) && (l.source[l.pos] == 'e' || l.source[l.pos] == 'E') {
+		kind = tokenFloat
+		l.pos++
+		if l.pos < len(l.source) && (l.source[l.pos] == '+' || l.source[l.pos] == '-') {
+			l.pos++
+		}
+		digits()
+	}
+
+	return token{kind: kind, value: l.source[start:l.pos], pos: start}, nil
+}
+
+func (l *lexer) string() (token, error) {
+	start := l.pos
+	if strings.HasPrefix(l.source[l.pos:], `"""`) {
+		end := strings.Index(l.source[l.pos+3:], `"""`)
+		if end < 0 {
+			return token{}, fmt.Errorf("Unterminated string at %d", start)
+		}
+		value := l.source[l.pos+3 : l.pos+3+end]
+		l.pos += end + 6
+		return token{kind: tokenString, value: strings.TrimSpace(value), pos: start}, nil
+	}
+
+	l.pos++
+	for l.pos < len(l.source) && l.source[l.pos] != '"' {
+		if l.source[l.pos] == '\\' {
+			l.pos++
+		}
+		if l.pos < len(l.source) && l.source[l.pos] == '\n' {
+			break
+		}
+		l.pos++
+	}
+	if l.pos >= len(l.source) || l.source[l.pos] != '"' {
+		return token{}, fmt.Errorf("Unterminated string at %d", start)
+	}
+	l.pos++
+	value, err := strconv.Unquote(l.source[start:l.pos])
+	if err != nil {
+		return token{}, fmt.Errorf("Invalid string at %d: %s", start, err)
+	}
+
+	return token{kind: tokenString, value: value, pos: start}, nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type parser struct {
+	lexer lexer
+	token token
+}
+
+func (p *parser) next() error {
+	var err error
+	p.token, err = p.lexer.next()
+
+	return err
+}
+
+func (p *parser) unexpected() error {
+	if p.token.kind == tokenEOF {
+		return fmt.Errorf("Unexpected end of document")
+	}
+
+	return fmt.Errorf("Unexpected %q at %d", p.token.value, p.token.pos)
+}
+
+// expect skips a punctuator, failing if it isn't the next token
+func (p *parser) expect(punctuator string) error {
+	if !p.token.is(tokenPunctuator, punctuator) {
+		return p.unexpected()
+	}
+
+	return p.next()
+}
+
+// skip skips a punctuator if it is the next token
+func (p *parser) skip(punctuator string) (bool, error) {
+	if !p.token.is(tokenPunctuator, punctuator) {
+		return false, nil
+	}
+
+	return true, p.next()
+}
+
+func (p *parser) name() (string, error) {
+	if p.token.kind != tokenName {
+		return "", p.unexpected()
+	}
+	name := p.token.value
+
+	return name, p.next()
+}
+
+func (p *parser) operation() (*Operation, error) {
+	operation := &Operation{Type: p.token.value}
+	err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if p.token.kind == tokenName {
+		operation.Name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.token.is(tokenPunctuator, "(") {
+		operation.Variables, err = p.variableDefinitions()
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	operation.SelectionSet, err = p.selectionSet()
+
+	return operation, err
+}
+
+func (p *parser) variableDefinitions() ([]VariableDefinition, error) {
+	err := p.expect("(")
+	if err != nil {
+		return nil, err
+	}
+
+	var definitions []VariableDefinition
+	for !p.token.is(tokenPunctuator, ")") {
+		err = p.expect("$")
+		if err != nil {
+			return nil, err
+		}
+		var definition VariableDefinition
+		definition.Name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expect(":")
+		if err != nil {
+			return nil, err
+		}
+		definition.Type, err = p.typeName()
+		if err != nil {
+			return nil, err
+		}
+		ok, err := p.skip("=")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			definition.Default, err = p.value(true)
+			if err != nil {
+				return nil, err
+			}
+		}
+		definitions = append(definitions, definition)
+	}
+
+	return definitions, p.next()
+}
+
+func (p *parser) typeName() (TypeName, error) {
+	var typeName TypeName
+	ok, err := p.skip("[")
+	if err != nil {
+		return typeName, err
+	}
+	if ok {
+		of, err := p.typeName()
+		if err != nil {
+			return typeName, err
+		}
+		typeName.List = &of
+		err = p.expect("]")
+		if err != nil {
+			return typeName, err
+		}
+	} else {
+		typeName.Name, err = p.name()
+		if err != nil {
+			return typeName, err
+		}
+	}
+	typeName.NonNull, err = p.skip("!")
+
+	return typeName, err
+}
+
+func (p *parser) fragment() (*Fragment, error) {
+	err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	fragment := &Fragment{}
+	fragment.Name, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	if !p.token.is(tokenName, "on") {
+		return nil, p.unexpected()
+	}
+	err = p.next()
+	if err != nil {
+		return nil, err
+	}
+	fragment.TypeCondition, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	fragment.SelectionSet, err = p.selectionSet()
+
+	return fragment, err
+}
+
+func (p *parser) selectionSet() ([]Selection, error) {
+	err := p.expect("{")
+	if err != nil {
+		return nil, err
+	}
+
+	var selections []Selection
+	for !p.token.is(tokenPunctuator, "}") {
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("Empty selection set at %d", p.token.pos)
+	}
+
+	return selections, p.next()
+}
+
+func (p *parser) selection() (Selection, error) {
+	var selection Selection
+	ok, err := p.skip("...")
+	if err != nil {
+		return selection, err
+	}
+	if ok {
+		if p.token.kind == tokenName && p.token.value != "on" {
+			selection.Fragment, err = p.name()
+			if err != nil {
+				return selection, err
+			}
+			selection.Directives, err = p.directives()
+			return selection, err
+		}
+
+		selection.Inline = true
+		if p.token.is(tokenName, "on") {
+			err = p.next()
+			if err != nil {
+				return selection, err
+			}
+			selection.TypeCondition, err = p.name()
+			if err != nil {
+				return selection, err
+			}
+		}
+		selection.Directives, err = p.directives()
+		if err != nil {
+			return selection, err
+		}
+		selection.SelectionSet, err = p.selectionSet()
+		return selection, err
+	}
+
+	selection.Name, err = p.name()
+	if err != nil {
+		return selection, err
+	}
+	ok, err = p.skip(":")
+	if err != nil {
+		return selection, err
+	}
+	if ok {
+		selection.Alias = selection.Name
+		selection.Name, err = p.name()
+		if err != nil {
+			return selection, err
+		}
+	}
+	selection.Arguments, err = p.arguments()
+	if err != nil {
+		return selection, err
+	}
+	selection.Directives, err = p.directives()
+	if err != nil {
+		return selection, err
+	}
+	if p.token.is(tokenPunctuator, "{") {
+		selection.SelectionSet, err = p.selectionSet()
+	}
+
+	return selection, err
+}
+
+func (p *parser) arguments() (map[string]interface{}, error) {
+	arguments := map[string]interface{}{}
+	ok, err := p.skip("(")
+	if err != nil || !ok {
+		return arguments, err
+	}
+
+	for !p.token.is(tokenPunctuator, ")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expect(":")
+		if err != nil {
+			return nil, err
+		}
+		arguments[name], err = p.value(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return arguments, p.next()
+}
+
+func (p *parser) directives() ([]Directive, error) {
+	var directives []Directive
+	for p.token.is(tokenPunctuator, "@") {
+		err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		var directive Directive
+		directive.Name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+		directive.Arguments, err = p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, directive)
+	}
+
+	return directives, nil
+}
+
+// value parses a value. Constant values, like variable defaults, can't use variables.
+func (p *parser) value(constant bool) (interface{}, error) {
+	current := p.token
+	switch current.kind {
+	case tokenInt:
+		number, err := strconv.ParseInt(current.value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Int %s at %d", current.value, current.pos)
+		}
+		return number, p.next()
+	case tokenFloat:
+		number, err := strconv.ParseFloat(current.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Float %s at %d", current.value, current.pos)
+		}
+		return number, p.next()
+	case tokenString:
+		return current.value, p.next()
+	case tokenName:
+		err := p.next()
+		switch current.value {
+		case "true":
+			return true, err
+		case "false":
+			return false, err
+		case "null":
+			return nil, err
+		}
+		return EnumValue(current.value), err
+	}
+
+	switch {
+	case current.is(tokenPunctuator, "$") && !constant:
+		err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return Variable(name), err
+	case current.is(tokenPunctuator, "["):
+		err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.token.is(tokenPunctuator, "]") {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, p.next()
+	case current.is(tokenPunctuator, "{"):
+		err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		object := map[string]interface{}{}
+		for !p.token.is(tokenPunctuator, "}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			err = p.expect(":")
+			if err != nil {
+				return nil, err
+			}
+			object[name], err = p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return object, p.next()
+	}
+
+	return nil, p.unexpected()
+}
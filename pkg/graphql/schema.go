@@ -0,0 +1,281 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Type is a GraphQL output or argument type
+type Type interface {
+	String() string
+}
+
+// Scalar is a built in scalar type
+type Scalar struct {
+	Name string
+}
+
+func (s *Scalar) String() string { return s.Name }
+
+// Built in scalars
+var (
+	String  = &Scalar{Name: "String"}
+	Int     = &Scalar{Name: "Int"}
+	Float   = &Scalar{Name: "Float"}
+	Boolean = &Scalar{Name: "Boolean"}
+	ID      = &Scalar{Name: "ID"}
+)
+
+// List is a list of another type
+type List struct {
+	Of Type
+}
+
+func (l *List) String() string { return "[" + l.Of.String() + "]" }
+
+// NonNull is a type that is never null
+type NonNull struct {
+	Of Type
+}
+
+func (n *NonNull) String() string { return n.Of.String() + "!" }
+
+// Object is an object type with fields
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+}
+
+func (o *Object) String() string { return o.Name }
+
+// Field gets a field by name
+func (o *Object) Field(name string) *Field {
+	for _, field := range o.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+
+	return nil
+}
+
+// AddField adds a field, replacing any field with the same name
+func (o *Object) AddField(field *Field) {
+	for i, existing := range o.Fields {
+		if existing.Name == field.Name {
+			o.Fields[i] = field
+			return
+		}
+	}
+	o.Fields = append(o.Fields, field)
+}
+
+// Resolver gets a field of every parent at once, so related records can be
+// loaded with one provider call instead of one per parent. It returns a value
+// per parent, in the same order.
+type Resolver func(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error)
+
+// Field is a field of an Object
+type Field struct {
+	Name        string
+	Description string
+	Type        Type
+	Args        []Argument
+	// Resolve gets the field, nil for struct fields, which are read from the parent
+	Resolve Resolver
+	// Cost is how expensive the field is for the query cost limit, 1 if zero
+	Cost int
+
+	index []int
+}
+
+// Argument is an argument of a field
+type Argument struct {
+	Name        string
+	Description string
+	Type        Type
+	Default     interface{}
+}
+
+// Schema is the types a query can ask for, starting at Query
+type Schema struct {
+	Query   *Object
+	objects map[reflect.Type]*Object
+}
+
+// NewSchema makes a schema with an empty Query type
+func NewSchema() *Schema {
+	return &Schema{Query: &Object{Name: "Query"}, objects: map[reflect.Type]*Object{}}
+}
+
+// ObjectOf gets the object type for the struct type of v, generating it the
+// first time. Fields are named like their JSON, fields without JSON are left out.
+func (s *Schema) ObjectOf(v interface{}) *Object {
+	return s.object(reflect.TypeOf(v))
+}
+
+func (s *Schema) object(t reflect.Type) *Object {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if object, ok := s.objects[t]; ok {
+		return object
+	}
+
+	object := &Object{Name: t.Name()}
+	s.objects[t] = object
+	s.addFields(object, t, nil)
+
+	return object
+}
+
+func (s *Schema) addFields(object *Object, t reflect.Type, index []int) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			s.addFields(object, field.Type, fieldIndex)
+			continue
+		}
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldType := s.typeOf(field.Type)
+		if fieldType == nil {
+			continue
+		}
+		if strings.EqualFold(name, "id") {
+			fieldType = ID
+		}
+		object.AddField(&Field{Name: name, Type: &NonNull{Of: fieldType}, index: fieldIndex})
+	}
+}
+
+func (s *Schema) typeOf(t reflect.Type) Type {
+	switch t.Kind() {
+	case reflect.String:
+		return String
+	case reflect.Bool:
+		return Boolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint8, reflect.Uint16:
+		return Int
+	case reflect.Float32, reflect.Float64:
+		return Float
+	case reflect.Slice, reflect.Array:
+		of := s.typeOf(t.Elem())
+		if of == nil {
+			return nil
+		}
+		return &List{Of: &NonNull{Of: of}}
+	case reflect.Struct:
+		return s.object(t)
+	case reflect.Ptr:
+		return s.typeOf(t.Elem())
+	}
+
+	return nil
+}
+
+// named gets a type by the name it has in queries, like [ID!]
+func (s *Schema) named(name TypeName) Type {
+	if name.List != nil {
+		of := s.named(*name.List)
+		if of == nil {
+			return nil
+		}
+		return wrapNonNull(&List{Of: of}, name.NonNull)
+	}
+	var t Type
+	switch name.Name {
+	case "String":
+		t = String
+	case "Int":
+		t = Int
+	case "Float":
+		t = Float
+	case "Boolean":
+		t = Boolean
+	case "ID":
+		t = ID
+	default:
+		return nil
+	}
+
+	return wrapNonNull(t, name.NonNull)
+}
+
+func wrapNonNull(t Type, nonNull bool) Type {
+	if nonNull {
+		return &NonNull{Of: t}
+	}
+
+	return t
+}
+
+// SDL is the schema in the GraphQL schema definition language
+func (s *Schema) SDL() string {
+	var objects []*Object
+	seen := map[*Object]bool{}
+	var visit func(t Type)
+	visit = func(t Type) {
+		switch typed := t.(type) {
+		case *NonNull:
+			visit(typed.Of)
+		case *List:
+			visit(typed.Of)
+		case *Object:
+			if seen[typed] {
+				return
+			}
+			seen[typed] = true
+			objects = append(objects, typed)
+			for _, field := range typed.Fields {
+				visit(field.Type)
+			}
+		}
+	}
+	visit(s.Query)
+	sort.SliceStable(objects[1:], func(i, j int) bool { return objects[i+1].Name < objects[j+1].Name })
+
+	var sdl strings.Builder
+	sdl.WriteString("schema {\n  query: Query\n}\n")
+	for _, object := range objects {
+		sdl.WriteString("\n")
+		writeDescription(&sdl, "", object.Description)
+		sdl.WriteString(fmt.Sprintf("type %s {\n", object.Name))
+		for _, field := range object.Fields {
+			writeDescription(&sdl, "  ", field.Description)
+			sdl.WriteString("  " + field.Name)
+			if len(field.Args) > 0 {
+				var args []string
+				for _, arg := range field.Args {
+					text := arg.Name + ": " + arg.Type.String()
+					if arg.Default != nil {
+						text += fmt.Sprintf(" = %v", arg.Default)
+					}
+					args = append(args, text)
+				}
+				sdl.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			sdl.WriteString(": " + field.Type.String() + "\n")
+		}
+		sdl.WriteString("}\n")
+	}
+
+	return sdl.String()
+}
+
+func writeDescription(sdl *strings.Builder, indent string, description string) {
+	if description != "" {
+		sdl.WriteString(fmt.Sprintf("%s\"%s\"\n", indent, strings.ReplaceAll(description, `"`, `\"`)))
+	}
+}
@@ -0,0 +1,150 @@
+// Package health runs the readiness checks of the server's dependencies. Results
+// are cached for a while, so probes are cheap however often they come.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Statuses of a check and of the whole report
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check returns an error if a dependency isn't usable. It should give up when
+// ctx is done.
+type Check func(ctx context.Context) error
+
+// Result is how a check went
+type Result struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+}
+
+// Report has the result of every check. Its status fails if any of them failed.
+type Report struct {
+	Status  string            `json:"status"`
+	Checked string            `json:"checked"`
+	Checks  map[string]Result `json:"checks"`
+}
+
+// OK is true if every check passed
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// PublicReport is a Report without errors or timings, only the status of each
+// check, for callers who shouldn't see how the server is set up
+type PublicReport struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Public leaves out everything but the statuses
+func (r Report) Public() PublicReport {
+	public := PublicReport{Status: r.Status, Checks: map[string]string{}}
+	for name, result := range r.Checks {
+		public.Checks[name] = result.Status
+	}
+
+	return public
+}
+
+// Checker runs its checks at most once per CacheTTL, each for up to Timeout.
+// OnFail, if set, gets each failed result once per run, not per cached report.
+type Checker struct {
+	Timeout  time.Duration
+	CacheTTL time.Duration
+	OnFail   func(name string, result Result)
+	names    []string
+	checks   map[string]Check
+	mutex    sync.Mutex
+	report   Report
+	expires  time.Time
+}
+
+// errTimedOut is the error of a check that didn't return within the timeout
+var errTimedOut = errors.New("Check timed out")
+
+// New makes a Checker without any checks
+func New(timeout time.Duration, cacheTTL time.Duration) *Checker {
+	return &Checker{Timeout: timeout, CacheTTL: cacheTTL, checks: map[string]Check{}}
+}
+
+// Add adds a named check
+func (c *Checker) Add(name string, check Check) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+	c.expires = time.Time{}
+}
+
+// Check gets the report, running the checks if the cached one is older than
+// CacheTTL. Checks run at the same time, and concurrent callers share a run.
+func (c *Checker) Check(now time.Time) Report {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if now.Before(c.expires) {
+		return c.report
+	}
+
+	results := make([]Result, len(c.names))
+	var wait sync.WaitGroup
+	for i, name := range c.names {
+		wait.Add(1)
+		go func(i int, check Check) {
+			defer wait.Done()
+			results[i] = c.run(check)
+		}(i, c.checks[name])
+	}
+	wait.Wait()
+
+	report := Report{Status: StatusOK, Checked: now.Format(time.RFC3339), Checks: map[string]Result{}}
+	for i, name := range c.names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+			if c.OnFail != nil {
+				c.OnFail(name, results[i])
+			}
+		}
+	}
+	c.report = report
+	c.expires = now.Add(c.CacheTTL)
+
+	return report
+}
+
+// run runs a check, giving up on it after Timeout even if it ignores its context
+func (c *Checker) run(check Check) Result {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errTimedOut
+	}
+
+	result := Result{Status: StatusOK, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	return result
+}
@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	runs := 0
+	failing := false
+	failed := map[string]int{}
+	checker := New(50*time.Millisecond, time.Minute)
+	checker.OnFail = func(name string, result Result) {
+		failed[name]++
+	}
+	checker.Add("database", func(ctx context.Context) error {
+		runs++
+		if failing {
+			return errors.New("Connection refused")
+		}
+		return nil
+	})
+	checker.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	now := time.Now()
+	report := checker.Check(now)
+	if report.OK() || report.Checks["database"].Status != StatusOK || report.Checks["slow"].Error != errTimedOut.Error() {
+		t.Errorf("Expected the slow check to time out and fail the report, got %+v", report)
+	}
+
+	checker.Add("slow", func(ctx context.Context) error { return nil })
+	failing = true
+	report = checker.Check(now)
+	if report.OK() || report.Checks["database"].Error != "Connection refused" || runs != 2 {
+		t.Errorf("Expected new checks to run right away, got %+v", report)
+	}
+
+	public := report.Public()
+	if public.Status != StatusFail || public.Checks["database"] != StatusFail || public.Checks["slow"] != StatusOK {
+		t.Errorf("Expected only the statuses in the public report, got %+v", public)
+	}
+
+	failing = false
+	if report = checker.Check(now.Add(30 * time.Second)); report.OK() || runs != 2 {
+		t.Errorf("Expected the cached report, got %+v after %d runs", report, runs)
+	}
+	if failed["slow"] != 1 || failed["database"] != 1 {
+		t.Errorf("Expected each failure to be reported once per run, got %v", failed)
+	}
+	if report = checker.Check(now.Add(2 * time.Minute)); !report.OK() || runs != 3 {
+		t.Errorf("Expected the checks to run again once the cache expired, got %+v", report)
+	}
+}
@@ -0,0 +1,230 @@
+// Package metrics keeps counters, gauges and histograms and writes them in the
+// Prometheus text exposition format. Metrics are made once, at package level,
+// in the Default registry, and can have labels like {method="GET"}.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of latency histograms, in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Default is the registry the server exposes
+var Default = NewRegistry()
+
+// Registry has a set of metrics
+type Registry struct {
+	mutex   sync.Mutex
+	metrics []*family
+}
+
+// NewRegistry makes an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// family is a metric with all of its label values
+type family struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	buckets    []float64
+	mutex      sync.Mutex
+	series     map[string]*series
+}
+
+// series is a metric with one set of label values
+type series struct {
+	labelValues []string
+	// value of a counter or gauge, the sum of a histogram
+	value float64
+	// counts of a histogram, per bucket and in all
+	bucketCounts []uint64
+	count        uint64
+}
+
+// Counter only goes up
+type Counter struct{ family *family }
+
+// Gauge goes up and down
+type Gauge struct{ family *family }
+
+// Histogram counts observations, like latencies, into buckets
+type Histogram struct{ family *family }
+
+// NewCounter adds a counter to the registry
+func (r *Registry) NewCounter(name string, help string, labelNames ...string) *Counter {
+	return &Counter{r.add(name, help, "counter", labelNames, nil)}
+}
+
+// NewGauge adds a gauge to the registry
+func (r *Registry) NewGauge(name string, help string, labelNames ...string) *Gauge {
+	return &Gauge{r.add(name, help, "gauge", labelNames, nil)}
+}
+
+// NewHistogram adds a histogram to the registry, with DefaultBuckets if
+// buckets is nil
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+
+	return &Histogram{r.add(name, help, "histogram", labelNames, buckets)}
+}
+
+func (r *Registry) add(name string, help string, kind string, labelNames []string, buckets []float64) *family {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, metric := range r.metrics {
+		if metric.name == name {
+			panic(fmt.Sprintf("metrics: %s is already registered", name))
+		}
+	}
+	metric := &family{name: name, help: help, kind: kind, labelNames: labelNames, buckets: buckets, series: map[string]*series{}}
+	r.metrics = append(r.metrics, metric)
+
+	return metric
+}
+
+// Add adds delta, which can't be negative, to the counter with the label values
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counters can't go down")
+	}
+	c.family.update(labelValues, func(s *series) { s.value += delta })
+}
+
+// Inc adds one to the counter with the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta to the gauge with the label values
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.family.update(labelValues, func(s *series) { s.value += delta })
+}
+
+// Set sets the gauge with the label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.family.update(labelValues, func(s *series) { s.value = value })
+}
+
+// Observe counts value into the histogram with the label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.family.update(labelValues, func(s *series) {
+		for i, bound := range h.family.buckets {
+			if value <= bound {
+				s.bucketCounts[i]++
+			}
+		}
+		s.count++
+		s.value += value
+	})
+}
+
+func (f *family) update(labelValues []string, update func(*series)) {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...), bucketCounts: make([]uint64, len(f.buckets))}
+		f.series[key] = s
+	}
+	update(s)
+}
+
+// WriteTo writes every metric in the text exposition format, sorted by name
+// and label values
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.Lock()
+	metrics := append([]*family(nil), r.metrics...)
+	r.mutex.Unlock()
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+
+	var out strings.Builder
+	for _, metric := range metrics {
+		metric.write(&out)
+	}
+	n, err := io.WriteString(w, out.String())
+
+	return int64(n), err
+}
+
+func (f *family) write(out *strings.Builder) {
+	fmt.Fprintf(out, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(out, "# TYPE %s %s\n", f.name, f.kind)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != "histogram" {
+			fmt.Fprintf(out, "%s%s %s\n", f.name, labels(f.labelNames, s.labelValues, "", ""), formatValue(s.value))
+			continue
+		}
+		for i, bound := range f.buckets {
+			fmt.Fprintf(out, "%s_bucket%s %d\n", f.name, labels(f.labelNames, s.labelValues, "le", formatValue(bound)), s.bucketCounts[i])
+		}
+		fmt.Fprintf(out, "%s_bucket%s %d\n", f.name, labels(f.labelNames, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(out, "%s_sum%s %s\n", f.name, labels(f.labelNames, s.labelValues, "", ""), formatValue(s.value))
+		fmt.Fprintf(out, "%s_count%s %d\n", f.name, labels(f.labelNames, s.labelValues, "", ""), s.count)
+	}
+}
+
+// labels formats label pairs like {method="GET",le="0.5"}, with an extra one if
+// extraName is set
+func labels(names []string, values []string, extraName string, extraValue string) string {
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
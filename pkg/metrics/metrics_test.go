@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounter("requests_total", "Requests.", "method", "path")
+	inFlight := registry.NewGauge("in_flight", "Requests being served.")
+	latency := registry.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "method")
+
+	requests.Inc("GET", "/api/users")
+	requests.Add(2, "GET", "/api/users")
+	requests.Inc("POST", `/api/"quoted"`)
+	inFlight.Add(3)
+	inFlight.Add(-1)
+	latency.Observe(0.05, "GET")
+	latency.Observe(0.5, "GET")
+	latency.Observe(2, "GET")
+
+	var out strings.Builder
+	_, err := registry.WriteTo(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP in_flight Requests being served.
+# TYPE in_flight gauge
+in_flight 2
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="GET",le="0.1"} 1
+latency_seconds_bucket{method="GET",le="1"} 2
+latency_seconds_bucket{method="GET",le="+Inf"} 3
+latency_seconds_sum{method="GET"} 2.55
+latency_seconds_count{method="GET"} 3
+# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{method="GET",path="/api/users"} 3
+requests_total{method="POST",path="/api/\"quoted\""} 1
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for missing label values")
+		}
+	}()
+	NewRegistry().NewCounter("requests_total", "Requests.", "method").Inc()
+}
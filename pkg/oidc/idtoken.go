@@ -0,0 +1,240 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// ErrInvalidIDToken if an ID token is malformed, badly signed or not meant for us
+var ErrInvalidIDToken = errors.New("Invalid ID token")
+
+// clockSkew is how far the IdP's clock may be off from ours
+const clockSkew = time.Minute
+
+// Verify checks the signature, issuer, audience, expiry and nonce of an ID token and returns its claims
+func (p *Provider) Verify(ctx context.Context, rawToken string, nonce string) (Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidIDToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return Claims{}, ErrInvalidIDToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrInvalidIDToken
+	}
+
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	err = checkSignature(header.Alg, key, parts[0]+"."+parts[1], signature)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	var raw map[string]interface{}
+	err = decodeSegment(parts[1], &raw)
+	if err != nil {
+		return Claims{}, ErrInvalidIDToken
+	}
+
+	if raw["iss"] != p.Config.Issuer {
+		return Claims{}, fmt.Errorf("%w: wrong issuer", ErrInvalidIDToken)
+	}
+	if !hasAudience(raw["aud"], p.Config.ClientID) {
+		return Claims{}, fmt.Errorf("%w: wrong audience", ErrInvalidIDToken)
+	}
+	expires, _ := raw["exp"].(float64)
+	if time.Now().Add(-clockSkew).Unix() > int64(expires) {
+		return Claims{}, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	}
+	if raw["nonce"] != nonce {
+		return Claims{}, fmt.Errorf("%w: wrong nonce", ErrInvalidIDToken)
+	}
+
+	claims := Claims{
+		Subject:   stringClaim(raw["sub"]),
+		Email:     strings.ToLower(stringClaim(raw["email"])),
+		FirstName: stringClaim(raw["given_name"]),
+		LastName:  stringClaim(raw["family_name"]),
+		Groups:    stringsClaim(raw[p.Config.GroupsClaim]),
+	}
+	// Some IdPs send email_verified as a string
+	switch verified := raw["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = verified
+	case string:
+		claims.EmailVerified = verified == "true"
+	}
+
+	return claims, nil
+}
+
+// key gets a signing key by ID, fetching the JWKS again if it is one we haven't seen
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := getJSON(ctx, p.Client, p.Discovery.JWKSURI, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting OIDC signing keys: %w", err)
+	}
+	p.keys = map[string]interface{}{}
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		publicKey, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		p.keys[k.Kid] = publicKey
+	}
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+	}
+
+	return key, nil
+}
+
+// jwk is a JSON web key, RSA or P-256 only
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("Unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported key type %s", k.Kty)
+}
+
+func checkSignature(alg string, key interface{}, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if ok && rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if ok && len(signature) == 64 {
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			if ecdsa.Verify(ecKey, digest[:], r, s) {
+				return nil
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidIDToken, alg)
+	}
+
+	return fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+}
+
+func decodeSegment(segment string, target interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(decoded, target)
+}
+
+func hasAudience(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func stringClaim(value interface{}) string {
+	s, _ := value.(string)
+
+	return s
+}
+
+// stringsClaim reads a claim that is a list of strings, or a single string
+func stringsClaim(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
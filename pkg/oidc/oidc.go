@@ -0,0 +1,193 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrIssuerMismatch if the discovery document is for a different issuer than configured
+var ErrIssuerMismatch = errors.New("OIDC discovery issuer does not match the configured issuer")
+
+// ErrNoIDToken if the token endpoint did not return an ID token
+var ErrNoIDToken = errors.New("OIDC token response has no id_token")
+
+// Config is the client registration with the identity provider
+type Config struct {
+	Issuer string
+	// DiscoveryURL defaults to the issuer's /.well-known/openid-configuration
+	DiscoveryURL string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// GroupsClaim is the ID token claim holding the user's groups, "groups" by default
+	GroupsClaim string
+}
+
+// Discovery is the part of the OpenID provider metadata we use
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the ID token claims we use
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	Groups        []string
+}
+
+// Provider is a discovered identity provider
+type Provider struct {
+	Config    Config
+	Discovery Discovery
+	Client    *http.Client
+
+	mu   sync.Mutex
+	keys map[string]interface{}
+}
+
+// Discover fetches the provider metadata for the configured issuer
+func Discover(ctx context.Context, config Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.DiscoveryURL == "" {
+		config.DiscoveryURL = strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+
+	var discovery Discovery
+	err := getJSON(ctx, client, config.DiscoveryURL, &discovery)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting OIDC discovery document: %w", err)
+	}
+	if discovery.Issuer != config.Issuer {
+		return nil, fmt.Errorf("%w: got %q", ErrIssuerMismatch, discovery.Issuer)
+	}
+
+	return &Provider{Config: config, Discovery: discovery, Client: client}, nil
+}
+
+// NewVerifier makes a random PKCE code verifier, also good for state and nonce values
+func NewVerifier() (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Challenge is the S256 PKCE code challenge for a verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL is where to send the user to sign in
+func (p *Provider) AuthCodeURL(state string, nonce string, verifier string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.Config.ClientID)
+	query.Set("redirect_uri", p.Config.RedirectURL)
+	query.Set("scope", strings.Join(p.Config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", Challenge(verifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.Discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return p.Discovery.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange trades an authorization code for an ID token and returns its verified claims
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string, nonce string) (Claims, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.Config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	if p.Config.ClientSecret == "" {
+		form.Set("client_id", p.Config.ClientID)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.Config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.Config.ClientID), url.QueryEscape(p.Config.ClientSecret))
+	}
+
+	response, err := p.Client.Do(request)
+	if err != nil {
+		return Claims{}, err
+	}
+	defer response.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&tokens)
+	if err != nil {
+		return Claims{}, fmt.Errorf("Error decoding OIDC token response: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return Claims{}, fmt.Errorf("OIDC token request failed with %d: %s %s", response.StatusCode, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return Claims{}, ErrNoIDToken
+	}
+
+	return p.Verify(ctx, tokens.IDToken, nonce)
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, target interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
@@ -0,0 +1,234 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// mockIdP is a minimal OpenID provider that supports the authorization code flow with PKCE
+type mockIdP struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+	secret   string
+	// pending authorization codes, with the challenge and nonce they were issued for
+	codes map[string]url.Values
+	// claims to put in the next ID token
+	claims map[string]interface{}
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, clientID: "pace", secret: "s3cret", codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("client_id") != idp.clientID || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+			http.Error(w, "bad authorization request", http.StatusBadRequest)
+			return
+		}
+		code := fmt.Sprintf("code-%d", len(idp.codes))
+		idp.codes[code] = query
+		redirect, _ := url.Parse(query.Get("redirect_uri"))
+		redirect.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != idp.clientID || secret != idp.secret {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		authorization, ok := idp.codes[r.PostFormValue("code")]
+		delete(idp.codes, r.PostFormValue("code"))
+		if !ok || Challenge(r.PostFormValue("code_verifier")) != authorization.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := map[string]interface{}{
+			"iss":   idp.server.URL,
+			"aud":   idp.clientID,
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": authorization.Get("nonce"),
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t, claims)})
+	})
+	idp.server = httptest.NewServer(mux)
+
+	return idp
+}
+
+func (idp *mockIdP) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// authorize follows the login redirect like a browser would and returns the code and state
+func authorize(t *testing.T, authURL string) (string, string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, err := response.Location()
+	if err != nil {
+		t.Fatalf("Expected a redirect from the IdP, got %d", response.StatusCode)
+	}
+
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.server.Close()
+	idp.claims = map[string]interface{}{
+		"sub":            "abc123",
+		"email":          "Jane@Example.com",
+		"email_verified": true,
+		"given_name":     "Jane",
+		"family_name":    "Doe",
+		"groups":         []string{"pace-admins", "staff"},
+	}
+	ctx := context.Background()
+
+	provider, err := Discover(ctx, Config{
+		Issuer:       idp.server.URL,
+		ClientID:     idp.clientID,
+		ClientSecret: idp.secret,
+		RedirectURL:  "https://pace.example.com/api/oidc/callback",
+	}, nil)
+	if err != nil {
+		t.Fatal("Error discovering mock IdP: ", err)
+	}
+
+	verifier, _ := NewVerifier()
+	code, state := authorize(t, provider.AuthCodeURL("state1", "nonce1", verifier))
+	if state != "state1" {
+		t.Error("State was not passed back: ", state)
+	}
+
+	claims, err := provider.Exchange(ctx, code, verifier, "nonce1")
+	if err != nil {
+		t.Fatal("Error exchanging code: ", err)
+	}
+	if claims.Subject != "abc123" || claims.Email != "jane@example.com" || !claims.EmailVerified || claims.FirstName != "Jane" {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+	if len(claims.Groups) != 2 || claims.Groups[0] != "pace-admins" {
+		t.Errorf("Unexpected groups: %v", claims.Groups)
+	}
+
+	// The IdP rejects a verifier that doesn't match the challenge
+	otherVerifier, _ := NewVerifier()
+	code, _ = authorize(t, provider.AuthCodeURL("state2", "nonce2", verifier))
+	_, err = provider.Exchange(ctx, code, otherVerifier, "nonce2")
+	if err == nil {
+		t.Error("Expected a wrong code verifier to fail")
+	}
+
+	// A token issued for another login's nonce is rejected
+	code, _ = authorize(t, provider.AuthCodeURL("state3", "nonce3", verifier))
+	_, err = provider.Exchange(ctx, code, verifier, "nonce1")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Error("Expected a wrong nonce to fail, got: ", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.server.Close()
+	ctx := context.Background()
+
+	provider, err := Discover(ctx, Config{Issuer: idp.server.URL, ClientID: idp.clientID}, nil)
+	if err != nil {
+		t.Fatal("Error discovering mock IdP: ", err)
+	}
+
+	valid := map[string]interface{}{
+		"iss":   idp.server.URL,
+		"aud":   []string{"other", idp.clientID},
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": "n",
+	}
+	_, err = provider.Verify(ctx, idp.sign(t, valid), "n")
+	if err != nil {
+		t.Error("Expected a valid token, got: ", err)
+	}
+
+	tests := map[string]map[string]interface{}{
+		"issuer":   {"iss": "https://evil.example.com"},
+		"audience": {"aud": "other"},
+		"expiry":   {"exp": time.Now().Add(-time.Hour).Unix()},
+	}
+	for name, override := range tests {
+		claims := map[string]interface{}{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		for k, v := range override {
+			claims[k] = v
+		}
+		_, err = provider.Verify(ctx, idp.sign(t, claims), "n")
+		if !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("Expected a bad %s to fail, got: %v", name, err)
+		}
+	}
+
+	token := idp.sign(t, valid)
+	_, err = provider.Verify(ctx, token[:len(token)-4]+"AAAA", "n")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Error("Expected a bad signature to fail, got: ", err)
+	}
+
+	_, err = Discover(ctx, Config{Issuer: "https://other.example.com", DiscoveryURL: idp.server.URL + "/.well-known/openid-configuration"}, nil)
+	if !errors.Is(err, ErrIssuerMismatch) {
+		t.Error("Expected an issuer mismatch, got: ", err)
+	}
+}
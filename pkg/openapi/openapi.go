@@ -0,0 +1,322 @@
+package openapi
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version of the OpenAPI spec the documents follow
+const Version = "3.0.3"
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]*PathItem  `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Components are the schemas and security schemes operations refer to
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is a way to authenticate
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// PathItem has the operations of a path, by lower case method
+type PathItem map[string]*Operation
+
+// Operation is a method on a path
+type Operation struct {
+	Summary     string                 `json:"summary,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	OperationID string                 `json:"operationId,omitempty"`
+	Deprecated  bool                   `json:"deprecated,omitempty"`
+	Parameters  []Parameter            `json:"parameters,omitempty"`
+	RequestBody *RequestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]*Response   `json:"responses"`
+	Security    *[]map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the JSON body of a request
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response is a response for a status code
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType has the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is a JSON schema, as far as OpenAPI 3.0 goes
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// Namer is a type that picks its own schema name, instead of its Go type name
+type Namer interface {
+	SchemaName() string
+}
+
+var namerType = reflect.TypeOf((*Namer)(nil)).Elem()
+
+// OneOf is a body that can be any of several types, like a list or a single item
+type OneOf []interface{}
+
+// New makes an empty Document
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      map[string]*PathItem{},
+		Components: Components{Schemas: map[string]*Schema{}},
+	}
+}
+
+// Add adds an operation for a method on a path
+func (d *Document) Add(method string, path string, operation *Operation) {
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = operation
+}
+
+// Body makes a JSON request body for the type of v
+func (d *Document) Body(v interface{}) *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content:  map[string]*MediaType{"application/json": {Schema: d.SchemaOf(v)}},
+	}
+}
+
+// JSON makes a JSON response for the type of v
+func (d *Document) JSON(description string, v interface{}) *Response {
+	return &Response{
+		Description: description,
+		Content:     map[string]*MediaType{"application/json": {Schema: d.SchemaOf(v)}},
+	}
+}
+
+// SchemaOf gets the schema for the type of v. Named structs are added to the
+// components and referred to, so each entity is only described once.
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	if oneOf, ok := v.(OneOf); ok {
+		schema := &Schema{}
+		for _, option := range oneOf {
+			schema.OneOf = append(schema.OneOf, d.SchemaOf(option))
+		}
+		return schema
+	}
+
+	return d.schema(reflect.TypeOf(v))
+}
+
+func (d *Document) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: d.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.object(t)
+		}
+		name := t.Name()
+		if t.Implements(namerType) {
+			name = reflect.Zero(t).Interface().(Namer).SchemaName()
+		}
+		if _, ok := d.Components.Schemas[name]; !ok {
+			// Added before the fields so types that refer to themselves end
+			d.Components.Schemas[name] = &Schema{}
+			*d.Components.Schemas[name] = *d.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	return &Schema{}
+}
+
+// object describes a struct's fields as they are in JSON
+func (d *Document) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	d.addFields(schema, t)
+	sort.Strings(schema.Required)
+
+	return schema
+}
+
+func (d *Document) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			// Like encoding/json, embedded struct fields are promoted even if the struct isn't exported
+			d.addFields(schema, field.Type)
+			continue
+		}
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldSchema := d.schema(field.Type)
+		if applyRules(fieldSchema, field.Tag.Get("validate")) {
+			schema.Required = appendOnce(schema.Required, name)
+		}
+		schema.Properties[name] = fieldSchema
+	}
+}
+
+// applyRules describes the validate tag rules of a field, returning whether it is required
+func applyRules(schema *Schema, tag string) bool {
+	if tag == "" || schema.Ref != "" {
+		return false
+	}
+
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		name, param := rule, ""
+		if index := strings.Index(rule, "="); index >= 0 {
+			name, param = rule[:index], rule[index+1:]
+		}
+		switch name {
+		case "required":
+			required = true
+			if schema.Type == "string" {
+				schema.MinLength = intPointer(1)
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			setLimit(schema, name == "min", limit)
+		case "oneof":
+			schema.Enum = strings.Fields(param)
+		case "email":
+			schema.Format = "email"
+		case "datetime":
+			schema.Format = "date-time"
+		case "date":
+			schema.Description = "A date like 2006-01-02 or an RFC 3339 time"
+		case "after":
+			schema.Description = "A date like 2006-01-02 or an RFC 3339 time, not before " + param
+		case "state":
+			schema.Pattern = "^[A-Z]{2}$"
+		case "zip":
+			schema.Pattern = `^[0-9]{5}(-[0-9]{4})?$`
+		case "phone":
+			schema.Pattern = `^\+?[0-9 ().-]{7,20}$`
+		}
+	}
+
+	return required
+}
+
+func setLimit(schema *Schema, min bool, limit float64) {
+	switch schema.Type {
+	case "string":
+		if min {
+			schema.MinLength = intPointer(int(limit))
+		} else {
+			schema.MaxLength = intPointer(int(limit))
+		}
+	case "array":
+		if min {
+			schema.MinItems = intPointer(int(limit))
+		} else {
+			schema.MaxItems = intPointer(int(limit))
+		}
+	default:
+		if min {
+			schema.Minimum = &limit
+		} else {
+			schema.Maximum = &limit
+		}
+	}
+}
+
+func intPointer(i int) *int {
+	return &i
+}
+
+func appendOnce(list []string, value string) []string {
+	for _, existing := range list {
+		if existing == value {
+			return list
+		}
+	}
+
+	return append(list, value)
+}
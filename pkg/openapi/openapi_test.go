@@ -0,0 +1,59 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+type part struct {
+	ID      string   `json:"ID"`
+	Name    string   `json:"name" validate:"required,max=20"`
+	Secret  string   `json:"-"`
+	Grade   int32    `json:"grade" validate:"min=0"`
+	Stage   string   `json:"stage" validate:"oneof=raw finished"`
+	Email   string   `json:"email" validate:"email"`
+	Related []part   `json:"related"`
+	Tags    []string `json:"tags" validate:"max=5"`
+}
+
+type namedPart struct {
+	part
+	Extra bool `json:"extra"`
+}
+
+func (namedPart) SchemaName() string {
+	return "Part"
+}
+
+func TestSchemaOf(t *testing.T) {
+	document := New(Info{Title: "Test", Version: "1"})
+	schema := document.SchemaOf([]part{})
+	if schema.Type != "array" || schema.Items.Ref != "#/components/schemas/part" {
+		t.Fatalf("Unexpected list schema %+v", schema)
+	}
+
+	component := document.Components.Schemas["part"]
+	if _, ok := component.Properties["Secret"]; ok {
+		t.Error("Expected fields hidden from JSON to be left out")
+	}
+	if !reflect.DeepEqual(component.Required, []string{"name"}) || *component.Properties["name"].MaxLength != 20 {
+		t.Errorf("Unexpected name rules %+v %+v", component.Required, component.Properties["name"])
+	}
+	if *component.Properties["grade"].Minimum != 0 || component.Properties["grade"].Format != "int32" {
+		t.Errorf("Unexpected grade schema %+v", component.Properties["grade"])
+	}
+	if !reflect.DeepEqual(component.Properties["stage"].Enum, []string{"raw", "finished"}) || component.Properties["email"].Format != "email" {
+		t.Errorf("Unexpected stage or email schema %+v %+v", component.Properties["stage"], component.Properties["email"])
+	}
+	if component.Properties["related"].Items.Ref != "#/components/schemas/part" || *component.Properties["tags"].MaxItems != 5 {
+		t.Errorf("Unexpected list properties %+v %+v", component.Properties["related"], component.Properties["tags"])
+	}
+
+	schema = document.SchemaOf(OneOf{namedPart{}, ""})
+	if len(schema.OneOf) != 2 || schema.OneOf[0].Ref != "#/components/schemas/Part" || schema.OneOf[1].Type != "string" {
+		t.Fatalf("Unexpected one of schema %+v", schema)
+	}
+	if _, ok := document.Components.Schemas["Part"].Properties["ID"]; !ok {
+		t.Error("Expected embedded fields to be flattened")
+	}
+}
@@ -3,6 +3,7 @@ package paceconfig
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -12,6 +13,119 @@ type Config struct {
 	DocumentDBUrl  string
 	FirebaseConfig string
 	RollbarToken   string
+	// TokenSecret signs access tokens. Login is disabled until it is set.
+	TokenSecret     string
+	TokenTTL        time.Duration
+	RefreshTokenTTL time.Duration
+	// Failed logins before a username or client IP gets locked out, and
+	// the first lockout, which doubles with each further failure.
+	LoginLockoutThreshold   int
+	LoginIPLockoutThreshold int
+	LoginLockoutDelay       time.Duration
+	LoginLockoutMaxDelay    time.Duration
+	// TrustedProxies are the IPs or CIDRs allowed to set X-Forwarded-For
+	TrustedProxies []string
+	// Single sign-on with an OpenID Connect provider, off unless OIDCIssuer is set.
+	// OIDCDiscoveryURL defaults to the issuer's well-known configuration.
+	OIDCIssuer       string
+	OIDCDiscoveryURL string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
+	OIDCGroupsClaim  string
+	// OIDCRoleMappings give users a role from their IdP groups, the first match wins.
+	// Users in none of the groups get OIDCDefaultRole.
+	OIDCRoleMappings []OIDCRoleMapping
+	OIDCDefaultRole  string
+	// RateLimits are per client, by the route group after /api/ (like "inventory").
+	// The "default" group covers every group without its own limit.
+	RateLimits []RateLimit
+	// IPRateLimits are per client IP, checked before authentication so failed
+	// logins and bad keys count. Offices share an IP, so keep them above RateLimits.
+	IPRateLimits []RateLimit
+	// DeprecatedAPIVersions send Deprecation and Sunset headers, and their use is logged
+	DeprecatedAPIVersions []DeprecatedAPIVersion
+	// GraphQL queries deeper or more costly than these are rejected. Each field costs
+	// 1, times the expected size of the lists it is in.
+	GraphQLMaxDepth int
+	GraphQLMaxCost  int
+	// ConflictPolicies settle fields changed both on the server and in an
+	// uploaded offline edit. The first match wins, unmatched fields are "manual".
+	ConflictPolicies []ConflictPolicy
+	// IdempotencyKeyTTL is how long responses to requests with an Idempotency-Key are kept
+	IdempotencyKeyTTL time.Duration
+	// GRPCAddress is where the gRPC services listen, like ":8002". Off when empty.
+	GRPCAddress string
+	// CORSAllowedOrigins can call the API from a browser, like "https://dashboard.pace.example.com",
+	// or "*" for any site. CORS is off when empty. Methods and headers have defaults.
+	CORSAllowedOrigins []string
+	CORSAllowedMethods []string
+	CORSAllowedHeaders []string
+	// CORSMaxAge is how long browsers can cache a preflight
+	CORSMaxAge time.Duration
+	// MaxBodySize is the largest request body in bytes, 1 MiB by default
+	MaxBodySize int64
+	// ListenAddress is where the HTTP server listens, ":8001" by default. It
+	// serves HTTPS when TLSCertFile and TLSKeyFile are set.
+	ListenAddress string
+	TLSCertFile   string
+	TLSKeyFile    string
+	// Server timeouts, with defaults when they're zero. ShutdownTimeout is how
+	// long in-flight requests get to finish on SIGTERM.
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	// HealthCheckTimeout bounds each readiness check, and their results are
+	// reused for HealthCheckCacheTTL
+	HealthCheckTimeout  time.Duration
+	HealthCheckCacheTTL time.Duration
+	// /metrics is open to MetricsAllowedIPs (IPs or CIDRs) and to MetricsToken,
+	// sent as a bearer token. Either one lets a scraper in. Without either, only
+	// loopback clients get it.
+	MetricsAllowedIPs []string
+	MetricsToken      string
+}
+
+// Conflict policies
+const (
+	// ConflictManual sends the conflict back for the user to resolve
+	ConflictManual     = "manual"
+	ConflictServerWins = "serverWins"
+	ConflictClientWins = "clientWins"
+	// ConflictLastWriterWins keeps whichever edit was made last
+	ConflictLastWriterWins = "lastWriterWins"
+)
+
+// ConflictPolicy is the policy for a Field of a Collection. Leave either empty
+// to match them all, an empty Field also covers deletes.
+type ConflictPolicy struct {
+	Collection string
+	Field      string
+	Policy     string
+}
+
+// OIDCRoleMapping maps an IdP group to a user role
+type OIDCRoleMapping struct {
+	Group string
+	Role  string
+}
+
+// RateLimit lets each client make Requests every Per, with bursts of up to Burst
+// (Requests by default)
+type RateLimit struct {
+	Group    string
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// DeprecatedAPIVersion is an API version, like "v1", that will be removed on
+// the Sunset date (2006-01-02)
+type DeprecatedAPIVersion struct {
+	Version string
+	Sunset  string
 }
 
 // GetConf gets a config file from local disk
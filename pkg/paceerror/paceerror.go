@@ -0,0 +1,160 @@
+package paceerror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Code is a machine readable error code, sent to clients along with the message
+type Code string
+
+// Error codes and the HTTP status they are sent with
+const (
+	CodeBadRequest      Code = "bad_request"
+	CodeUnauthorized    Code = "unauthorized"
+	CodeForbidden       Code = "forbidden"
+	CodeNotFound        Code = "not_found"
+	CodeConflict        Code = "conflict"
+	CodeValidation      Code = "validation_failed"
+	CodeTooLarge        Code = "too_large"
+	CodeTooManyRequests Code = "too_many_requests"
+	CodeInternal        Code = "internal"
+)
+
+var statuses = map[Code]int{
+	CodeBadRequest:      http.StatusBadRequest,
+	CodeUnauthorized:    http.StatusUnauthorized,
+	CodeForbidden:       http.StatusForbidden,
+	CodeNotFound:        http.StatusNotFound,
+	CodeConflict:        http.StatusConflict,
+	CodeValidation:      http.StatusUnprocessableEntity,
+	CodeTooLarge:        http.StatusRequestEntityTooLarge,
+	CodeTooManyRequests: http.StatusTooManyRequests,
+	CodeInternal:        http.StatusInternalServerError,
+}
+
+// Error is an error with a code. Providers return them so handlers know which status to send.
+type Error struct {
+	Code    Code
+	Message string
+	// Details are sent to the client as is, like the fields that failed validation
+	Details interface{}
+	// Err is the underlying error, it is logged but not sent to the client
+	Err error
+}
+
+// New makes an Error
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// NotFound makes a CodeNotFound Error
+func NotFound(format string, args ...interface{}) *Error {
+	return New(CodeNotFound, fmt.Sprintf(format, args...))
+}
+
+// Conflict makes a CodeConflict Error, for things like duplicate names
+func Conflict(format string, args ...interface{}) *Error {
+	return New(CodeConflict, fmt.Sprintf(format, args...))
+}
+
+// BadRequest makes a CodeBadRequest Error for a request that couldn't be read
+func BadRequest(err error) *Error {
+	return &Error{Code: CodeBadRequest, Message: err.Error(), Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Message, e.Err)
+	}
+
+	return e.Message
+}
+
+// Unwrap gets the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// CodeOf gets the code of the first Error in err's chain, CodeInternal if there isn't one
+func CodeOf(err error) Code {
+	var pErr *Error
+	if errors.As(err, &pErr) {
+		return pErr.Code
+	}
+
+	return CodeInternal
+}
+
+// Status gets the HTTP status for a code
+func Status(code Code) int {
+	status, ok := statuses[code]
+	if !ok {
+		return http.StatusInternalServerError
+	}
+
+	return status
+}
+
+// CodeForStatus gets the code for an HTTP error status
+func CodeForStatus(status int) Code {
+	for code, codeStatus := range statuses {
+		if codeStatus == status {
+			return code
+		}
+	}
+	if status < http.StatusInternalServerError {
+		return CodeBadRequest
+	}
+
+	return CodeInternal
+}
+
+// Body is the JSON body of every error response
+type Body struct {
+	Error Response `json:"error"`
+}
+
+// SchemaName names Body in the OpenAPI document
+func (Body) SchemaName() string {
+	return "ErrorBody"
+}
+
+// Response is the error sent to the client
+type Response struct {
+	Code      Code        `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"requestID,omitempty"`
+}
+
+// SchemaName names Response in the OpenAPI document
+func (Response) SchemaName() string {
+	return "Error"
+}
+
+// NewBody makes the response body for an error. Internal errors only get a
+// generic message, their details are in the logs under the request ID.
+func NewBody(status int, v interface{}, requestID string) Body {
+	response := Response{Code: CodeForStatus(status), RequestID: requestID}
+	switch v := v.(type) {
+	case error:
+		var pErr *Error
+		if errors.As(v, &pErr) {
+			response.Code = pErr.Code
+			response.Message = pErr.Message
+			response.Details = pErr.Details
+		} else {
+			response.Message = v.Error()
+		}
+	case string:
+		response.Message = v
+	}
+	if response.Code == CodeInternal {
+		response.Message = "Internal server error"
+		response.Details = nil
+	}
+
+	return Body{Error: response}
+}
@@ -0,0 +1,47 @@
+package paceerror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+var errThingNotFound = NotFound("Thing not found")
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{errThingNotFound, http.StatusNotFound},
+		{fmt.Errorf("Error getting things with ID 1: %w", errThingNotFound), http.StatusNotFound},
+		{Conflict("Thing %s already exists", "one"), http.StatusConflict},
+		{BadRequest(errors.New("unexpected EOF")), http.StatusBadRequest},
+		{New(CodeValidation, "Thing is invalid"), http.StatusUnprocessableEntity},
+		{errors.New("connection reset"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		if status := Status(CodeOf(test.err)); status != test.expected {
+			t.Errorf("Status of %q = %d, expected %d", test.err, status, test.expected)
+		}
+	}
+}
+
+func TestNewBody(t *testing.T) {
+	body := NewBody(http.StatusNotFound, fmt.Errorf("Error getting things with ID 1: %w", errThingNotFound), "req-1")
+	if body.Error.Code != CodeNotFound || body.Error.Message != "Thing not found" || body.Error.RequestID != "req-1" {
+		t.Errorf("Unexpected not found body %+v", body.Error)
+	}
+
+	body = NewBody(http.StatusForbidden, "Not allowed", "req-2")
+	if body.Error.Code != CodeForbidden || body.Error.Message != "Not allowed" {
+		t.Errorf("Unexpected forbidden body %+v", body.Error)
+	}
+
+	// Internal errors don't leak their message
+	body = NewBody(http.StatusInternalServerError, errors.New("dial tcp 10.0.0.1:443: connection refused"), "req-3")
+	if body.Error.Code != CodeInternal || body.Error.Message != "Internal server error" {
+		t.Errorf("Unexpected internal body %+v", body.Error)
+	}
+}
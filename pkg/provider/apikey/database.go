@@ -0,0 +1,114 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+	helper "github.com/coma-toast/pace-api/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/rollbar/rollbar-go"
+)
+
+// KeyPrefix starts every API key so they are easy to spot in logs and config
+const KeyPrefix = "pace_"
+
+// DatabaseProvider is a apikey.Provider the uses a database
+type DatabaseProvider struct {
+	SharedProvider *firestoredb.DatabaseProvider
+	UsageProvider  *firestoredb.DatabaseProvider
+}
+
+// ErrAPIKeyNotFound if no API keys are found
+var ErrAPIKeyNotFound = paceerror.NotFound("API key not found")
+
+// GetAll gets all API keys, including revoked ones
+func (d *DatabaseProvider) GetAll() ([]entity.APIKey, error) {
+	var apiKeys []entity.APIKey
+	err := d.SharedProvider.GetAll(&apiKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return apiKeys, nil
+}
+
+// GetByID gets an API key by ID
+func (d *DatabaseProvider) GetByID(ID string) (entity.APIKey, error) {
+	var apiKey entity.APIKey
+	err := d.SharedProvider.GetByID(ID, &apiKey)
+	if err != nil {
+		return entity.APIKey{}, firestoredb.WrapNotFound(err, ErrAPIKeyNotFound)
+	}
+
+	return apiKey, nil
+}
+
+// Add creates an API key and returns it along with the plain key
+func (d *DatabaseProvider) Add(newAPIKeyData entity.APIKey) (entity.APIKey, string, error) {
+	rollbar.Info(fmt.Sprintf("Adding new API key %s for %s", newAPIKeyData.Name, newAPIKeyData.CreatedBy))
+
+	secretBytes := make([]byte, 32)
+	_, err := rand.Read(secretBytes)
+	if err != nil {
+		return entity.APIKey{}, "", fmt.Errorf("Error generating API key: %w", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	newUUID := uuid.New().String()
+	newAPIKeyData = entity.APIKey{
+		ID:        newUUID,
+		Created:   time.Now().Format(time.RFC3339),
+		CreatedBy: newAPIKeyData.CreatedBy,
+		Name:      newAPIKeyData.Name,
+		Hash:      helper.Hash(secret, newUUID),
+		Scopes:    newAPIKeyData.Scopes,
+		Expires:   newAPIKeyData.Expires,
+
+		DailyQuota: newAPIKeyData.DailyQuota,
+	}
+	err = d.SharedProvider.Set(newAPIKeyData.ID, newAPIKeyData)
+	if err != nil {
+		return entity.APIKey{}, "", fmt.Errorf("Error setting API key %s by ID: %s", newAPIKeyData.Name, err)
+	}
+
+	newAPIKey, err := d.GetByID(newAPIKeyData.ID)
+	if err != nil {
+		return entity.APIKey{}, "", fmt.Errorf("Error getting newly created API key %s by ID: %s", newAPIKeyData.Name, err)
+	}
+
+	rollbar.Info(fmt.Sprintf("API key %s added.", newAPIKeyData.ID))
+	return newAPIKey, fmt.Sprintf("%s%s.%s", KeyPrefix, newAPIKeyData.ID, secret), nil
+}
+
+// Touch records that an API key was just used. Only LastUsed is written, so
+// it can't undo a revoke made at the same time.
+func (d *DatabaseProvider) Touch(ID string) error {
+	return d.SharedProvider.SetFields(ID, map[string]interface{}{"LastUsed": time.Now().Format(time.RFC3339)})
+}
+
+// Revoke disables an API key. The record is kept so it still shows up in the key list.
+func (d *DatabaseProvider) Revoke(ID string) error {
+	apiKey, err := d.GetByID(ID)
+	if err != nil {
+		return err
+	}
+	err = d.SharedProvider.SetFields(apiKey.ID, map[string]interface{}{"Revoked": true})
+	if err != nil {
+		return err
+	}
+	rollbar.Info(fmt.Sprintf("Revoked API key %s: %s", apiKey.ID, apiKey.Name))
+
+	return nil
+}
+
+// CountUse records a request made with an API key and returns how many it has
+// made that day. The count is sharded, so a busy key doesn't queue its requests
+// on one record.
+func (d *DatabaseProvider) CountUse(ID string, day string) (int64, error) {
+	return d.UsageProvider.IncrementSharded(fmt.Sprintf("%s-%s", ID, day), "Count")
+}
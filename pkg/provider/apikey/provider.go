@@ -0,0 +1,13 @@
+package apikey
+
+import "github.com/coma-toast/pace-api/pkg/entity"
+
+// Provider is for working with API key data
+type Provider interface {
+	GetAll() ([]entity.APIKey, error)
+	GetByID(ID string) (entity.APIKey, error)
+	Add(entity.APIKey) (entity.APIKey, string, error)
+	Touch(ID string) error
+	Revoke(ID string) error
+	CountUse(ID string, day string) (int64, error)
+}
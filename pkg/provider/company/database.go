@@ -1,11 +1,12 @@
 package company
 
 import (
-	"errors"
 	"fmt"
 	"time"
 
 	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/events"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
 	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
 	"github.com/google/uuid"
 	"github.com/rollbar/rollbar-go"
@@ -14,10 +15,26 @@ import (
 // DatabaseProvider is a company.Provider the uses a database
 type DatabaseProvider struct {
 	SharedProvider *firestoredb.DatabaseProvider
+	Events         events.Publisher
 }
 
 // ErrCompanyNotFound if no companies are found
-var ErrCompanyNotFound = errors.New("Company not found")
+var ErrCompanyNotFound = paceerror.NotFound("Company not found")
+
+// GetChanges gets up to limit changes to companies after the cursor since, for sync
+func (d *DatabaseProvider) GetChanges(since firestoredb.SyncCursor, limit int) ([]entity.Change, error) {
+	return d.SharedProvider.GetChanges(since, limit)
+}
+
+// GetChange gets the latest change to a Company
+func (d *DatabaseProvider) GetChange(ID string) (entity.Change, error) {
+	return d.SharedProvider.GetChange(ID)
+}
+
+// GetLastChange gets the latest change to any of the companies
+func (d *DatabaseProvider) GetLastChange() (entity.Change, error) {
+	return d.SharedProvider.GetLastChange()
+}
 
 // GetAll gets a Company by ID
 func (d *DatabaseProvider) GetAll() ([]entity.Company, error) {
@@ -31,6 +48,17 @@ func (d *DatabaseProvider) GetAll() ([]entity.Company, error) {
 	return allCompanyData, nil
 }
 
+// GetByID gets a Company by ID
+func (d *DatabaseProvider) GetByID(ID string) (entity.Company, error) {
+	var company entity.Company
+	err := d.SharedProvider.GetByID(ID, &company)
+	if err != nil {
+		return entity.Company{}, firestoredb.WrapNotFound(err, ErrCompanyNotFound)
+	}
+
+	return company, nil
+}
+
 // GetByName gets a Company by name
 func (d *DatabaseProvider) GetByName(companyName string) (entity.Company, error) {
 	var company entity.Company
@@ -42,6 +70,17 @@ func (d *DatabaseProvider) GetByName(companyName string) (entity.Company, error)
 	return company, nil
 }
 
+// GetByIDs gets the Companys with the given IDs. IDs that aren't found are skipped.
+func (d *DatabaseProvider) GetByIDs(IDs []string) ([]entity.Company, error) {
+	var companies []entity.Company
+	err := d.SharedProvider.GetByIDs(IDs, &companies)
+	if err != nil {
+		return nil, err
+	}
+
+	return companies, nil
+}
+
 // Add is to update a Company record
 func (d *DatabaseProvider) Add(newCompanyData entity.Company) (entity.Company, error) {
 	rollbar.Info(fmt.Sprintf("Adding new Company to DB %s", newCompanyData.Name))
@@ -49,7 +88,7 @@ func (d *DatabaseProvider) Add(newCompanyData entity.Company) (entity.Company, e
 	var existingCompany entity.Company
 	err := d.SharedProvider.GetFirstBy("Name", "==", newCompanyData.Name, &existingCompany)
 	if (entity.Company{}) != existingCompany {
-		return entity.Company{}, fmt.Errorf("Error adding Company %s: Companyname already exists. ID: %s", newCompanyData.Name, existingCompany.ID)
+		return entity.Company{}, paceerror.Conflict("Company %s already exists", newCompanyData.Name)
 	}
 
 	newUUID := uuid.New().String()
@@ -77,6 +116,7 @@ func (d *DatabaseProvider) Add(newCompanyData entity.Company) (entity.Company, e
 	}
 
 	rollbar.Info(fmt.Sprintf("Company %s added.", newCompanyData.Name))
+	events.Publish(d.Events, "company.created", newCompany)
 	return newCompany, nil
 }
 
@@ -85,7 +125,7 @@ func (d *DatabaseProvider) Update(newCompanyData entity.Company) (entity.Company
 	var currentCompanyData = entity.Company{}
 	err := d.SharedProvider.GetByID(newCompanyData.ID, &currentCompanyData)
 	if err != nil {
-		return entity.Company{}, err
+		return entity.Company{}, firestoredb.WrapNotFound(err, ErrCompanyNotFound)
 	}
 	rollbar.Info(fmt.Sprintf("Updating CompanyID %s. \nOld Data: %v \nNew Data: %v", currentCompanyData.ID, currentCompanyData, newCompanyData))
 	updatedCompany := entity.Company{
@@ -112,6 +152,7 @@ func (d *DatabaseProvider) Update(newCompanyData entity.Company) (entity.Company
 		return entity.Company{}, err
 	}
 
+	events.Publish(d.Events, "company.updated", updatedCompanyData)
 	return updatedCompanyData, nil
 }
 
@@ -121,7 +162,7 @@ func (d *DatabaseProvider) Delete(company entity.Company) error {
 
 	err := d.SharedProvider.GetByID(company.ID, &currentCompany)
 	if (entity.Company{}) == currentCompany {
-		return fmt.Errorf("Company not found")
+		return ErrCompanyNotFound
 	}
 
 	err = d.SharedProvider.Delete(company.ID)
@@ -129,6 +170,7 @@ func (d *DatabaseProvider) Delete(company entity.Company) error {
 		return err
 	}
 	rollbar.Info(fmt.Sprintf("Deleted Company %s: %s", company.ID, company.Name))
+	events.Publish(d.Events, "company.deleted", currentCompany)
 
 	return nil
 }
@@ -1,11 +1,19 @@
 package company
 
-import "github.com/coma-toast/pace-api/pkg/entity"
+import (
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+)
 
 // Provider is for working with company data
 type Provider interface {
+	GetByID(ID string) (entity.Company, error)
+	GetByIDs(IDs []string) ([]entity.Company, error)
 	GetByName(companyname string) (entity.Company, error)
 	GetAll() ([]entity.Company, error)
+	GetChange(ID string) (entity.Change, error)
+	GetChanges(since firestoredb.SyncCursor, limit int) ([]entity.Change, error)
+	GetLastChange() (entity.Change, error)
 	Add(entity.Company) (entity.Company, error)
 	Update(entity.Company) (entity.Company, error)
 	Delete(companyname entity.Company) error
@@ -1,11 +1,12 @@
 package contact
 
 import (
-	"errors"
 	"fmt"
 	"time"
 
 	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/events"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
 	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
 	"github.com/google/uuid"
 	"github.com/rollbar/rollbar-go"
@@ -14,10 +15,26 @@ import (
 // DatabaseProvider is a contact.Provider the uses a database
 type DatabaseProvider struct {
 	SharedProvider *firestoredb.DatabaseProvider
+	Events         events.Publisher
 }
 
 // ErrContactNotFound if no Contacts are found
-var ErrContactNotFound = errors.New("Contact not found")
+var ErrContactNotFound = paceerror.NotFound("Contact not found")
+
+// GetChanges gets up to limit changes to contacts after the cursor since, for sync
+func (d *DatabaseProvider) GetChanges(since firestoredb.SyncCursor, limit int) ([]entity.Change, error) {
+	return d.SharedProvider.GetChanges(since, limit)
+}
+
+// GetChange gets the latest change to a Contact
+func (d *DatabaseProvider) GetChange(ID string) (entity.Change, error) {
+	return d.SharedProvider.GetChange(ID)
+}
+
+// GetLastChange gets the latest change to any of the contacts
+func (d *DatabaseProvider) GetLastChange() (entity.Change, error) {
+	return d.SharedProvider.GetLastChange()
+}
 
 // GetAll gets a Contact by ID
 func (d *DatabaseProvider) GetAll() ([]entity.Contact, error) {
@@ -31,6 +48,17 @@ func (d *DatabaseProvider) GetAll() ([]entity.Contact, error) {
 	return allContactData, nil
 }
 
+// GetByID gets a Contact by ID
+func (d *DatabaseProvider) GetByID(ID string) (entity.Contact, error) {
+	var contact entity.Contact
+	err := d.SharedProvider.GetByID(ID, &contact)
+	if err != nil {
+		return entity.Contact{}, firestoredb.WrapNotFound(err, ErrContactNotFound)
+	}
+
+	return contact, nil
+}
+
 // // GetByName gets a Contact by name
 // func (d *DatabaseProvider) GetByName(contactName string) (entity.Contact, error) {
 // 	var contact entity.Contact
@@ -42,6 +70,17 @@ func (d *DatabaseProvider) GetAll() ([]entity.Contact, error) {
 // 	return contact, nil
 // }
 
+// GetByIDs gets the Contacts with the given IDs. IDs that aren't found are skipped.
+func (d *DatabaseProvider) GetByIDs(IDs []string) ([]entity.Contact, error) {
+	var contacts []entity.Contact
+	err := d.SharedProvider.GetByIDs(IDs, &contacts)
+	if err != nil {
+		return nil, err
+	}
+
+	return contacts, nil
+}
+
 // Add is to update a Contact record
 func (d *DatabaseProvider) Add(newContactData entity.Contact) (entity.Contact, error) {
 	rollbar.Info(fmt.Sprintf("Adding new Contact to DB %s %s", newContactData.FirstName, newContactData.LastName))
@@ -77,6 +116,7 @@ func (d *DatabaseProvider) Add(newContactData entity.Contact) (entity.Contact, e
 
 	rollbar.Info(fmt.Sprintf("Contact %s %s added.", newContactData.FirstName, newContactData.LastName))
 
+	events.Publish(d.Events, "contact.created", newContact)
 	return newContact, nil
 }
 
@@ -85,7 +125,7 @@ func (d *DatabaseProvider) Update(newContactData entity.Contact) (entity.Contact
 	var currentContactData = entity.Contact{}
 	err := d.SharedProvider.GetByID(newContactData.ID, &currentContactData)
 	if err != nil {
-		return entity.Contact{}, err
+		return entity.Contact{}, firestoredb.WrapNotFound(err, ErrContactNotFound)
 	}
 	rollbar.Info(fmt.Sprintf("Updating ContactID %s. \nOld Data: %v \nNew Data: %v", currentContactData.ID, currentContactData, newContactData))
 	updatedContact := entity.Contact{
@@ -113,6 +153,7 @@ func (d *DatabaseProvider) Update(newContactData entity.Contact) (entity.Contact
 		return entity.Contact{}, err
 	}
 
+	events.Publish(d.Events, "contact.updated", updatedContactData)
 	return updatedContactData, nil
 }
 
@@ -123,7 +164,7 @@ func (d *DatabaseProvider) Delete(contact entity.Contact) error {
 
 	err := d.SharedProvider.GetByID(contact.ID, &currentContact)
 	if (entity.Contact{}) == currentContact {
-		return fmt.Errorf("Contact not found")
+		return ErrContactNotFound
 	}
 
 	err = d.SharedProvider.Delete(contact.ID)
@@ -131,6 +172,7 @@ func (d *DatabaseProvider) Delete(contact entity.Contact) error {
 		return err
 	}
 	rollbar.Info(fmt.Sprintf("Deleted Contact %s %s: %s", contact.FirstName, contact.LastName, contact.ID))
+	events.Publish(d.Events, "contact.deleted", currentContact)
 
 	return nil
 }
@@ -1,11 +1,19 @@
 package contact
 
-import "github.com/coma-toast/pace-api/pkg/entity"
+import (
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+)
 
 // Provider is for working with contact data
 type Provider interface {
 	// GetBy(contactname string) (entity.Contact, error)
+	GetByID(ID string) (entity.Contact, error)
+	GetByIDs(IDs []string) ([]entity.Contact, error)
 	GetAll() ([]entity.Contact, error)
+	GetChange(ID string) (entity.Change, error)
+	GetChanges(since firestoredb.SyncCursor, limit int) ([]entity.Change, error)
+	GetLastChange() (entity.Change, error)
 	Add(entity.Contact) (entity.Contact, error)
 	Update(entity.Contact) (entity.Contact, error)
 	Delete(contactname entity.Contact) error
@@ -5,22 +5,54 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math/rand"
+	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/search"
 	"github.com/mitchellh/mapstructure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // DatabaseProvider is a firestore.Provider the uses a database
 type DatabaseProvider struct {
 	Database   *firestore.Client
 	Collection string
+	// TrackChanges records every write and delete in the <Collection>Changes
+	// collection, so clients can sync what changed
+	TrackChanges bool
+	// Search is kept up to date with the records written, if set
+	Search *search.Index
 }
 
+// sequenceCollection has the last change sequence number of each shard of each collection
+const sequenceCollection = "syncSequences"
+
 // ErrFirestoreNotFound if no Firestores are found
-var ErrFirestoreNotFound = errors.New("Firestore Item not found")
+var ErrFirestoreNotFound = paceerror.NotFound("Firestore Item not found")
+
+// ErrFirestoreExists if a record being created already exists
+var ErrFirestoreExists = paceerror.Conflict("Firestore Item already exists")
+
+// ErrRevisionChanged if a record changed since the revision it was read at
+var ErrRevisionChanged = paceerror.Conflict("Firestore Item changed since it was read")
+
+// WrapNotFound returns notFound, the provider's own not found error, if err is
+// because a record wasn't found. Other errors are returned as they are.
+func WrapNotFound(err error, notFound error) error {
+	if errors.Is(err, ErrFirestoreNotFound) {
+		return fmt.Errorf("%s: %w", err, notFound)
+	}
+
+	return err
+}
 
 // GetAll gets all items in a Firestore collection
-func (d *DatabaseProvider) GetAll(target interface{}) error {
+func (d *DatabaseProvider) GetAll(target interface{}) (err error) {
+	defer d.observe("getAll", time.Now(), &err)
 	returnData := make([]interface{}, 0)
 	allFirestoreData, err := d.Database.Collection(d.Collection).Documents(context.TODO()).GetAll()
 	// test, err := d.Database.Collection(d.Collection).Documents(context.TODO()).GetAll()
@@ -47,8 +79,12 @@ func (d *DatabaseProvider) GetAll(target interface{}) error {
 }
 
 // GetByID gets an item by ID
-func (d *DatabaseProvider) GetByID(ID string, target interface{}) error {
+func (d *DatabaseProvider) GetByID(ID string, target interface{}) (err error) {
+	defer d.observe("getByID", time.Now(), &err)
 	firestoreData, err := d.Database.Collection(d.Collection).Doc(ID).Get(context.TODO())
+	if status.Code(err) == codes.NotFound {
+		return fmt.Errorf("Error getting %s with ID %s: %w", d.Collection, ID, ErrFirestoreNotFound)
+	}
 	if err != nil {
 		return fmt.Errorf("Error getting %s with ID %s: %w", d.Collection, ID, err)
 	}
@@ -63,7 +99,8 @@ func (d *DatabaseProvider) GetByID(ID string, target interface{}) error {
 }
 
 // GetFirstBy gets the first returned item by a path, operator and value
-func (d *DatabaseProvider) GetFirstBy(path string, op string, value string, target interface{}) error {
+func (d *DatabaseProvider) GetFirstBy(path string, op string, value string, target interface{}) (err error) {
+	defer d.observe("getFirstBy", time.Now(), &err)
 	allFirestoreData, err := d.Database.Collection(d.Collection).Where(path, op, value).Documents(context.TODO()).GetAll()
 	log.Println(allFirestoreData)
 	if err != nil {
@@ -79,29 +116,378 @@ func (d *DatabaseProvider) GetFirstBy(path string, op string, value string, targ
 		return nil
 	}
 
-	return fmt.Errorf("%s not found: %s", path, value)
+	return fmt.Errorf("%s %s: %w", path, value, ErrFirestoreNotFound)
+}
+
+// GetAllBy gets all items matching a path, operator and value
+func (d *DatabaseProvider) GetAllBy(path string, op string, value string, target interface{}) (err error) {
+	defer d.observe("getAllBy", time.Now(), &err)
+	returnData := make([]interface{}, 0)
+	allFirestoreData, err := d.Database.Collection(d.Collection).Where(path, op, value).Documents(context.TODO()).GetAll()
+	if err != nil {
+		return fmt.Errorf("Error getting collection: %w", err)
+	}
+	for _, firestoreData := range allFirestoreData {
+		data := make(map[string]interface{})
+		err := firestoreData.DataTo(&data)
+		if err != nil {
+			return fmt.Errorf("ERROR: GetAllBy(): Firestore.DataTo() error %w", err)
+		}
+		returnData = append(returnData, data)
+	}
+
+	mapstructure.Decode(returnData, target)
+
+	return nil
+}
+
+// GetByIDs gets the items with the given IDs in one call. IDs that aren't found are skipped.
+func (d *DatabaseProvider) GetByIDs(IDs []string, target interface{}) (err error) {
+	defer d.observe("getByIDs", time.Now(), &err)
+	returnData := make([]interface{}, 0)
+	if len(IDs) == 0 {
+		mapstructure.Decode(returnData, target)
+		return nil
+	}
+
+	docs := make([]*firestore.DocumentRef, len(IDs))
+	for i, ID := range IDs {
+		docs[i] = d.Database.Collection(d.Collection).Doc(ID)
+	}
+	allFirestoreData, err := d.Database.GetAll(context.TODO(), docs)
+	if err != nil {
+		return fmt.Errorf("Error getting %s by IDs: %w", d.Collection, err)
+	}
+	for _, firestoreData := range allFirestoreData {
+		if !firestoreData.Exists() {
+			continue
+		}
+		data := make(map[string]interface{})
+		err := firestoreData.DataTo(&data)
+		if err != nil {
+			return fmt.Errorf("ERROR: GetByIDs(): Firestore.DataTo() error %w", err)
+		}
+		returnData = append(returnData, data)
+	}
+
+	mapstructure.Decode(returnData, target)
+
+	return nil
+}
+
+// maxInValues is how many values Firestore allows in an "in" query
+const maxInValues = 10
+
+// GetAllIn gets all items where path is one of values, splitting the values
+// into as few "in" queries as Firestore allows
+func (d *DatabaseProvider) GetAllIn(path string, values []string, target interface{}) (err error) {
+	defer d.observe("getAllIn", time.Now(), &err)
+	returnData := make([]interface{}, 0)
+	for start := 0; start < len(values); start += maxInValues {
+		end := start + maxInValues
+		if end > len(values) {
+			end = len(values)
+		}
+		allFirestoreData, err := d.Database.Collection(d.Collection).Where(path, "in", values[start:end]).Documents(context.TODO()).GetAll()
+		if err != nil {
+			return fmt.Errorf("Error getting collection: %w", err)
+		}
+		for _, firestoreData := range allFirestoreData {
+			data := make(map[string]interface{})
+			err := firestoreData.DataTo(&data)
+			if err != nil {
+				return fmt.Errorf("ERROR: GetAllIn(): Firestore.DataTo() error %w", err)
+			}
+			returnData = append(returnData, data)
+		}
+	}
+
+	mapstructure.Decode(returnData, target)
+
+	return nil
 }
 
 // Set is to add a Firestore record
-func (d *DatabaseProvider) Set(ID string, data interface{}) error {
-	_, err := d.Database.Collection(d.Collection).Doc(ID).Set(context.TODO(), data)
+func (d *DatabaseProvider) Set(ID string, data interface{}) (err error) {
+	defer d.observe("set", time.Now(), &err)
+	if d.TrackChanges {
+		err = d.writeWithChange(ID, false, func(tx *firestore.Transaction, doc *firestore.DocumentRef) error {
+			return tx.Set(doc, data)
+		})
+	} else if _, err = d.Database.Collection(d.Collection).Doc(ID).Set(context.TODO(), data); err != nil {
+		err = fmt.Errorf("Error setting %s with ID %s: %w", d.Collection, ID, err)
+	}
 	if err != nil {
-		return fmt.Errorf("Error setting %s with ID %s: %w", d.Collection, ID, err)
+		return err
+	}
+	d.Search.Save(d.Collection, ID, data)
+
+	return nil
+}
+
+// SetFields changes only the given fields of a record, creating it if needed,
+// so it can't undo a concurrent write to its other fields. Field names are the
+// struct field names, like "LastUsed". The search index isn't updated.
+func (d *DatabaseProvider) SetFields(ID string, fields map[string]interface{}) (err error) {
+	defer d.observe("setFields", time.Now(), &err)
+	if d.TrackChanges {
+		return d.writeWithChange(ID, false, func(tx *firestore.Transaction, doc *firestore.DocumentRef) error {
+			return tx.Set(doc, fields, firestore.MergeAll)
+		})
+	}
+	_, err = d.Database.Collection(d.Collection).Doc(ID).Set(context.TODO(), fields, firestore.MergeAll)
+	if err != nil {
+		return fmt.Errorf("Error setting fields of %s with ID %s: %w", d.Collection, ID, err)
+	}
+
+	return nil
+}
+
+// Create adds a Firestore record, failing with ErrFirestoreExists if there already is one with the ID
+func (d *DatabaseProvider) Create(ID string, data interface{}) (err error) {
+	defer d.observe("create", time.Now(), &err)
+	if d.TrackChanges {
+		err = d.writeWithChange(ID, false, func(tx *firestore.Transaction, doc *firestore.DocumentRef) error {
+			return tx.Create(doc, data)
+		})
+	} else {
+		_, err = d.Database.Collection(d.Collection).Doc(ID).Create(context.TODO(), data)
+	}
+	if status.Code(err) == codes.AlreadyExists || errors.Is(err, ErrFirestoreExists) {
+		return fmt.Errorf("Error creating %s with ID %s: %w", d.Collection, ID, ErrFirestoreExists)
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating %s with ID %s: %w", d.Collection, ID, err)
 	}
+	d.Search.Save(d.Collection, ID, data)
 
 	return nil
 }
 
+// Increment adds one to a number field of a record, creating the record if
+// needed, and returns the new value. Each caller gets a different value.
+func (d *DatabaseProvider) Increment(ID string, field string) (count int64, err error) {
+	defer d.observe("increment", time.Now(), &err)
+	err = d.RunTransaction(func(tx *Transaction) error {
+		data := map[string]interface{}{}
+		err := tx.GetByID(ID, &data)
+		if err != nil && !errors.Is(err, ErrFirestoreNotFound) {
+			return err
+		}
+		count, _ = data[field].(int64)
+		count++
+		tx.SetFields(ID, map[string]interface{}{field: count})
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Error incrementing %s of %s with ID %s: %w", field, d.Collection, ID, err)
+	}
+
+	return count, nil
+}
+
+// counterShards is how many records a sharded counter is spread over. Firestore
+// only takes about one write a second to a record, so busy counters are split up.
+const counterShards = 10
+
+// IncrementSharded adds one to a counter spread over the records <ID>-0 to
+// <ID>-9, creating them if needed, and returns the sum of all of them. Writes
+// don't wait on each other, so callers at the same time can get the same sum.
+func (d *DatabaseProvider) IncrementSharded(ID string, field string) (count int64, err error) {
+	defer d.observe("incrementSharded", time.Now(), &err)
+	shard := fmt.Sprintf("%s-%d", ID, rand.Intn(counterShards))
+	_, err = d.Database.Collection(d.Collection).Doc(shard).Set(context.TODO(), map[string]interface{}{field: firestore.Increment(1)}, firestore.MergeAll)
+	if err != nil {
+		return 0, fmt.Errorf("Error incrementing %s of %s with ID %s: %w", field, d.Collection, shard, err)
+	}
+
+	docs := make([]*firestore.DocumentRef, counterShards)
+	for i := range docs {
+		docs[i] = d.Database.Collection(d.Collection).Doc(fmt.Sprintf("%s-%d", ID, i))
+	}
+	snapshots, err := d.Database.GetAll(context.TODO(), docs)
+	if err != nil {
+		return 0, fmt.Errorf("Error getting %s of %s with ID %s: %w", field, d.Collection, ID, err)
+	}
+	for _, snapshot := range snapshots {
+		if !snapshot.Exists() {
+			continue
+		}
+		value, _ := snapshot.Data()[field].(int64)
+		count += value
+	}
+
+	return count, nil
+}
+
 // Delete is to delete a record
-func (d *DatabaseProvider) Delete(ID string) error {
-	_, err := d.Database.Collection(d.Collection).Doc(ID).Delete(context.TODO())
+func (d *DatabaseProvider) Delete(ID string) (err error) {
+	defer d.observe("delete", time.Now(), &err)
+	if d.TrackChanges {
+		err = d.writeWithChange(ID, true, func(tx *firestore.Transaction, doc *firestore.DocumentRef) error {
+			return tx.Delete(doc)
+		})
+	} else if _, err = d.Database.Collection(d.Collection).Doc(ID).Delete(context.TODO()); err != nil {
+		err = fmt.Errorf("Error deleting %s with ID %s: %w", d.Collection, ID, err)
+	}
+	if err != nil {
+		return err
+	}
+	d.Search.Remove(d.Collection, ID)
+
+	return nil
+}
+
+// SetAtRevision writes a whole record like Set, but only if its latest change
+// is still revision, failing with ErrRevisionChanged otherwise. The check and
+// the write are one transaction, so nothing can get in between.
+func (d *DatabaseProvider) SetAtRevision(ID string, data interface{}, revision int64) (err error) {
+	defer d.observe("setAtRevision", time.Now(), &err)
+	err = d.RunTransaction(func(tx *Transaction) error {
+		err := tx.checkRevision(ID, revision)
+		if err != nil {
+			return err
+		}
+		tx.Set(ID, data)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error setting %s with ID %s: %w", d.Collection, ID, err)
+	}
+	d.Search.Save(d.Collection, ID, data)
+
+	return nil
+}
+
+// DeleteAtRevision deletes a record like Delete, but only if its latest change
+// is still revision, failing with ErrRevisionChanged otherwise
+func (d *DatabaseProvider) DeleteAtRevision(ID string, revision int64) (err error) {
+	defer d.observe("deleteAtRevision", time.Now(), &err)
+	err = d.RunTransaction(func(tx *Transaction) error {
+		err := tx.checkRevision(ID, revision)
+		if err != nil {
+			return err
+		}
+		tx.Delete(ID)
+
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("Error deleting %s with ID %s: %w", d.Collection, ID, err)
 	}
+	d.Search.Remove(d.Collection, ID)
+
+	return nil
+}
+
+// writeWithChange writes a record and its change in one transaction, with the
+// next sequence number of the record's shard. Taking the sequence number in the
+// transaction means the changes of a shard commit in sequence order, so once a
+// change can be read every change of its shard before it can be too.
+func (d *DatabaseProvider) writeWithChange(ID string, deleted bool, write func(*firestore.Transaction, *firestore.DocumentRef) error) error {
+	err := d.RunTransaction(func(tx *Transaction) error {
+		tx.write(ID, deleted, write)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error writing %s with ID %s: %w", d.Collection, ID, err)
+	}
 
 	return nil
 }
 
+// GetChange gets the latest change to a record. Records that haven't changed
+// since changes were tracked get an empty change.
+func (d *DatabaseProvider) GetChange(ID string) (entity.Change, error) {
+	var change entity.Change
+	err := (&DatabaseProvider{Database: d.Database, Collection: d.Collection + "Changes"}).GetByID(ID, &change)
+	if errors.Is(err, ErrFirestoreNotFound) {
+		return entity.Change{ID: ID}, nil
+	}
+	if err != nil {
+		return entity.Change{}, err
+	}
+
+	return change, nil
+}
+
+// GetChanges gets up to limit changes after the cursor, oldest first within
+// each shard. Each record only has its latest change.
+func (d *DatabaseProvider) GetChanges(since SyncCursor, limit int) (_ []entity.Change, err error) {
+	defer d.observe("getChanges", time.Now(), &err)
+	shards := make([][]entity.Change, ChangeShards)
+	for shard := range shards {
+		allFirestoreData, err := d.Database.Collection(d.Collection+"Changes").
+			Where("Sequence", ">", shardSequence(shard, since[shard])).
+			Where("Sequence", "<", shardSequence(shard+1, 0)).
+			OrderBy("Sequence", firestore.Asc).
+			Limit(limit).
+			Documents(context.TODO()).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("Error getting changes of %s: %w", d.Collection, err)
+		}
+		for _, firestoreData := range allFirestoreData {
+			var change entity.Change
+			err := firestoreData.DataTo(&change)
+			if err != nil {
+				return nil, fmt.Errorf("ERROR: GetChanges(): Firestore.DataTo() error %w", err)
+			}
+			shards[shard] = append(shards[shard], change)
+		}
+	}
+
+	return mergeChanges(shards, limit), nil
+}
+
+// mergeChanges takes up to limit of the oldest changes of the shards. Each
+// shard's changes are taken from the start, so a cursor moved past them doesn't
+// skip any.
+func mergeChanges(shards [][]entity.Change, limit int) []entity.Change {
+	changes := []entity.Change{}
+	for len(changes) < limit {
+		oldest := -1
+		for shard := range shards {
+			if len(shards[shard]) > 0 && (oldest < 0 || shards[shard][0].Modified < shards[oldest][0].Modified) {
+				oldest = shard
+			}
+		}
+		if oldest < 0 {
+			break
+		}
+		changes = append(changes, shards[oldest][0])
+		shards[oldest] = shards[oldest][1:]
+	}
+
+	return changes
+}
+
+// GetLastChange gets the latest change to any record of the collection, an
+// empty change if nothing has changed since changes were tracked. Sequences
+// don't say which shard changed last, so it goes by Modified.
+func (d *DatabaseProvider) GetLastChange() (_ entity.Change, err error) {
+	defer d.observe("getLastChange", time.Now(), &err)
+	allFirestoreData, err := d.Database.Collection(d.Collection+"Changes").
+		OrderBy("Modified", firestore.Desc).
+		Limit(1).
+		Documents(context.TODO()).GetAll()
+	if err != nil {
+		return entity.Change{}, fmt.Errorf("Error getting the last change of %s: %w", d.Collection, err)
+	}
+
+	var change entity.Change
+	if len(allFirestoreData) > 0 {
+		err = allFirestoreData[0].DataTo(&change)
+		if err != nil {
+			return entity.Change{}, fmt.Errorf("ERROR: GetLastChange(): Firestore.DataTo() error %w", err)
+		}
+	}
+
+	return change, nil
+}
+
 // * Do we want to use .Update to keep existing data? Or just pull the data and then use .Set with old+new data?
 // Update is to update a Firestore record
 // func (d *DatabaseProvider) Update(ID string, data interface{}) error {
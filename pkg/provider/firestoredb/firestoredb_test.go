@@ -0,0 +1,48 @@
+package firestoredb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+)
+
+func TestSyncCursor(t *testing.T) {
+	cursor, err := ParseSyncCursor("41")
+	if err != nil || cursor != (SyncCursor{41}) {
+		t.Errorf("Expected a token from before sharding to be shard 0, got %v, %v", cursor, err)
+	}
+
+	cursor.Advance(shardSequence(2, 7))
+	cursor.Advance(shardSequence(0, 40))
+	if cursor.String() != "41.0.7" {
+		t.Errorf("Expected 41.0.7, got %s", cursor)
+	}
+	if parsed, err := ParseSyncCursor(cursor.String()); err != nil || parsed != cursor {
+		t.Errorf("Expected the token to parse back to %v, got %v, %v", cursor, parsed, err)
+	}
+	if (SyncCursor{}).String() != "0" {
+		t.Errorf("Expected an empty cursor to be 0, got %s", SyncCursor{})
+	}
+
+	for _, token := range []string{"x", "-1", "1..2", "1.2.3.4.5.6.7.8.9"} {
+		if _, err := ParseSyncCursor(token); err == nil {
+			t.Errorf("Expected %q to be invalid", token)
+		}
+	}
+}
+
+func TestMergeChanges(t *testing.T) {
+	shards := [][]entity.Change{
+		{{ID: "a", Modified: "2020-01-01T00:00:01Z"}, {ID: "c", Modified: "2020-01-01T00:00:03Z"}},
+		{},
+		{{ID: "b", Modified: "2020-01-01T00:00:02Z"}},
+	}
+	var IDs []string
+	for _, change := range mergeChanges(shards, 2) {
+		IDs = append(IDs, change.ID)
+	}
+	if !reflect.DeepEqual(IDs, []string{"a", "b"}) {
+		t.Errorf("Expected the oldest changes across shards, got %v", IDs)
+	}
+}
@@ -0,0 +1,27 @@
+package firestoredb
+
+import (
+	"errors"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/metrics"
+)
+
+var (
+	operationsTotal = metrics.Default.NewCounter("pace_firestore_operations_total",
+		"Firestore operations by collection and operation.", "collection", "operation")
+	operationErrorsTotal = metrics.Default.NewCounter("pace_firestore_operation_errors_total",
+		"Firestore operations that failed. Records not found or already existing aren't failures.", "collection", "operation")
+	operationDuration = metrics.Default.NewHistogram("pace_firestore_operation_duration_seconds",
+		"How long Firestore operations took.", nil, "collection", "operation")
+)
+
+// observe records an operation that started at start and ended with *err. It is
+// deferred with the named error result, so every return is counted.
+func (d *DatabaseProvider) observe(operation string, start time.Time, err *error) {
+	operationsTotal.Inc(d.Collection, operation)
+	operationDuration.Observe(time.Since(start).Seconds(), d.Collection, operation)
+	if *err != nil && !errors.Is(*err, ErrFirestoreNotFound) && !errors.Is(*err, ErrFirestoreExists) {
+		operationErrorsTotal.Inc(d.Collection, operation)
+	}
+}
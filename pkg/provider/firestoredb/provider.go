@@ -1,10 +1,25 @@
 package firestoredb
 
+import "github.com/coma-toast/pace-api/pkg/entity"
+
 // Provider is for working with contact data
 type Provider interface {
 	GetAll(target interface{}) error
 	GetByID(ID string, target interface{}) error
 	GetFirstBy(path string, op string, value string, target interface{}) error
+	GetAllBy(path string, op string, value string, target interface{}) error
+	GetByIDs(IDs []string, target interface{}) error
+	GetAllIn(path string, values []string, target interface{}) error
 	Set(ID string, data interface{}) error
+	SetFields(ID string, fields map[string]interface{}) error
+	Create(ID string, data interface{}) error
+	Increment(ID string, field string) (int64, error)
+	IncrementSharded(ID string, field string) (int64, error)
 	Delete(ID string) error
+	SetAtRevision(ID string, data interface{}, revision int64) error
+	DeleteAtRevision(ID string, revision int64) error
+	GetChange(ID string) (entity.Change, error)
+	GetChanges(since SyncCursor, limit int) ([]entity.Change, error)
+	GetLastChange() (entity.Change, error)
+	RunTransaction(f func(*Transaction) error) error
 }
@@ -0,0 +1,96 @@
+package firestoredb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// ChangeShards is how many sequences the changes of a collection are numbered
+// in. Each shard has its own record in syncSequences, so writes to records in
+// different shards don't wait on each other.
+const ChangeShards = 8
+
+// shardBits splits Sequence into the shard, above it, and the shard's own
+// sequence number. Shard 0 keeps the sequence numbers from before sharding.
+const shardBits = 40
+
+// changeShard is the shard of a record. It never changes, so the changes of a
+// record are always in the same order as its writes.
+func changeShard(ID string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(ID))
+
+	return int(hash.Sum32() % ChangeShards)
+}
+
+// shardSequence is the Sequence of the nth change of a shard
+func shardSequence(shard int, n int64) int64 {
+	return int64(shard)<<shardBits | n
+}
+
+// sequenceDocID is the syncSequences record of a shard. Shard 0 uses the
+// record of the collection from before sharding.
+func sequenceDocID(collection string, shard int) string {
+	if shard == 0 {
+		return collection
+	}
+
+	return fmt.Sprintf("%s-%d", collection, shard)
+}
+
+// SyncCursor is how far a sync got in each shard of a collection's changes.
+// Changes of a shard commit in sequence order, so everything up to the cursor
+// has been read.
+type SyncCursor [ChangeShards]int64
+
+// ParseSyncCursor reads a cursor from a sync token. A plain number, the token
+// from before sharding, is where shard 0 got to.
+func ParseSyncCursor(token string) (SyncCursor, error) {
+	var cursor SyncCursor
+	if token == "" {
+		return cursor, nil
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) > ChangeShards {
+		return SyncCursor{}, fmt.Errorf("Sync token %q has more than %d parts", token, ChangeShards)
+	}
+	for shard, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 || n >= 1<<shardBits {
+			return SyncCursor{}, fmt.Errorf("Invalid sync token %q", token)
+		}
+		cursor[shard] = n
+	}
+
+	return cursor, nil
+}
+
+// Advance moves the cursor past a change, if it isn't already
+func (c *SyncCursor) Advance(sequence int64) {
+	shard := sequence >> shardBits
+	if shard < 0 || shard >= ChangeShards {
+		return
+	}
+	if n := sequence & (1<<shardBits - 1); n > c[shard] {
+		c[shard] = n
+	}
+}
+
+// String is the sync token of the cursor, with the shards that haven't been
+// synced left off the end
+func (c SyncCursor) String() string {
+	last := 0
+	for shard, n := range c {
+		if n > 0 {
+			last = shard
+		}
+	}
+	parts := make([]string, last+1)
+	for shard := range parts {
+		parts[shard] = strconv.FormatInt(c[shard], 10)
+	}
+
+	return strings.Join(parts, ".")
+}
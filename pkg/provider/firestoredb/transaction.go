@@ -0,0 +1,191 @@
+package firestoredb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Transaction reads and writes records of a collection atomically. Writes are
+// held until the function given to RunTransaction returns, so they always come
+// after the reads as Firestore requires. The search index isn't updated.
+type Transaction struct {
+	provider *DatabaseProvider
+	tx       *firestore.Transaction
+	writes   []transactionWrite
+}
+
+type transactionWrite struct {
+	ID      string
+	deleted bool
+	write   func(*firestore.Transaction, *firestore.DocumentRef) error
+}
+
+// RunTransaction runs f in a transaction, running it again if another write
+// got in first, so f must not do anything besides its reads and writes. An
+// error returned by f cancels the transaction and is returned as it is.
+func (d *DatabaseProvider) RunTransaction(f func(*Transaction) error) (err error) {
+	defer d.observe("transaction", time.Now(), &err)
+	err = d.Database.RunTransaction(context.TODO(), func(ctx context.Context, tx *firestore.Transaction) error {
+		transaction := &Transaction{provider: d, tx: tx}
+		err := f(transaction)
+		if err != nil {
+			return err
+		}
+
+		return transaction.commit()
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return fmt.Errorf("Error creating %s: %w", d.Collection, ErrFirestoreExists)
+	}
+
+	return err
+}
+
+// GetByID gets an item by ID
+func (t *Transaction) GetByID(ID string, target interface{}) error {
+	firestoreData, err := t.tx.Get(t.provider.Database.Collection(t.provider.Collection).Doc(ID))
+	if status.Code(err) == codes.NotFound {
+		return fmt.Errorf("Error getting %s with ID %s: %w", t.provider.Collection, ID, ErrFirestoreNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("Error getting %s with ID %s: %w", t.provider.Collection, ID, err)
+	}
+
+	err = firestoreData.DataTo(target)
+	if err != nil {
+		return fmt.Errorf("ERROR: GetByID(): Firestore.DataTo() error %w", err)
+	}
+
+	return nil
+}
+
+// GetChange gets the latest change to a record, an empty change if it hasn't
+// changed since changes were tracked
+func (t *Transaction) GetChange(ID string) (entity.Change, error) {
+	firestoreData, err := t.tx.Get(t.provider.Database.Collection(t.provider.Collection + "Changes").Doc(ID))
+	if status.Code(err) == codes.NotFound {
+		return entity.Change{ID: ID}, nil
+	}
+	if err != nil {
+		return entity.Change{}, fmt.Errorf("Error getting the change of %s with ID %s: %w", t.provider.Collection, ID, err)
+	}
+
+	var change entity.Change
+	err = firestoreData.DataTo(&change)
+	if err != nil {
+		return entity.Change{}, fmt.Errorf("ERROR: GetChange(): Firestore.DataTo() error %w", err)
+	}
+
+	return change, nil
+}
+
+// checkRevision fails with ErrRevisionChanged if the record changed since revision
+func (t *Transaction) checkRevision(ID string, revision int64) error {
+	change, err := t.GetChange(ID)
+	if err != nil {
+		return err
+	}
+	if change.Sequence != revision {
+		return fmt.Errorf("%s with ID %s is at revision %d, not %d: %w", t.provider.Collection, ID, change.Sequence, revision, ErrRevisionChanged)
+	}
+
+	return nil
+}
+
+// Create adds a record. The transaction fails with ErrFirestoreExists if there
+// already is one with the ID.
+func (t *Transaction) Create(ID string, data interface{}) {
+	t.write(ID, false, func(tx *firestore.Transaction, doc *firestore.DocumentRef) error {
+		return tx.Create(doc, data)
+	})
+}
+
+// Set writes a whole record
+func (t *Transaction) Set(ID string, data interface{}) {
+	t.write(ID, false, func(tx *firestore.Transaction, doc *firestore.DocumentRef) error {
+		return tx.Set(doc, data)
+	})
+}
+
+// SetFields changes only the given fields of a record, creating it if needed
+func (t *Transaction) SetFields(ID string, fields map[string]interface{}) {
+	t.write(ID, false, func(tx *firestore.Transaction, doc *firestore.DocumentRef) error {
+		return tx.Set(doc, fields, firestore.MergeAll)
+	})
+}
+
+// Delete deletes a record
+func (t *Transaction) Delete(ID string) {
+	t.write(ID, true, func(tx *firestore.Transaction, doc *firestore.DocumentRef) error {
+		return tx.Delete(doc)
+	})
+}
+
+func (t *Transaction) write(ID string, deleted bool, write func(*firestore.Transaction, *firestore.DocumentRef) error) {
+	t.writes = append(t.writes, transactionWrite{ID: ID, deleted: deleted, write: write})
+}
+
+// commit applies the writes, along with their changes if the collection tracks
+// them. Each change gets the next sequence number of its record's shard.
+func (t *Transaction) commit() error {
+	d := t.provider
+	if len(t.writes) == 0 {
+		return nil
+	}
+
+	// Firestore wants every read before the first write
+	sequences := map[int]int64{}
+	if d.TrackChanges {
+		for _, write := range t.writes {
+			shard := changeShard(write.ID)
+			if _, ok := sequences[shard]; ok {
+				continue
+			}
+			firestoreData, err := t.tx.Get(d.Database.Collection(sequenceCollection).Doc(sequenceDocID(d.Collection, shard)))
+			if err != nil && status.Code(err) != codes.NotFound {
+				return fmt.Errorf("Error getting the change sequence of %s: %w", d.Collection, err)
+			}
+			sequences[shard] = 0
+			if err == nil {
+				value, _ := firestoreData.DataAt("Sequence")
+				sequences[shard], _ = value.(int64)
+			}
+		}
+	}
+
+	for _, write := range t.writes {
+		err := write.write(t.tx, d.Database.Collection(d.Collection).Doc(write.ID))
+		if err != nil {
+			return fmt.Errorf("Error writing %s with ID %s: %w", d.Collection, write.ID, err)
+		}
+		if !d.TrackChanges {
+			continue
+		}
+		shard := changeShard(write.ID)
+		sequences[shard]++
+		err = t.tx.Set(d.Database.Collection(d.Collection+"Changes").Doc(write.ID), entity.Change{
+			ID:       write.ID,
+			Sequence: shardSequence(shard, sequences[shard]),
+			Deleted:  write.deleted,
+			Modified: time.Now().Format(time.RFC3339),
+		})
+		if err != nil {
+			return fmt.Errorf("Error writing the change of %s with ID %s: %w", d.Collection, write.ID, err)
+		}
+	}
+
+	for shard, sequence := range sequences {
+		err := t.tx.Set(d.Database.Collection(sequenceCollection).Doc(sequenceDocID(d.Collection, shard)), map[string]interface{}{"Sequence": sequence}, firestore.MergeAll)
+		if err != nil {
+			return fmt.Errorf("Error saving the change sequence of %s: %w", d.Collection, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package idempotency
+
+import (
+	"errors"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+)
+
+// DatabaseProvider is an idempotency.Provider the uses a database
+type DatabaseProvider struct {
+	SharedProvider *firestoredb.DatabaseProvider
+}
+
+// ErrRecordNotFound if there is no record for a key
+var ErrRecordNotFound = paceerror.NotFound("Idempotency key not found")
+
+// ErrKeyInUse if a key was claimed by another request
+var ErrKeyInUse = paceerror.Conflict("Idempotency key is already in use")
+
+// Get gets the record of a key
+func (d *DatabaseProvider) Get(ID string) (entity.IdempotencyRecord, error) {
+	var record entity.IdempotencyRecord
+	err := d.SharedProvider.GetByID(ID, &record)
+	if err != nil {
+		return entity.IdempotencyRecord{}, firestoredb.WrapNotFound(err, ErrRecordNotFound)
+	}
+
+	return record, nil
+}
+
+// Claim saves the record of a new request, failing with ErrKeyInUse if another
+// request has the key, so only one of two concurrent retries runs
+func (d *DatabaseProvider) Claim(record entity.IdempotencyRecord) error {
+	err := d.SharedProvider.Create(record.ID, record)
+	if errors.Is(err, firestoredb.ErrFirestoreExists) {
+		return ErrKeyInUse
+	}
+
+	return err
+}
+
+// Set saves the record with the response
+func (d *DatabaseProvider) Set(record entity.IdempotencyRecord) error {
+	return d.SharedProvider.Set(record.ID, record)
+}
+
+// Delete removes the record of a key, so it can be used again
+func (d *DatabaseProvider) Delete(ID string) error {
+	return d.SharedProvider.Delete(ID)
+}
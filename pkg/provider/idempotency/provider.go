@@ -0,0 +1,11 @@
+package idempotency
+
+import "github.com/coma-toast/pace-api/pkg/entity"
+
+// Provider is for working with saved responses to idempotent requests
+type Provider interface {
+	Get(ID string) (entity.IdempotencyRecord, error)
+	Claim(entity.IdempotencyRecord) error
+	Set(entity.IdempotencyRecord) error
+	Delete(ID string) error
+}
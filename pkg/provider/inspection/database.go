@@ -1,11 +1,12 @@
 package inspection
 
 import (
-	"errors"
 	"fmt"
 	"time"
 
 	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/events"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
 	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
 	"github.com/google/uuid"
 	"github.com/rollbar/rollbar-go"
@@ -14,10 +15,26 @@ import (
 // DatabaseProvider is a inspection.Provider the uses a database
 type DatabaseProvider struct {
 	SharedProvider *firestoredb.DatabaseProvider
+	Events         events.Publisher
 }
 
 // ErrInspectionNotFound if no Inspections are found
-var ErrInspectionNotFound = errors.New("Inspection not found")
+var ErrInspectionNotFound = paceerror.NotFound("Inspection not found")
+
+// GetChange gets the latest change to an Inspection, its revision
+func (d *DatabaseProvider) GetChange(ID string) (entity.Change, error) {
+	return d.SharedProvider.GetChange(ID)
+}
+
+// GetChanges gets up to limit changes to inspections after the cursor since, for sync
+func (d *DatabaseProvider) GetChanges(since firestoredb.SyncCursor, limit int) ([]entity.Change, error) {
+	return d.SharedProvider.GetChanges(since, limit)
+}
+
+// GetLastChange gets the latest change to any of the inspections
+func (d *DatabaseProvider) GetLastChange() (entity.Change, error) {
+	return d.SharedProvider.GetLastChange()
+}
 
 // GetAll gets a Inspection by inspectionname
 func (d *DatabaseProvider) GetAll() ([]entity.Inspection, error) {
@@ -35,12 +52,34 @@ func (d *DatabaseProvider) GetByID(ID string) (entity.Inspection, error) {
 	var inspection entity.Inspection
 	err := d.SharedProvider.GetFirstBy("ID", "==", ID, &inspection)
 	if err != nil {
-		return entity.Inspection{}, fmt.Errorf("%s: %w", err, ErrInspectionNotFound)
+		return entity.Inspection{}, firestoredb.WrapNotFound(err, ErrInspectionNotFound)
 	}
 
 	return inspection, nil
 }
 
+// GetByIDs gets the Inspections with the given IDs. IDs that aren't found are skipped.
+func (d *DatabaseProvider) GetByIDs(IDs []string) ([]entity.Inspection, error) {
+	var inspections []entity.Inspection
+	err := d.SharedProvider.GetByIDs(IDs, &inspections)
+	if err != nil {
+		return nil, err
+	}
+
+	return inspections, nil
+}
+
+// GetByProjectIDs gets all Inspections of the given projects
+func (d *DatabaseProvider) GetByProjectIDs(projectIDs []string) ([]entity.Inspection, error) {
+	var inspections []entity.Inspection
+	err := d.SharedProvider.GetAllIn("ProjectID", projectIDs, &inspections)
+	if err != nil {
+		return nil, err
+	}
+
+	return inspections, nil
+}
+
 // Add is to update a inspection record
 func (d *DatabaseProvider) Add(inspectionData entity.UpdateInspectionRequest) (entity.Inspection, error) {
 	rollbar.Info(fmt.Sprintf("Adding new Inspection to DB %s", inspectionData.ID))
@@ -48,7 +87,7 @@ func (d *DatabaseProvider) Add(inspectionData entity.UpdateInspectionRequest) (e
 	var existingInspection entity.Inspection
 	err := d.SharedProvider.GetFirstBy("ID", "==", inspectionData.ID, &existingInspection)
 	if (entity.Inspection{}) != existingInspection {
-		return entity.Inspection{}, fmt.Errorf("Error adding inspection %s: ID already exists. ID: %s", inspectionData.ID, existingInspection.ID)
+		return entity.Inspection{}, paceerror.Conflict("Inspection %s already exists", inspectionData.ID)
 	}
 
 	newUUID := uuid.New().String()
@@ -73,11 +112,24 @@ func (d *DatabaseProvider) Add(inspectionData entity.UpdateInspectionRequest) (e
 	}
 
 	rollbar.Info(fmt.Sprintf("Inspection %s added.", newInspectionData.ID))
+	events.Publish(d.Events, "inspection.created", newInspection)
 	return newInspection, nil
 }
 
 // Update is to update a inspection record
 func (d *DatabaseProvider) Update(newInspectionData entity.UpdateInspectionRequest) (entity.Inspection, error) {
+	return d.update(newInspectionData, d.SharedProvider.Set)
+}
+
+// UpdateAtRevision updates an inspection record if it hasn't changed since
+// revision, failing with firestoredb.ErrRevisionChanged otherwise
+func (d *DatabaseProvider) UpdateAtRevision(newInspectionData entity.UpdateInspectionRequest, revision int64) (entity.Inspection, error) {
+	return d.update(newInspectionData, func(ID string, data interface{}) error {
+		return d.SharedProvider.SetAtRevision(ID, data, revision)
+	})
+}
+
+func (d *DatabaseProvider) update(newInspectionData entity.UpdateInspectionRequest, set func(ID string, data interface{}) error) (entity.Inspection, error) {
 	var currentInspectionData entity.Inspection
 	err := d.SharedProvider.GetFirstBy("ID", "==", newInspectionData.ID, &currentInspectionData)
 	if err != nil {
@@ -95,7 +147,7 @@ func (d *DatabaseProvider) Update(newInspectionData entity.UpdateInspectionReque
 		InspectedParts: newInspectionData.InspectedParts,
 	}
 
-	err = d.SharedProvider.Set(currentInspectionData.ID, updatedInspection)
+	err = set(currentInspectionData.ID, updatedInspection)
 	if err != nil {
 		return entity.Inspection{}, err
 	}
@@ -108,25 +160,39 @@ func (d *DatabaseProvider) Update(newInspectionData entity.UpdateInspectionReque
 
 	rollbar.Info(fmt.Sprintf("Inspection %s updated.", updatedInspectionData.ID))
 
+	events.Publish(d.Events, "inspection.updated", updatedInspectionData)
 	return updatedInspectionData, nil
 }
 
 // Delete deletes an inspection
 func (d *DatabaseProvider) Delete(inspection entity.Inspection) error {
+	return d.delete(inspection, d.SharedProvider.Delete)
+}
+
+// DeleteAtRevision deletes an inspection if it hasn't changed since revision,
+// failing with firestoredb.ErrRevisionChanged otherwise
+func (d *DatabaseProvider) DeleteAtRevision(inspection entity.Inspection, revision int64) error {
+	return d.delete(inspection, func(ID string) error {
+		return d.SharedProvider.DeleteAtRevision(ID, revision)
+	})
+}
+
+func (d *DatabaseProvider) delete(inspection entity.Inspection, remove func(ID string) error) error {
 	var currentInspection entity.Inspection
 
 	err := d.SharedProvider.GetByID(inspection.ID, &currentInspection)
 	if (entity.Inspection{}) == currentInspection {
-		return fmt.Errorf("Inspection not found")
+		return ErrInspectionNotFound
 	}
 
 	rollbar.Info(fmt.Sprintf("Deleting Inspection from DB: %s", inspection.ID))
 
-	err = d.SharedProvider.Delete(inspection.ID)
+	err = remove(inspection.ID)
 	if err != nil {
 		return err
 	}
 	rollbar.Info(fmt.Sprintf("Deleted inspection %s", inspection.ID))
+	events.Publish(d.Events, "inspection.deleted", currentInspection)
 
 	return nil
 }
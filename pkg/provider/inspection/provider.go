@@ -1,12 +1,22 @@
 package inspection
 
-import "github.com/coma-toast/pace-api/pkg/entity"
+import (
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+)
 
 // Provider is for working with inspection data
 type Provider interface {
 	GetByID(ID string) (entity.Inspection, error)
+	GetByIDs(IDs []string) ([]entity.Inspection, error)
+	GetByProjectIDs(projectIDs []string) ([]entity.Inspection, error)
 	GetAll() ([]entity.Inspection, error)
+	GetChange(ID string) (entity.Change, error)
+	GetChanges(since firestoredb.SyncCursor, limit int) ([]entity.Change, error)
+	GetLastChange() (entity.Change, error)
 	Add(entity.UpdateInspectionRequest) (entity.Inspection, error)
 	Update(entity.UpdateInspectionRequest) (entity.Inspection, error)
+	UpdateAtRevision(update entity.UpdateInspectionRequest, revision int64) (entity.Inspection, error)
 	Delete(inspection entity.Inspection) error
+	DeleteAtRevision(inspection entity.Inspection, revision int64) error
 }
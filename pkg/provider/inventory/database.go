@@ -1,11 +1,12 @@
 package inventory
 
 import (
-	"errors"
 	"fmt"
 	"time"
 
 	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/events"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
 	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
 	"github.com/google/uuid"
 	"github.com/rollbar/rollbar-go"
@@ -14,10 +15,26 @@ import (
 // DatabaseProvider is a inventory.Provider the uses a database
 type DatabaseProvider struct {
 	SharedProvider *firestoredb.DatabaseProvider
+	Events         events.Publisher
 }
 
 // ErrInventoryNotFound if no Inventor is found
-var ErrInventoryNotFound = errors.New("Inventory not found")
+var ErrInventoryNotFound = paceerror.NotFound("Inventory not found")
+
+// GetChange gets the latest change to an Inventory item, its revision
+func (d *DatabaseProvider) GetChange(ID string) (entity.Change, error) {
+	return d.SharedProvider.GetChange(ID)
+}
+
+// GetChanges gets up to limit changes to inventory items after the cursor since, for sync
+func (d *DatabaseProvider) GetChanges(since firestoredb.SyncCursor, limit int) ([]entity.Change, error) {
+	return d.SharedProvider.GetChanges(since, limit)
+}
+
+// GetLastChange gets the latest change to any of the inventory
+func (d *DatabaseProvider) GetLastChange() (entity.Change, error) {
+	return d.SharedProvider.GetLastChange()
+}
 
 // GetAll gets all inventory
 func (d *DatabaseProvider) GetAll() ([]entity.Inventory, error) {
@@ -35,7 +52,29 @@ func (d *DatabaseProvider) GetByID(ID string) (entity.Inventory, error) {
 	var inventory entity.Inventory
 	err := d.SharedProvider.GetFirstBy("ID", "==", ID, &inventory)
 	if err != nil {
-		return entity.Inventory{}, fmt.Errorf("%s: %w", err, ErrInventoryNotFound)
+		return entity.Inventory{}, firestoredb.WrapNotFound(err, ErrInventoryNotFound)
+	}
+
+	return inventory, nil
+}
+
+// GetByIDs gets the Inventory items with the given IDs. IDs that aren't found are skipped.
+func (d *DatabaseProvider) GetByIDs(IDs []string) ([]entity.Inventory, error) {
+	var inventory []entity.Inventory
+	err := d.SharedProvider.GetByIDs(IDs, &inventory)
+	if err != nil {
+		return nil, err
+	}
+
+	return inventory, nil
+}
+
+// GetByProjectIDs gets all Inventory items of the given projects
+func (d *DatabaseProvider) GetByProjectIDs(projectIDs []string) ([]entity.Inventory, error) {
+	var inventory []entity.Inventory
+	err := d.SharedProvider.GetAllIn("ProjectID", projectIDs, &inventory)
+	if err != nil {
+		return nil, err
 	}
 
 	return inventory, nil
@@ -48,7 +87,7 @@ func (d *DatabaseProvider) Add(newInventoryData entity.Inventory) (entity.Invent
 	var existingInventory entity.Inventory
 	err := d.SharedProvider.GetFirstBy("ID", "==", newInventoryData.ID, &existingInventory)
 	if (entity.Inventory{}) != existingInventory {
-		return entity.Inventory{}, fmt.Errorf("Error adding inventory %s: Inventoryname already exists. ID: %s", newInventoryData.ID, existingInventory.ID)
+		return entity.Inventory{}, paceerror.Conflict("Inventory item %s already exists", newInventoryData.ID)
 	}
 
 	newUUID := uuid.New().String()
@@ -77,11 +116,24 @@ func (d *DatabaseProvider) Add(newInventoryData entity.Inventory) (entity.Invent
 	}
 
 	rollbar.Info(fmt.Sprintf("Inventory %s added.", newInventoryData.ID))
+	events.Publish(d.Events, "inventory.created", newInventory)
 	return newInventory, nil
 }
 
 // Update is to update a inventory record
 func (d *DatabaseProvider) Update(newInventoryData entity.UpdateInventoryRequest) (entity.Inventory, error) {
+	return d.update(newInventoryData, d.SharedProvider.Set)
+}
+
+// UpdateAtRevision updates an inventory record if it hasn't changed since
+// revision, failing with firestoredb.ErrRevisionChanged otherwise
+func (d *DatabaseProvider) UpdateAtRevision(newInventoryData entity.UpdateInventoryRequest, revision int64) (entity.Inventory, error) {
+	return d.update(newInventoryData, func(ID string, data interface{}) error {
+		return d.SharedProvider.SetAtRevision(ID, data, revision)
+	})
+}
+
+func (d *DatabaseProvider) update(newInventoryData entity.UpdateInventoryRequest, set func(ID string, data interface{}) error) (entity.Inventory, error) {
 	var currentInventoryData entity.Inventory
 	err := d.SharedProvider.GetFirstBy("ID", "==", newInventoryData.ID, &currentInventoryData)
 	if err != nil {
@@ -103,7 +155,7 @@ func (d *DatabaseProvider) Update(newInventoryData entity.UpdateInventoryRequest
 		Priority:  newInventoryData.Priority,
 	}
 
-	err = d.SharedProvider.Set(currentInventoryData.ID, updatedInventory)
+	err = set(currentInventoryData.ID, updatedInventory)
 	if err != nil {
 		return entity.Inventory{}, err
 	}
@@ -116,24 +168,42 @@ func (d *DatabaseProvider) Update(newInventoryData entity.UpdateInventoryRequest
 
 	rollbar.Info(fmt.Sprintf("Inventory %s updated.", updatedInventoryData.ID))
 
+	events.Publish(d.Events, "inventory.updated", updatedInventoryData)
+	if updatedInventoryData.Stage != currentInventoryData.Stage {
+		events.Publish(d.Events, "inventory.stageChanged", updatedInventoryData)
+	}
+
 	return updatedInventoryData, nil
 }
 
 // Delete deletes an inventory item
 func (d *DatabaseProvider) Delete(inventory entity.Inventory) error {
+	return d.delete(inventory, d.SharedProvider.Delete)
+}
+
+// DeleteAtRevision deletes an inventory item if it hasn't changed since revision,
+// failing with firestoredb.ErrRevisionChanged otherwise
+func (d *DatabaseProvider) DeleteAtRevision(inventory entity.Inventory, revision int64) error {
+	return d.delete(inventory, func(ID string) error {
+		return d.SharedProvider.DeleteAtRevision(ID, revision)
+	})
+}
+
+func (d *DatabaseProvider) delete(inventory entity.Inventory, remove func(ID string) error) error {
 	rollbar.Info(fmt.Sprintf("Deleting Inventory from DB: %s", inventory.ID))
 	var currentInventory entity.Inventory
 
 	err := d.SharedProvider.GetByID(inventory.ID, &currentInventory)
 	if (entity.Inventory{}) == currentInventory {
-		return fmt.Errorf("Inventory not found")
+		return ErrInventoryNotFound
 	}
 
-	err = d.SharedProvider.Delete(inventory.ID)
+	err = remove(inventory.ID)
 	if err != nil {
 		return err
 	}
 	rollbar.Info(fmt.Sprintf("Deleted inventory %s", inventory.ID))
+	events.Publish(d.Events, "inventory.deleted", currentInventory)
 
 	return nil
 }
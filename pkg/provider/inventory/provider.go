@@ -1,12 +1,22 @@
 package inventory
 
-import "github.com/coma-toast/pace-api/pkg/entity"
+import (
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+)
 
 // Provider is for working with inventory data
 type Provider interface {
 	GetByID(inventoryname string) (entity.Inventory, error)
+	GetByIDs(IDs []string) ([]entity.Inventory, error)
+	GetByProjectIDs(projectIDs []string) ([]entity.Inventory, error)
 	GetAll() ([]entity.Inventory, error)
+	GetChange(ID string) (entity.Change, error)
+	GetChanges(since firestoredb.SyncCursor, limit int) ([]entity.Change, error)
+	GetLastChange() (entity.Change, error)
 	Add(entity.Inventory) (entity.Inventory, error)
 	Update(entity.UpdateInventoryRequest) (entity.Inventory, error)
+	UpdateAtRevision(update entity.UpdateInventoryRequest, revision int64) (entity.Inventory, error)
 	Delete(inventoryname entity.Inventory) error
+	DeleteAtRevision(inventory entity.Inventory, revision int64) error
 }
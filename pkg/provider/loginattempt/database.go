@@ -0,0 +1,93 @@
+package loginattempt
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+	helper "github.com/coma-toast/pace-api/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/rollbar/rollbar-go"
+)
+
+// DatabaseProvider is a loginattempt.Provider the uses a database
+type DatabaseProvider struct {
+	SharedProvider *firestoredb.DatabaseProvider
+	EventProvider  *firestoredb.DatabaseProvider
+}
+
+// Get gets the failed logins for a key. Keys without failures get an empty record.
+func (d *DatabaseProvider) Get(key string) (entity.LoginAttempts, error) {
+	var attempts entity.LoginAttempts
+	err := d.SharedProvider.GetByID(documentID(key), &attempts)
+	if errors.Is(err, firestoredb.ErrFirestoreNotFound) {
+		return entity.LoginAttempts{ID: documentID(key), Key: key}, nil
+	}
+	if err != nil {
+		return entity.LoginAttempts{}, err
+	}
+
+	return attempts, nil
+}
+
+// Update runs update on the failed logins for a key and saves what it returns,
+// in one transaction, so failures at the same time are all counted. update
+// can run more than once.
+func (d *DatabaseProvider) Update(key string, update func(entity.LoginAttempts) entity.LoginAttempts) (entity.LoginAttempts, error) {
+	var attempts entity.LoginAttempts
+	err := d.SharedProvider.RunTransaction(func(tx *firestoredb.Transaction) error {
+		attempts = entity.LoginAttempts{ID: documentID(key), Key: key}
+		err := tx.GetByID(attempts.ID, &attempts)
+		if err != nil && !errors.Is(err, firestoredb.ErrFirestoreNotFound) {
+			return err
+		}
+
+		attempts = update(attempts)
+		attempts.ID = documentID(key)
+		attempts.Key = key
+		tx.Set(attempts.ID, attempts)
+
+		return nil
+	})
+	if err != nil {
+		return entity.LoginAttempts{}, fmt.Errorf("Error updating failed logins for %s: %w", key, err)
+	}
+
+	return attempts, nil
+}
+
+// Reset clears the failed logins for a key
+func (d *DatabaseProvider) Reset(key string) error {
+	return d.SharedProvider.Delete(documentID(key))
+}
+
+// AddEvent records a lockout event
+func (d *DatabaseProvider) AddEvent(event entity.LockoutEvent) (entity.LockoutEvent, error) {
+	event.ID = uuid.New().String()
+	event.Created = time.Now().Format(time.RFC3339)
+	err := d.EventProvider.Set(event.ID, event)
+	if err != nil {
+		return entity.LockoutEvent{}, fmt.Errorf("Error setting lockout event %s by ID: %s", event.ID, err)
+	}
+	rollbar.Warning(fmt.Sprintf("Login %s %s (%d failures)", event.Key, event.Event, event.Failures))
+
+	return event, nil
+}
+
+// GetEvents gets all lockout events
+func (d *DatabaseProvider) GetEvents() ([]entity.LockoutEvent, error) {
+	var events []entity.LockoutEvent
+	err := d.EventProvider.GetAll(&events)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// documentID keeps usernames and IPv6 addresses out of document paths
+func documentID(key string) string {
+	return helper.Hash(key, "")
+}
@@ -0,0 +1,12 @@
+package loginattempt
+
+import "github.com/coma-toast/pace-api/pkg/entity"
+
+// Provider is for working with failed login and lockout data
+type Provider interface {
+	Get(key string) (entity.LoginAttempts, error)
+	Update(key string, update func(entity.LoginAttempts) entity.LoginAttempts) (entity.LoginAttempts, error)
+	Reset(key string) error
+	AddEvent(entity.LockoutEvent) (entity.LockoutEvent, error)
+	GetEvents() ([]entity.LockoutEvent, error)
+}
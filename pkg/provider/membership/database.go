@@ -0,0 +1,132 @@
+package membership
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+	"github.com/google/uuid"
+	"github.com/rollbar/rollbar-go"
+)
+
+// DatabaseProvider is a membership.Provider the uses a database
+type DatabaseProvider struct {
+	SharedProvider *firestoredb.DatabaseProvider
+}
+
+// ErrMembershipNotFound if no Memberships are found
+var ErrMembershipNotFound = paceerror.NotFound("Membership not found")
+
+// GetByID gets a Membership by ID
+func (d *DatabaseProvider) GetByID(ID string) (entity.Membership, error) {
+	var membership entity.Membership
+	err := d.SharedProvider.GetByID(ID, &membership)
+	if err != nil {
+		return entity.Membership{}, firestoredb.WrapNotFound(err, ErrMembershipNotFound)
+	}
+
+	return membership, nil
+}
+
+// GetByUser gets all Memberships for a user
+func (d *DatabaseProvider) GetByUser(userID string) ([]entity.Membership, error) {
+	var memberships []entity.Membership
+	err := d.SharedProvider.GetAllBy("UserID", "==", userID, &memberships)
+	if err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+// GetByProject gets all Memberships for a project
+func (d *DatabaseProvider) GetByProject(projectID string) ([]entity.Membership, error) {
+	var memberships []entity.Membership
+	err := d.SharedProvider.GetAllBy("ProjectID", "==", projectID, &memberships)
+	if err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+// Add is to add a membership record
+func (d *DatabaseProvider) Add(newMembershipData entity.Membership) (entity.Membership, error) {
+	rollbar.Info(fmt.Sprintf("Adding user %s to project %s as %s", newMembershipData.UserID, newMembershipData.ProjectID, newMembershipData.Role))
+
+	existingMemberships, err := d.GetByUser(newMembershipData.UserID)
+	if err != nil {
+		return entity.Membership{}, err
+	}
+	for _, existingMembership := range existingMemberships {
+		if existingMembership.ProjectID == newMembershipData.ProjectID {
+			return entity.Membership{}, paceerror.Conflict("User %s is already a member of project %s", newMembershipData.UserID, newMembershipData.ProjectID)
+		}
+	}
+
+	newUUID := uuid.New().String()
+	newMembershipData = entity.Membership{
+		ID:        newUUID,
+		Created:   time.Now().Format(time.RFC3339),
+		UserID:    newMembershipData.UserID,
+		ProjectID: newMembershipData.ProjectID,
+		Role:      newMembershipData.Role,
+	}
+	err = d.SharedProvider.Set(newMembershipData.ID, newMembershipData)
+	if err != nil {
+		return entity.Membership{}, fmt.Errorf("Error setting membership %s by ID: %s", newMembershipData.ID, err)
+	}
+
+	var newMembership = entity.Membership{}
+	err = d.SharedProvider.GetByID(newMembershipData.ID, &newMembership)
+	if err != nil {
+		return entity.Membership{}, fmt.Errorf("Error getting newly created membership %s by ID: %s", newMembershipData.ID, err)
+	}
+
+	rollbar.Info(fmt.Sprintf("Membership %s added.", newMembershipData.ID))
+	return newMembership, nil
+}
+
+// Update changes the project role of a membership
+func (d *DatabaseProvider) Update(newMembershipData entity.Membership) (entity.Membership, error) {
+	currentMembershipData, err := d.GetByID(newMembershipData.ID)
+	if err != nil {
+		return entity.Membership{}, err
+	}
+
+	rollbar.Info(fmt.Sprintf("Updating membershipID %s. \nOld Data: %v \nNew Data: %v", currentMembershipData.ID, currentMembershipData, newMembershipData))
+	updatedMembership := entity.Membership{
+		ID:        currentMembershipData.ID,
+		Created:   currentMembershipData.Created,
+		UserID:    currentMembershipData.UserID,
+		ProjectID: currentMembershipData.ProjectID,
+		Role:      newMembershipData.Role,
+	}
+
+	err = d.SharedProvider.Set(currentMembershipData.ID, updatedMembership)
+	if err != nil {
+		return entity.Membership{}, err
+	}
+
+	return d.GetByID(currentMembershipData.ID)
+}
+
+// Delete removes a user from a project
+func (d *DatabaseProvider) Delete(membership entity.Membership) error {
+	rollbar.Info(fmt.Sprintf("Deleting Membership from DB: %s", membership.ID))
+
+	_, err := d.GetByID(membership.ID)
+	if err != nil {
+		return err
+	}
+
+	err = d.SharedProvider.Delete(membership.ID)
+	if err != nil {
+		return err
+	}
+	rollbar.Info(fmt.Sprintf("Deleted membership %s", membership.ID))
+
+	return nil
+}
@@ -0,0 +1,13 @@
+package membership
+
+import "github.com/coma-toast/pace-api/pkg/entity"
+
+// Provider is for working with project membership data
+type Provider interface {
+	GetByID(ID string) (entity.Membership, error)
+	GetByUser(userID string) ([]entity.Membership, error)
+	GetByProject(projectID string) ([]entity.Membership, error)
+	Add(entity.Membership) (entity.Membership, error)
+	Update(entity.Membership) (entity.Membership, error)
+	Delete(membership entity.Membership) error
+}
@@ -0,0 +1,43 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+	"github.com/rollbar/rollbar-go"
+)
+
+// twoFactorID is the document that holds the TwoFactorPolicy
+const twoFactorID = "twoFactor"
+
+// DatabaseProvider is a policy.Provider the uses a database
+type DatabaseProvider struct {
+	SharedProvider *firestoredb.DatabaseProvider
+}
+
+// GetTwoFactor gets the two-factor policy. Nothing is required until an admin sets one.
+func (d *DatabaseProvider) GetTwoFactor() (entity.TwoFactorPolicy, error) {
+	var twoFactorPolicy entity.TwoFactorPolicy
+	err := d.SharedProvider.GetByID(twoFactorID, &twoFactorPolicy)
+	if errors.Is(err, firestoredb.ErrFirestoreNotFound) {
+		return entity.TwoFactorPolicy{}, nil
+	}
+	if err != nil {
+		return entity.TwoFactorPolicy{}, err
+	}
+
+	return twoFactorPolicy, nil
+}
+
+// SetTwoFactor replaces the two-factor policy
+func (d *DatabaseProvider) SetTwoFactor(twoFactorPolicy entity.TwoFactorPolicy) (entity.TwoFactorPolicy, error) {
+	err := d.SharedProvider.Set(twoFactorID, twoFactorPolicy)
+	if err != nil {
+		return entity.TwoFactorPolicy{}, fmt.Errorf("Error setting two-factor policy: %s", err)
+	}
+	rollbar.Info(fmt.Sprintf("Two-factor policy updated. Required for: %v", twoFactorPolicy.RequiredRoles))
+
+	return d.GetTwoFactor()
+}
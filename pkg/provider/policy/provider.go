@@ -0,0 +1,9 @@
+package policy
+
+import "github.com/coma-toast/pace-api/pkg/entity"
+
+// Provider is for working with admin-set security policies
+type Provider interface {
+	GetTwoFactor() (entity.TwoFactorPolicy, error)
+	SetTwoFactor(entity.TwoFactorPolicy) (entity.TwoFactorPolicy, error)
+}
@@ -1,11 +1,12 @@
 package project
 
 import (
-	"errors"
 	"fmt"
 	"time"
 
 	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/events"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
 	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
 	"github.com/google/uuid"
 	"github.com/rollbar/rollbar-go"
@@ -14,10 +15,26 @@ import (
 // DatabaseProvider is a project.Provider the uses a database
 type DatabaseProvider struct {
 	SharedProvider *firestoredb.DatabaseProvider
+	Events         events.Publisher
 }
 
 // ErrProjectNotFound if no Projects are found
-var ErrProjectNotFound = errors.New("Project not found")
+var ErrProjectNotFound = paceerror.NotFound("Project not found")
+
+// GetChanges gets up to limit changes to projects after the cursor since, for sync
+func (d *DatabaseProvider) GetChanges(since firestoredb.SyncCursor, limit int) ([]entity.Change, error) {
+	return d.SharedProvider.GetChanges(since, limit)
+}
+
+// GetChange gets the latest change to a Project
+func (d *DatabaseProvider) GetChange(ID string) (entity.Change, error) {
+	return d.SharedProvider.GetChange(ID)
+}
+
+// GetLastChange gets the latest change to any of the projects
+func (d *DatabaseProvider) GetLastChange() (entity.Change, error) {
+	return d.SharedProvider.GetLastChange()
+}
 
 // GetAll gets a Project by projectname
 func (d *DatabaseProvider) GetAll() ([]entity.Project, error) {
@@ -30,17 +47,39 @@ func (d *DatabaseProvider) GetAll() ([]entity.Project, error) {
 	return projects, nil
 }
 
+// GetByID gets a Project by ID
+func (d *DatabaseProvider) GetByID(ID string) (entity.Project, error) {
+	var project entity.Project
+	err := d.SharedProvider.GetByID(ID, &project)
+	if err != nil {
+		return entity.Project{}, firestoredb.WrapNotFound(err, ErrProjectNotFound)
+	}
+
+	return project, nil
+}
+
 // GetByName gets a Project by projectname
 func (d *DatabaseProvider) GetByName(projectname string) (entity.Project, error) {
 	var project entity.Project
 	err := d.SharedProvider.GetFirstBy("Name", "==", projectname, &project)
 	if err != nil {
-		return entity.Project{}, fmt.Errorf("%s: %w", err, ErrProjectNotFound)
+		return entity.Project{}, firestoredb.WrapNotFound(err, ErrProjectNotFound)
 	}
 
 	return project, nil
 }
 
+// GetByIDs gets the Projects with the given IDs. IDs that aren't found are skipped.
+func (d *DatabaseProvider) GetByIDs(IDs []string) ([]entity.Project, error) {
+	var projects []entity.Project
+	err := d.SharedProvider.GetByIDs(IDs, &projects)
+	if err != nil {
+		return nil, err
+	}
+
+	return projects, nil
+}
+
 // Add is to update a project record
 func (d *DatabaseProvider) Add(newProjectData entity.Project) (entity.Project, error) {
 	rollbar.Info(fmt.Sprintf("Adding new Project to DB %s - %s", newProjectData.Name, newProjectData.Name))
@@ -48,7 +87,7 @@ func (d *DatabaseProvider) Add(newProjectData entity.Project) (entity.Project, e
 	var existingProject entity.Project
 	err := d.SharedProvider.GetFirstBy("Name", "==", newProjectData.Name, &existingProject)
 	if (entity.Project{}) != existingProject {
-		return entity.Project{}, fmt.Errorf("Error adding project %s: Projectname already exists. ID: %s", newProjectData.Name, existingProject.ID)
+		return entity.Project{}, paceerror.Conflict("Project %s already exists", newProjectData.Name)
 	}
 
 	newUUID := uuid.New().String()
@@ -87,16 +126,29 @@ func (d *DatabaseProvider) Add(newProjectData entity.Project) (entity.Project, e
 	}
 
 	rollbar.Info(fmt.Sprintf("Project %s added.", newProjectData.Name))
+	events.Publish(d.Events, "project.created", newProject)
 	return newProject, nil
 }
 
-// Update is to update a project record
+// Update is to update a project record. Projects are looked up by ID, or by
+// name for older clients that don't send one, in which case they can't be renamed.
 func (d *DatabaseProvider) Update(newProjectData entity.UpdateProjectRequest) (entity.Project, error) {
 	var currentProjectData entity.Project
-	err := d.SharedProvider.GetFirstBy("Name", "==", newProjectData.Name, &currentProjectData)
+	var err error
+	if newProjectData.ID != "" {
+		currentProjectData, err = d.GetByID(newProjectData.ID)
+	} else {
+		currentProjectData, err = d.GetByName(newProjectData.Name)
+	}
 	if err != nil {
 		return entity.Project{}, err
 	}
+	if newProjectData.Name != currentProjectData.Name {
+		existingProject, _ := d.GetByName(newProjectData.Name)
+		if existingProject.ID != "" {
+			return entity.Project{}, paceerror.Conflict("Project %s already exists", newProjectData.Name)
+		}
+	}
 
 	rollbar.Info(fmt.Sprintf("Updating projectID %s. \nOld Data: %v \nNew Data: %v", currentProjectData.ID, currentProjectData, newProjectData))
 	updatedProject := entity.Project{
@@ -137,6 +189,7 @@ func (d *DatabaseProvider) Update(newProjectData entity.UpdateProjectRequest) (e
 
 	rollbar.Info(fmt.Sprintf("Project %s updated.", updatedProjectData.Name))
 
+	events.Publish(d.Events, "project.updated", updatedProjectData)
 	return updatedProjectData, nil
 }
 
@@ -147,7 +200,7 @@ func (d *DatabaseProvider) Delete(project entity.Project) error {
 
 	err := d.SharedProvider.GetByID(project.ID, &currentProject)
 	if (entity.Project{}) == currentProject {
-		return fmt.Errorf("Project not found")
+		return ErrProjectNotFound
 	}
 
 	err = d.SharedProvider.Delete(project.ID)
@@ -155,6 +208,7 @@ func (d *DatabaseProvider) Delete(project entity.Project) error {
 		return err
 	}
 	rollbar.Info(fmt.Sprintf("Deleted project %s", project.ID))
+	events.Publish(d.Events, "project.deleted", currentProject)
 
 	return nil
 }
@@ -1,11 +1,19 @@
 package project
 
-import "github.com/coma-toast/pace-api/pkg/entity"
+import (
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+)
 
 // Provider is for working with project data
 type Provider interface {
+	GetByID(ID string) (entity.Project, error)
+	GetByIDs(IDs []string) ([]entity.Project, error)
 	GetByName(projectname string) (entity.Project, error)
 	GetAll() ([]entity.Project, error)
+	GetChange(ID string) (entity.Change, error)
+	GetChanges(since firestoredb.SyncCursor, limit int) ([]entity.Change, error)
+	GetLastChange() (entity.Change, error)
 	Add(entity.Project) (entity.Project, error)
 	Update(entity.UpdateProjectRequest) (entity.Project, error)
 	Delete(projectname entity.Project) error
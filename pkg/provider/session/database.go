@@ -0,0 +1,184 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/auth"
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+	helper "github.com/coma-toast/pace-api/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/rollbar/rollbar-go"
+)
+
+// DatabaseProvider is a session.Provider the uses a database
+type DatabaseProvider struct {
+	SharedProvider *firestoredb.DatabaseProvider
+}
+
+// ErrSessionNotFound if no sessions are found
+var ErrSessionNotFound = paceerror.NotFound("Session not found")
+
+// GetByID gets a session by ID
+func (d *DatabaseProvider) GetByID(ID string) (entity.Session, error) {
+	var session entity.Session
+	err := d.SharedProvider.GetByID(ID, &session)
+	if err != nil {
+		return entity.Session{}, firestoredb.WrapNotFound(err, ErrSessionNotFound)
+	}
+
+	return session, nil
+}
+
+// GetByUser gets every session of a user, including rotated and revoked ones
+func (d *DatabaseProvider) GetByUser(userID string) ([]entity.Session, error) {
+	var sessions []entity.Session
+	err := d.SharedProvider.GetAllBy("UserID", "==", userID, &sessions)
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Add starts a new session family and returns it along with its refresh token
+func (d *DatabaseProvider) Add(newSessionData entity.Session) (entity.Session, string, error) {
+	newUUID := uuid.New().String()
+	newSessionData.FamilyID = newUUID
+
+	return d.add(newUUID, newSessionData)
+}
+
+// Rotate replaces a session with a new one in the same family and returns it
+// along with its refresh token. The session is checked again in the same
+// transaction, so of two refreshes with the same token only one gets through
+// and the other gets auth.ErrTokenReused.
+func (d *DatabaseProvider) Rotate(currentSession entity.Session, expires string) (entity.Session, string, error) {
+	newSessionData := currentSession
+	newSessionData.Expires = expires
+	newSession, token, err := newSessionWithToken(uuid.New().String(), newSessionData)
+	if err != nil {
+		return entity.Session{}, "", err
+	}
+
+	err = d.SharedProvider.RunTransaction(func(tx *firestoredb.Transaction) error {
+		var session entity.Session
+		err := tx.GetByID(currentSession.ID, &session)
+		if err != nil {
+			return firestoredb.WrapNotFound(err, ErrSessionNotFound)
+		}
+		if session.Revoked {
+			return auth.ErrSessionRevoked
+		}
+		if session.ReplacedBy != "" {
+			return auth.ErrTokenReused
+		}
+
+		tx.Create(newSession.ID, newSession)
+		tx.SetFields(currentSession.ID, map[string]interface{}{"ReplacedBy": newSession.ID})
+
+		return nil
+	})
+	if err == auth.ErrSessionRevoked || err == auth.ErrTokenReused {
+		return entity.Session{}, "", err
+	}
+	if err != nil {
+		return entity.Session{}, "", fmt.Errorf("Error rotating session %s: %w", currentSession.ID, err)
+	}
+
+	return newSession, token, nil
+}
+
+// RevokeFamily ends a login, including every refresh token it has used
+func (d *DatabaseProvider) RevokeFamily(familyID string) error {
+	var sessions []entity.Session
+	err := d.SharedProvider.GetAllBy("FamilyID", "==", familyID, &sessions)
+	if err != nil {
+		return err
+	}
+
+	err = d.revoke(sessions)
+	if err != nil {
+		return err
+	}
+	rollbar.Info(fmt.Sprintf("Revoked session family %s", familyID))
+
+	return nil
+}
+
+// RevokeUser ends every login of a user
+func (d *DatabaseProvider) RevokeUser(userID string) error {
+	sessions, err := d.GetByUser(userID)
+	if err != nil {
+		return err
+	}
+
+	err = d.revoke(sessions)
+	if err != nil {
+		return err
+	}
+	rollbar.Info(fmt.Sprintf("Revoked all sessions of user %s", userID))
+
+	return nil
+}
+
+func (d *DatabaseProvider) add(ID string, sessionData entity.Session) (entity.Session, string, error) {
+	sessionData, token, err := newSessionWithToken(ID, sessionData)
+	if err != nil {
+		return entity.Session{}, "", err
+	}
+
+	err = d.SharedProvider.Set(sessionData.ID, sessionData)
+	if err != nil {
+		return entity.Session{}, "", fmt.Errorf("Error setting session %s by ID: %s", sessionData.ID, err)
+	}
+
+	newSession, err := d.GetByID(sessionData.ID)
+	if err != nil {
+		return entity.Session{}, "", fmt.Errorf("Error getting newly created session %s by ID: %s", sessionData.ID, err)
+	}
+
+	return newSession, token, nil
+}
+
+// newSessionWithToken makes a session with a new refresh token, which only its hash is kept of
+func newSessionWithToken(ID string, sessionData entity.Session) (entity.Session, string, error) {
+	secretBytes := make([]byte, 32)
+	_, err := rand.Read(secretBytes)
+	if err != nil {
+		return entity.Session{}, "", fmt.Errorf("Error generating refresh token: %w", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	sessionData = entity.Session{
+		ID:        ID,
+		Created:   time.Now().Format(time.RFC3339),
+		UserID:    sessionData.UserID,
+		FamilyID:  sessionData.FamilyID,
+		Hash:      helper.Hash(secret, ID),
+		Expires:   sessionData.Expires,
+		UserAgent: sessionData.UserAgent,
+		IP:        sessionData.IP,
+	}
+
+	return sessionData, fmt.Sprintf("%s.%s", ID, secret), nil
+}
+
+// revoke sets only Revoked, so a rotation at the same time isn't undone
+func (d *DatabaseProvider) revoke(sessions []entity.Session) error {
+	for _, session := range sessions {
+		if session.Revoked {
+			continue
+		}
+		err := d.SharedProvider.SetFields(session.ID, map[string]interface{}{"Revoked": true})
+		if err != nil {
+			return fmt.Errorf("Error revoking session %s: %s", session.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,13 @@
+package session
+
+import "github.com/coma-toast/pace-api/pkg/entity"
+
+// Provider is for working with login session data
+type Provider interface {
+	GetByID(ID string) (entity.Session, error)
+	GetByUser(userID string) ([]entity.Session, error)
+	Add(entity.Session) (entity.Session, string, error)
+	Rotate(current entity.Session, expires string) (entity.Session, string, error)
+	RevokeFamily(familyID string) error
+	RevokeUser(userID string) error
+}
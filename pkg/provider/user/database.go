@@ -3,9 +3,11 @@ package user
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
 	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
 	helper "github.com/coma-toast/pace-api/pkg/utils"
 	"github.com/google/uuid"
@@ -18,7 +20,22 @@ type DatabaseProvider struct {
 }
 
 // ErrUserNotFound if no users are found
-var ErrUserNotFound = errors.New("User not found")
+var ErrUserNotFound = paceerror.NotFound("User not found")
+
+// GetChanges gets up to limit changes to users after the cursor since, for sync
+func (d *DatabaseProvider) GetChanges(since firestoredb.SyncCursor, limit int) ([]entity.Change, error) {
+	return d.SharedProvider.GetChanges(since, limit)
+}
+
+// GetChange gets the latest change to a User
+func (d *DatabaseProvider) GetChange(ID string) (entity.Change, error) {
+	return d.SharedProvider.GetChange(ID)
+}
+
+// GetLastChange gets the latest change to any of the users
+func (d *DatabaseProvider) GetLastChange() (entity.Change, error) {
+	return d.SharedProvider.GetLastChange()
+}
 
 // GetAll gets a User by username
 func (d *DatabaseProvider) GetAll() ([]entity.User, error) {
@@ -31,25 +48,67 @@ func (d *DatabaseProvider) GetAll() ([]entity.User, error) {
 	return users, nil
 }
 
+// GetByIDs gets the Users with the given IDs. IDs that aren't found are skipped.
+func (d *DatabaseProvider) GetByIDs(IDs []string) ([]entity.User, error) {
+	var users []entity.User
+	err := d.SharedProvider.GetByIDs(IDs, &users)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// GetByID gets a User by ID
+func (d *DatabaseProvider) GetByID(ID string) (entity.User, error) {
+	var user entity.User
+	err := d.SharedProvider.GetByID(ID, &user)
+	if err != nil {
+		return entity.User{}, firestoredb.WrapNotFound(err, ErrUserNotFound)
+	}
+
+	return user, nil
+}
+
 // GetByUsername gets a User by username
 func (d *DatabaseProvider) GetByUsername(username string) (entity.User, error) {
 	var user entity.User
 	err := d.SharedProvider.GetFirstBy("Username", "==", username, &user)
 	if err != nil {
-		return entity.User{}, fmt.Errorf("%s: %w", err, ErrUserNotFound)
+		return entity.User{}, firestoredb.WrapNotFound(err, ErrUserNotFound)
+	}
+
+	return user, nil
+}
+
+// GetByEmail gets a User by email
+func (d *DatabaseProvider) GetByEmail(email string) (entity.User, error) {
+	var user entity.User
+	err := d.SharedProvider.GetFirstBy("Email", "==", NormalizeEmail(email), &user)
+	if errors.Is(err, firestoredb.ErrFirestoreNotFound) && email != NormalizeEmail(email) {
+		// Users saved before emails were lowercased keep theirs as it was typed
+		err = d.SharedProvider.GetFirstBy("Email", "==", email, &user)
+	}
+	if err != nil {
+		return entity.User{}, firestoredb.WrapNotFound(err, ErrUserNotFound)
 	}
 
 	return user, nil
 }
 
+// NormalizeEmail lowercases an email, so emails match whatever case they are typed in
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 // Add is to update a user record
 func (d *DatabaseProvider) Add(userData entity.User) (entity.User, error) {
 	rollbar.Info(fmt.Sprintf("Adding new User to DB %s %s - %s", userData.FirstName, userData.LastName, userData.Username))
 
 	var existingUser entity.User
 	err := d.SharedProvider.GetFirstBy("Username", "==", userData.Username, &existingUser)
-	if (entity.User{}) != existingUser {
-		return entity.User{}, fmt.Errorf("Error adding user %s: Username already exists. ID: %s", userData.Username, existingUser.ID)
+	if existingUser.ID != "" {
+		return entity.User{}, paceerror.Conflict("Username %s already exists", userData.Username)
 	}
 
 	newUUID := uuid.New().String()
@@ -61,7 +120,7 @@ func (d *DatabaseProvider) Add(userData entity.User) (entity.User, error) {
 		Role:      userData.Role,
 		Username:  userData.Username,
 		Password:  helper.Hash(userData.Password, newUUID),
-		Email:     userData.Email,
+		Email:     NormalizeEmail(userData.Email),
 		Phone:     userData.Phone,
 		TimeZone:  userData.TimeZone,
 		DarkMode:  userData.DarkMode,
@@ -84,27 +143,37 @@ func (d *DatabaseProvider) Add(userData entity.User) (entity.User, error) {
 // Update is to update a user record
 func (d *DatabaseProvider) Update(newUserData entity.UpdateUserRequest) (entity.User, error) {
 	var currentUserData entity.User
-	err := d.SharedProvider.GetFirstBy("Username", "==", newUserData.Username, &currentUserData)
+	var err error
+	if newUserData.ID != "" {
+		currentUserData, err = d.GetByID(newUserData.ID)
+	} else {
+		currentUserData, err = d.GetByUsername(newUserData.Username)
+	}
 	if err != nil {
 		return entity.User{}, err
 	}
-
-	rollbar.Info(fmt.Sprintf("Updating userID %s. \nOld Data: %v \nNew Data: %v", currentUserData.ID, currentUserData, newUserData))
-	updatedUser := entity.User{
-		ID:        currentUserData.ID,
-		Created:   currentUserData.Created,
-		FirstName: newUserData.FirstName,
-		LastName:  newUserData.LastName,
-		Role:      newUserData.Role,
-		Username:  newUserData.Username,
-		Password:  currentUserData.Password,
-		Email:     newUserData.Email,
-		Phone:     newUserData.Phone,
-		TimeZone:  newUserData.TimeZone,
-		DarkMode:  newUserData.DarkMode,
+	if newUserData.Username != currentUserData.Username {
+		existingUser, _ := d.GetByUsername(newUserData.Username)
+		if existingUser.ID != "" {
+			return entity.User{}, paceerror.Conflict("Username %s already exists", newUserData.Username)
+		}
 	}
 
-	err = d.SharedProvider.Set(currentUserData.ID, updatedUser)
+	// Only name the user, their record has the password hash and two-factor secrets
+	rollbar.Info(fmt.Sprintf("Updating userID %s (%s)", currentUserData.ID, currentUserData.Username))
+	// Only the profile is written, so a password or two-factor change saved
+	// since the user was read isn't undone. The transaction makes sure the
+	// user wasn't deleted in the meantime.
+	err = d.SharedProvider.RunTransaction(func(tx *firestoredb.Transaction) error {
+		var userData entity.User
+		err := tx.GetByID(currentUserData.ID, &userData)
+		if err != nil {
+			return firestoredb.WrapNotFound(err, ErrUserNotFound)
+		}
+		tx.SetFields(currentUserData.ID, profileFields(newUserData))
+
+		return nil
+	})
 	if err != nil {
 		return entity.User{}, err
 	}
@@ -120,6 +189,67 @@ func (d *DatabaseProvider) Update(newUserData entity.UpdateUserRequest) (entity.
 	return updatedUserData, nil
 }
 
+// UpdateTwoFactor saves the two-factor settings of a user, leaving the rest of the record as it is
+func (d *DatabaseProvider) UpdateTwoFactor(userData entity.User) (entity.User, error) {
+	currentUserData, err := d.GetByID(userData.ID)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	err = d.SharedProvider.SetFields(currentUserData.ID, twoFactorFields(userData))
+	if err != nil {
+		return entity.User{}, err
+	}
+	rollbar.Info(fmt.Sprintf("User %s two-factor settings updated. Enabled: %t", currentUserData.Username, userData.TOTPEnabled))
+
+	return d.GetByID(currentUserData.ID)
+}
+
+// UseTwoFactorCode runs use on the user as saved and saves the two-factor
+// settings it changes, in one transaction. use checks the code and marks it
+// used, so two logins at the same time can't both use it. An error from use
+// is returned as it is. use can run more than once.
+func (d *DatabaseProvider) UseTwoFactorCode(ID string, use func(*entity.User) error) error {
+	return d.SharedProvider.RunTransaction(func(tx *firestoredb.Transaction) error {
+		var userData entity.User
+		err := tx.GetByID(ID, &userData)
+		if err != nil {
+			return firestoredb.WrapNotFound(err, ErrUserNotFound)
+		}
+
+		err = use(&userData)
+		if err != nil {
+			return err
+		}
+		tx.SetFields(ID, twoFactorFields(userData))
+
+		return nil
+	})
+}
+
+// profileFields are the fields of a user that Update changes
+func profileFields(userData entity.UpdateUserRequest) map[string]interface{} {
+	return map[string]interface{}{
+		"FirstName": userData.FirstName,
+		"LastName":  userData.LastName,
+		"Role":      userData.Role,
+		"Username":  userData.Username,
+		"Email":     NormalizeEmail(userData.Email),
+		"Phone":     userData.Phone,
+		"TimeZone":  userData.TimeZone,
+		"DarkMode":  userData.DarkMode,
+	}
+}
+
+func twoFactorFields(userData entity.User) map[string]interface{} {
+	return map[string]interface{}{
+		"TOTPSecret":      userData.TOTPSecret,
+		"TOTPEnabled":     userData.TOTPEnabled,
+		"TOTPLastCounter": userData.TOTPLastCounter,
+		"RecoveryCodes":   userData.RecoveryCodes,
+	}
+}
+
 // Delete deletes a user
 func (d *DatabaseProvider) Delete(user entity.User) error {
 	rollbar.Info(fmt.Sprintf("Deleting User from DB: %s %s (%s)", user.FirstName, user.LastName, user.Username))
@@ -127,8 +257,8 @@ func (d *DatabaseProvider) Delete(user entity.User) error {
 	var currentUser entity.User
 
 	err := d.SharedProvider.GetByID(user.ID, &currentUser)
-	if (entity.User{}) == currentUser {
-		return fmt.Errorf("User not found")
+	if currentUser.ID == "" {
+		return ErrUserNotFound
 	}
 
 	err = d.SharedProvider.Delete(user.ID)
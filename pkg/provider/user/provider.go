@@ -1,12 +1,23 @@
 package user
 
-import "github.com/coma-toast/pace-api/pkg/entity"
+import (
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+)
 
 // Provider is for working with User data
 type Provider interface {
+	GetByID(ID string) (entity.User, error)
+	GetByIDs(IDs []string) ([]entity.User, error)
 	GetByUsername(username string) (entity.User, error)
+	GetByEmail(email string) (entity.User, error)
 	GetAll() ([]entity.User, error)
+	GetChange(ID string) (entity.Change, error)
+	GetChanges(since firestoredb.SyncCursor, limit int) ([]entity.Change, error)
+	GetLastChange() (entity.Change, error)
 	Add(entity.User) (entity.User, error)
 	Update(entity.UpdateUserRequest) (entity.User, error)
+	UpdateTwoFactor(entity.User) (entity.User, error)
+	UseTwoFactorCode(ID string, use func(*entity.User) error) error
 	Delete(username entity.User) error
 }
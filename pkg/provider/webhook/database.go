@@ -0,0 +1,219 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"github.com/coma-toast/pace-api/pkg/provider/firestoredb"
+	"github.com/google/uuid"
+	"github.com/rollbar/rollbar-go"
+)
+
+// SecretPrefix starts every webhook secret
+const SecretPrefix = "whsec_"
+
+// DatabaseProvider is a webhook.Provider the uses a database
+type DatabaseProvider struct {
+	SharedProvider   *firestoredb.DatabaseProvider
+	DeliveryProvider *firestoredb.DatabaseProvider
+	LockProvider     *firestoredb.DatabaseProvider
+}
+
+// deliveryLock is held by the server sending an attempt of a delivery
+type deliveryLock struct {
+	ID      string
+	Expires string
+}
+
+// ErrWebhookNotFound if no webhooks are found
+var ErrWebhookNotFound = paceerror.NotFound("Webhook not found")
+
+// ErrDeliveryNotFound if no webhook deliveries are found
+var ErrDeliveryNotFound = paceerror.NotFound("Webhook delivery not found")
+
+// GetAll gets all webhooks
+func (d *DatabaseProvider) GetAll() ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	err := d.SharedProvider.GetAll(&webhooks)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// GetByID gets a webhook by ID
+func (d *DatabaseProvider) GetByID(ID string) (entity.Webhook, error) {
+	var webhook entity.Webhook
+	err := d.SharedProvider.GetByID(ID, &webhook)
+	if err != nil {
+		return entity.Webhook{}, firestoredb.WrapNotFound(err, ErrWebhookNotFound)
+	}
+
+	return webhook, nil
+}
+
+// Add creates a webhook with a new secret, and returns it along with the secret
+func (d *DatabaseProvider) Add(newWebhookData entity.Webhook) (entity.Webhook, string, error) {
+	rollbar.Info(fmt.Sprintf("Adding new webhook to %s for %s", newWebhookData.URL, newWebhookData.CreatedBy))
+
+	secretBytes := make([]byte, 32)
+	_, err := rand.Read(secretBytes)
+	if err != nil {
+		return entity.Webhook{}, "", fmt.Errorf("Error generating webhook secret: %w", err)
+	}
+
+	newWebhookData = entity.Webhook{
+		ID:          uuid.New().String(),
+		Created:     time.Now().Format(time.RFC3339),
+		CreatedBy:   newWebhookData.CreatedBy,
+		URL:         newWebhookData.URL,
+		Description: newWebhookData.Description,
+		Events:      newWebhookData.Events,
+		Secret:      SecretPrefix + base64.RawURLEncoding.EncodeToString(secretBytes),
+		Disabled:    newWebhookData.Disabled,
+	}
+	err = d.SharedProvider.Set(newWebhookData.ID, newWebhookData)
+	if err != nil {
+		return entity.Webhook{}, "", fmt.Errorf("Error setting webhook %s by ID: %s", newWebhookData.ID, err)
+	}
+
+	newWebhook, err := d.GetByID(newWebhookData.ID)
+	if err != nil {
+		return entity.Webhook{}, "", fmt.Errorf("Error getting newly created webhook %s by ID: %s", newWebhookData.ID, err)
+	}
+
+	rollbar.Info(fmt.Sprintf("Webhook %s added.", newWebhookData.ID))
+	return newWebhook, newWebhook.Secret, nil
+}
+
+// Update changes the URL, description, events and whether a webhook is disabled
+func (d *DatabaseProvider) Update(newWebhookData entity.Webhook) (entity.Webhook, error) {
+	webhook, err := d.GetByID(newWebhookData.ID)
+	if err != nil {
+		return entity.Webhook{}, err
+	}
+	webhook.URL = newWebhookData.URL
+	webhook.Description = newWebhookData.Description
+	webhook.Events = newWebhookData.Events
+	webhook.Disabled = newWebhookData.Disabled
+
+	err = d.SharedProvider.Set(webhook.ID, webhook)
+	if err != nil {
+		return entity.Webhook{}, fmt.Errorf("Error setting webhook %s by ID: %s", webhook.ID, err)
+	}
+
+	return webhook, nil
+}
+
+// Delete removes a webhook. Its deliveries are kept for the log.
+func (d *DatabaseProvider) Delete(ID string) error {
+	_, err := d.GetByID(ID)
+	if err != nil {
+		return err
+	}
+
+	return d.SharedProvider.Delete(ID)
+}
+
+// GetDelivery gets a delivery by ID
+func (d *DatabaseProvider) GetDelivery(ID string) (entity.WebhookDelivery, error) {
+	var delivery entity.WebhookDelivery
+	err := d.DeliveryProvider.GetByID(ID, &delivery)
+	if err != nil {
+		return entity.WebhookDelivery{}, firestoredb.WrapNotFound(err, ErrDeliveryNotFound)
+	}
+
+	return delivery, nil
+}
+
+// GetDeliveries gets the deliveries of a webhook, newest first
+func (d *DatabaseProvider) GetDeliveries(webhookID string) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := d.DeliveryProvider.GetAllBy("WebhookID", "==", webhookID, &deliveries)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].Created > deliveries[j].Created
+	})
+
+	return deliveries, nil
+}
+
+// GetPendingDeliveries gets the deliveries still to be sent
+func (d *DatabaseProvider) GetPendingDeliveries() ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := d.DeliveryProvider.GetAllBy("Status", "==", entity.DeliveryPending, &deliveries)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// AddDelivery queues a delivery
+func (d *DatabaseProvider) AddDelivery(delivery entity.WebhookDelivery) (entity.WebhookDelivery, error) {
+	delivery.ID = uuid.New().String()
+	err := d.DeliveryProvider.Set(delivery.ID, delivery)
+	if err != nil {
+		return entity.WebhookDelivery{}, fmt.Errorf("Error setting webhook delivery %s by ID: %s", delivery.ID, err)
+	}
+
+	return delivery, nil
+}
+
+// SetDelivery saves a delivery
+func (d *DatabaseProvider) SetDelivery(delivery entity.WebhookDelivery) error {
+	return d.DeliveryProvider.Set(delivery.ID, delivery)
+}
+
+// ClaimDelivery locks the next attempt of a delivery for lease, so only one
+// server sends it. It is false if another server has it.
+func (d *DatabaseProvider) ClaimDelivery(delivery entity.WebhookDelivery, lease time.Duration) (bool, error) {
+	lock := deliveryLock{
+		ID:      lockID(delivery),
+		Expires: time.Now().Add(lease).Format(time.RFC3339),
+	}
+	err := d.LockProvider.Create(lock.ID, lock)
+	if !errors.Is(err, firestoredb.ErrFirestoreExists) {
+		return err == nil, err
+	}
+
+	// A server that stopped mid-send leaves its lock behind until it expires
+	var existing deliveryLock
+	err = d.LockProvider.GetByID(lock.ID, &existing)
+	if err != nil {
+		return false, err
+	}
+	expires, err := time.Parse(time.RFC3339, existing.Expires)
+	if err == nil && expires.After(time.Now()) {
+		return false, nil
+	}
+	err = d.LockProvider.Delete(lock.ID)
+	if err != nil {
+		return false, err
+	}
+	err = d.LockProvider.Create(lock.ID, lock)
+	if errors.Is(err, firestoredb.ErrFirestoreExists) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// ReleaseDelivery removes the lock on an attempt of a delivery
+func (d *DatabaseProvider) ReleaseDelivery(delivery entity.WebhookDelivery) error {
+	return d.LockProvider.Delete(lockID(delivery))
+}
+
+// lockID is per attempt, so a redelivery doesn't wait on an old lock
+func lockID(delivery entity.WebhookDelivery) string {
+	return fmt.Sprintf("%s-%d", delivery.ID, delivery.Attempts)
+}
@@ -0,0 +1,23 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+)
+
+// Provider is for working with webhooks and their deliveries
+type Provider interface {
+	GetAll() ([]entity.Webhook, error)
+	GetByID(ID string) (entity.Webhook, error)
+	Add(entity.Webhook) (entity.Webhook, string, error)
+	Update(entity.Webhook) (entity.Webhook, error)
+	Delete(ID string) error
+	GetDelivery(ID string) (entity.WebhookDelivery, error)
+	GetDeliveries(webhookID string) ([]entity.WebhookDelivery, error)
+	GetPendingDeliveries() ([]entity.WebhookDelivery, error)
+	AddDelivery(entity.WebhookDelivery) (entity.WebhookDelivery, error)
+	SetDelivery(entity.WebhookDelivery) error
+	ClaimDelivery(delivery entity.WebhookDelivery, lease time.Duration) (bool, error)
+	ReleaseDelivery(delivery entity.WebhookDelivery) error
+}
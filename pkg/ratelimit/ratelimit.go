@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultGroup is the limit for route groups that don't have their own
+const DefaultGroup = "default"
+
+// sweepInterval is how often buckets that have refilled are dropped
+const sweepInterval = time.Minute
+
+// Limit lets Burst requests through at once, refilling at Rate requests per second.
+// A zero Limit doesn't limit anything.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Per makes a Limit of requests per period, with a burst of the same size
+func Per(requests int, period time.Duration, burst int) Limit {
+	if requests <= 0 || period <= 0 {
+		return Limit{}
+	}
+	if burst <= 0 {
+		burst = requests
+	}
+
+	return Limit{Rate: float64(requests) / period.Seconds(), Burst: burst}
+}
+
+// Result is the outcome of a request against a bucket
+type Result struct {
+	Allowed bool
+	Limit   int
+	// Remaining is how many more requests can be made right now
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, if this one wasn't
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// Limiter is an in memory token bucket per group and client
+type Limiter struct {
+	mu        sync.Mutex
+	limits    map[string]Limit
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// New makes a Limiter with limits by route group. DefaultGroup is used for groups without a limit.
+func New(limits map[string]Limit) *Limiter {
+	return &Limiter{limits: limits, buckets: map[string]*bucket{}}
+}
+
+// LimitFor gets the limit of a route group
+func (l *Limiter) LimitFor(group string) Limit {
+	limit, ok := l.limits[group]
+	if !ok {
+		limit = l.limits[DefaultGroup]
+	}
+
+	return limit
+}
+
+// Allow takes a token from the client's bucket for the route group
+func (l *Limiter) Allow(group string, client string, now time.Time) Result {
+	limit := l.LimitFor(group)
+	if limit.Rate <= 0 || limit.Burst <= 0 {
+		return Result{Allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+
+	key := group + "\x00" + client
+	b, ok := l.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{tokens: float64(limit.Burst), updated: now, limit: limit}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	result := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+
+	return result
+}
+
+// sweep drops buckets that have refilled, they are the same as new ones
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.updated = now
+	}
+}
+
+// seconds rounds up to whole seconds, which is what the headers use
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter := New(map[string]Limit{
+		DefaultGroup: Per(60, time.Minute, 3),
+		"inventory":  Per(1, time.Second, 2),
+		"ping":       {},
+	})
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		result := limiter.Allow("inventory", "user:1", now)
+		if !result.Allowed || result.Limit != 2 || result.Remaining != 1-i {
+			t.Errorf("Request %d: unexpected result %+v", i, result)
+		}
+	}
+	result := limiter.Allow("inventory", "user:1", now)
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Errorf("Expected the third request to wait a second, got %+v", result)
+	}
+
+	// Other clients and groups have their own buckets
+	if !limiter.Allow("inventory", "user:2", now).Allowed {
+		t.Error("Expected another client to be allowed")
+	}
+	result = limiter.Allow("project", "user:1", now)
+	if !result.Allowed || result.Limit != 3 {
+		t.Errorf("Expected the default limit for other groups, got %+v", result)
+	}
+
+	// The bucket refills over time
+	result = limiter.Allow("inventory", "user:1", now.Add(time.Second))
+	if !result.Allowed || result.Remaining != 0 || result.Reset != 2*time.Second {
+		t.Errorf("Expected a refilled token, got %+v", result)
+	}
+
+	for i := 0; i < 100; i++ {
+		if !limiter.Allow("ping", "user:1", now).Allowed {
+			t.Fatal("Expected a zero limit to allow everything")
+		}
+	}
+
+	// Full buckets are dropped
+	limiter.Allow("inventory", "user:3", now)
+	limiter.sweep(now.Add(time.Hour))
+	if len(limiter.buckets) != 0 {
+		t.Errorf("Expected refilled buckets to be swept, %d left", len(limiter.buckets))
+	}
+}
@@ -0,0 +1,319 @@
+package rpc
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Codec encodes messages in the protobuf wire format, so clients generated from
+// proto/pace.proto can talk to the server. Field numbers come from the `proto`
+// tags of plain structs like the entity types, fields without one are left out.
+type Codec struct{}
+
+// Name is the content subtype of the codec
+func (Codec) Name() string {
+	return "proto"
+}
+
+func (c Codec) String() string {
+	return c.Name()
+}
+
+// Marshal encodes a pointer to a struct, or a struct
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("rpc: can't marshal %T, it isn't a struct", v)
+	}
+
+	return appendMessage(nil, value)
+}
+
+// Unmarshal decodes into a pointer to a struct
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("rpc: can't unmarshal into %T, it isn't a pointer to a struct", v)
+	}
+
+	return consumeMessage(data, value.Elem())
+}
+
+type field struct {
+	number protowire.Number
+	index  int
+}
+
+var fieldCache sync.Map
+
+// fieldsOf gets the tagged fields of a struct type
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("proto")
+		if tag == "" || t.Field(i).PkgPath != "" {
+			continue
+		}
+		number, err := strconv.Atoi(tag)
+		if err != nil || !protowire.Number(number).IsValid() {
+			panic(fmt.Sprintf("rpc: %s.%s has an invalid proto tag %q", t.Name(), t.Field(i).Name, tag))
+		}
+		fields = append(fields, field{number: protowire.Number(number), index: i})
+	}
+	fieldCache.Store(t, fields)
+
+	return fields
+}
+
+func appendMessage(b []byte, value reflect.Value) ([]byte, error) {
+	var err error
+	for _, field := range fieldsOf(value.Type()) {
+		b, err = appendField(b, field.number, value.Field(field.index))
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", value.Type().Name(), value.Type().Field(field.index).Name, err)
+		}
+	}
+
+	return b, nil
+}
+
+// appendField adds a field, leaving out zero values like proto3 does
+func appendField(b []byte, number protowire.Number, value reflect.Value) ([]byte, error) {
+	switch value.Kind() {
+	case reflect.String:
+		if value.Len() > 0 {
+			b = protowire.AppendTag(b, number, protowire.BytesType)
+			b = protowire.AppendString(b, value.String())
+		}
+	case reflect.Bool, reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		if !value.IsZero() {
+			b = appendScalar(protowire.AppendTag(b, number, wireType(value.Kind())), value)
+		}
+	case reflect.Struct:
+		message, err := appendMessage(nil, value)
+		if err != nil {
+			return nil, err
+		}
+		if len(message) > 0 {
+			b = protowire.AppendTag(b, number, protowire.BytesType)
+			b = protowire.AppendBytes(b, message)
+		}
+	case reflect.Ptr:
+		if !value.IsNil() {
+			return appendField(b, number, value.Elem())
+		}
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			if value.Len() > 0 {
+				b = protowire.AppendTag(b, number, protowire.BytesType)
+				b = protowire.AppendBytes(b, value.Bytes())
+			}
+			break
+		}
+		if wireType(value.Type().Elem().Kind()) != protowire.BytesType {
+			// Repeated numbers are packed
+			if value.Len() == 0 {
+				break
+			}
+			var packed []byte
+			for i := 0; i < value.Len(); i++ {
+				packed = appendScalar(packed, value.Index(i))
+			}
+			b = protowire.AppendTag(b, number, protowire.BytesType)
+			b = protowire.AppendBytes(b, packed)
+			break
+		}
+		for i := 0; i < value.Len(); i++ {
+			item := value.Index(i)
+			if item.Kind() == reflect.String {
+				b = protowire.AppendTag(b, number, protowire.BytesType)
+				b = protowire.AppendString(b, item.String())
+				continue
+			}
+			message, err := appendMessage(nil, reflect.Indirect(item))
+			if err != nil {
+				return nil, err
+			}
+			b = protowire.AppendTag(b, number, protowire.BytesType)
+			b = protowire.AppendBytes(b, message)
+		}
+	default:
+		return nil, fmt.Errorf("%s can't be sent", value.Type())
+	}
+
+	return b, nil
+}
+
+func wireType(kind reflect.Kind) protowire.Type {
+	switch kind {
+	case reflect.Bool, reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint32, reflect.Uint64:
+		return protowire.VarintType
+	case reflect.Float32:
+		return protowire.Fixed32Type
+	case reflect.Float64:
+		return protowire.Fixed64Type
+	}
+
+	return protowire.BytesType
+}
+
+func appendScalar(b []byte, value reflect.Value) []byte {
+	switch value.Kind() {
+	case reflect.Bool:
+		return protowire.AppendVarint(b, protowire.EncodeBool(value.Bool()))
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return protowire.AppendVarint(b, uint64(value.Int()))
+	case reflect.Uint32, reflect.Uint64:
+		return protowire.AppendVarint(b, value.Uint())
+	case reflect.Float32:
+		return protowire.AppendFixed32(b, math.Float32bits(float32(value.Float())))
+	}
+
+	return protowire.AppendFixed64(b, math.Float64bits(value.Float()))
+}
+
+func consumeMessage(b []byte, value reflect.Value) error {
+	fields := map[protowire.Number]int{}
+	for _, field := range fieldsOf(value.Type()) {
+		fields[field.number] = field.index
+	}
+
+	for len(b) > 0 {
+		number, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		index, ok := fields[number]
+		if !ok {
+			// Unknown fields are from newer clients, skip them
+			n = protowire.ConsumeFieldValue(number, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		n, err := consumeField(b, typ, value.Field(index))
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", value.Type().Name(), value.Type().Field(index).Name, err)
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+func consumeField(b []byte, typ protowire.Type, value reflect.Value) (int, error) {
+	switch value.Kind() {
+	case reflect.Struct:
+		if typ != protowire.BytesType {
+			return 0, fmt.Errorf("expected a message, got wire type %d", typ)
+		}
+		message, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		return n, consumeMessage(message, value)
+	case reflect.Ptr:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return consumeField(b, typ, value.Elem())
+	case reflect.Slice:
+		elemKind := value.Type().Elem().Kind()
+		if elemKind == reflect.Uint8 {
+			bytes, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			value.SetBytes(append([]byte{}, bytes...))
+			return n, nil
+		}
+		if typ == protowire.BytesType && wireType(elemKind) != protowire.BytesType {
+			packed, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			for len(packed) > 0 {
+				item := reflect.New(value.Type().Elem()).Elem()
+				m, err := consumeScalar(packed, wireType(elemKind), item)
+				if err != nil {
+					return 0, err
+				}
+				value.Set(reflect.Append(value, item))
+				packed = packed[m:]
+			}
+			return n, nil
+		}
+		item := reflect.New(value.Type().Elem()).Elem()
+		n, err := consumeField(b, typ, item)
+		if err != nil {
+			return 0, err
+		}
+		value.Set(reflect.Append(value, item))
+		return n, nil
+	}
+
+	return consumeScalar(b, typ, value)
+}
+
+func consumeScalar(b []byte, typ protowire.Type, value reflect.Value) (int, error) {
+	if value.Kind() == reflect.String {
+		if typ != protowire.BytesType {
+			return 0, fmt.Errorf("expected a string, got wire type %d", typ)
+		}
+		s, n := protowire.ConsumeString(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		value.SetString(s)
+		return n, nil
+	}
+	if typ != wireType(value.Kind()) {
+		return 0, fmt.Errorf("expected wire type %d for %s, got %d", wireType(value.Kind()), value.Type(), typ)
+	}
+
+	switch typ {
+	case protowire.VarintType:
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		switch value.Kind() {
+		case reflect.Bool:
+			value.SetBool(protowire.DecodeBool(v))
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			value.SetInt(int64(v))
+		default:
+			value.SetUint(v)
+		}
+		return n, nil
+	case protowire.Fixed32Type:
+		v, n := protowire.ConsumeFixed32(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		value.SetFloat(float64(math.Float32frombits(v)))
+		return n, nil
+	case protowire.Fixed64Type:
+		v, n := protowire.ConsumeFixed64(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		value.SetFloat(math.Float64frombits(v))
+		return n, nil
+	}
+
+	return 0, fmt.Errorf("%s can't be received", value.Type())
+}
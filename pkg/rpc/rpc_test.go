@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type stage struct {
+	Raw      bool `proto:"1"`
+	Finished bool `proto:"4"`
+}
+
+type item struct {
+	ID       string   `proto:"1"`
+	Stage    stage    `proto:"3"`
+	Size     int      `proto:"5"`
+	Weight   float64  `proto:"6"`
+	Tags     []string `proto:"7"`
+	Counts   []int    `proto:"8"`
+	Internal string
+}
+
+func TestCodec(t *testing.T) {
+	in := item{ID: "a", Stage: stage{Finished: true}, Size: 300, Weight: 1.5, Tags: []string{"x", "y"}, Counts: []int{1, 2}, Internal: "skipped"}
+	data, err := Codec{}.Marshal(&in)
+	if err != nil {
+		t.Fatal("Error marshaling: ", err)
+	}
+
+	var out item
+	err = Codec{}.Unmarshal(data, &out)
+	if err != nil {
+		t.Fatal("Error unmarshaling: ", err)
+	}
+	in.Internal = ""
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("Expected %+v, got %+v", in, out)
+	}
+
+	// Field 1 "a", field 5 varint 300, the same bytes protoc-generated code sends
+	data, _ = Codec{}.Marshal(item{ID: "a", Size: 300})
+	if expected := []byte{0x0a, 0x01, 'a', 0x28, 0xac, 0x02}; !bytes.Equal(data, expected) {
+		t.Errorf("Expected % x, got % x", expected, data)
+	}
+
+	// Unknown fields are skipped
+	err = Codec{}.Unmarshal([]byte{0x0a, 0x01, 'b', 0x48, 0x01}, &out)
+	if err != nil || out.ID != "b" {
+		t.Errorf("Expected unknown fields to be skipped, got %+v %s", out, err)
+	}
+}
+
+func TestError(t *testing.T) {
+	err := Error(paceerror.NotFound("Project not found"))
+	if status.Code(err) != codes.NotFound || status.Convert(err).Message() != "Project not found" {
+		t.Error("Expected NotFound, got: ", err)
+	}
+
+	err = Error(errors.New("firestore is down"))
+	if status.Code(err) != codes.Internal || status.Convert(err).Message() != "Internal server error" {
+		t.Error("Expected a generic internal error, got: ", err)
+	}
+}
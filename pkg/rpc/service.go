@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Package is the protobuf package of the services in proto/pace.proto
+const Package = "pace.v1"
+
+// IDRequest asks for a record by ID
+type IDRequest struct {
+	ID string `proto:"1"`
+}
+
+// NameRequest asks for a record by its name, or a user by username
+type NameRequest struct {
+	Name string `proto:"1"`
+}
+
+// ListRequest lists records. ProjectID only lists the inventory or
+// inspections of a project.
+type ListRequest struct {
+	ProjectID string `proto:"1"`
+}
+
+// DeleteResponse is sent when a record is deleted
+type DeleteResponse struct {
+	Message string `proto:"1"`
+}
+
+// Method is an RPC of a Service. Unary methods answer with one message,
+// streaming methods call send for each message.
+type Method struct {
+	Name string
+	// Write is set for methods that change data, which need the write scope
+	Write bool
+	// NewRequest makes an empty request message to decode into
+	NewRequest func() interface{}
+	Unary      func(ctx context.Context, request interface{}) (interface{}, error)
+	Stream     func(ctx context.Context, request interface{}, send func(interface{}) error) error
+}
+
+// Service is a gRPC service, Resource is the API key scope resource it needs
+type Service struct {
+	Name     string
+	Resource string
+	Methods  []Method
+}
+
+// FullName is the service name clients call, like pace.v1.ProjectService
+func (s Service) FullName() string {
+	return Package + "." + s.Name
+}
+
+// Register adds the service to a server
+func (s Service) Register(server *grpc.Server) {
+	desc := &grpc.ServiceDesc{
+		ServiceName: s.FullName(),
+		HandlerType: (*interface{})(nil),
+		Metadata:    "proto/pace.proto",
+	}
+	for _, method := range s.Methods {
+		method := method
+		fullMethod := "/" + s.FullName() + "/" + method.Name
+		if method.Stream != nil {
+			desc.Streams = append(desc.Streams, grpc.StreamDesc{
+				StreamName:    method.Name,
+				ServerStreams: true,
+				Handler: func(srv interface{}, stream grpc.ServerStream) error {
+					request := method.NewRequest()
+					err := stream.RecvMsg(request)
+					if err != nil {
+						return err
+					}
+					return method.Stream(stream.Context(), request, stream.SendMsg)
+				},
+			})
+			continue
+		}
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: method.Name,
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				request := method.NewRequest()
+				err := dec(request)
+				if err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return method.Unary(ctx, request)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}
+				return interceptor(ctx, request, info, method.Unary)
+			},
+		})
+	}
+
+	server.RegisterService(desc, struct{}{})
+}
+
+// statusCodes maps error codes to gRPC status codes
+var statusCodes = map[paceerror.Code]codes.Code{
+	paceerror.CodeBadRequest:      codes.InvalidArgument,
+	paceerror.CodeUnauthorized:    codes.Unauthenticated,
+	paceerror.CodeForbidden:       codes.PermissionDenied,
+	paceerror.CodeNotFound:        codes.NotFound,
+	paceerror.CodeConflict:        codes.AlreadyExists,
+	paceerror.CodeValidation:      codes.InvalidArgument,
+	paceerror.CodeTooLarge:        codes.ResourceExhausted,
+	paceerror.CodeTooManyRequests: codes.ResourceExhausted,
+	paceerror.CodeInternal:        codes.Internal,
+}
+
+// Error turns err into a gRPC status error with the code of its paceerror.Code.
+// Like the REST API, internal errors only say Internal server error.
+func Error(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := paceerror.CodeOf(err)
+	if code == paceerror.CodeInternal {
+		return status.Error(codes.Internal, "Internal server error")
+	}
+	var pErr *paceerror.Error
+	errors.As(err, &pErr)
+
+	return status.Error(statusCodes[code], pErr.Message)
+}
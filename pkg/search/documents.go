@@ -0,0 +1,57 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+)
+
+// Types are the types of record that can be searched
+var Types = []string{"project", "company", "contact", "inventory"}
+
+// DocumentOf gets the searchable fields of a record, false if it can't be searched
+func DocumentOf(data interface{}) (Document, bool) {
+	switch record := data.(type) {
+	case entity.Project:
+		if record.Deleted {
+			return Document{}, false
+		}
+		return Document{Type: "project", ID: record.ID, ProjectID: record.ID, Title: record.Name, Fields: map[string]string{
+			"address":             strings.Join([]string{record.Address, record.City, record.State, zip(record.Zip)}, " "),
+			"projectManager":      record.ProjectManager,
+			"primaryContactEmail": record.PrimaryContactEmail,
+		}}, true
+	case entity.Company:
+		if record.Deleted {
+			return Document{}, false
+		}
+		return Document{Type: "company", ID: record.ID, Title: record.Name, Fields: map[string]string{
+			"primaryContact": record.PrimaryContact,
+			"email":          record.Email,
+			"address":        strings.Join([]string{record.Address, record.City, record.State, record.Zip}, " "),
+		}}, true
+	case entity.Contact:
+		if record.Deleted {
+			return Document{}, false
+		}
+		return Document{Type: "contact", ID: record.ID, Title: strings.TrimSpace(record.FirstName + " " + record.LastName), Fields: map[string]string{
+			"company": record.Company,
+			"email":   record.Email,
+		}}, true
+	case entity.Inventory:
+		return Document{Type: "inventory", ID: record.ID, ProjectID: record.ProjectID, Title: record.Shape, Fields: map[string]string{
+			"id": record.ID,
+		}}, true
+	}
+
+	return Document{}, false
+}
+
+func zip(code int32) string {
+	if code == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(int(code))
+}
@@ -0,0 +1,291 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+)
+
+// titleWeight is how much more a word in the title counts than one in another field
+const titleWeight = 2
+
+// Document is a record in the index
+type Document struct {
+	Type string
+	ID   string
+	// ProjectID is the project the record belongs to, empty if it's shared
+	ProjectID string
+	Title     string
+	// Fields has the other searchable text, by field name
+	Fields map[string]string
+}
+
+// Query is a search
+type Query struct {
+	Text string
+	// Types limits the results to these types, all of them if empty
+	Types []string
+	// CanRead is asked about each matching document, unreadable ones are left out
+	CanRead func(Document) bool
+	Limit   int
+}
+
+// Index is an in-memory full-text index, matching words by prefix and with typos
+type Index struct {
+	mutex sync.RWMutex
+	// documents by collection/ID, and the words in each of them
+	documents map[string]Document
+	words     map[string]map[string]float64
+	postings  map[string]map[string]float64
+
+	buildMutex sync.Mutex
+	built      bool
+}
+
+// New makes an empty index
+func New() *Index {
+	return &Index{
+		documents: map[string]Document{},
+		words:     map[string]map[string]float64{},
+		postings:  map[string]map[string]float64{},
+	}
+}
+
+// Build runs load to fill the index, once it succeeds
+func (i *Index) Build(load func() error) error {
+	i.buildMutex.Lock()
+	defer i.buildMutex.Unlock()
+	if i.built {
+		return nil
+	}
+	err := load()
+	i.built = err == nil
+
+	return err
+}
+
+// Save indexes a record written to collection. Records that can't be
+// searched, or were soft deleted, are removed.
+func (i *Index) Save(collection string, ID string, data interface{}) {
+	if i == nil {
+		return
+	}
+	document, ok := DocumentOf(data)
+	if !ok {
+		i.Remove(collection, ID)
+		return
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	key := collection + "/" + ID
+	i.remove(key)
+
+	words := map[string]float64{}
+	for _, word := range Words(document.Title) {
+		words[word] += titleWeight
+	}
+	for _, text := range document.Fields {
+		for _, word := range Words(text) {
+			words[word]++
+		}
+	}
+	for word, weight := range words {
+		if i.postings[word] == nil {
+			i.postings[word] = map[string]float64{}
+		}
+		i.postings[word][key] = weight
+	}
+	i.documents[key] = document
+	i.words[key] = words
+}
+
+// Remove takes a record deleted from collection out of the index
+func (i *Index) Remove(collection string, ID string) {
+	if i == nil {
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.remove(collection + "/" + ID)
+}
+
+func (i *Index) remove(key string) {
+	for word := range i.words[key] {
+		delete(i.postings[word], key)
+		if len(i.postings[word]) == 0 {
+			delete(i.postings, word)
+		}
+	}
+	delete(i.documents, key)
+	delete(i.words, key)
+}
+
+// Search finds the documents with every word of the query, best matches first.
+// Facets count the readable matches of each type, before Types and Limit.
+func (i *Index) Search(query Query) entity.SearchResult {
+	result := entity.SearchResult{Hits: []entity.SearchHit{}, Facets: map[string]int{}}
+	queryWords := Words(query.Text)
+	if len(queryWords) == 0 {
+		return result
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	// Every query word has to match some word of the document
+	var scores map[string]float64
+	for _, queryWord := range queryWords {
+		wordScores := map[string]float64{}
+		for word, keys := range i.postings {
+			match := matchScore(queryWord, word)
+			if match == 0 {
+				continue
+			}
+			for key, weight := range keys {
+				if score := match * weight; score > wordScores[key] {
+					wordScores[key] = score
+				}
+			}
+		}
+		if scores == nil {
+			scores = wordScores
+			continue
+		}
+		for key := range scores {
+			if wordScores[key] == 0 {
+				delete(scores, key)
+			} else {
+				scores[key] += wordScores[key]
+			}
+		}
+	}
+
+	types := map[string]bool{}
+	for _, documentType := range query.Types {
+		types[documentType] = true
+	}
+	for key, score := range scores {
+		document := i.documents[key]
+		if query.CanRead != nil && !query.CanRead(document) {
+			continue
+		}
+		result.Facets[document.Type]++
+		if len(types) > 0 && !types[document.Type] {
+			continue
+		}
+		result.Hits = append(result.Hits, entity.SearchHit{
+			Type:      document.Type,
+			ID:        document.ID,
+			ProjectID: document.ProjectID,
+			Title:     document.Title,
+			Score:     score,
+		})
+	}
+	result.Total = len(result.Hits)
+
+	sort.Slice(result.Hits, func(a, b int) bool {
+		if result.Hits[a].Score != result.Hits[b].Score {
+			return result.Hits[a].Score > result.Hits[b].Score
+		}
+		return result.Hits[a].Title < result.Hits[b].Title
+	})
+	if query.Limit > 0 && len(result.Hits) > query.Limit {
+		result.Hits = result.Hits[:query.Limit]
+	}
+
+	return result
+}
+
+// matchScore is 1 for the same word, less for a prefix or a typo, and 0 if it doesn't match
+func matchScore(queryWord string, word string) float64 {
+	if queryWord == word {
+		return 1
+	}
+	if len(queryWord) >= 2 && strings.HasPrefix(word, queryWord) {
+		return 0.75
+	}
+	allowed := maxTypos(queryWord)
+	if allowed == 0 {
+		return 0
+	}
+	// Typos in what has been typed so far still match longer words
+	if prefix := []rune(word); len(prefix) > len([]rune(queryWord))+allowed {
+		word = string(prefix[:len([]rune(queryWord))+allowed])
+	}
+	if typos := editDistance(queryWord, word, allowed); typos <= allowed {
+		return 0.5 / float64(typos)
+	}
+
+	return 0
+}
+
+// maxTypos is how many typos a word can have, more for longer words
+func maxTypos(word string) int {
+	switch length := len([]rune(word)); {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance counts the letters to add, remove, change or swap to turn a
+// into b. It gives up at more than limit.
+func editDistance(a string, b string, limit int) int {
+	source, target := []rune(a), []rune(b)
+	if difference := len(source) - len(target); difference > limit || -difference > limit {
+		return limit + 1
+	}
+
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	beforePrevious := make([]int, len(target)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(source); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if source[i-1] == target[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if i > 1 && j > 1 && source[i-1] == target[j-2] && source[i-2] == target[j-1] {
+				current[j] = min(current[j], beforePrevious[j-2]+1)
+			}
+			rowMin = min(rowMin, current[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		beforePrevious, previous, current = previous, current, beforePrevious
+	}
+
+	return previous[len(target)]
+}
+
+func min(values ...int) int {
+	smallest := values[0]
+	for _, value := range values[1:] {
+		if value < smallest {
+			smallest = value
+		}
+	}
+
+	return smallest
+}
+
+// Words splits text into lower case words
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,70 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+)
+
+func testIndex() *Index {
+	index := New()
+	index.Save("projects", "41", entity.Project{ID: "41", Name: "Riverside Warehouse", City: "Omaha"})
+	index.Save("projects", "42", entity.Project{ID: "42", Name: "Warehouse Annex", Deleted: true})
+	index.Save("projects", "43", entity.Project{ID: "43", Name: "City Library", Address: "12 Warehouse Row"})
+	index.Save("company", "c1", entity.Company{ID: "c1", Name: "Omaha Steel Erectors"})
+	index.Save("inventory", "i1", entity.Inventory{ID: "i1", ProjectID: "43", Shape: "W8x10"})
+
+	return index
+}
+
+func TestSearch(t *testing.T) {
+	index := testIndex()
+
+	result := index.Search(Query{Text: "warehouse"})
+	if result.Total != 2 || result.Hits[0].ID != "41" || result.Hits[1].ID != "43" {
+		t.Errorf("Expected the title match first and the deleted project left out, got %+v", result.Hits)
+	}
+
+	for _, text := range []string{"wareh", "warehuose", "Omaha stel", "w8x10"} {
+		if result := index.Search(Query{Text: text}); result.Total == 0 {
+			t.Errorf("Expected %q to match", text)
+		}
+	}
+	if result := index.Search(Query{Text: "cty"}); result.Total != 0 {
+		t.Errorf("Expected no typos in short words, got %+v", result.Hits)
+	}
+
+	result = index.Search(Query{Text: "omaha", Types: []string{"company"}})
+	if result.Total != 1 || result.Hits[0].ID != "c1" || result.Facets["project"] != 1 || result.Facets["company"] != 1 {
+		t.Errorf("Expected one company, and facets for both types, got %+v", result)
+	}
+
+	result = index.Search(Query{Text: "w8x10", CanRead: func(document Document) bool { return document.ProjectID != "43" }})
+	if result.Total != 0 || len(result.Facets) != 0 {
+		t.Errorf("Expected unreadable records left out, got %+v", result)
+	}
+
+	index.Remove("projects", "41")
+	index.Save("projects", "43", entity.Project{ID: "43", Name: "City Library"})
+	if result := index.Search(Query{Text: "warehouse"}); result.Total != 0 {
+		t.Errorf("Expected removed and changed records to stop matching, got %+v", result.Hits)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"steel", "steel", 0},
+		{"steel", "stel", 1},
+		{"steel", "stele", 1},
+		{"girder", "grider", 1},
+		{"beam", "column", 3},
+	}
+	for _, test := range tests {
+		if distance := editDistance(test.a, test.b, 2); distance != test.expected {
+			t.Errorf("Expected %s to %s to be %d, got %d", test.a, test.b, test.expected, distance)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+)
+
+// FieldError is a field that failed validation, named like it is in the JSON
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Date formats accepted by the date rule
+var dateFormats = []string{time.RFC3339, "2006-01-02"}
+
+var (
+	phonePattern = regexp.MustCompile(`^\+?[0-9 ().-]{7,20}$`)
+	zipPattern   = regexp.MustCompile(`^[0-9]{5}(-[0-9]{4})?$`)
+)
+
+// states are the US state, district and territory codes
+var states = map[string]bool{}
+
+func init() {
+	for _, state := range strings.Fields(`AL AK AZ AR CA CO CT DE FL GA HI ID IL IN IA KS KY LA ME MD MA MI MN MS MO
+		MT NE NV NH NJ NM NY NC ND OH OK OR PA RI SC SD TN TX UT VT VA WA WV WI WY DC AS GU MP PR VI`) {
+		states[state] = true
+	}
+}
+
+// Struct checks v against the `validate` tags on its fields. Rules are separated by commas:
+//
+//	required      must not be empty
+//	min=N, max=N  length of strings and lists, or the value of numbers
+//	oneof=a b c   one of the listed values
+//	email         an email address
+//	phone         a phone number
+//	zip           a US zip code, as a string
+//	state         a US state code
+//	date          an RFC 3339 time or a 2006-01-02 date
+//	datetime      an RFC 3339 time
+//	after=Field   a date that isn't before the date in Field
+//
+// Rules other than required are skipped for empty strings. The error is a
+// paceerror with CodeValidation and a []FieldError in its details.
+func Struct(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: %T is not a struct", v)
+	}
+
+	fieldErrors := check(value)
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(fieldErrors))
+	for _, fieldError := range fieldErrors {
+		messages = append(messages, fieldError.Field+" "+fieldError.Message)
+	}
+
+	return &paceerror.Error{
+		Code:    paceerror.CodeValidation,
+		Message: strings.Join(messages, "; "),
+		Details: fieldErrors,
+	}
+}
+
+func check(value reflect.Value) []FieldError {
+	var fieldErrors []FieldError
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fieldErrors = append(fieldErrors, check(value.Field(i))...)
+			continue
+		}
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		for _, rule := range strings.Split(tag, ",") {
+			name, param := rule, ""
+			if index := strings.Index(rule, "="); index >= 0 {
+				name, param = rule[:index], rule[index+1:]
+			}
+			message := apply(name, param, value.Field(i), value)
+			if message != "" {
+				fieldErrors = append(fieldErrors, FieldError{Field: jsonName(field), Message: message})
+				break
+			}
+		}
+	}
+
+	return fieldErrors
+}
+
+// apply runs one rule against a field, returning why it failed or "" if it passed
+func apply(name string, param string, field reflect.Value, parent reflect.Value) string {
+	if name == "required" {
+		if isEmpty(field) {
+			return "is required"
+		}
+		return ""
+	}
+	if field.Kind() == reflect.String && field.String() == "" {
+		return ""
+	}
+
+	switch name {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: bad %s limit %q", name, param))
+		}
+		size, unit := measure(field)
+		if name == "min" && size < limit {
+			return fmt.Sprintf("must be at least %s%s", param, unit)
+		}
+		if name == "max" && size > limit {
+			return fmt.Sprintf("must be at most %s%s", param, unit)
+		}
+	case "oneof":
+		for _, option := range strings.Fields(param) {
+			if fmt.Sprint(field.Interface()) == option {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %s", strings.Join(strings.Fields(param), ", "))
+	case "email":
+		address, err := mail.ParseAddress(field.String())
+		if err != nil || address.Address != field.String() {
+			return "must be an email address"
+		}
+	case "phone":
+		if !phonePattern.MatchString(field.String()) {
+			return "must be a phone number"
+		}
+	case "zip":
+		if !zipPattern.MatchString(field.String()) {
+			return "must be a zip code"
+		}
+	case "state":
+		if !states[field.String()] {
+			return "must be a two letter US state code"
+		}
+	case "date":
+		if _, ok := parseDate(field.String()); !ok {
+			return "must be a date like 2006-01-02 or an RFC 3339 time"
+		}
+	case "datetime":
+		if _, err := time.Parse(time.RFC3339, field.String()); err != nil {
+			return "must be an RFC 3339 time"
+		}
+	case "after":
+		other, ok := parent.Type().FieldByName(param)
+		if !ok {
+			panic(fmt.Sprintf("validate: no field %s to compare to", param))
+		}
+		date, ok := parseDate(field.String())
+		otherDate, otherOK := parseDate(parent.FieldByIndex(other.Index).String())
+		if ok && otherOK && date.Before(otherDate) {
+			return fmt.Sprintf("must not be before %s", jsonName(other))
+		}
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q", name))
+	}
+
+	return ""
+}
+
+// measure is the length of strings and lists, or the value of numbers
+func measure(field reflect.Value) (float64, string) {
+	switch field.Kind() {
+	case reflect.String:
+		return float64(len([]rune(field.String()))), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(field.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(field.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(field.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return field.Float(), ""
+	}
+
+	panic(fmt.Sprintf("validate: can't measure a %s", field.Kind()))
+}
+
+func isEmpty(field reflect.Value) bool {
+	if field.Kind() == reflect.String {
+		return strings.TrimSpace(field.String()) == ""
+	}
+
+	return field.IsZero()
+}
+
+func parseDate(value string) (time.Time, bool) {
+	for _, format := range dateFormats {
+		date, err := time.Parse(format, value)
+		if err == nil {
+			return date, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// jsonName is the name of a field in JSON
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return field.Name
+	}
+
+	return name
+}
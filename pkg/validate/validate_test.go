@@ -0,0 +1,74 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/coma-toast/pace-api/pkg/entity"
+	"github.com/coma-toast/pace-api/pkg/paceerror"
+)
+
+func fieldErrors(t *testing.T, err error) []FieldError {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var pErr *paceerror.Error
+	if !errors.As(err, &pErr) || pErr.Code != paceerror.CodeValidation {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+
+	return pErr.Details.([]FieldError)
+}
+
+func TestProject(t *testing.T) {
+	project := entity.Project{
+		Name:                "Riverside Garage",
+		StartDate:           "2020-06-01",
+		DueDate:             "2020-11-30T17:00:00Z",
+		State:               "WI",
+		Zip:                 53703,
+		PrimaryContactEmail: "pm@example.com",
+	}
+	if err := Struct(project); err != nil {
+		t.Errorf("Expected a valid project, got %v", err)
+	}
+
+	project = entity.Project{
+		Name:                " ",
+		StartDate:           "2020-06-01",
+		DueDate:             "2020-05-01",
+		State:               "Wisconsin",
+		Zip:                 -1,
+		PrimaryContactEmail: "pm at example.com",
+	}
+	expected := []FieldError{
+		{"name", "is required"},
+		{"dueDate", "must not be before startDate"},
+		{"state", "must be a two letter US state code"},
+		{"zip", "must be at least 0"},
+		{"primaryContactEmail", "must be an email address"},
+	}
+	if got := fieldErrors(t, Struct(project)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected field errors %v", got)
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	user := entity.CreateUserRequest{User: entity.User{Email: "jason@example.com"}, Password: "hunter2"}
+	expected := []FieldError{
+		{"username", "is required"},
+		{"password", "must be at least 8 characters"},
+	}
+	if got := fieldErrors(t, Struct(&user)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected field errors %v", got)
+	}
+}
+
+func TestMembership(t *testing.T) {
+	expected := []FieldError{{"role", "must be one of viewer, editor, manager"}}
+	if got := fieldErrors(t, Struct(entity.Membership{Role: "owner"})); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected field errors %v", got)
+	}
+}